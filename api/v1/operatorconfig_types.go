@@ -0,0 +1,221 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// OperatorConfigName is the name of the OperatorConfig singleton. OperatorConfig objects with any other name are
+// ignored.
+const OperatorConfigName = "cluster"
+
+// OperatorConfigSpec holds the settings that can be changed while the operator is running
+type OperatorConfigSpec struct {
+	// MaxParallelUpgrades is the maximum number of Windows nodes that can be upgraded at the same time.
+	// Defaults to 1. Ignored when upgradeStrategy.maxUnavailable is set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxParallelUpgrades *int32 `json:"maxParallelUpgrades,omitempty"`
+	// MaxUnhealthyCount is the maximum number of Machines in a Windows MachineSet that can be unhealthy before the
+	// deletion of further Machines is blocked. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxUnhealthyCount *int32 `json:"maxUnhealthyCount,omitempty"`
+	// DebugLogging enables debug level logging in the operator. Logging is also at debug level when the operator
+	// has been started with the --debugLogging flag.
+	// +optional
+	DebugLogging bool `json:"debugLogging,omitempty"`
+	// WICDReconcilePeriod is how often the Windows Instance Config Daemon reconciles the state of the Windows
+	// services on each node, in the absence of any other event. Defaults to 2m.
+	// +optional
+	WICDReconcilePeriod *meta.Duration `json:"wicdReconcilePeriod,omitempty"`
+	// Retry holds the wait times used when retrying operations
+	// +optional
+	Retry *RetrySettings `json:"retry,omitempty"`
+	// UpgradeStrategy describes how Windows nodes are rolled over to a new operator version
+	// +optional
+	UpgradeStrategy *UpgradeStrategy `json:"upgradeStrategy,omitempty"`
+	// WindowsExporter configures the windows_exporter service exposing the metrics of each Windows node. Changes are
+	// rolled out to the Windows nodes through the services ConfigMap.
+	// +optional
+	WindowsExporter *WindowsExporterSettings `json:"windowsExporter,omitempty"`
+}
+
+// UpgradeOrder is a rule deciding which Windows nodes are upgraded first
+// +kubebuilder:validation:Enum=BYOHFirst;MachinesFirst;OldestFirst;NewestFirst
+type UpgradeOrder string
+
+const (
+	// UpgradeOrderBYOHFirst upgrades BYOH nodes before Machine-backed nodes
+	UpgradeOrderBYOHFirst UpgradeOrder = "BYOHFirst"
+	// UpgradeOrderMachinesFirst upgrades Machine-backed nodes before BYOH nodes
+	UpgradeOrderMachinesFirst UpgradeOrder = "MachinesFirst"
+	// UpgradeOrderOldestFirst upgrades nodes in order of creation, oldest first
+	UpgradeOrderOldestFirst UpgradeOrder = "OldestFirst"
+	// UpgradeOrderNewestFirst upgrades nodes in reverse order of creation, newest first
+	UpgradeOrderNewestFirst UpgradeOrder = "NewestFirst"
+)
+
+// UpgradeStrategy describes how Windows nodes are rolled over to a new operator version
+type UpgradeStrategy struct {
+	// MaxUnavailable is the maximum number of Windows nodes that can be upgraded at the same time, as a number or as a
+	// percentage of the Windows nodes. Percentages are rounded down, but at least one node can always be upgraded.
+	// Defaults to maxParallelUpgrades.
+	// +kubebuilder:validation:XIntOrString
+	// +kubebuilder:validation:Pattern=`^[0-9]+%?$`
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// Groups limit the number of nodes upgraded at the same time within sets of nodes. A node is only upgraded when
+	// both maxUnavailable and the budget of every group it belongs to allow it.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Groups []UpgradeGroup `json:"groups,omitempty"`
+	// Order lists the rules deciding which nodes are upgraded first, by decreasing precedence. Nodes that are equal
+	// under every rule are upgraded in order of name.
+	// +optional
+	Order []UpgradeOrder `json:"order,omitempty"`
+	// Paused stops Windows nodes from starting an upgrade. Nodes that are already upgrading complete their upgrade.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+	// Canary describes nodes that are upgraded ahead of the others. The other nodes are only upgraded once every
+	// canary has been upgraded and has stayed healthy for the soak period. The rollout halts if a canary fails.
+	// +optional
+	Canary *UpgradeCanary `json:"canary,omitempty"`
+	// RollbackOnFailure reconfigures a node which failed its in-place upgrade with the services ConfigMap of the
+	// operator version it was previously configured by, bringing it back into service. The failure is still reported,
+	// and the node is not upgraded again until the rolled-back-from annotation is removed from it.
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+}
+
+// UpgradeCanary describes the Windows nodes upgraded ahead of the others
+type UpgradeCanary struct {
+	// Selector selects the nodes that can be used as canaries by their labels
+	Selector meta.LabelSelector `json:"selector"`
+	// Count is the number of selected nodes used as canaries, picked following the upgrade order. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count *int32 `json:"count,omitempty"`
+	// SoakPeriod is how long the canaries must stay Ready after their upgrade before the other nodes are upgraded.
+	// Defaults to 30m.
+	// +optional
+	SoakPeriod *meta.Duration `json:"soakPeriod,omitempty"`
+}
+
+// UpgradeGroup is a set of Windows nodes with its own upgrade budget
+type UpgradeGroup struct {
+	// Name identifies the group
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Selector selects the Windows nodes in the group by their labels
+	Selector meta.LabelSelector `json:"selector"`
+	// MaxUnavailable is the maximum number of nodes in the group that can be upgraded at the same time, as a number
+	// or as a percentage of the nodes in the group. Percentages are rounded down, but at least one node of the group
+	// can always be upgraded.
+	// +kubebuilder:validation:XIntOrString
+	// +kubebuilder:validation:Pattern=`^[0-9]+%?$`
+	MaxUnavailable intstr.IntOrString `json:"maxUnavailable"`
+}
+
+// WindowsExporterSettings configures windows_exporter on top of the collectors and flags set by the operator
+type WindowsExporterSettings struct {
+	// AdditionalCollectors are the windows_exporter collectors enabled alongside the default ones, such as iis,
+	// process, hyperv, smb or tcp.
+	// +listType=set
+	// +kubebuilder:validation:items:Pattern=`^[a-z][a-z0-9_.]*$`
+	// +optional
+	AdditionalCollectors []string `json:"additionalCollectors,omitempty"`
+	// CollectorFlags are collector-specific flags given to windows_exporter, keyed by flag name without the leading
+	// dashes, such as collector.process.include. Only flags of the collector. namespace can be set, and values cannot
+	// contain spaces or double quotes.
+	// +kubebuilder:validation:XValidation:rule="self.all(k, k.startsWith('collector.'))",message="flag names must start with collector."
+	// +kubebuilder:validation:XValidation:rule="self.all(k, !self[k].contains(' ') && !self[k].contains('\"'))",message="flag values cannot contain spaces or double quotes"
+	// +optional
+	CollectorFlags map[string]string `json:"collectorFlags,omitempty"`
+	// ScrapeTimeoutMargin is subtracted from the scrape timeout given by Prometheus to get the time windows_exporter
+	// has to collect metrics before replying, so slow collectors do not make the whole scrape time out. Defaults to
+	// the windows_exporter default of 500ms.
+	// +optional
+	ScrapeTimeoutMargin *meta.Duration `json:"scrapeTimeoutMargin,omitempty"`
+}
+
+// RetrySettings holds the wait times used when retrying operations. Unset fields use the operator default.
+type RetrySettings struct {
+	// Interval is the wait time between API calls on a failure. Defaults to 15s.
+	// +optional
+	Interval *meta.Duration `json:"interval,omitempty"`
+	// Timeout is the total time waited for an event to occur. Defaults to 10m.
+	// +optional
+	Timeout *meta.Duration `json:"timeout,omitempty"`
+	// ResourceChangeTimeout is the total time waited for a resource change to take place. Defaults to 2m.
+	// +optional
+	ResourceChangeTimeout *meta.Duration `json:"resourceChangeTimeout,omitempty"`
+	// WindowsAPIInterval is the wait time between calls to the Windows OS API on a failure. Defaults to 5s.
+	// +optional
+	WindowsAPIInterval *meta.Duration `json:"windowsAPIInterval,omitempty"`
+}
+
+// OperatorConfigStatus describes the settings currently in use
+type OperatorConfigStatus struct {
+	// ObservedGeneration is the generation of the spec that was last applied
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the current state of the configuration
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []meta.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// OperatorConfigAppliedCondition is the condition type indicating if the spec has been applied by the operator
+	OperatorConfigAppliedCondition = "Applied"
+	// UpgradeProgressingCondition is the condition type indicating if Windows nodes are being upgraded to the current
+	// operator version. The reason tells if the rollout is paused, halted by a failed canary, or waiting on canaries.
+	UpgradeProgressingCondition = "UpgradeProgressing"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:validation:XValidation:rule="self.metadata.name == 'cluster'",message="OperatorConfig must be named cluster"
+
+// OperatorConfig holds the operator settings that can be changed without redeploying the operator. It is a
+// singleton, which must be named cluster. When it does not exist the default for every setting is used.
+type OperatorConfig struct {
+	meta.TypeMeta   `json:",inline"`
+	meta.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OperatorConfigSpec   `json:"spec,omitempty"`
+	Status OperatorConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OperatorConfigList contains a list of OperatorConfig
+type OperatorConfigList struct {
+	meta.TypeMeta `json:",inline"`
+	meta.ListMeta `json:"metadata,omitempty"`
+	Items         []OperatorConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OperatorConfig{}, &OperatorConfigList{})
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InstancePhase describes where a Windows instance is in the configuration process
+type InstancePhase string
+
+const (
+	// PhaseConnecting means an SSH connection to the instance is being established
+	PhaseConnecting InstancePhase = "Connecting"
+	// PhaseTransferringPayload means the files required to configure the instance are being copied to it
+	PhaseTransferringPayload InstancePhase = "TransferringPayload"
+	// PhaseBootstrapping means the node services are being bootstrapped on the instance
+	PhaseBootstrapping InstancePhase = "Bootstrapping"
+	// PhaseWaitingForNode means the instance is waiting for its Node object to be created
+	PhaseWaitingForNode InstancePhase = "WaitingForNode"
+	// PhaseConfiguringWICD means the Windows Instance Config Daemon is being configured on the instance
+	PhaseConfiguringWICD InstancePhase = "ConfiguringWICD"
+	// PhaseWaitingForVersion means the instance is waiting for WICD to finish configuring the node services
+	PhaseWaitingForVersion InstancePhase = "WaitingForVersion"
+	// PhaseReady means the instance has been configured into a Node by the current operator version
+	PhaseReady InstancePhase = "Ready"
+	// PhaseDeconfiguring means the instance is being reverted to its state before it was configured
+	PhaseDeconfiguring InstancePhase = "Deconfiguring"
+	// PhaseRollingBack means the instance failed its upgrade and is being configured by its previous services
+	// ConfigMap
+	PhaseRollingBack InstancePhase = "RollingBack"
+	// PhaseFailed means a phase of the configuration process failed
+	PhaseFailed InstancePhase = "Failed"
+)
+
+// ConfiguredCondition is the condition type indicating if the instance has been configured by the current
+// operator version
+const ConfiguredCondition = "Configured"
+
+// DefaultSSHPort is the port used to connect to an instance when no port is given
+const DefaultSSHPort = 22
+
+// WindowsInstanceSpec describes a Windows instance that should be configured as a worker Node
+type WindowsInstanceSpec struct {
+	// Address is the network address of the instance. Must be an IPv4 address or a DNS name that resolves to one.
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+	// Username is the name of a user that can be used to SSH into the instance
+	// +kubebuilder:validation:MinLength=1
+	Username string `json:"username"`
+	// SSHPort is the port the SSH server on the instance is listening on. Defaults to 22.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	SSHPort int32 `json:"sshPort,omitempty"`
+	// Labels are applied to the Node associated with the instance, in addition to the labels WMCO applies
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Taints are applied to the Node associated with the instance
+	// +optional
+	Taints []core.Taint `json:"taints,omitempty"`
+	// Hostname is the name the instance is renamed to before it is configured. Changing it has no effect on an
+	// instance that has already been configured.
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?$`
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+	// NodeIP is the IPv4 address the Node is registered with, overriding the address discovered on the instance
+	// +optional
+	NodeIP string `json:"nodeIP,omitempty"`
+	// SSH holds the parameters used when connecting to the instance over SSH
+	// +optional
+	SSH *SSHSettings `json:"ssh,omitempty"`
+	// KeySecret is the name of a Secret in the operator namespace holding the private key used to SSH into the
+	// instance, under the private-key.pem key. Defaults to the cloud-private-key Secret.
+	// +optional
+	KeySecret string `json:"keySecret,omitempty"`
+	// JumpHosts are the SSH servers that connections to the instance are tunnelled through, in the order they are
+	// dialed
+	// +optional
+	JumpHosts []JumpHost `json:"jumpHosts,omitempty"`
+	// WinRM being set means that the instance is connected to over WinRM instead of SSH. SSHPort, KeySecret and
+	// JumpHosts cannot be set for such instances, the SSH settings apply to WinRM connections as well.
+	// +optional
+	WinRM *WinRMSettings `json:"winRM,omitempty"`
+}
+
+// WinRMSettings are the parameters used when connecting to an instance over WinRM. Only HTTPS listeners are supported.
+type WinRMSettings struct {
+	// Port is the port the WinRM HTTPS listener on the instance is listening on. Defaults to 5986.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Auth is the method used to authenticate against the instance. With ntlm, the instance's user is authenticated
+	// with the password under the password key of the credentials Secret. With certificate, the client certificate
+	// held by the credentials Secret, a kubernetes.io/tls Secret, is used and must be mapped to the instance's user.
+	// Defaults to ntlm.
+	// +kubebuilder:validation:Enum=ntlm;certificate
+	// +optional
+	Auth string `json:"auth,omitempty"`
+	// CredentialsSecret is the name of a Secret in the operator namespace holding the credentials used to authenticate
+	// against the instance. The certificate presented by the instance is verified with the CA bundle under its ca.crt
+	// key if present, otherwise the certificate's key is pinned the first time it is presented.
+	// +kubebuilder:validation:MinLength=1
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// JumpHost is an SSH server that connections to an instance are tunnelled through
+type JumpHost struct {
+	// Address is the network address of the jump host
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+	// Port is the port the SSH server on the jump host is listening on. Defaults to 22.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// Username is the name of the user to SSH into the jump host as
+	// +kubebuilder:validation:MinLength=1
+	Username string `json:"username"`
+	// KeySecret is the name of a Secret in the operator namespace holding the private key used to authenticate against
+	// the jump host, under the private-key.pem key
+	// +kubebuilder:validation:MinLength=1
+	KeySecret string `json:"keySecret"`
+}
+
+// SSHSettings are the parameters used when connecting to an instance over SSH. Unset fields use their default.
+type SSHSettings struct {
+	// DialTimeout is the maximum time a single connection attempt, including the SSH handshake, may take. There is no
+	// limit by default.
+	// +optional
+	DialTimeout *meta.Duration `json:"dialTimeout,omitempty"`
+	// KeepaliveInterval is how often a keepalive request is sent over an established connection. Keepalive requests
+	// are not sent by default.
+	// +optional
+	KeepaliveInterval *meta.Duration `json:"keepaliveInterval,omitempty"`
+	// RetryInterval is the wait time between connection attempts. Defaults to 1m.
+	// +optional
+	RetryInterval *meta.Duration `json:"retryInterval,omitempty"`
+	// RetryTimeout is the total time spent attempting to connect. Defaults to the operator's retry timeout.
+	// +optional
+	RetryTimeout *meta.Duration `json:"retryTimeout,omitempty"`
+}
+
+// WindowsInstanceStatus describes the observed state of a Windows instance
+type WindowsInstanceStatus struct {
+	// Phase is the point of the configuration process the instance is at
+	// +optional
+	Phase InstancePhase `json:"phase,omitempty"`
+	// PhaseTransitionTime is the time the instance entered its current phase
+	// +optional
+	PhaseTransitionTime *meta.Time `json:"phaseTransitionTime,omitempty"`
+	// FailedPhase is the phase that failed when the phase is Failed
+	// +optional
+	FailedPhase InstancePhase `json:"failedPhase,omitempty"`
+	// NodeName is the name of the Node associated with the instance
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+	// Version is the WMCO version that last successfully configured the instance
+	// +optional
+	Version string `json:"version,omitempty"`
+	// LastError is the error that occurred during the last failed configuration attempt
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// Conditions describe the current state of the instance
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []meta.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Address",type=string,JSONPath=`.spec.address`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.status.nodeName`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.version`
+
+// WindowsInstance describes a Windows instance that WMCO should configure into a worker Node. It is the typed
+// replacement for entries in the windows-instances ConfigMap.
+type WindowsInstance struct {
+	meta.TypeMeta   `json:",inline"`
+	meta.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WindowsInstanceSpec   `json:"spec,omitempty"`
+	Status WindowsInstanceStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// WindowsInstanceList contains a list of WindowsInstance
+type WindowsInstanceList struct {
+	meta.TypeMeta `json:",inline"`
+	meta.ListMeta `json:"metadata,omitempty"`
+	Items         []WindowsInstance `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WindowsInstance{}, &WindowsInstanceList{})
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/operator-framework/operator-lib/leader"
 	monv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/spf13/pflag"
+	uzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -25,8 +26,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/controllers"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
@@ -45,6 +48,10 @@ import (
 // ServiceAccount permissions used to watch operator on secrets.
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=watch
 
+// Permissions used to authenticate and authorize the requests made to the metrics endpoint
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -57,12 +64,14 @@ func init() {
 	utilruntime.Must(mcfg.Install(scheme))
 	utilruntime.Must(openshiftconfig.AddToScheme(scheme))
 	utilruntime.Must(monv1.AddToScheme(scheme))
+	utilruntime.Must(wmcov1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var debugLogging bool
 	var metricsAddr string
+	var metricsCertDir string
 
 	if extraArgs := os.Getenv("ARGS"); extraArgs != "" {
 		for _, arg := range strings.Split(extraArgs, " ") {
@@ -75,6 +84,9 @@ func main() {
 	flag.BoolVar(&debugLogging, "debugLogging", false, "Log debug messages")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0.0.0.0:9182",
 		"The address and port the metric endpoint binds to 0.0.0.0:9182")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "",
+		"The directory holding the tls.crt and tls.key files served by the metric endpoint. "+
+			"A self-signed certificate is generated if not given")
 
 	// Add flags registered by imported packages (e.g. glog and
 	// controller-runtime)
@@ -82,7 +94,12 @@ func main() {
 
 	pflag.Parse()
 
-	opts := zap.Options{Development: debugLogging, TimeEncoder: zapcore.RFC3339TimeEncoder}
+	// The log level can be changed at runtime through the OperatorConfig
+	logLevel := uzap.NewAtomicLevelAt(zapcore.InfoLevel)
+	if debugLogging {
+		logLevel.SetLevel(zapcore.DebugLevel)
+	}
+	opts := zap.Options{Development: debugLogging, Level: logLevel, TimeEncoder: zapcore.RFC3339TimeEncoder}
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	// add version subcommand to query the operator version
@@ -172,6 +189,7 @@ func main() {
 		Metrics: metricsserver.Options{
 			BindAddress:    metricsAddr,
 			SecureServing:  true,
+			CertDir:        metricsCertDir,
 			FilterProvider: filters.WithAuthenticationAndAuthorization,
 		},
 	})
@@ -179,6 +197,7 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	metrics.RegisterCollectors()
 
 	// Get the watched namespace. This is originally sourced from from the OperatorGroup associated with the CSV.
 	// Because the WMCO CSV only supports the OwnNamespace InstallMode, the watch namespace will always be the namespace
@@ -286,6 +305,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = controllers.NewOperatorConfigReconciler(mgr, logLevel, debugLogging).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OperatorConfig")
+		os.Exit(1)
+	}
+
 	//+kubebuilder:scaffold:builder
 	// The above marker tells kubebuilder that this is where the SetupWithManager function should be inserted when new
 	// controllers are generated by Operator SDK.
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	config "github.com/openshift/api/config/v1"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/condition"
+	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/signer"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+const (
+	// BYOHInstanceController is the name of this controller in logs and other outputs.
+	BYOHInstanceController = "byohinstance"
+	// maxParallelInstanceConfigurations is the maximum number of BYOH instances configured at the same time
+	maxParallelInstanceConfigurations = 5
+	// instanceRetryBaseDelay is the delay before an instance whose configuration failed is retried. The delay is
+	// doubled on each consecutive failure of the instance, up to instanceRetryMaxDelay.
+	instanceRetryBaseDelay = 5 * time.Second
+	// instanceRetryMaxDelay is the maximum delay between retries of an instance whose configuration is failing
+	instanceRetryMaxDelay = 5 * time.Minute
+)
+
+// byohInstanceReconciler configures a single BYOH instance into a node. The ConfigMap controller enqueues a request
+// for each instance described by the windows-instances ConfigMap and WindowsInstance objects, named after the address
+// of the instance, so that instances are configured in parallel and are retried independently of each other.
+type byohInstanceReconciler struct {
+	instanceReconciler
+}
+
+// newBYOHInstanceReconciler returns a pointer to a byohInstanceReconciler sharing the clients of the given reconciler
+func newBYOHInstanceReconciler(r instanceReconciler) *byohInstanceReconciler {
+	r.log = ctrl.Log.WithName("controllers").WithName(BYOHInstanceController)
+	// The signer is created on each reconcile, as reconciles run concurrently
+	r.signer = nil
+	return &byohInstanceReconciler{instanceReconciler: r}
+}
+
+// Reconcile ensures the BYOH instance with the address given by the request name is configured as a node. The result
+// is published in the status of the WindowsInstance describing the instance, if any, and as events.
+func (r *byohInstanceReconciler) Reconcile(ctx context.Context,
+	req ctrl.Request) (result ctrl.Result, reconcileErr error) {
+	log := r.log.WithValues("instance", req.Name)
+	// Prevent WMCO upgrades while the instance is being processed. Each instance is tracked separately, so that the
+	// operator is not considered free until every instance has been configured.
+	busyName := BYOHInstanceController + "/" + req.Name
+	if err := condition.MarkAsBusy(ctx, r.client, r.watchNamespace, r.recorder, busyName); err != nil {
+		return ctrl.Result{}, err
+	}
+	defer func() {
+		reconcileErr = markAsFreeOnSuccess(ctx, r.client, r.watchNamespace, r.recorder, busyName,
+			result.Requeue, reconcileErr)
+	}()
+
+	windowsInstances := &core.ConfigMap{}
+	err := r.client.Get(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace, Name: wiparser.InstanceConfigMap},
+		windowsInstances)
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		windowsInstances = &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap,
+			Namespace: r.watchNamespace}}
+	}
+	nodes := &core.NodeList{}
+	if err = r.client.List(ctx, nodes, client.MatchingLabels{BYOHLabel: "true", core.LabelOSStable: "windows"}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing nodes: %w", err)
+	}
+	windowsInstanceList := &wmcov1.WindowsInstanceList{}
+	if err = r.client.List(ctx, windowsInstanceList, client.InNamespace(r.watchNamespace)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing WindowsInstances: %w", err)
+	}
+	// Invalid instance descriptions are reported by the ConfigMap controller
+	instances, _, err := parseInstances(windowsInstances, windowsInstanceList.Items, nodes)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	instanceInfo := findInstance(instances, req.Name)
+	if instanceInfo == nil {
+		// The instance is no longer described, its node is removed by the ConfigMap controller
+		log.V(1).Info("instance is no longer expected to be a node")
+		return ctrl.Result{}, nil
+	}
+
+	// Create a new signer using the private key that the instances will be configured with. As reconciles run
+	// concurrently, the signer is set on a copy of the reconciler.
+	instanceSigner, err := signer.Create(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.PrivateKeySecret}, r.client)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
+	}
+	instanceConfigurer := *r
+	instanceConfigurer.signer = instanceSigner
+	instanceConfigurer.log = log
+	wi := findWindowsInstance(windowsInstanceList.Items, instanceInfo.Address)
+	err = instanceConfigurer.ensureBYOHInstanceIsUpToDate(ctx, instanceInfo, wi)
+	if wi != nil {
+		if statusErr := r.updateWindowsInstanceStatus(ctx, wi, instanceInfo, err); statusErr != nil {
+			log.Error(statusErr, "unable to update status", "WindowsInstance", wi.GetName())
+		}
+	}
+	var rolledBack *rolledBackErr
+	if errors.As(err, &rolledBack) {
+		// The rollback has been reported on the node, and the instance is not configured again until it is retried
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		// The event is recorded on the object describing the instance, so that the error of each host can be told
+		// apart from the others
+		var object client.Object = windowsInstances
+		if wi != nil {
+			object = wi
+		}
+		r.recordHostKeyMismatch(object, err)
+		r.recorder.Eventf(object, core.EventTypeWarning, "InstanceSetupFailure",
+			"error configuring host with address %s: %s", instanceInfo.Address, err.Error())
+		// Returning the error requeues the request with a per-instance exponential backoff
+		return ctrl.Result{}, fmt.Errorf("error configuring host with address %s: %w", instanceInfo.Address, err)
+	}
+	r.recorder.Eventf(windowsInstances, core.EventTypeNormal, "InstanceSetup",
+		"Configured instance with address %s as a worker node", instanceInfo.Address)
+	return ctrl.Result{}, nil
+}
+
+// ensureBYOHInstanceIsUpToDate configures the given instance into a node, applying the labels and annotations all BYOH
+// nodes are expected to have. wi is the WindowsInstance describing the instance, if any.
+func (r *byohInstanceReconciler) ensureBYOHInstanceIsUpToDate(ctx context.Context, instanceInfo *instance.Info,
+	wi *wmcov1.WindowsInstance) error {
+	// Get private key to encrypt instance usernames
+	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.PrivateKeySecret}, r.client)
+	if err != nil {
+		return err
+	}
+	// When platform type is none or Nutanix, kubelet will pick a random interface to use for the Node's IP. In that
+	// case we should override that with the IP that the user is providing via the ConfigMap.
+	instanceInfo.SetNodeIP = r.platform == config.NonePlatformType || r.platform == config.NutanixPlatformType
+	encryptedUsername, err := crypto.EncryptToJSONString(instanceInfo.Username, privateKeyBytes)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt username for instance %s: %w", instanceInfo.Address, err)
+	}
+	labelsToApply := map[string]string{}
+	for key, value := range instanceInfo.Labels {
+		labelsToApply[key] = value
+	}
+	labelsToApply[BYOHLabel] = "true"
+	labelsToApply[nodeconfig.WorkerLabel] = ""
+	annotationsToApply := map[string]string{UsernameAnnotation: encryptedUsername}
+	if instanceInfo.SSHPort != 0 {
+		annotationsToApply[SSHPortAnnotation] = strconv.Itoa(instanceInfo.SSHPort)
+	}
+	if instanceInfo.NodeIP != "" {
+		annotationsToApply[AddressAnnotation] = instanceInfo.Address
+	}
+	if sshOptions := instanceInfo.SSHOptions.String(); sshOptions != "" {
+		annotationsToApply[SSHOptionsAnnotation] = sshOptions
+	}
+	if instanceInfo.KeySecret != "" {
+		annotationsToApply[KeySecretAnnotation] = instanceInfo.KeySecret
+	}
+	if len(instanceInfo.JumpHosts) != 0 {
+		annotationsToApply[JumpHostsAnnotation] = instance.FormatJumpHosts(instanceInfo.JumpHosts)
+	}
+	if instanceInfo.WinRM != nil {
+		annotationsToApply[WinRMAnnotation] = instanceInfo.WinRM.String()
+	}
+	var phaseRecorder nodeconfig.PhaseRecorder
+	if wi != nil {
+		phaseRecorder = &windowsInstancePhaseRecorder{client: r.client, windowsInstance: wi}
+	}
+	if instanceInfo.UpToDate() {
+		// The labels and taints specified for an instance can change after it has been configured
+		if _, err := nodeconfig.ApplyInstanceLabelsAndTaints(ctx, r.client, instanceInfo.Node.GetName(),
+			instanceInfo.Labels, instanceInfo.Taints); err != nil {
+			return fmt.Errorf("error applying labels and taints to node %s: %w", instanceInfo.Node.GetName(), err)
+		}
+	}
+	if instanceInfo.Node != nil {
+		// So can the parameters used to connect to it, which other controllers read from the node annotations
+		connection := make(map[string]string)
+		for _, key := range connectionAnnotations {
+			if value, present := annotationsToApply[key]; present {
+				connection[key] = value
+			}
+		}
+		node, err := nodeconfig.ApplyInstanceAnnotations(ctx, r.client, instanceInfo.Node.GetName(), connection,
+			connectionAnnotations)
+		if err != nil {
+			return fmt.Errorf("error applying connection annotations to node %s: %w", instanceInfo.Node.GetName(), err)
+		}
+		instanceInfo.Node = node
+	}
+	return r.ensureInstanceIsUpToDate(ctx, instanceInfo, labelsToApply, annotationsToApply, phaseRecorder)
+}
+
+// updateWindowsInstanceStatus updates the status of the given WindowsInstance to reflect the result of an attempt to
+// configure the instance it describes. configErr is the error that occurred during configuration, if any. An instance
+// which was rolled back stays Failed, with the version it was rolled back to.
+func (r *byohInstanceReconciler) updateWindowsInstanceStatus(ctx context.Context, wi *wmcov1.WindowsInstance,
+	instanceInfo *instance.Info, configErr error) error {
+	patchBase := client.MergeFrom(wi.DeepCopy())
+	if instanceInfo.Node != nil {
+		wi.Status.NodeName = instanceInfo.Node.GetName()
+	}
+	var rolledBack *rolledBackErr
+	if errors.As(configErr, &rolledBack) {
+		// The instance runs the services of the version it was rolled back to. The phase that failed is kept, as well
+		// as the error the upgrade failed with if the rollback happened in a previous reconcile.
+		setWindowsInstancePhase(&wi.Status, wmcov1.PhaseFailed)
+		wi.Status.Version = rolledBack.version
+		if rolledBack.cause != nil || wi.Status.LastError == "" {
+			wi.Status.LastError = configErr.Error()
+		}
+		apimeta.SetStatusCondition(&wi.Status.Conditions, meta.Condition{Type: wmcov1.ConfiguredCondition,
+			Status: meta.ConditionFalse, Reason: "RolledBack", Message: configErr.Error(),
+			ObservedGeneration: wi.GetGeneration()})
+	} else if configErr != nil {
+		setWindowsInstancePhase(&wi.Status, wmcov1.PhaseFailed)
+		wi.Status.LastError = configErr.Error()
+		apimeta.SetStatusCondition(&wi.Status.Conditions, meta.Condition{Type: wmcov1.ConfiguredCondition,
+			Status: meta.ConditionFalse, Reason: "ConfigurationFailed", Message: configErr.Error(),
+			ObservedGeneration: wi.GetGeneration()})
+	} else {
+		setWindowsInstancePhase(&wi.Status, wmcov1.PhaseReady)
+		wi.Status.Version = version.Get()
+		wi.Status.FailedPhase = ""
+		wi.Status.LastError = ""
+		apimeta.SetStatusCondition(&wi.Status.Conditions, meta.Condition{Type: wmcov1.ConfiguredCondition,
+			Status: meta.ConditionTrue, Reason: "Configured", ObservedGeneration: wi.GetGeneration(),
+			Message: fmt.Sprintf("instance configured by version %s", version.Get())})
+	}
+	return r.client.Status().Patch(ctx, wi, patchBase)
+}
+
+// findInstance returns the instance with the given address, or nil if there is none
+func findInstance(instances []*instance.Info, address string) *instance.Info {
+	for _, instanceInfo := range instances {
+		if instanceInfo.Address == address {
+			return instanceInfo
+		}
+	}
+	return nil
+}
+
+// enqueueInstanceHandler returns an event handler enqueuing a request for the instance with the address given by the
+// event, named after the address. Instances backing off after a failed configuration are not enqueued again, so that
+// changes to the ConfigMap or cluster do not bypass the backoff of the failing hosts.
+func enqueueInstanceHandler(namespace string) handler.TypedEventHandler[string, reconcile.Request] {
+	return handler.TypedFuncs[string, reconcile.Request]{
+		GenericFunc: func(_ context.Context, e event.TypedGenericEvent[string],
+			q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			req := reconcile.Request{NamespacedName: kubeTypes.NamespacedName{Namespace: namespace, Name: e.Object}}
+			if q.NumRequeues(req) > 0 {
+				return
+			}
+			q.Add(req)
+		},
+	}
+}
+
+// setupWithManager sets up the controller with the Manager. Requests are received from the given channel.
+func (r *byohInstanceReconciler) setupWithManager(mgr ctrl.Manager,
+	instanceRequests <-chan event.TypedGenericEvent[string]) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(BYOHInstanceController).
+		WatchesRawSource(source.Channel(instanceRequests, enqueueInstanceHandler(r.watchNamespace))).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: maxParallelInstanceConfigurations,
+			RateLimiter: workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](
+				instanceRetryBaseDelay, instanceRetryMaxDelay),
+		}).
+		Complete(r)
+}
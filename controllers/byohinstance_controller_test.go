@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+func TestEnqueueInstanceHandler(t *testing.T) {
+	q := workqueue.NewTypedRateLimitingQueue[reconcile.Request](
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](time.Hour, time.Hour))
+	defer q.ShutDown()
+	h := enqueueInstanceHandler("test")
+	failing := reconcile.Request{NamespacedName: kubeTypes.NamespacedName{Namespace: "test", Name: "10.0.0.1"}}
+
+	// Each instance gets its own request, named after its address
+	h.Generic(context.Background(), event.TypedGenericEvent[string]{Object: "10.0.0.1"}, q)
+	h.Generic(context.Background(), event.TypedGenericEvent[string]{Object: "10.0.0.2"}, q)
+	h.Generic(context.Background(), event.TypedGenericEvent[string]{Object: "10.0.0.1"}, q)
+	assert.Equal(t, 2, q.Len())
+
+	// Simulate the configuration of the first instance failing, which requeues it after a backoff
+	req, _ := q.Get()
+	assert.Equal(t, failing, req)
+	q.AddRateLimited(req)
+	q.Done(req)
+	h.Generic(context.Background(), event.TypedGenericEvent[string]{Object: "10.0.0.1"}, q)
+	assert.Equal(t, 1, q.Len(), "an instance backing off should not be enqueued again")
+
+	// Once the instance is successfully configured it can be enqueued again
+	q.Forget(failing)
+	h.Generic(context.Background(), event.TypedGenericEvent[string]{Object: "10.0.0.1"}, q)
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestUpdateWindowsInstanceStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, wmcov1.AddToScheme(scheme))
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"}}
+	instanceInfo := &instance.Info{Address: "10.0.0.1", Node: node}
+
+	testCases := []struct {
+		name              string
+		configErr         error
+		lastError         string
+		expectedPhase     wmcov1.InstancePhase
+		expectedVersion   string
+		expectedLastError string
+		expectedReason    string
+	}{
+		{
+			name:              "configured",
+			lastError:         "previous error",
+			expectedPhase:     wmcov1.PhaseReady,
+			expectedVersion:   version.Get(),
+			expectedLastError: "",
+			expectedReason:    "Configured",
+		},
+		{
+			name:              "configuration failed",
+			configErr:         fmt.Errorf("bootstrap failed"),
+			expectedPhase:     wmcov1.PhaseFailed,
+			expectedVersion:   "old",
+			expectedLastError: "bootstrap failed",
+			expectedReason:    "ConfigurationFailed",
+		},
+		{
+			name:              "rolled back",
+			configErr:         &rolledBackErr{version: "previous", cause: fmt.Errorf("bootstrap failed")},
+			expectedPhase:     wmcov1.PhaseFailed,
+			expectedVersion:   "previous",
+			expectedLastError: (&rolledBackErr{version: "previous", cause: fmt.Errorf("bootstrap failed")}).Error(),
+			expectedReason:    "RolledBack",
+		},
+		{
+			name:              "rolled back by a previous reconcile",
+			configErr:         &rolledBackErr{version: "previous"},
+			lastError:         "bootstrap failed",
+			expectedPhase:     wmcov1.PhaseFailed,
+			expectedVersion:   "previous",
+			expectedLastError: "bootstrap failed",
+			expectedReason:    "RolledBack",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			wi := &wmcov1.WindowsInstance{
+				ObjectMeta: meta.ObjectMeta{Name: "instance", Namespace: "test"},
+				Status:     wmcov1.WindowsInstanceStatus{Version: "old", LastError: test.lastError},
+			}
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(wi).WithStatusSubresource(wi).Build()
+			r := &byohInstanceReconciler{instanceReconciler: instanceReconciler{client: c}}
+
+			require.NoError(t, r.updateWindowsInstanceStatus(context.Background(), wi, instanceInfo, test.configErr))
+			require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(wi), wi))
+			assert.Equal(t, test.expectedPhase, wi.Status.Phase)
+			assert.Equal(t, test.expectedVersion, wi.Status.Version)
+			assert.Equal(t, test.expectedLastError, wi.Status.LastError)
+			assert.Equal(t, node.GetName(), wi.Status.NodeName)
+			configured := apimeta.FindStatusCondition(wi.Status.Conditions, wmcov1.ConfiguredCondition)
+			require.NotNil(t, configured)
+			assert.Equal(t, test.expectedReason, configured.Reason)
+		})
+	}
+}
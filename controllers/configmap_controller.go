@@ -25,15 +25,17 @@ import (
 	"reflect"
 	"strings"
 
-	config "github.com/openshift/api/config/v1"
 	oconfig "github.com/openshift/api/config/v1"
 	mcfgv1 "github.com/openshift/api/machineconfiguration/v1"
 	core "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -43,13 +45,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
-	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
 	"github.com/openshift/windows-machine-config-operator/pkg/ignition"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/patch"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/services"
@@ -67,12 +70,32 @@ import (
 //+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=rolebindings,verbs=get;create;delete
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=clusterrolebindings,verbs=get;create;delete
+//+kubebuilder:rbac:groups=windowsmachineconfig.openshift.io,resources=windowsinstances,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=windowsmachineconfig.openshift.io,resources=windowsinstances/status,verbs=get;update;patch
 
 const (
 	// BYOHLabel is a label that should be applied to all Windows nodes not associated with a Machine.
 	BYOHLabel = "windowsmachineconfig.openshift.io/byoh"
 	// UsernameAnnotation is a node annotation that contains the username used to log into the Windows instance
 	UsernameAnnotation = "windowsmachineconfig.openshift.io/username"
+	// SSHPortAnnotation is a node annotation that contains the port used to SSH into the Windows instance, if it is
+	// not the default port
+	SSHPortAnnotation = "windowsmachineconfig.openshift.io/ssh-port"
+	// SSHOptionsAnnotation is a node annotation that contains the SSH connection parameters of the Windows instance, if
+	// any differ from the defaults
+	SSHOptionsAnnotation = "windowsmachineconfig.openshift.io/ssh-options"
+	// AddressAnnotation is a node annotation that contains the address used to SSH into the Windows instance, if the
+	// node has been registered with an overridden IP
+	AddressAnnotation = "windowsmachineconfig.openshift.io/address"
+	// KeySecretAnnotation is a node annotation that contains the name of the Secret holding the private key used to SSH
+	// into the Windows instance, if the instance does not use the cloud private key
+	KeySecretAnnotation = "windowsmachineconfig.openshift.io/key-secret"
+	// JumpHostsAnnotation is a node annotation that contains the SSH jump hosts connections to the Windows instance
+	// are tunnelled through, if any
+	JumpHostsAnnotation = "windowsmachineconfig.openshift.io/jump-hosts"
+	// WinRMAnnotation is a node annotation that contains the WinRM parameters used to connect to the Windows instance,
+	// as a comma separated list of <option>=<value> pairs. Nodes without it are connected to over SSH.
+	WinRMAnnotation = "windowsmachineconfig.openshift.io/winrm"
 	// ConfigMapController is the name of this controller in logs and other outputs.
 	ConfigMapController = "configmap"
 	// wicdRBACResourceName is the name of the resources associated with WICD's RBAC permissions
@@ -81,12 +104,19 @@ const (
 	InjectionRequestLabel = "config.openshift.io/inject-trusted-cabundle"
 )
 
+// connectionAnnotations are the node annotations describing how to connect to a BYOH instance, which are only present
+// when the description of the instance gives them
+var connectionAnnotations = []string{SSHPortAnnotation, SSHOptionsAnnotation, AddressAnnotation, KeySecretAnnotation,
+	JumpHostsAnnotation, WinRMAnnotation}
+
 // ConfigMapReconciler reconciles a ConfigMap object
 type ConfigMapReconciler struct {
 	instanceReconciler
 	servicesManifest *servicescm.Data
 	proxyEnabled     bool
 	VXLANPort        string
+	// instanceRequests carries the addresses of the BYOH instances to be configured by the BYOH instance controller
+	instanceRequests chan event.TypedGenericEvent[string]
 }
 
 // NewConfigMapReconciler returns a pointer to a ConfigMapReconciler
@@ -101,7 +131,9 @@ func NewConfigMapReconciler(ctx context.Context, mgr manager.Manager, clusterCon
 	if err != nil {
 		return nil, err
 	}
-	svcData, err := generateServicesManifest(ctx, directClient, clusterConfig.Network().VXLANPort(), clusterConfig.Platform())
+	recorder := mgr.GetEventRecorderFor(ConfigMapController)
+	svcData, err := generateServicesManifest(ctx, directClient, recorder, watchNamespace,
+		clusterConfig.Network().VXLANPort(), clusterConfig.Platform())
 	if err != nil {
 		return nil, err
 	}
@@ -113,12 +145,13 @@ func NewConfigMapReconciler(ctx context.Context, mgr manager.Manager, clusterCon
 			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
 			log:                ctrl.Log.WithName("controllers").WithName(ConfigMapController),
 			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(ConfigMapController),
+			recorder:           recorder,
 			platform:           clusterConfig.Platform(),
 		},
 		servicesManifest: svcData,
 		proxyEnabled:     proxyEnabled,
 		VXLANPort:        clusterConfig.Network().VXLANPort(),
+		instanceRequests: make(chan event.TypedGenericEvent[string]),
 	}, nil
 }
 
@@ -147,7 +180,8 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context,
 		return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
 	}
 
-	servicesManifest, err := generateServicesManifest(ctx, r.client, r.VXLANPort, r.platform)
+	servicesManifest, err := generateServicesManifest(ctx, r.client, r.recorder, r.watchNamespace, r.VXLANPort,
+		r.platform)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -256,7 +290,8 @@ func isTiedToRelevantVersion(v string, versions map[string]struct{}) bool {
 	return false
 }
 
-// reconcileNodes corrects the discrepancy between the "expected" instances, and the "actual" Node list
+// reconcileNodes corrects the discrepancy between the "expected" instances, and the "actual" Node list. Expected
+// instances are described by both the windows-instances ConfigMap and WindowsInstance objects.
 func (r *ConfigMapReconciler) reconcileNodes(ctx context.Context, windowsInstances *core.ConfigMap) error {
 	// Get the current list of Windows BYOH Nodes
 	nodes := &core.NodeList{}
@@ -265,73 +300,209 @@ func (r *ConfigMapReconciler) reconcileNodes(ctx context.Context, windowsInstanc
 		return fmt.Errorf("error listing nodes: %w", err)
 	}
 
-	// Get the list of instances that are expected to be Nodes
-	instances, err := wiparser.Parse(windowsInstances.Data, nodes)
+	windowsInstanceList := &wmcov1.WindowsInstanceList{}
+	if err = r.client.List(ctx, windowsInstanceList, client.InNamespace(r.watchNamespace)); err != nil {
+		return fmt.Errorf("error listing WindowsInstances: %w", err)
+	}
+	if windowsInstances.GetAnnotations()[wiparser.MigrateAnnotation] == "true" {
+		if err = r.migrateInstancesConfigMap(ctx, windowsInstances, windowsInstanceList.Items); err != nil {
+			return fmt.Errorf("error migrating %s entries to WindowsInstances: %w", wiparser.InstanceConfigMap, err)
+		}
+	}
+
+	// Get the list of instances that are expected to be Nodes. Invalid instance descriptions are reported, and do not
+	// hold up the configuration of the other instances.
+	instances, invalid, err := parseInstances(windowsInstances, windowsInstanceList.Items, nodes)
 	if err != nil {
-		return fmt.Errorf("unable to parse instances from ConfigMap: %w", err)
+		return err
+	}
+	for address, invalidErr := range invalid {
+		r.log.Error(invalidErr, "invalid instance", "address", address)
+		wi := findWindowsInstance(windowsInstanceList.Items, address)
+		if wi == nil {
+			r.recorder.Eventf(windowsInstances, core.EventTypeWarning, "InvalidInstance", invalidErr.Error())
+			continue
+		}
+		r.recorder.Eventf(wi, core.EventTypeWarning, "InvalidInstance", invalidErr.Error())
+		if err = r.reportInvalidWindowsInstance(ctx, wi, invalidErr); err != nil {
+			r.log.Error(err, "unable to update status", "WindowsInstance", wi.GetName())
+		}
 	}
 
-	r.log.Info("processing", "instances in", wiparser.InstanceConfigMap)
-	// For each instance, ensure that it is configured into a node
-	if err := r.ensureInstancesAreUpToDate(ctx, instances); err != nil {
-		r.recorder.Eventf(windowsInstances, core.EventTypeWarning, "InstanceSetupFailure", err.Error())
+	r.log.Info("processing", "instances in", wiparser.InstanceConfigMap, "WindowsInstances",
+		len(windowsInstanceList.Items))
+	// Each instance is configured into a node by its own work item, so that a host which is slow or failing to be
+	// configured does not hold up the configuration of the others
+	if err := r.enqueueInstances(ctx, instances); err != nil {
 		return err
 	}
 
 	// Ensure that only instances currently specified by the ConfigMap are joined to the cluster as nodes
-	if err = r.deconfigureInstances(ctx, instances, nodes); err != nil {
+	if err = r.deconfigureInstances(ctx, instances, invalid, nodes); err != nil {
 		return fmt.Errorf("error removing undesired nodes from cluster: %w", err)
 	}
 
 	return nil
 }
 
-// ensureInstancesAreUpToDate configures all instances that require configuration
-func (r *ConfigMapReconciler) ensureInstancesAreUpToDate(ctx context.Context, instances []*instance.Info) error {
-	// Get private key to encrypt instance usernames
-	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: secrets.PrivateKeySecret}, r.client)
+// parseInstances returns the instances described by both the given windows-instances ConfigMap and WindowsInstances,
+// along with the errors describing the invalid ConfigMap entries and WindowsInstances, keyed by address. A
+// WindowsInstance takes precedence over a ConfigMap entry with the same address, even if it is invalid. The nodes
+// parameter should be a list of all Windows BYOH nodes.
+func parseInstances(windowsInstances *core.ConfigMap, windowsInstanceCRs []wmcov1.WindowsInstance,
+	nodes *core.NodeList) ([]*instance.Info, map[string]error, error) {
+	cmInstances, invalid, err := wiparser.Parse(windowsInstances.Data, nodes)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("unable to parse instances from ConfigMap: %w", err)
 	}
-	windowsInstances := &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap,
-		Namespace: r.watchNamespace}}
+	crInstances, invalidCRs, err := wiparser.ParseWindowsInstances(windowsInstanceCRs, nodes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse instances from WindowsInstances: %w", err)
+	}
+	for _, wi := range windowsInstanceCRs {
+		delete(invalid, wi.Spec.Address)
+		crErr, isInvalid := invalidCRs[wi.GetName()]
+		if !isInvalid {
+			continue
+		}
+		invalid[wi.Spec.Address] = crErr
+		valid := cmInstances[:0]
+		for _, cmInstance := range cmInstances {
+			if cmInstance.Address != wi.Spec.Address {
+				valid = append(valid, cmInstance)
+			}
+		}
+		cmInstances = valid
+	}
+	return wiparser.Merge(cmInstances, crInstances), invalid, nil
+}
+
+// enqueueInstances requests the configuration of each of the given instances by the BYOH instance controller
+func (r *ConfigMapReconciler) enqueueInstances(ctx context.Context, instances []*instance.Info) error {
 	for _, instanceInfo := range instances {
-		// When platform type is none or Nutanix, kubelet will pick a random interface to use for the Node's IP. In that case we
-		// should override that with the IP that the user is providing via the ConfigMap.
-		instanceInfo.SetNodeIP = r.platform == config.NonePlatformType || r.platform == config.NutanixPlatformType
-		encryptedUsername, err := crypto.EncryptToJSONString(instanceInfo.Username, privateKeyBytes)
-		if err != nil {
-			return fmt.Errorf("unable to encrypt username for instance %s: %w", instanceInfo.Address, err)
+		select {
+		case r.instanceRequests <- event.TypedGenericEvent[string]{Object: instanceInfo.Address}:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		err = r.ensureInstanceIsUpToDate(ctx, instanceInfo, map[string]string{BYOHLabel: "true", nodeconfig.WorkerLabel: ""},
-			map[string]string{UsernameAnnotation: encryptedUsername})
-		if err != nil {
-			// It is better to return early like this, instead of trying to configure as many instances as possible in a
-			// single reconcile call, as it simplifies error collection. The order the map is read from is
-			// psuedo-random, so the configuration effort for configurable hosts will not be blocked by a specific host
-			// that has issues with configuration.
-			return fmt.Errorf("error configuring host with address %s: %w", instanceInfo.Address, err)
+	}
+	return nil
+}
+
+// migrateInstancesConfigMap creates a WindowsInstance for each entry in the windows-instances ConfigMap. Entries are
+// only removed from the ConfigMap once the associated WindowsInstance is present in the given list, ensuring the
+// instance is described at all times and does not get deconfigured during the migration. The migration annotation is
+// removed once the ConfigMap has no entries left.
+func (r *ConfigMapReconciler) migrateInstancesConfigMap(ctx context.Context, windowsInstances *core.ConfigMap,
+	existing []wmcov1.WindowsInstance) error {
+	converted, err := wiparser.ToWindowsInstances(windowsInstances.Data, r.watchNamespace)
+	if err != nil {
+		return err
+	}
+	patchBase := client.MergeFrom(windowsInstances.DeepCopy())
+	for _, wi := range converted {
+		if findWindowsInstance(existing, wi.Spec.Address) != nil {
+			// The instance has already been migrated, the entry can be safely removed
+			delete(windowsInstances.Data, wi.Spec.Address)
+			continue
+		}
+		if err = r.client.Create(ctx, wi); err != nil && !k8sapierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error creating WindowsInstance %s: %w", wi.GetName(), err)
+		}
+		r.log.Info("Created", "WindowsInstance", kubeTypes.NamespacedName{Namespace: wi.Namespace, Name: wi.Name})
+	}
+	if len(windowsInstances.Data) == 0 {
+		delete(windowsInstances.Annotations, wiparser.MigrateAnnotation)
+	}
+	return r.client.Patch(ctx, windowsInstances, patchBase)
+}
+
+// findWindowsInstance returns the WindowsInstance describing the instance with the given address, or nil if there is
+// none
+func findWindowsInstance(windowsInstances []wmcov1.WindowsInstance, address string) *wmcov1.WindowsInstance {
+	for i := range windowsInstances {
+		if windowsInstances[i].Spec.Address == address {
+			return &windowsInstances[i]
 		}
-		r.recorder.Eventf(windowsInstances, core.EventTypeNormal, "InstanceSetup",
-			"Configured instance with address %s as a worker node", instanceInfo.Address)
 	}
 	return nil
 }
 
+// reportInvalidWindowsInstance publishes the given error, describing why the given WindowsInstance is invalid, in its
+// status. The instance it describes is not configured until it is fixed.
+func (r *ConfigMapReconciler) reportInvalidWindowsInstance(ctx context.Context, wi *wmcov1.WindowsInstance,
+	invalidErr error) error {
+	original := wi.DeepCopy()
+	setWindowsInstancePhase(&wi.Status, wmcov1.PhaseFailed)
+	wi.Status.FailedPhase = ""
+	wi.Status.LastError = invalidErr.Error()
+	apimeta.SetStatusCondition(&wi.Status.Conditions, meta.Condition{Type: wmcov1.ConfiguredCondition,
+		Status: meta.ConditionFalse, Reason: "InvalidSpec", Message: invalidErr.Error(),
+		ObservedGeneration: wi.GetGeneration()})
+	if equality.Semantic.DeepEqual(original.Status, wi.Status) {
+		return nil
+	}
+	return r.client.Status().Patch(ctx, wi, client.MergeFrom(original))
+}
+
+// setWindowsInstancePhase sets the phase in the given status, updating the transition time if the phase changed
+func setWindowsInstancePhase(status *wmcov1.WindowsInstanceStatus, phase wmcov1.InstancePhase) {
+	if status.Phase == phase && status.PhaseTransitionTime != nil {
+		return
+	}
+	now := meta.Now()
+	status.Phase = phase
+	status.PhaseTransitionTime = &now
+}
+
+// windowsInstancePhaseRecorder publishes the configuration phase of an instance in the status of its WindowsInstance
+type windowsInstancePhaseRecorder struct {
+	client          client.Client
+	windowsInstance *wmcov1.WindowsInstance
+}
+
+// RecordPhase sets the phase of the WindowsInstance. If err is not nil, the WindowsInstance is marked as Failed, and
+// the failed phase and error are recorded.
+func (w *windowsInstancePhaseRecorder) RecordPhase(ctx context.Context, phase wmcov1.InstancePhase, err error) error {
+	patchBase := client.MergeFrom(w.windowsInstance.DeepCopy())
+	status := &w.windowsInstance.Status
+	if err != nil {
+		setWindowsInstancePhase(status, wmcov1.PhaseFailed)
+		status.FailedPhase = phase
+		status.LastError = err.Error()
+	} else {
+		setWindowsInstancePhase(status, phase)
+		status.FailedPhase = ""
+	}
+	return w.client.Status().Patch(ctx, w.windowsInstance, patchBase)
+}
+
 // deconfigureInstances removes all BYOH nodes that are not specified in the given instances slice, and
-// deconfigures the instances associated with them. The nodes parameter should be a list of all Windows BYOH nodes.
-func (r *ConfigMapReconciler) deconfigureInstances(ctx context.Context, instances []*instance.Info, nodes *core.NodeList) error {
+// deconfigures the instances associated with them. Nodes of instances whose description is invalid, given by the
+// addresses of the invalid map, are kept until their description is fixed or removed. The nodes parameter should be a
+// list of all Windows BYOH nodes.
+func (r *ConfigMapReconciler) deconfigureInstances(ctx context.Context, instances []*instance.Info,
+	invalid map[string]error, nodes *core.NodeList) error {
 	windowsInstances := &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap,
 		Namespace: r.watchNamespace}}
+	invalidInstances := make([]*instance.Info, 0, len(invalid))
+	for address := range invalid {
+		invalidInstances = append(invalidInstances, &instance.Info{Address: address})
+	}
 	for _, node := range nodes.Items {
 		// Check for instances associated with this node
 		if hasAssociatedInstance(node.Status.Addresses, instances) {
 			continue
 		}
+		if hasAssociatedInstance(node.Status.Addresses, invalidInstances) ||
+			invalid[node.GetAnnotations()[AddressAnnotation]] != nil {
+			r.log.Info("keeping node of invalid instance", "node", node.GetName())
+			continue
+		}
 
 		// no instance found in the provided list, remove the node from the cluster
 		if err := r.deconfigureInstance(ctx, &node); err != nil {
+			r.recordHostKeyMismatch(&node, err)
 			return fmt.Errorf("unable to deconfigure instance with node %s: %w", node.GetName(), err)
 		}
 		r.recorder.Eventf(windowsInstances, core.EventTypeNormal, "InstanceTeardown",
@@ -345,8 +516,8 @@ func (r *ConfigMapReconciler) deconfigureInstances(ctx context.Context, instance
 func hasAssociatedInstance(nodeAddresses []core.NodeAddress, instances []*instance.Info) bool {
 	for _, nodeAddress := range nodeAddresses {
 		for _, instanceInfo := range instances {
-			// Direct match node network address whether it is a DNS name or an IP address
-			if nodeAddress.Address == instanceInfo.Address || nodeAddress.Address == instanceInfo.IPv4Address {
+			// Direct match node network address whether it is a DNS name, an IP address or an overridden node IP
+			if instanceInfo.HasAddress(nodeAddress.Address) {
 				return true
 			}
 		}
@@ -399,6 +570,9 @@ func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			return r.isValidConfigMap(e.Object)
 		},
 	}
+	if err := newBYOHInstanceReconciler(r.instanceReconciler).setupWithManager(mgr, r.instanceRequests); err != nil {
+		return fmt.Errorf("unable to create %s controller: %w", BYOHInstanceController, err)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&core.ConfigMap{}, builder.WithPredicates(configMapPredicate)).
 		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToInstancesConfigMap),
@@ -407,6 +581,12 @@ func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			builder.WithPredicates(windowsNodeVersionChangePredicate())).
 		Watches(&mcfgv1.MachineConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapToServicesConfigMap),
 			builder.WithPredicates(machineConfigCreatedPredicate())).
+		Watches(&core.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapToServicesConfigMap),
+			builder.WithPredicates(r.additionalServicesPredicate())).
+		Watches(&wmcov1.WindowsInstance{}, handler.EnqueueRequestsFromMapFunc(r.mapToInstancesConfigMap),
+			builder.WithPredicates(r.windowsInstancePredicate())).
+		Watches(&wmcov1.OperatorConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapToServicesConfigMap),
+			builder.WithPredicates(operatorConfigSpecChangePredicate())).
 		Complete(r)
 }
 
@@ -427,6 +607,31 @@ func machineConfigCreatedPredicate() predicate.Funcs {
 	}
 }
 
+// additionalServicesPredicate filters out ConfigMaps other than the additional services ConfigMap
+func (r *ConfigMapReconciler) additionalServicesPredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetNamespace() == r.watchNamespace && o.GetName() == servicescm.AdditionalServicesConfigMap
+	})
+}
+
+// operatorConfigSpecChangePredicate filters out OperatorConfigs other than the singleton, and updates which do not
+// change its spec, as the windows_exporter settings it holds are part of the services ConfigMap
+func operatorConfigSpecChangePredicate() predicate.Predicate {
+	singleton := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetName() == wmcov1.OperatorConfigName
+	})
+	return predicate.And(singleton, predicate.GenerationChangedPredicate{})
+}
+
+// windowsInstancePredicate filters out WindowsInstances outside of the watch namespace, and updates which do not
+// change the spec, such as status updates
+func (r *ConfigMapReconciler) windowsInstancePredicate() predicate.Predicate {
+	inWatchNamespace := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetNamespace() == r.watchNamespace
+	})
+	return predicate.And(inWatchNamespace, predicate.GenerationChangedPredicate{})
+}
+
 // isValidConfigMap returns true if the ConfigMap object is the InstanceConfigMap or a WMCO-managed ConfigMap
 func (r *ConfigMapReconciler) isValidConfigMap(o client.Object) bool {
 	return o.GetNamespace() == r.watchNamespace &&
@@ -533,8 +738,12 @@ func (r *ConfigMapReconciler) ensureTrustedCABundleInNode(ctx context.Context, n
 	if err != nil {
 		return err
 	}
+	instanceSigner, err := r.signerFor(ctx, winInstance)
+	if err != nil {
+		return err
+	}
 	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-		winInstance, r.signer, nil, nil, r.platform)
+		winInstance, instanceSigner, nil, nil, r.platform)
 	if err != nil {
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
@@ -688,10 +897,12 @@ func (r *ConfigMapReconciler) ensureWICDClusterRoleBinding(ctx context.Context)
 	return err
 }
 
-// generateServicesManifest generates and regenerates the services manifest.
+// generateServicesManifest generates and regenerates the services manifest, including the additional services given
+// by the cluster admin.
 // this gets called when the configmap reconciler is first created, to create the services manifest,
-// and also when the rendered-worker configmap is changed, to regenerate it.
-func generateServicesManifest(ctx context.Context, client client.Client, port string, platform oconfig.PlatformType) (*servicescm.Data, error) {
+// and also when the rendered-worker configmap or the additional services ConfigMap is changed, to regenerate it.
+func generateServicesManifest(ctx context.Context, client client.Client, recorder record.EventRecorder,
+	namespace, port string, platform oconfig.PlatformType) (*servicescm.Data, error) {
 	ign, err := ignition.New(ctx, client)
 	if err != nil {
 		return nil, fmt.Errorf("error creating ignition object: %w", err)
@@ -700,9 +911,75 @@ func generateServicesManifest(ctx context.Context, client client.Client, port st
 	if err != nil {
 		return nil, fmt.Errorf("Error getting kubelet args from ignition: %w", err)
 	}
-	svcData, err := services.GenerateManifest(argsFromIgnition, port, platform, ctrl.Log.V(1).Enabled())
+	exporterSettings, err := windowsExporterSettings(ctx, client, recorder)
+	if err != nil {
+		return nil, err
+	}
+	svcData, err := services.GenerateManifest(argsFromIgnition, port, platform, ctrl.Log.V(1).Enabled(),
+		exporterSettings)
 	if err != nil {
 		return nil, fmt.Errorf("error generating expected Windows service state: %w", err)
 	}
-	return svcData, nil
+	return withAdditionalServices(ctx, client, recorder, namespace, svcData)
+}
+
+// windowsExporterSettings returns the windows_exporter settings given in the OperatorConfig. If they are invalid, a
+// warning event is recorded on the OperatorConfig and windows_exporter is run with its default collectors and flags.
+func windowsExporterSettings(ctx context.Context, c client.Client,
+	recorder record.EventRecorder) (operatorconfig.WindowsExporter, error) {
+	settings, err := operatorconfig.Get(ctx, c)
+	if err != nil {
+		return operatorconfig.WindowsExporter{}, err
+	}
+	if err = services.ValidateWindowsExporterSettings(settings.WindowsExporter); err != nil {
+		config := &wmcov1.OperatorConfig{ObjectMeta: meta.ObjectMeta{Name: wmcov1.OperatorConfigName}}
+		recorder.Eventf(config, core.EventTypeWarning, "InvalidWindowsExporterSettings",
+			"windows_exporter settings are invalid and will not be applied until fixed: %s", err)
+		return operatorconfig.WindowsExporter{}, nil
+	}
+	return settings.WindowsExporter, nil
+}
+
+// withAdditionalServices returns the given services data along with the services defined in the additional services
+// ConfigMap. If the ConfigMap is invalid, a warning event is recorded on it and the additional services of the current
+// services ConfigMap are kept, so that services running on the instances are not removed until the ConfigMap is fixed.
+func withAdditionalServices(ctx context.Context, c client.Client, recorder record.EventRecorder, namespace string,
+	svcData *servicescm.Data) (*servicescm.Data, error) {
+	additionalServices := &core.ConfigMap{}
+	err := c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: servicescm.AdditionalServicesConfigMap},
+		additionalServices)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return svcData, nil
+		}
+		return nil, fmt.Errorf("unable to get ConfigMap %s: %w", servicescm.AdditionalServicesConfigMap, err)
+	}
+	additional, err := servicescm.ParseAdditionalServices(additionalServices.Data)
+	if err == nil {
+		var merged *servicescm.Data
+		if merged, err = svcData.WithAdditionalServices(additional); err == nil {
+			return merged, nil
+		}
+	}
+	recorder.Eventf(additionalServices, core.EventTypeWarning, "InvalidAdditionalServices",
+		"Additional services are invalid and will not be applied until fixed: %s", err)
+
+	current := &core.ConfigMap{}
+	err = c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: servicescm.Name}, current)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return svcData, nil
+		}
+		return nil, fmt.Errorf("unable to get ConfigMap %s: %w", servicescm.Name, err)
+	}
+	currentData, err := servicescm.Parse(current.Data)
+	if err != nil {
+		// The invalid services ConfigMap is replaced, keep none of its services
+		return svcData, nil
+	}
+	merged, err := svcData.WithAdditionalServices(currentData.AdditionalServices())
+	if err != nil {
+		return svcData, nil
+	}
+	return merged, nil
 }
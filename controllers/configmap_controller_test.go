@@ -1,14 +1,24 @@
 package controllers
 
 import (
+	"context"
 	"testing"
 
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
 )
@@ -150,3 +160,189 @@ func TestHasAssociatedInstance(t *testing.T) {
 		})
 	}
 }
+
+func TestWithAdditionalServices(t *testing.T) {
+	namespace := "test"
+	builtIn := &servicescm.Data{Services: []servicescm.Service{{Name: "kubelet", Command: "kubelet.exe",
+		Bootstrap: true, Priority: 0}}, Files: []servicescm.FileInfo{}}
+	additionalCM := func(services string) *core.ConfigMap {
+		return &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: servicescm.AdditionalServicesConfigMap,
+			Namespace: namespace}, Data: map[string]string{"services": services}}
+	}
+	agent := servicescm.Service{Name: "agent", Command: "agent.exe", Priority: 1, Additional: true}
+	current, err := builtIn.WithAdditionalServices([]servicescm.Service{agent})
+	require.NoError(t, err)
+	currentCM, err := servicescm.Generate(servicescm.Name, namespace, current)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		objects        []client.Object
+		expected       []string
+		expectedEvents int
+	}{
+		{
+			name:     "no additional services ConfigMap",
+			expected: []string{"kubelet"},
+		},
+		{
+			name: "valid additional services",
+			objects: []client.Object{
+				additionalCM(`[{"name":"agent","path":"agent.exe","priority":1},` +
+					`{"name":"logger","path":"logger.exe","priority":2}]`),
+				currentCM},
+			expected: []string{"kubelet", "agent", "logger"},
+		},
+		{
+			name:           "invalid additional services keep the current ones",
+			objects:        []client.Object{additionalCM(`[{"name":"kubelet","path":"agent.exe","priority":1}]`), currentCM},
+			expected:       []string{"kubelet", "agent"},
+			expectedEvents: 1,
+		},
+		{
+			name:           "invalid additional services without a current ConfigMap",
+			objects:        []client.Object{additionalCM(`{`)},
+			expected:       []string{"kubelet"},
+			expectedEvents: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := clientfake.NewClientBuilder().WithObjects(test.objects...).Build()
+			recorder := record.NewFakeRecorder(10)
+			data, err := withAdditionalServices(context.Background(), c, recorder, namespace, builtIn)
+			require.NoError(t, err)
+			var names []string
+			for _, svc := range data.Services {
+				names = append(names, svc.Name)
+			}
+			require.Equal(t, test.expected, names)
+			require.Len(t, recorder.Events, test.expectedEvents)
+		})
+	}
+}
+
+func TestWindowsExporterSettings(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, wmcov1.AddToScheme(scheme))
+	operatorConfig := func(flags map[string]string) *wmcov1.OperatorConfig {
+		return &wmcov1.OperatorConfig{ObjectMeta: meta.ObjectMeta{Name: wmcov1.OperatorConfigName},
+			Spec: wmcov1.OperatorConfigSpec{WindowsExporter: &wmcov1.WindowsExporterSettings{
+				AdditionalCollectors: []string{"iis"}, CollectorFlags: flags}}}
+	}
+
+	tests := []struct {
+		name           string
+		objects        []client.Object
+		expected       operatorconfig.WindowsExporter
+		expectedEvents int
+	}{
+		{
+			name: "no OperatorConfig",
+		},
+		{
+			name:    "valid settings",
+			objects: []client.Object{operatorConfig(map[string]string{"collector.process.include": "^w3wp$"})},
+			expected: operatorconfig.WindowsExporter{AdditionalCollectors: []string{"iis"},
+				CollectorFlags: map[string]string{"collector.process.include": "^w3wp$"}},
+		},
+		{
+			name:           "invalid settings fall back to the defaults",
+			objects:        []client.Object{operatorConfig(map[string]string{"web.config.file": "config.yaml"})},
+			expectedEvents: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(test.objects...).Build()
+			recorder := record.NewFakeRecorder(10)
+			settings, err := windowsExporterSettings(context.Background(), c, recorder)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, settings)
+			require.Len(t, recorder.Events, test.expectedEvents)
+		})
+	}
+}
+
+func TestReconcileNodesWithInvalidInstance(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, wmcov1.AddToScheme(scheme))
+	windowsInstances := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap, Namespace: "test"},
+		Data: map[string]string{
+			"127.0.0.1": "username=core",
+			"127.0.0.2": "hostname=win",
+			"127.0.0.3": "username=Admin",
+		},
+	}
+	// The node of the instance with the invalid entry must not be deconfigured
+	node := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "invalid-instance",
+			Labels: map[string]string{BYOHLabel: "true", core.LabelOSStable: "windows"}},
+		Status: core.NodeStatus{Addresses: []core.NodeAddress{{Address: "127.0.0.2", Type: core.NodeInternalIP}}},
+	}
+	recorder := record.NewFakeRecorder(10)
+	instanceRequests := make(chan event.TypedGenericEvent[string], 10)
+	r := &ConfigMapReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(windowsInstances, node).Build(),
+			log:            logr.Discard(),
+			watchNamespace: "test",
+			recorder:       recorder,
+		},
+		instanceRequests: instanceRequests,
+	}
+
+	require.NoError(t, r.reconcileNodes(context.Background(), windowsInstances))
+	close(instanceRequests)
+	var enqueued []string
+	for request := range instanceRequests {
+		enqueued = append(enqueued, request.Object)
+	}
+	assert.ElementsMatch(t, []string{"127.0.0.1", "127.0.0.3"}, enqueued)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "InvalidInstance")
+}
+
+func TestReconcileNodesWithInvalidWindowsInstance(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, wmcov1.AddToScheme(scheme))
+	// The entry is superseded by the invalid WindowsInstance with the same address
+	windowsInstances := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap, Namespace: "test"},
+		Data:       map[string]string{"127.0.0.2": "username=core"},
+	}
+	valid := &wmcov1.WindowsInstance{ObjectMeta: meta.ObjectMeta{Name: "valid", Namespace: "test"},
+		Spec: wmcov1.WindowsInstanceSpec{Address: "127.0.0.1", Username: "core"}}
+	invalid := &wmcov1.WindowsInstance{ObjectMeta: meta.ObjectMeta{Name: "invalid", Namespace: "test"},
+		Spec: wmcov1.WindowsInstanceSpec{Address: "127.0.0.2"}}
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(windowsInstances, valid, invalid).
+		WithStatusSubresource(valid, invalid).Build()
+	recorder := record.NewFakeRecorder(10)
+	instanceRequests := make(chan event.TypedGenericEvent[string], 10)
+	r := &ConfigMapReconciler{
+		instanceReconciler: instanceReconciler{client: c, log: logr.Discard(), watchNamespace: "test",
+			recorder: recorder},
+		instanceRequests: instanceRequests,
+	}
+
+	require.NoError(t, r.reconcileNodes(context.Background(), windowsInstances))
+	close(instanceRequests)
+	var enqueued []string
+	for request := range instanceRequests {
+		enqueued = append(enqueued, request.Object)
+	}
+	assert.Equal(t, []string{"127.0.0.1"}, enqueued)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "InvalidInstance")
+
+	require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(invalid), invalid))
+	assert.Equal(t, wmcov1.PhaseFailed, invalid.Status.Phase)
+	assert.Contains(t, invalid.Status.LastError, "empty username")
+	require.Len(t, invalid.Status.Conditions, 1)
+	assert.Equal(t, "InvalidSpec", invalid.Status.Conditions[0].Reason)
+	require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(valid), valid))
+	assert.Empty(t, valid.Status.Phase)
+}
@@ -2,14 +2,21 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	config "github.com/openshift/api/config/v1"
 	"golang.org/x/crypto/ssh"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
@@ -17,26 +24,49 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
 	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/signer"
+	"github.com/openshift/windows-machine-config-operator/pkg/upgrade"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
 
-const (
-	// MaxParallelUpgrades is the default maximum allowed number of nodes that can be upgraded in parallel.
-	// It is a positive integer and cannot be used to stop upgrades, only to limit the number of concurrent upgrades.
-	MaxParallelUpgrades = 1
-)
-
 var (
 	// controllerLocker is used to synchronize upgrades between controllers
 	controllerLocker sync.Mutex
 )
 
+// rolledBackErr is returned for an instance whose upgrade to the current operator version failed and which was rolled
+// back to the version it was previously configured by. The instance is back in service, so the error is published in
+// the instance's status but the reconcile is not retried.
+type rolledBackErr struct {
+	// version is the WMCO version the instance was rolled back to
+	version string
+	// cause is the error the upgrade failed with, nil if the instance was rolled back by a previous reconcile
+	cause error
+}
+
+func (e *rolledBackErr) Error() string {
+	if e.cause == nil {
+		return fmt.Sprintf("upgrade to version %s was rolled back to version %s", version.Get(), e.version)
+	}
+	return fmt.Sprintf("upgrade to version %s failed and was rolled back to version %s: %v", version.Get(), e.version,
+		e.cause)
+}
+
+func (e *rolledBackErr) Unwrap() error {
+	return e.cause
+}
+
 // instanceReconciler contains everything needed to perform actions on a Windows instance
 type instanceReconciler struct {
 	// Client is the cache client
@@ -58,8 +88,11 @@ type instanceReconciler struct {
 
 // ensureInstanceIsUpToDate ensures that the given instance is configured as a node and upgraded to the specifications
 // defined by the current version of WMCO. If labelsToApply/annotationsToApply is not nil, the node will have the
-// specified annotations and/or labels applied to it.
-func (r *instanceReconciler) ensureInstanceIsUpToDate(ctx context.Context, instanceInfo *instance.Info, labelsToApply, annotationsToApply map[string]string) error {
+// specified annotations and/or labels applied to it. The configuration phase is published on the instance's Node and,
+// if phaseRecorder is not nil, with phaseRecorder. A *rolledBackErr is returned if the instance failed its upgrade and
+// was rolled back.
+func (r *instanceReconciler) ensureInstanceIsUpToDate(ctx context.Context, instanceInfo *instance.Info, labelsToApply,
+	annotationsToApply map[string]string, phaseRecorder nodeconfig.PhaseRecorder) error {
 	if instanceInfo == nil {
 		return fmt.Errorf("instance cannot be nil")
 	}
@@ -72,27 +105,112 @@ func (r *instanceReconciler) ensureInstanceIsUpToDate(ctx context.Context, insta
 		return nil
 	}
 
+	start := time.Now()
+	nodeconfig.RecordPhase(ctx, r.client, r.log, instanceInfo.Node, phaseRecorder, wmcov1.PhaseConnecting, nil)
+	instanceSigner, err := r.signerFor(ctx, instanceInfo)
+	if err != nil {
+		nodeconfig.RecordPhase(ctx, r.client, r.log, instanceInfo.Node, phaseRecorder, wmcov1.PhaseConnecting, err)
+		return err
+	}
 	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-		instanceInfo, r.signer, labelsToApply, annotationsToApply, r.platform)
+		instanceInfo, instanceSigner, labelsToApply, annotationsToApply, r.platform)
 	if err != nil {
+		nodeconfig.RecordPhase(ctx, r.client, r.log, instanceInfo.Node, phaseRecorder, wmcov1.PhaseConnecting, err)
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
+	nc.SetPhaseRecorder(phaseRecorder)
 
-	// Check if the instance was configured by a previous version of WMCO and must be deconfigured before being
-	// configured again.
+	// A node which is rolled back after a failed upgrade keeps the version it is rolled back to until it is upgraded
+	var rollbackVersion string
+	if instanceInfo.Node != nil {
+		rollbackVersion = instanceInfo.Node.GetAnnotations()[metadata.RollbackVersionAnnotation]
+	}
+	operation := metrics.OperationConfigure
+	// Check if the instance was configured by a previous version of WMCO and must be upgraded
 	if instanceInfo.UpgradeRequired() {
+		operation = metrics.OperationUpgrade
 		// Instance requiring an upgrade indicates that node object is present with the version annotation
+		if upgrade.IsRolledBack(instanceInfo.Node) {
+			// The rollback has already been reported, the node is left as is until the annotation is removed
+			r.log.Info("instance was rolled back after failing its upgrade, remove the annotation to retry",
+				"node", instanceInfo.Node.GetName(), "version",
+				instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation], "annotation",
+				metadata.RolledBackAnnotation)
+			return &rolledBackErr{version: instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation]}
+		}
 		r.log.Info("instance requires upgrade", "node", instanceInfo.Node.GetName(), "version",
 			instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation], "expected version", version.Get())
 		if err := markNodeAsUpgrading(ctx, r.client, instanceInfo.Node); err != nil {
 			return err
 		}
-		if err := nc.Deconfigure(ctx); err != nil {
+		if rollbackVersion, err = r.prepareRollback(ctx, instanceInfo.Node); err != nil {
+			return err
+		}
+		nc.SetRollbackOnFailure(rollbackVersion != "")
+		err = nc.Upgrade(ctx, instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation])
+	} else {
+		err = nc.Configure(ctx)
+	}
+	if err != nil {
+		if rollbackVersion == "" {
 			return err
 		}
+		return r.reportRollback(instanceInfo.Node, rollbackVersion, err,
+			nc.Rollback(ctx, rollbackVersion, err))
+	}
+	metrics.ConfigurationDuration.WithLabelValues(configurationType(instanceInfo), operation).
+		Observe(time.Since(start).Seconds())
+	if rollbackVersion != "" {
+		return metadata.RemoveRollbackVersionAnnotation(ctx, r.client, instanceInfo.Node, "")
+	}
+	return nil
+}
+
+// prepareRollback records the version the given node is configured by as the version it is rolled back to if its
+// upgrade fails, when the upgrade strategy asks for it. The version is returned, or an empty string if the node cannot
+// be rolled back as the services ConfigMap of that version does not exist anymore.
+func (r *instanceReconciler) prepareRollback(ctx context.Context, node *core.Node) (string, error) {
+	settings, err := operatorconfig.Get(ctx, r.client)
+	if err != nil {
+		return "", err
+	}
+	if !settings.UpgradeStrategy.RollbackOnFailure {
+		return "", nil
+	}
+	previousVersion := node.GetAnnotations()[metadata.VersionAnnotation]
+	cm := &core.ConfigMap{}
+	err = r.client.Get(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: servicescm.NamePrefix + previousVersion}, cm)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			r.log.Info("node cannot be rolled back if its upgrade fails, services ConfigMap not found", "node",
+				node.GetName(), "version", previousVersion)
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting services ConfigMap of version %s: %w", previousVersion, err)
 	}
+	if err = metadata.ApplyRollbackVersionAnnotation(ctx, r.client, *node, previousVersion); err != nil {
+		return "", err
+	}
+	return previousVersion, nil
+}
 
-	return nc.Configure(ctx)
+// reportRollback emits an event on the given node, whose upgrade failed with cause and was rolled back to the given
+// version. rollbackErr is the error the rollback failed with, if any, in which case an error is returned so that the
+// upgrade is retried. A node which was rolled back is back in service and is not upgraded again until its
+// rolled-back-from annotation is removed, so a *rolledBackErr is returned.
+func (r *instanceReconciler) reportRollback(node *core.Node, rollbackVersion string, cause, rollbackErr error) error {
+	if rollbackErr != nil {
+		r.recorder.Eventf(node, core.EventTypeWarning, "UpgradeRollbackFailed",
+			"Upgrade to version %s failed and rolling back to version %s failed: %v", version.Get(),
+			rollbackVersion, rollbackErr)
+		return fmt.Errorf("error rolling back node %s to version %s after failed upgrade: %w", node.GetName(),
+			rollbackVersion, errors.Join(cause, rollbackErr))
+	}
+	r.recorder.Eventf(node, core.EventTypeWarning, "UpgradeRolledBack",
+		"Upgrade to version %s failed and was rolled back to version %s: %v", version.Get(), rollbackVersion, cause)
+	r.log.Error(cause, "upgrade failed and was rolled back", "node", node.GetName(), "version", rollbackVersion)
+	return &rolledBackErr{version: rollbackVersion, cause: cause}
 }
 
 // instanceFromNode returns an instance object for the given node. Requires a username that can be used to SSH into the
@@ -102,9 +220,12 @@ func (r *instanceReconciler) instanceFromNode(ctx context.Context, node *core.No
 	if usernameAnnotation == "" {
 		return nil, fmt.Errorf("node is missing valid username annotation")
 	}
-	addr, err := GetAddress(node.Status.Addresses)
-	if err != nil {
-		return nil, err
+	addr, present := node.Annotations[AddressAnnotation]
+	if !present {
+		var err error
+		if addr, err = GetAddress(node.Status.Addresses); err != nil {
+			return nil, err
+		}
 	}
 
 	// Decrypt username annotation to plain text using private key
@@ -118,7 +239,45 @@ func (r *instanceReconciler) instanceFromNode(ctx context.Context, node *core.No
 		return nil, fmt.Errorf("unable to decrypt username annotation for node %s: %w", node.Name, err)
 	}
 
-	return instance.NewInfo(addr, username, "", false, node)
+	instanceInfo, err := instance.NewInfo(addr, username, "", false, node)
+	if err != nil {
+		return nil, err
+	}
+	if portAnnotation, present := node.Annotations[SSHPortAnnotation]; present {
+		if instanceInfo.SSHPort, err = strconv.Atoi(portAnnotation); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on node %s: %w", SSHPortAnnotation, node.Name, err)
+		}
+	}
+	if optionsAnnotation, present := node.Annotations[SSHOptionsAnnotation]; present {
+		if instanceInfo.SSHOptions, err = instance.ParseSSHOptions(optionsAnnotation); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on node %s: %w", SSHOptionsAnnotation, node.Name, err)
+		}
+	}
+	if jumpHostsAnnotation, present := node.Annotations[JumpHostsAnnotation]; present {
+		if instanceInfo.JumpHosts, err = instance.ParseJumpHosts(jumpHostsAnnotation); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on node %s: %w", JumpHostsAnnotation, node.Name, err)
+		}
+	}
+	instanceInfo.KeySecret = node.Annotations[KeySecretAnnotation]
+	if winRMAnnotation, present := node.Annotations[WinRMAnnotation]; present {
+		if instanceInfo.WinRM, err = instance.ParseWinRM(winRMAnnotation); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on node %s: %w", WinRMAnnotation, node.Name, err)
+		}
+	}
+	if machineAnnotation, present := node.Annotations[MachineAnnotation]; present && node.Labels[BYOHLabel] != "true" {
+		// The annotation value is in the form <namespace>/<name>
+		instanceInfo.MachineName = machineAnnotation[strings.LastIndex(machineAnnotation, "/")+1:]
+	}
+	return instanceInfo, nil
+}
+
+// signerFor returns the signer used to SSH into the given instance. Instances without a key Secret of their own are
+// accessed with the signer created from the cloud private key.
+func (r *instanceReconciler) signerFor(ctx context.Context, instanceInfo *instance.Info) (ssh.Signer, error) {
+	if instanceInfo.KeySecret == "" && r.signer != nil {
+		return r.signer, nil
+	}
+	return signer.ForInstance(ctx, r.client, r.watchNamespace, instanceInfo)
 }
 
 // updateKubeletCA updates the kubelet CA in the node, by copying the kubelet CA file content to the Windows instance
@@ -127,8 +286,12 @@ func (r *instanceReconciler) updateKubeletCA(ctx context.Context, node core.Node
 	if err != nil {
 		return fmt.Errorf("error creating instance for node %s: %w", node.Name, err)
 	}
+	instanceSigner, err := r.signerFor(ctx, winInstance)
+	if err != nil {
+		return err
+	}
 	nodeConfig, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR,
-		r.watchNamespace, winInstance, r.signer, nil, nil, r.platform)
+		r.watchNamespace, winInstance, instanceSigner, nil, nil, r.platform)
 	if err != nil {
 		return fmt.Errorf("error creating nodeConfig for instance %s: %w", winInstance.Address, err)
 	}
@@ -151,15 +314,20 @@ func GetAddress(addresses []core.NodeAddress) (string, error) {
 	return "", fmt.Errorf("no usable address")
 }
 
-// deconfigureInstance deconfigures the instance associated with the given node, removing the node from the cluster.
+// deconfigureInstance deconfigures the instance associated with the given node, removing the node from the cluster
+// and unpinning the instance's host key.
 func (r *instanceReconciler) deconfigureInstance(ctx context.Context, node *core.Node) error {
 	instance, err := r.instanceFromNode(ctx, node)
 	if err != nil {
 		return fmt.Errorf("unable to create instance object from node: %w", err)
 	}
+	instanceSigner, err := r.signerFor(ctx, instance)
+	if err != nil {
+		return err
+	}
 
 	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-		instance, r.signer, nil, nil, r.platform)
+		instance, instanceSigner, nil, nil, r.platform)
 	if err != nil {
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
@@ -170,9 +338,26 @@ func (r *instanceReconciler) deconfigureInstance(ctx context.Context, node *core
 	if err = r.client.Delete(ctx, instance.Node); err != nil {
 		return fmt.Errorf("error deleting node %s: %w", instance.Node.GetName(), err)
 	}
+	// The instance is no longer managed, so its host key should not be enforced if it is added back after a rebuild
+	if err = secrets.NewHostKeyStore(r.client, r.watchNamespace).Unpin(ctx, instance.HostKeyID()); err != nil {
+		return fmt.Errorf("error unpinning host key of instance %s: %w", instance.Address, err)
+	}
 	return nil
 }
 
+// recordHostKeyMismatch emits a warning event on the given object if err was caused by an instance presenting an SSH
+// host key that does not match the host key pinned for it
+func (r *instanceReconciler) recordHostKeyMismatch(object runtime.Object, err error) {
+	var mismatchErr *windows.HostKeyMismatchErr
+	if !errors.As(err, &mismatchErr) {
+		return
+	}
+	r.recorder.Eventf(object, core.EventTypeWarning, "HostKeyMismatch",
+		"Instance %s presented SSH host key %s, which does not match the pinned host key %s. If the host key change "+
+			"is expected, remove the %s entry from the %s secret", mismatchErr.Address, mismatchErr.Presented,
+		mismatchErr.Pinned, mismatchErr.ID, secrets.HostKeysSecret)
+}
+
 // windowsNodeVersionChangePredicate returns a predicate whose filter catches Windows nodes that indicate a version
 // change either through deletion away from an old version or creation/update to the latest WMCO version
 func windowsNodeVersionChangePredicate() predicate.Funcs {
@@ -208,7 +393,12 @@ func outdatedWindowsNodePredicate(byoh bool) predicate.Funcs {
 				e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get()
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
-			if !isValidWindowsNode(e.ObjectNew, byoh) {
+			if !isValidWindowsNode(e.ObjectNew, byoh) || isPhaseAnnotationUpdate(e) || isWICDStatusUpdate(e) {
+				return false
+			}
+			// Nodes rolled back after a failed upgrade are left as is until their rolled-back-from annotation is
+			// removed
+			if node, ok := e.ObjectNew.(*core.Node); ok && upgrade.IsRolledBack(node) {
 				return false
 			}
 			if e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation] != version.Get() ||
@@ -229,13 +419,56 @@ func outdatedWindowsNodePredicate(byoh bool) predicate.Funcs {
 
 }
 
-// getVersionAnnotations returns a map whose keys are the WMCO versions that have configured any Windows nodes
+// isPhaseAnnotationUpdate returns true if the given update event only changed the configuration phase annotations of
+// the object. These updates are made while an instance is being configured, and should not trigger a reconcile.
+func isPhaseAnnotationUpdate(e event.UpdateEvent) bool {
+	return isAnnotationOnlyUpdate(e, []string{metadata.PhaseAnnotation, metadata.PhaseTimeAnnotation,
+		metadata.PhaseErrorAnnotation})
+}
+
+// isWICDStatusUpdate returns true if the given update event only changed the WICD status annotation of the object.
+// These updates are made each time WICD reconciles the node, and should not trigger a reconcile.
+func isWICDStatusUpdate(e event.UpdateEvent) bool {
+	return isAnnotationOnlyUpdate(e, []string{metadata.WICDStatusAnnotation})
+}
+
+// isAnnotationOnlyUpdate returns true if the given update event changed any of the given annotations of the object,
+// and nothing else
+func isAnnotationOnlyUpdate(e event.UpdateEvent, annotations []string) bool {
+	changed := false
+	for _, annotation := range annotations {
+		if e.ObjectOld.GetAnnotations()[annotation] != e.ObjectNew.GetAnnotations()[annotation] {
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	oldObj := e.ObjectOld.DeepCopyObject().(client.Object)
+	newObj := e.ObjectNew.DeepCopyObject().(client.Object)
+	for _, obj := range []client.Object{oldObj, newObj} {
+		objAnnotations := obj.GetAnnotations()
+		for _, annotation := range annotations {
+			delete(objAnnotations, annotation)
+		}
+		obj.SetAnnotations(objAnnotations)
+		obj.SetResourceVersion("")
+		obj.SetManagedFields(nil)
+	}
+	return equality.Semantic.DeepEqual(oldObj, newObj)
+}
+
+// getVersionAnnotations returns a map whose keys are the WMCO versions that have configured any Windows nodes, or that
+// upgrading Windows nodes would be rolled back to
 func getVersionAnnotations(nodes []core.Node) map[string]struct{} {
 	versions := make(map[string]struct{})
 	for _, node := range nodes {
 		if versionAnnotation, present := node.Annotations[metadata.VersionAnnotation]; present {
 			versions[versionAnnotation] = struct{}{}
 		}
+		if rollbackVersion, present := node.Annotations[metadata.RollbackVersionAnnotation]; present {
+			versions[rollbackVersion] = struct{}{}
+		}
 	}
 	return versions
 }
@@ -264,37 +497,41 @@ func markAsFreeOnSuccess(ctx context.Context, c client.Client, watchNamespace st
 	return err
 }
 
-// markNodeAsUpgrading marks the given node as upgrading by adding an annotation to it. If the number of nodes
-// performing upgrades in parallel exceeds the maximum allowed, an error is returned
+// markNodeAsUpgrading marks the given node as upgrading by adding a label to it, and annotates it if it upgrades as a
+// canary. If the upgrade strategy of the
+// OperatorConfig does not allow the node to start upgrading yet, an error is returned
 func markNodeAsUpgrading(ctx context.Context, c client.Client, currentNode *core.Node) error {
 	controllerLocker.Lock()
 	defer controllerLocker.Unlock()
-	upgradingNodes, err := findUpgradingNodes(ctx, c)
+	settings, err := operatorconfig.Get(ctx, c)
 	if err != nil {
 		return err
 	}
-	// check if current node is already marked as upgrading
-	for _, node := range upgradingNodes.Items {
-		if node.Name == currentNode.Name {
-			// current node is upgrading, continue with it
-			return nil
-		}
+	nodes := &core.NodeList{}
+	if err := c.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return fmt.Errorf("error listing Windows nodes: %w", err)
 	}
-	if len(upgradingNodes.Items) >= MaxParallelUpgrades {
-		return fmt.Errorf("cannot mark node %s as upgrading, maximum number of parallel upgrading nodes reached (%d)",
-			currentNode.Name, MaxParallelUpgrades)
+	canary, err := upgrade.CanStart(currentNode, nodes.Items, settings, isBYOHNode)
+	if err != nil {
+		return err
+	}
+	// Canaries are recorded on the node, so that the canary set does not change as nodes are upgraded
+	canaryFor := ""
+	if canary {
+		canaryFor = version.Get()
 	}
-	return metadata.ApplyUpgradingLabel(ctx, c, currentNode)
+	return metadata.ApplyUpgradingLabel(ctx, c, currentNode, canaryFor)
+}
+
+// isBYOHNode returns true if the given node is a BYOH node
+func isBYOHNode(node *core.Node) bool {
+	return node.GetLabels()[BYOHLabel] == "true"
 }
 
-// findUpgradingNodes returns a pointer to the resulting list of Windows nodes that are upgrading  i.e. have the
-// upgrading label set to true
-func findUpgradingNodes(ctx context.Context, c client.Client) (*core.NodeList, error) {
-	// get nodes Windows nodes with upgrading label
-	matchingLabels := client.MatchingLabels{core.LabelOSStable: "windows", metadata.UpgradingLabel: "true"}
-	nodeList := &core.NodeList{}
-	if err := c.List(ctx, nodeList, matchingLabels); err != nil {
-		return nil, fmt.Errorf("error listing Windows nodes with upgrading label: %w", err)
+// configurationType returns the type label value of the configuration metrics of the given instance
+func configurationType(instanceInfo *instance.Info) string {
+	if instanceInfo.MachineName == "" {
+		return metrics.TypeBYOH
 	}
-	return nodeList, nil
+	return metrics.TypeMachine
 }
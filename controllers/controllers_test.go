@@ -6,6 +6,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/version"
 )
 
 func TestGetAddress(t *testing.T) {
@@ -62,3 +67,152 @@ func TestGetAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestIsPhaseAnnotationUpdate(t *testing.T) {
+	node := func(resourceVersion string, annotations map[string]string, unschedulable bool) *core.Node {
+		return &core.Node{
+			ObjectMeta: meta.ObjectMeta{Name: "node", ResourceVersion: resourceVersion, Annotations: annotations},
+			Spec:       core.NodeSpec{Unschedulable: unschedulable},
+		}
+	}
+	testCases := []struct {
+		name        string
+		old         *core.Node
+		new         *core.Node
+		expectedOut bool
+	}{
+		{
+			name:        "no change",
+			old:         node("1", nil, false),
+			new:         node("1", nil, false),
+			expectedOut: false,
+		},
+		{
+			name:        "phase annotation added",
+			old:         node("1", nil, false),
+			new:         node("2", map[string]string{metadata.PhaseAnnotation: "Bootstrapping"}, false),
+			expectedOut: true,
+		},
+		{
+			name: "phase annotation changed",
+			old:  node("1", map[string]string{metadata.PhaseAnnotation: "Bootstrapping", "a": "b"}, false),
+			new: node("2", map[string]string{metadata.PhaseAnnotation: "Failed",
+				metadata.PhaseErrorAnnotation: "Bootstrapping: error", "a": "b"}, false),
+			expectedOut: true,
+		},
+		{
+			name:        "other annotation changed",
+			old:         node("1", map[string]string{metadata.PhaseAnnotation: "Bootstrapping"}, false),
+			new:         node("2", map[string]string{metadata.PhaseAnnotation: "Ready", "a": "b"}, false),
+			expectedOut: false,
+		},
+		{
+			name:        "spec changed",
+			old:         node("1", map[string]string{metadata.PhaseAnnotation: "Bootstrapping"}, true),
+			new:         node("2", map[string]string{metadata.PhaseAnnotation: "Ready"}, false),
+			expectedOut: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out := isPhaseAnnotationUpdate(event.UpdateEvent{ObjectOld: test.old, ObjectNew: test.new})
+			assert.Equal(t, test.expectedOut, out)
+		})
+	}
+}
+
+func TestIsWICDStatusUpdate(t *testing.T) {
+	node := func(resourceVersion string, annotations map[string]string) *core.Node {
+		return &core.Node{
+			ObjectMeta: meta.ObjectMeta{Name: "node", ResourceVersion: resourceVersion, Annotations: annotations},
+		}
+	}
+	testCases := []struct {
+		name        string
+		old         *core.Node
+		new         *core.Node
+		expectedOut bool
+	}{
+		{
+			name:        "status changed",
+			old:         node("1", map[string]string{metadata.WICDStatusAnnotation: "{}"}),
+			new:         node("2", map[string]string{metadata.WICDStatusAnnotation: `{"lastError":"error"}`}),
+			expectedOut: true,
+		},
+		{
+			name: "version changed along with status",
+			old:  node("1", map[string]string{metadata.WICDStatusAnnotation: "{}"}),
+			new: node("2", map[string]string{metadata.WICDStatusAnnotation: `{"desiredVersion":"2"}`,
+				metadata.VersionAnnotation: "2"}),
+			expectedOut: false,
+		},
+		{
+			name:        "phase changed",
+			old:         node("1", nil),
+			new:         node("2", map[string]string{metadata.PhaseAnnotation: "Ready"}),
+			expectedOut: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out := isWICDStatusUpdate(event.UpdateEvent{ObjectOld: test.old, ObjectNew: test.new})
+			assert.Equal(t, test.expectedOut, out)
+		})
+	}
+}
+
+func TestGetVersionAnnotations(t *testing.T) {
+	node := func(annotations map[string]string) core.Node {
+		return core.Node{ObjectMeta: meta.ObjectMeta{Annotations: annotations}}
+	}
+	nodes := []core.Node{
+		node(nil),
+		node(map[string]string{metadata.VersionAnnotation: "1.0.0"}),
+		node(map[string]string{metadata.VersionAnnotation: "1.0.0"}),
+		// A node being upgraded has no version annotation, but may be rolled back to its previous version
+		node(map[string]string{metadata.RollbackVersionAnnotation: "0.9.0"}),
+		node(map[string]string{metadata.VersionAnnotation: "1.1.0", metadata.RolledBackAnnotation: "1.2.0"}),
+	}
+	assert.Equal(t, map[string]struct{}{"1.0.0": {}, "0.9.0": {}, "1.1.0": {}}, getVersionAnnotations(nodes))
+}
+
+func TestOutdatedWindowsNodePredicate(t *testing.T) {
+	node := func(resourceVersion string, annotations map[string]string) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", ResourceVersion: resourceVersion,
+			Labels: map[string]string{core.LabelOSStable: "windows"}, Annotations: annotations}}
+	}
+	rolledBack := map[string]string{metadata.VersionAnnotation: "previous",
+		metadata.RolledBackAnnotation: version.Get()}
+	testCases := []struct {
+		name        string
+		old         *core.Node
+		new         *core.Node
+		expectedOut bool
+	}{
+		{
+			name:        "outdated node updated",
+			old:         node("1", map[string]string{metadata.VersionAnnotation: "previous"}),
+			new:         node("2", map[string]string{metadata.VersionAnnotation: "previous"}),
+			expectedOut: true,
+		},
+		{
+			name:        "rolled back node updated",
+			old:         node("1", rolledBack),
+			new:         node("2", rolledBack),
+			expectedOut: false,
+		},
+		{
+			name:        "rolled back annotation removed",
+			old:         node("1", rolledBack),
+			new:         node("2", map[string]string{metadata.VersionAnnotation: "previous"}),
+			expectedOut: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out := outdatedWindowsNodePredicate(false).Update(event.UpdateEvent{ObjectOld: test.old,
+				ObjectNew: test.new})
+			assert.Equal(t, test.expectedOut, out)
+		})
+	}
+}
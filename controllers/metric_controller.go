@@ -82,8 +82,8 @@ func (r *metricReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 	if !enabled {
 		return ctrl.Result{}, nil
 	}
-	if err := r.ensureServiceMonitor(ctx); err != nil {
-		return ctrl.Result{}, fmt.Errorf("error ensuring serviceMonitor exists: %w", err)
+	if err := r.ensureServiceMonitors(ctx); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error ensuring serviceMonitors exist: %w", err)
 	}
 	return ctrl.Result{}, nil
 }
@@ -118,21 +118,52 @@ func (r *metricReconciler) validate(ctx context.Context) (bool, error) {
 	return r.monitoringEnabled, nil
 }
 
-// ensureServiceMonitor creates a serviceMonitor object in the operator namespace if it does not exist.
-func (r *metricReconciler) ensureServiceMonitor(ctx context.Context) error {
+// ensureServiceMonitors creates the serviceMonitor objects scraping the Windows nodes and the operator in the operator
+// namespace if they do not exist.
+func (r *metricReconciler) ensureServiceMonitors(ctx context.Context) error {
+	if err := r.ensureServiceMonitor(ctx, r.windowsNodesServiceMonitor()); err != nil {
+		return err
+	}
+	return r.ensureServiceMonitor(ctx, r.operatorServiceMonitor())
+}
+
+// ensureServiceMonitor creates the given serviceMonitor object in the operator namespace if it does not exist, and
+// recreates it if its spec differs from the given one.
+func (r *metricReconciler) ensureServiceMonitor(ctx context.Context, expectedSM *monv1.ServiceMonitor) error {
 	// get existing serviceMonitor object if it exists
-	existingSM, err := r.ServiceMonitors(r.watchNamespace).Get(ctx, metrics.WindowsMetricsResource, metav1.GetOptions{})
+	existingSM, err := r.ServiceMonitors(r.watchNamespace).Get(ctx, expectedSM.Name, metav1.GetOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf(
-			"error retrieving %s serviceMonitor: %w", metrics.WindowsMetricsResource, err)
+			"error retrieving %s serviceMonitor: %w", expectedSM.Name, err)
 	}
 
+	if err == nil {
+		// check if existing serviceMonitor's contents are as expected, delete it if not
+		if existingSM.Name == expectedSM.Name && existingSM.Namespace == expectedSM.Namespace &&
+			reflect.DeepEqual(existingSM.Spec, expectedSM.Spec) {
+			return nil
+		}
+		err = r.ServiceMonitors(r.watchNamespace).Delete(ctx, expectedSM.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to delete service monitor %s/%s: %w", r.watchNamespace, expectedSM.Name, err)
+		}
+		r.log.Info("Deleted malformed resource", "serviceMonitor", expectedSM.Name,
+			"namespace", r.watchNamespace)
+	}
+
+	_, err = r.ServiceMonitors(r.watchNamespace).Create(ctx, expectedSM, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating service monitor %s: %w", expectedSM.Name, err)
+	}
+	return nil
+}
+
+// windowsNodesServiceMonitor returns the serviceMonitor scraping windows-exporter and WICD on the Windows nodes
+func (r *metricReconciler) windowsNodesServiceMonitor() *monv1.ServiceMonitor {
+	// WICD serves its metrics with the same certificate as windows-exporter
 	serverName := fmt.Sprintf("%s.%s.svc", metrics.WindowsMetricsResource, r.watchNamespace)
-	replacement0 := "$1"
-	replacement1 := "$1:9182"
-	replacement2 := metrics.WindowsMetricsResource
 	attachMetadataBool := true
-	expectedSM := &monv1.ServiceMonitor{
+	return &monv1.ServiceMonitor{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      metrics.WindowsMetricsResource,
 			Namespace: r.watchNamespace,
@@ -144,12 +175,41 @@ func (r *metricReconciler) ensureServiceMonitor(ctx context.Context) error {
 			AttachMetadata: &monv1.AttachMetadata{
 				Node: &attachMetadataBool,
 			},
+			Endpoints: []monv1.Endpoint{
+				windowsNodeEndpoint(metrics.Port, metrics.WindowsMetricsResource, serverName),
+				windowsNodeEndpoint(metrics.WICDPort, metrics.WICDJob, serverName),
+			},
+			NamespaceSelector: monv1.NamespaceSelector{
+				MatchNames: []string{"kube-system"},
+			},
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"k8s-app": "kubelet",
+				},
+			},
+		},
+	}
+}
+
+// operatorServiceMonitor returns the serviceMonitor scraping the metrics of the operator itself through its metrics
+// Service
+func (r *metricReconciler) operatorServiceMonitor() *monv1.ServiceMonitor {
+	// the operator serves its metrics with the same certificate as windows-exporter
+	serverName := fmt.Sprintf("%s.%s.svc", metrics.WindowsMetricsResource, r.watchNamespace)
+	return &monv1.ServiceMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      metrics.OperatorMetricsResource,
+			Namespace: r.watchNamespace,
+			Labels: map[string]string{
+				"name": metrics.OperatorMetricsResource,
+			},
+		},
+		Spec: monv1.ServiceMonitorSpec{
 			Endpoints: []monv1.Endpoint{
 				{
-					HonorLabels:     true,
 					Interval:        "30s",
 					Path:            "/metrics",
-					Port:            "https-metrics",
+					Port:            metrics.OperatorPortName,
 					Scheme:          "https",
 					BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
 					TLSConfig: &monv1.TLSConfig{
@@ -158,72 +218,71 @@ func (r *metricReconciler) ensureServiceMonitor(ctx context.Context) error {
 							ServerName: &serverName,
 						},
 					},
-					RelabelConfigs: []monv1.RelabelConfig{
-						{
-							Action:      "replace",
-							Regex:       "(.*)",
-							Replacement: &replacement0,
-							TargetLabel: "instance",
-							SourceLabels: []monv1.LabelName{
-								"__meta_kubernetes_endpoint_address_target_name",
-							},
-						},
-						{ // Include only Windows nodes for this serviceMonitor
-							Action: "keep",
-							Regex:  "windows",
-							SourceLabels: []monv1.LabelName{
-								"__meta_kubernetes_node_label_kubernetes_io_os",
-							},
-						},
-						{ // Change the port from the kubelet port 10250 to 9182
-							Action:      "replace",
-							Regex:       "(.+)(?::\\d+)",
-							Replacement: &replacement1,
-							TargetLabel: "__address__",
-							SourceLabels: []monv1.LabelName{
-								"__address__",
-							},
-						},
-						{ // Update the job label from kubelet to windows-exporter
-							Action:      "replace",
-							Replacement: &replacement2,
-							TargetLabel: "job",
-						},
-					},
 				},
 			},
 			NamespaceSelector: monv1.NamespaceSelector{
-				MatchNames: []string{"kube-system"},
+				MatchNames: []string{r.watchNamespace},
 			},
 			Selector: metav1.LabelSelector{
 				MatchLabels: map[string]string{
-					"k8s-app": "kubelet",
+					"name": metrics.OperatorMetricsResource,
 				},
 			},
 		},
 	}
+}
 
-	if err == nil {
-		// check if existing serviceMonitor's contents are as expected, delete it if not
-		if existingSM.Name == expectedSM.Name && existingSM.Namespace == expectedSM.Namespace &&
-			reflect.DeepEqual(existingSM.Spec, expectedSM.Spec) {
-			return nil
-		}
-		err = r.ServiceMonitors(r.watchNamespace).Delete(ctx, metrics.WindowsMetricsResource,
-			metav1.DeleteOptions{})
-		if err != nil {
-			return fmt.Errorf("unable to delete service monitor %s/%s: %w", r.watchNamespace, metrics.WindowsMetricsResource,
-				err)
-		}
-		r.log.Info("Deleted malformed resource", "serviceMonitor", metrics.WindowsMetricsResource,
-			"namespace", r.watchNamespace)
-	}
-
-	_, err = r.ServiceMonitors(r.watchNamespace).Create(ctx, expectedSM, metav1.CreateOptions{})
-	if err != nil {
-		return fmt.Errorf("error creating service monitor: %w", err)
+// windowsNodeEndpoint returns an endpoint scraping the given port of the Windows nodes selected through the kubelet
+// service, over TLS with the given server name. The metrics scraped are given the given job label.
+func windowsNodeEndpoint(port int32, job, serverName string) monv1.Endpoint {
+	replacement0 := "$1"
+	replacement1 := fmt.Sprintf("$1:%d", port)
+	return monv1.Endpoint{
+		HonorLabels:     true,
+		Interval:        "30s",
+		Path:            "/metrics",
+		Port:            "https-metrics",
+		Scheme:          "https",
+		BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+		TLSConfig: &monv1.TLSConfig{
+			CAFile: "/etc/prometheus/configmaps/serving-certs-ca-bundle/service-ca.crt",
+			SafeTLSConfig: monv1.SafeTLSConfig{
+				ServerName: &serverName,
+			},
+		},
+		RelabelConfigs: []monv1.RelabelConfig{
+			{
+				Action:      "replace",
+				Regex:       "(.*)",
+				Replacement: &replacement0,
+				TargetLabel: "instance",
+				SourceLabels: []monv1.LabelName{
+					"__meta_kubernetes_endpoint_address_target_name",
+				},
+			},
+			{ // Include only Windows nodes for this serviceMonitor
+				Action: "keep",
+				Regex:  "windows",
+				SourceLabels: []monv1.LabelName{
+					"__meta_kubernetes_node_label_kubernetes_io_os",
+				},
+			},
+			{ // Change the port from the kubelet port 10250 to the given port
+				Action:      "replace",
+				Regex:       "(.+)(?::\\d+)",
+				Replacement: &replacement1,
+				TargetLabel: "__address__",
+				SourceLabels: []monv1.LabelName{
+					"__address__",
+				},
+			},
+			{ // Update the job label from kubelet to the given job
+				Action:      "replace",
+				Replacement: &job,
+				TargetLabel: "job",
+			},
+		},
 	}
-	return nil
 }
 
 // mapToWatchNamespace fulfills the MapFn type, while always returning a request to the operator watch namespace
@@ -23,7 +23,6 @@ import (
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -35,8 +34,7 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
-	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
-	"github.com/openshift/windows-machine-config-operator/pkg/signer"
+	"github.com/openshift/windows-machine-config-operator/version"
 )
 
 const (
@@ -93,27 +91,45 @@ func (r *nodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (resul
 		return ctrl.Result{}, err
 	}
 
-	if _, ok := node.GetAnnotations()[metadata.RebootAnnotation]; ok {
-		// Create a new signer using the private key that the instances will be reconciled with
-		signer, err := signer.Create(ctx, types.NamespacedName{Namespace: r.watchNamespace,
-			Name: secrets.PrivateKeySecret}, r.client)
-		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
-		}
-		instanceInfo, err := r.instanceFromNode(ctx, node)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-			instanceInfo, signer, nil, nil, r.platform)
-		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
-		}
+	_, rebootRequired := node.GetAnnotations()[metadata.RebootAnnotation]
+	_, repairRequired := node.GetAnnotations()[metadata.RepairAnnotation]
+	if !rebootRequired && !repairRequired {
+		return ctrl.Result{}, nil
+	}
+	// The payload of this operator version only matches the files of the nodes it configured. The files of other nodes
+	// are replaced as they are upgraded.
+	if !rebootRequired && node.GetAnnotations()[metadata.VersionAnnotation] != version.Get() {
+		r.log.Info("deferring payload repair until the node is upgraded")
+		return ctrl.Result{}, nil
+	}
 
+	instanceInfo, err := r.instanceFromNode(ctx, node)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Create a new signer using the private key that the instance will be reconciled with
+	instanceSigner, err := r.signerFor(ctx, instanceInfo)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
+		instanceInfo, instanceSigner, nil, nil, r.platform)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
+	}
+
+	if rebootRequired {
 		if err := nc.SafeReboot(ctx); err != nil {
 			return ctrl.Result{}, fmt.Errorf("full instance reboot failed: %w", err)
 		}
+		return ctrl.Result{}, nil
+	}
+	if err := nc.RepairPayload(ctx); err != nil {
+		r.recorder.Eventf(node, core.EventTypeWarning, "PayloadRepairFailed",
+			"failed to repair the payload files of the instance: %s", err)
+		return ctrl.Result{}, fmt.Errorf("payload repair failed: %w", err)
 	}
+	r.recorder.Event(node, core.EventTypeNormal, "PayloadRepaired", "payload files of the instance have been repaired")
 	return ctrl.Result{}, nil
 }
 
@@ -0,0 +1,217 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
+	"github.com/openshift/windows-machine-config-operator/pkg/upgrade"
+)
+
+//+kubebuilder:rbac:groups=windowsmachineconfig.openshift.io,resources=operatorconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=windowsmachineconfig.openshift.io,resources=operatorconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+const (
+	// OperatorConfigController is the name of this controller in logs and other outputs.
+	OperatorConfigController = "operatorconfig"
+)
+
+// OperatorConfigReconciler applies the settings held in the OperatorConfig singleton to the running operator
+type OperatorConfigReconciler struct {
+	client client.Client
+	log    logr.Logger
+	// logLevel is the level of the operator logger, which is changed when debug logging is toggled
+	logLevel zap.AtomicLevel
+	// debugLoggingFlag is the value of the --debugLogging flag. When set, debug logging cannot be turned off.
+	debugLoggingFlag bool
+}
+
+// NewOperatorConfigReconciler returns a pointer to a new OperatorConfigReconciler
+func NewOperatorConfigReconciler(mgr manager.Manager, logLevel zap.AtomicLevel,
+	debugLoggingFlag bool) *OperatorConfigReconciler {
+	return &OperatorConfigReconciler{
+		client:           mgr.GetClient(),
+		log:              ctrl.Log.WithName("controllers").WithName(OperatorConfigController),
+		logLevel:         logLevel,
+		debugLoggingFlag: debugLoggingFlag,
+	}
+}
+
+// Reconcile applies the settings described by the OperatorConfig, or the default settings if it does not exist. The
+// state of the upgrade of the Windows nodes is published in the OperatorConfig status.
+func (r *OperatorConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	config := &wmcov1.OperatorConfig{}
+	err := r.client.Get(ctx, req.NamespacedName, config)
+	if err != nil && !k8sapierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	found := err == nil
+	settings := operatorconfig.Defaults()
+	if found {
+		settings = operatorconfig.FromSpec(&config.Spec)
+	}
+	r.apply(settings)
+
+	nodes := &core.NodeList{}
+	if err = r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	rollout, err := upgrade.GetRollout(nodes.Items, settings, isBYOHNode, time.Now())
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to determine the upgrade state of the Windows nodes: %w", err)
+	}
+	// The upgrade progress is published even when there is no OperatorConfig to hold it in its status
+	metrics.RecordRollout(rollout.Reason, rollout.Outdated)
+	metrics.RecordNodeVersions(nodes.Items)
+	// The soak period of canary nodes ends without any object changing
+	result := ctrl.Result{RequeueAfter: rollout.RequeueAfter}
+	if !found {
+		return result, nil
+	}
+
+	patchBase := client.MergeFrom(config.DeepCopy())
+	original := config.Status.DeepCopy()
+	config.Status.ObservedGeneration = config.GetGeneration()
+	apimeta.SetStatusCondition(&config.Status.Conditions, meta.Condition{
+		Type:               wmcov1.OperatorConfigAppliedCondition,
+		Status:             meta.ConditionTrue,
+		Reason:             "Applied",
+		Message:            fmt.Sprintf("generation %d applied", config.GetGeneration()),
+		ObservedGeneration: config.GetGeneration(),
+	})
+	progressing := meta.ConditionFalse
+	if rollout.Progressing() {
+		progressing = meta.ConditionTrue
+	}
+	apimeta.SetStatusCondition(&config.Status.Conditions, meta.Condition{
+		Type:               wmcov1.UpgradeProgressingCondition,
+		Status:             progressing,
+		Reason:             rollout.Reason,
+		Message:            rollout.Message,
+		ObservedGeneration: config.GetGeneration(),
+	})
+	if equality.Semantic.DeepEqual(original, &config.Status) {
+		return result, nil
+	}
+	if err = r.client.Status().Patch(ctx, config, patchBase); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to update OperatorConfig status: %w", err)
+	}
+	previous := apimeta.FindStatusCondition(original.Conditions, wmcov1.UpgradeProgressingCondition)
+	if previous == nil || previous.Reason != rollout.Reason {
+		r.log.Info("Windows node upgrade state changed", "reason", rollout.Reason, "message", rollout.Message)
+	}
+	return result, nil
+}
+
+// apply makes the given settings take effect
+func (r *OperatorConfigReconciler) apply(settings operatorconfig.Settings) {
+	retry.Set(settings.Retry)
+	level := zapcore.InfoLevel
+	if settings.DebugLogging || r.debugLoggingFlag {
+		level = zapcore.DebugLevel
+	}
+	if r.logLevel.Level() != level {
+		r.log.Info("changing log level", "level", level.String())
+		r.logLevel.SetLevel(level)
+	}
+	r.log.V(1).Info("applied operator settings", "settings", settings)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *OperatorConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	singletonPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return object.GetName() == wmcov1.OperatorConfigName
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&wmcov1.OperatorConfig{}, builder.WithPredicates(singletonPredicate,
+			predicate.GenerationChangedPredicate{})).
+		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(mapToOperatorConfig),
+			builder.WithPredicates(upgradeStateChangePredicate())).
+		Complete(r)
+}
+
+// mapToOperatorConfig fulfills the MapFn type, while always returning a request to the OperatorConfig singleton
+func mapToOperatorConfig(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: kubeTypes.NamespacedName{Name: wmcov1.OperatorConfigName}}}
+}
+
+// upgradeStateChangePredicate returns a predicate whose filter catches changes to Windows nodes that affect the state
+// of the upgrade rollout: their version, configuration phase, upgrading label and readiness
+func upgradeStateChangePredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if !isWindowsNode(e.ObjectNew) {
+				return false
+			}
+			for _, annotation := range []string{metadata.VersionAnnotation, metadata.PhaseAnnotation,
+				metadata.PhaseTimeAnnotation} {
+				if e.ObjectOld.GetAnnotations()[annotation] != e.ObjectNew.GetAnnotations()[annotation] {
+					return true
+				}
+			}
+			oldNode, oldOK := e.ObjectOld.(*core.Node)
+			newNode, newOK := e.ObjectNew.(*core.Node)
+			return e.ObjectOld.GetLabels()[metadata.UpgradingLabel] != e.ObjectNew.GetLabels()[metadata.UpgradingLabel] ||
+				(oldOK && newOK && isNodeReady(oldNode) != isNodeReady(newNode))
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+	}
+}
+
+// isNodeReady returns true if the given node has the Ready condition set to True
+func isNodeReady(node *core.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == core.NodeReady {
+			return condition.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
@@ -110,8 +110,12 @@ func (r *registryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (r
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("unable to create instance object from node: %w", err)
 		}
+		instanceSigner, err := r.signerFor(ctx, winInstance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-			winInstance, r.signer, nil, nil, r.platform)
+			winInstance, instanceSigner, nil, nil, r.platform)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
 		}
@@ -113,10 +113,26 @@ func (r *SecretReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manage
 			return false
 		},
 	})
+	keySecretPredicate := builder.WithPredicates(predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isInstanceKeySecret(e.Object, r.watchNamespace)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// get update event only when the private key is changed
+			return isInstanceKeySecret(e.ObjectNew, r.watchNamespace) &&
+				string(e.ObjectOld.(*core.Secret).Data[secrets.PrivateKeySecretKey]) !=
+					string(e.ObjectNew.(*core.Secret).Data[secrets.PrivateKeySecretKey])
+		},
+	})
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&core.Secret{}, secretPredicate).
 		Watches(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapToPrivateKeySecret),
 			mappingPredicate).
+		Watches(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapToInstanceKeySecret),
+			keySecretPredicate).
 		Complete(r)
 }
 
@@ -135,6 +151,13 @@ func isTlsSecret(obj client.Object, keyNamespace string) bool {
 	return obj.GetName() == secrets.TLSSecret && obj.GetNamespace() == keyNamespace
 }
 
+// isInstanceKeySecret returns true if the provided object is a secret in the given namespace which may hold the private
+// key of BYOH instances
+func isInstanceKeySecret(obj client.Object, keyNamespace string) bool {
+	return obj.GetNamespace() == keyNamespace && !isPrivateKeySecret(obj, keyNamespace) &&
+		!isTlsSecret(obj, keyNamespace)
+}
+
 // SecretReconciler is used to create a controller which manages Secret objects
 type SecretReconciler struct {
 	scheme *runtime.Scheme
@@ -165,10 +188,14 @@ func (r *SecretReconciler) Reconcile(ctx context.Context,
 		return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
 	}
 
-	if request.NamespacedName.Name == secrets.TLSSecret {
+	switch request.NamespacedName.Name {
+	case secrets.TLSSecret:
 		return ctrl.Result{}, r.reconcileTLSSecret(ctx)
+	case secrets.PrivateKeySecret:
+		return ctrl.Result{}, r.reconcileUserDataSecret(ctx)
+	default:
+		return ctrl.Result{}, r.reconcileInstanceKeySecret(ctx, request.NamespacedName.Name)
 	}
-	return ctrl.Result{}, r.reconcileUserDataSecret(ctx)
 }
 
 func (r *SecretReconciler) reconcileUserDataSecret(ctx context.Context) error {
@@ -242,8 +269,12 @@ func (r *SecretReconciler) reconcileTLSSecret(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("unable to create instance object from node: %w", err)
 		}
+		instanceSigner, err := r.signerFor(ctx, winInstance)
+		if err != nil {
+			return err
+		}
 		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-			winInstance, r.signer, nil, nil, r.platform)
+			winInstance, instanceSigner, nil, nil, r.platform)
 		if err != nil {
 			return fmt.Errorf("failed to create new nodeconfig: %w", err)
 		}
@@ -263,7 +294,6 @@ func (r *SecretReconciler) updateUserData(ctx context.Context, keySigner ssh.Sig
 	}
 
 	// Modify annotations on nodes configured with the previous private key, if it has changed
-	expectedPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(keySigner.PublicKey())
 	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
 		Name: secrets.PrivateKeySecret}, r.client)
 	if err != nil {
@@ -272,20 +302,14 @@ func (r *SecretReconciler) updateUserData(ctx context.Context, keySigner ssh.Sig
 	for _, node := range nodes.Items {
 		annotationsToApply := make(map[string]string)
 		if _, present := node.GetLabels()[BYOHLabel]; present {
-			// Since the public key hash and username annotations are both dependent on the private key secret as well
-			// as applied and updated at the same time, checking one is enough to see if the private key is up to date
-			if node.Annotations[nodeconfig.PubKeyHashAnnotation] == expectedPubKeyAnno {
-				continue
-			}
-			// For BYOH nodes, update the username annotation and public key hash annotation using new private key
-			expectedUsernameAnnotation, err := r.getEncryptedUsername(ctx, node, privateKeyBytes)
+			// For BYOH nodes, update the username annotation and public key hash annotation which do not match the
+			// new private key, or the private key of the node's own key Secret
+			annotationsToApply, err = r.outdatedKeyAnnotations(ctx, node, keySigner, privateKeyBytes)
 			if err != nil {
-				return fmt.Errorf("unable to retrieve expected username annotation: %w", err)
+				return err
 			}
-
-			annotationsToApply = map[string]string{
-				UsernameAnnotation:              expectedUsernameAnnotation,
-				nodeconfig.PubKeyHashAnnotation: expectedPubKeyAnno,
+			if len(annotationsToApply) == 0 {
+				continue
 			}
 		} else {
 			// For Nodes associated with Machines, clear the public key annotation, as the clearing of the
@@ -309,6 +333,73 @@ func (r *SecretReconciler) updateUserData(ctx context.Context, keySigner ssh.Sig
 	return nil
 }
 
+// outdatedKeyAnnotations returns the annotations of the given BYOH node which depend on a private key and are not up to
+// date, with their expected values. The public key hash must match the private key used to SSH into the instance: the
+// one held by the node's key Secret, if any, else the cloud private key used by the given signer. The username must be
+// encrypted with the given cloud private key.
+func (r *SecretReconciler) outdatedKeyAnnotations(ctx context.Context, node core.Node, cloudSigner ssh.Signer,
+	cloudPrivateKey []byte) (map[string]string, error) {
+	annotations := make(map[string]string)
+	expectedPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(cloudSigner.PublicKey())
+	if keySecret := node.Annotations[KeySecretAnnotation]; keySecret != "" {
+		keySigner, err := signer.Create(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+			Name: keySecret}, r.client)
+		switch {
+		case k8sapierrors.IsNotFound(err):
+			// The public key hash is updated once the key Secret is created
+			expectedPubKeyAnno = node.Annotations[nodeconfig.PubKeyHashAnnotation]
+		case err != nil:
+			return nil, fmt.Errorf("unable to create signer from secret %s of node %s: %w", keySecret,
+				node.GetName(), err)
+		default:
+			expectedPubKeyAnno = nodeconfig.CreatePubKeyHashAnnotation(keySigner.PublicKey())
+		}
+	}
+	if node.Annotations[nodeconfig.PubKeyHashAnnotation] != expectedPubKeyAnno {
+		annotations[nodeconfig.PubKeyHashAnnotation] = expectedPubKeyAnno
+	}
+	if _, err := crypto.DecryptFromJSONString(node.Annotations[UsernameAnnotation], cloudPrivateKey); err != nil {
+		expectedUsernameAnnotation, err := r.getEncryptedUsername(ctx, node, cloudPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve expected username annotation: %w", err)
+		}
+		annotations[UsernameAnnotation] = expectedUsernameAnnotation
+	}
+	return annotations, nil
+}
+
+// reconcileInstanceKeySecret updates the public key hash annotation of the BYOH nodes whose instances are accessed with
+// the private key held by the key Secret with the given name
+func (r *SecretReconciler) reconcileInstanceKeySecret(ctx context.Context, name string) error {
+	keySigner, err := signer.Create(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace, Name: name}, r.client)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			// Secret was not found, could have been deleted after reconcile request.
+			return nil
+		}
+		return fmt.Errorf("unable to create signer from secret %s: %w", name, err)
+	}
+	expectedPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(keySigner.PublicKey())
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes,
+		client.MatchingLabels{core.LabelOSStable: "windows", BYOHLabel: "true"}); err != nil {
+		return fmt.Errorf("error getting node list: %w", err)
+	}
+	for _, node := range nodes.Items {
+		if node.Annotations[KeySecretAnnotation] != name ||
+			node.Annotations[nodeconfig.PubKeyHashAnnotation] == expectedPubKeyAnno {
+			continue
+		}
+		annotationsToApply := map[string]string{nodeconfig.PubKeyHashAnnotation: expectedPubKeyAnno}
+		if err := metadata.ApplyLabelsAndAnnotations(ctx, r.client, node, nil, annotationsToApply); err != nil {
+			return fmt.Errorf("error updating annotations on node %s: %w", node.GetName(), err)
+		}
+		r.log.Info("updated public key hash of node accessed with key secret", "node", node.GetName(),
+			"secret", name)
+	}
+	return nil
+}
+
 // getEncryptedUsername retrieves the username associated with a given node and ecrypts it using the given key
 func (r *SecretReconciler) getEncryptedUsername(ctx context.Context, node core.Node, key []byte) (string, error) {
 	// The instance ConfigMap is the source of truth linking BYOH nodes to their underlying instances
@@ -358,6 +449,25 @@ func (r *SecretReconciler) RemoveInvalidAnnotationsFromLinuxNodes(ctx context.Co
 	return nil
 }
 
+// mapToInstanceKeySecret is a mapping function that returns a request for the given secret if it is the key Secret of
+// any BYOH node
+func (r *SecretReconciler) mapToInstanceKeySecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes,
+		client.MatchingLabels{core.LabelOSStable: "windows", BYOHLabel: "true"}); err != nil {
+		r.log.Error(err, "error getting node list")
+		return nil
+	}
+	for _, node := range nodes.Items {
+		if node.Annotations[KeySecretAnnotation] == obj.GetName() {
+			return []reconcile.Request{
+				{NamespacedName: kubeTypes.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}},
+			}
+		}
+	}
+	return nil
+}
+
 // mapToPrivateKeySecret is a mapping function that will always return a request for the cloud private key secret
 func (r *SecretReconciler) mapToPrivateKeySecret(_ context.Context, _ client.Object) []reconcile.Request {
 	return []reconcile.Request{
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+)
+
+// newKeySecret returns a Secret with the given name holding a new private key, and the signer created from the key
+func newKeySecret(t *testing.T, name string) (*core.Secret, ssh.Signer) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	keySigner, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "test"},
+		Data:       map[string][]byte{secrets.PrivateKeySecretKey: pem.EncodeToMemory(block)},
+	}, keySigner
+}
+
+// byohNode returns a BYOH node with the given name, address and annotations
+func byohNode(name, address string, annotations map[string]string) *core.Node {
+	return &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: name, Annotations: annotations,
+			Labels: map[string]string{BYOHLabel: "true", core.LabelOSStable: "windows"}},
+		Status: core.NodeStatus{Addresses: []core.NodeAddress{{Address: address, Type: core.NodeInternalIP}}},
+	}
+}
+
+func TestReconcileInstanceKeySecret(t *testing.T) {
+	teamA, teamASigner := newKeySecret(t, "team-a")
+	teamB, teamBSigner := newKeySecret(t, "team-b")
+	_, oldSigner := newKeySecret(t, "old")
+	oldHash := nodeconfig.CreatePubKeyHashAnnotation(oldSigner.PublicKey())
+	teamBHash := nodeconfig.CreatePubKeyHashAnnotation(teamBSigner.PublicKey())
+	nodes := []*core.Node{
+		byohNode("a", "127.0.0.1",
+			map[string]string{KeySecretAnnotation: "team-a", nodeconfig.PubKeyHashAnnotation: oldHash}),
+		byohNode("b", "127.0.0.2",
+			map[string]string{KeySecretAnnotation: "team-b", nodeconfig.PubKeyHashAnnotation: teamBHash}),
+		byohNode("c", "127.0.0.3", map[string]string{nodeconfig.PubKeyHashAnnotation: oldHash}),
+	}
+	builder := clientfake.NewClientBuilder().WithObjects(teamA, teamB)
+	for _, node := range nodes {
+		builder = builder.WithObjects(node)
+	}
+	r := &SecretReconciler{
+		instanceReconciler: instanceReconciler{client: builder.Build(), log: logr.Discard(), watchNamespace: "test"},
+	}
+
+	require.NoError(t, r.reconcileInstanceKeySecret(context.Background(), "team-a"))
+	expectedHashes := map[string]string{
+		"a": nodeconfig.CreatePubKeyHashAnnotation(teamASigner.PublicKey()),
+		"b": teamBHash,
+		"c": oldHash,
+	}
+	for name, expectedHash := range expectedHashes {
+		node := &core.Node{}
+		require.NoError(t, r.client.Get(context.Background(), kubeTypes.NamespacedName{Name: name}, node))
+		assert.Equal(t, expectedHash, node.Annotations[nodeconfig.PubKeyHashAnnotation], name)
+	}
+
+	// A key Secret which does not exist is ignored
+	assert.NoError(t, r.reconcileInstanceKeySecret(context.Background(), "missing"))
+}
+
+func TestOutdatedKeyAnnotations(t *testing.T) {
+	cloudKey, cloudSigner := newKeySecret(t, secrets.PrivateKeySecret)
+	cloudPrivateKey := cloudKey.Data[secrets.PrivateKeySecretKey]
+	teamA, teamASigner := newKeySecret(t, "team-a")
+	oldKey, oldSigner := newKeySecret(t, "old")
+	cloudHash := nodeconfig.CreatePubKeyHashAnnotation(cloudSigner.PublicKey())
+	teamAHash := nodeconfig.CreatePubKeyHashAnnotation(teamASigner.PublicKey())
+	oldHash := nodeconfig.CreatePubKeyHashAnnotation(oldSigner.PublicKey())
+	username, err := crypto.EncryptToJSONString("core", cloudPrivateKey)
+	require.NoError(t, err)
+	oldUsername, err := crypto.EncryptToJSONString("core", oldKey.Data[secrets.PrivateKeySecretKey])
+	require.NoError(t, err)
+	windowsInstances := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap, Namespace: "test"},
+		Data:       map[string]string{"127.0.0.1": "username=core"},
+	}
+	r := &SecretReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         clientfake.NewClientBuilder().WithObjects(teamA, windowsInstances).Build(),
+			log:            logr.Discard(),
+			watchNamespace: "test",
+		},
+	}
+
+	testCases := []struct {
+		name                    string
+		annotations             map[string]string
+		expectedHash            string
+		expectedUsernameUpdated bool
+	}{
+		{
+			name:        "up to date node accessed with the cloud private key",
+			annotations: map[string]string{UsernameAnnotation: username, nodeconfig.PubKeyHashAnnotation: cloudHash},
+		},
+		{
+			name: "up to date node accessed with a key secret",
+			annotations: map[string]string{KeySecretAnnotation: "team-a", UsernameAnnotation: username,
+				nodeconfig.PubKeyHashAnnotation: teamAHash},
+		},
+		{
+			name: "node accessed with the previous cloud private key",
+			annotations: map[string]string{UsernameAnnotation: oldUsername,
+				nodeconfig.PubKeyHashAnnotation: oldHash},
+			expectedHash:            cloudHash,
+			expectedUsernameUpdated: true,
+		},
+		{
+			name: "node accessed with a key secret with a username encrypted with the previous cloud private key",
+			annotations: map[string]string{KeySecretAnnotation: "team-a", UsernameAnnotation: oldUsername,
+				nodeconfig.PubKeyHashAnnotation: teamAHash},
+			expectedUsernameUpdated: true,
+		},
+		{
+			name: "node accessed with a rotated key secret",
+			annotations: map[string]string{KeySecretAnnotation: "team-a", UsernameAnnotation: username,
+				nodeconfig.PubKeyHashAnnotation: oldHash},
+			expectedHash: teamAHash,
+		},
+		{
+			name: "node accessed with a missing key secret",
+			annotations: map[string]string{KeySecretAnnotation: "missing", UsernameAnnotation: username,
+				nodeconfig.PubKeyHashAnnotation: oldHash},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			node := byohNode("node", "127.0.0.1", test.annotations)
+			annotations, err := r.outdatedKeyAnnotations(context.Background(), *node, cloudSigner, cloudPrivateKey)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedHash, annotations[nodeconfig.PubKeyHashAnnotation])
+			encryptedUsername, updated := annotations[UsernameAnnotation]
+			require.Equal(t, test.expectedUsernameUpdated, updated)
+			if updated {
+				decrypted, err := crypto.DecryptFromJSONString(encryptedUsername, cloudPrivateKey)
+				require.NoError(t, err)
+				assert.Equal(t, "core", decrypted)
+			}
+		})
+	}
+}
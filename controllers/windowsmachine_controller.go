@@ -31,6 +31,7 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
@@ -41,19 +42,19 @@ import (
 //+kubebuilder:rbac:groups=machine.openshift.io,resources=machines,verbs=get;list;watch;delete
 //+kubebuilder:rbac:groups=machine.openshift.io,resources=machinesets,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;patch;watch
-//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;create;patch
 //+kubebuilder:rbac:groups="",resources=events,verbs=*
 
 const (
-	// maxUnhealthyCount is the maximum number of nodes that are not ready to serve at a given time.
-	// TODO: https://issues.redhat.com/browse/WINC-524
-	maxUnhealthyCount = 1
 	// MachineOSLabel is the label used to identify the Windows Machines.
 	MachineOSLabel = "machine.openshift.io/os-id"
 	// WindowsMachineController is the name of this controller in logs and other outputs.
 	WindowsMachineController = "windowsmachine"
 	// IgnoreLabel is a label that will cause machines to be ignored by the Windows Machine controller
 	IgnoreLabel = "windowsmachineconfig.openshift.io/ignore"
+	// MachineAnnotation is the annotation the Machine API applies to a Node, containing the namespaced name of the
+	// Machine backing it
+	MachineAnnotation = "machine.openshift.io/machine"
 )
 
 // WindowsMachineReconciler is used to create a controller which manages Windows Machine objects
@@ -105,7 +106,8 @@ func (r *WindowsMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			return r.isValidMachine(e.Object) && isWindowsMachine(e.Object.GetLabels())
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
-			return r.isValidMachine(e.ObjectNew) && isWindowsMachine(e.ObjectNew.GetLabels())
+			return r.isValidMachine(e.ObjectNew) && isWindowsMachine(e.ObjectNew.GetLabels()) &&
+				!isPhaseAnnotationUpdate(e)
 		},
 		GenericFunc: func(e event.GenericEvent) bool {
 			return r.isValidMachine(e.Object) && isWindowsMachine(e.Object.GetLabels())
@@ -235,7 +237,8 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 			// In the case the machine was deleted, ensure that the metrics subsets are configured properly, so that
 			// the current Windows nodes are properly reflected there.
 			log.V(1).Info("not found")
-			return ctrl.Result{}, nil
+			// The Machine's VM is gone, its host key will never be presented again
+			return ctrl.Result{}, secrets.NewHostKeyStore(r.client, r.watchNamespace).Unpin(ctx, request.Name)
 		}
 		// Error reading the object - requeue the request.
 		return ctrl.Result{}, err
@@ -276,7 +279,12 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 			if node.Annotations[nodeconfig.PubKeyHashAnnotation] !=
 				nodeconfig.CreatePubKeyHashAnnotation(r.signer.PublicKey()) {
 				log.Info("deleting machine")
-				deletionAllowed, err := r.isAllowedDeletion(ctx, machine)
+				settings, err := operatorconfig.Get(ctx, r.client)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				maxUnhealthyCount := settings.MaxUnhealthyCount
+				deletionAllowed, err := r.isAllowedDeletion(ctx, machine, maxUnhealthyCount)
 				if err != nil {
 					return ctrl.Result{}, fmt.Errorf("unable to determine if Machine can be deleted: %w", err)
 				}
@@ -326,7 +334,12 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 
 	log.Info("processing", "address", ipAddress)
 	// Configure the Machine as an up-to-date Windows Worker node
-	if err := r.configureMachine(ctx, ipAddress, instanceID, machine.Name, node); err != nil {
+	if err := r.configureMachine(ctx, ipAddress, instanceID, machine, node); err != nil {
+		var rolledBack *rolledBackErr
+		if errors.As(err, &rolledBack) {
+			// The rollback has been reported on the node, which is back in service
+			return ctrl.Result{}, nil
+		}
 		var authErr *windows.AuthErr
 		if errors.As(err, &authErr) {
 			// SSH authentication errors with the Machine are non recoverable, stemming from a mismatch with the
@@ -336,6 +349,7 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 				"Machine %s authentication failure", machine.Name)
 			return ctrl.Result{}, r.deleteMachine(ctx, machine)
 		}
+		r.recordHostKeyMismatch(machine, err)
 		r.recorder.Eventf(machine, core.EventTypeWarning, "MachineSetupFailure",
 			"Machine %s configuration failure", machine.Name)
 		return ctrl.Result{}, err
@@ -374,7 +388,8 @@ func (r *WindowsMachineReconciler) getDefaultUsername() string {
 }
 
 // configureMachine configures the given Windows VM, adding it as a node object to the cluster or upgrading it in place.
-func (r *WindowsMachineReconciler) configureMachine(ctx context.Context, ipAddress, instanceID, machineName string, node *core.Node) error {
+func (r *WindowsMachineReconciler) configureMachine(ctx context.Context, ipAddress, instanceID string,
+	machine *mapi.Machine, node *core.Node) error {
 	// The name of the Machine must be the same as the hostname of the associated VM. This is currently not true in the
 	// case of vSphere VMs provisioned by MAPI. In case of Linux, ignition was handling it. As we don't have an
 	// equivalent of ignition in Windows, WMCO must correct this by changing the VM's hostname.
@@ -383,13 +398,14 @@ func (r *WindowsMachineReconciler) configureMachine(ctx context.Context, ipAddre
 	// Windows Hostname could be changed in initial customizing, however Nutanix is using the same workflow as with vSphere
 	hostname := ""
 	if r.platform == oconfig.VSpherePlatformType || r.platform == oconfig.NutanixPlatformType {
-		hostname = machineName
+		hostname = machine.Name
 	}
 	username := r.getDefaultUsername()
 	instanceInfo, err := instance.NewInfo(ipAddress, username, hostname, false, node)
 	if err != nil {
 		return err
 	}
+	instanceInfo.MachineName = machine.Name
 	// Get private key to encrypt instance usernames
 	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
 		Name: secrets.PrivateKeySecret}, r.client)
@@ -402,7 +418,8 @@ func (r *WindowsMachineReconciler) configureMachine(ctx context.Context, ipAddre
 	}
 
 	if err := r.ensureInstanceIsUpToDate(ctx, instanceInfo, nil,
-		map[string]string{UsernameAnnotation: encryptedUsername}); err != nil {
+		map[string]string{UsernameAnnotation: encryptedUsername},
+		nodeconfig.NewAnnotationPhaseRecorder(r.client, machine)); err != nil {
 		return fmt.Errorf("unable to configure instance %s: %w", instanceID, err)
 	}
 
@@ -434,9 +451,10 @@ func (r *WindowsMachineReconciler) validateUserData(ctx context.Context) error {
 	return nil
 }
 
-// isAllowedDeletion determines if the number of machines after deletion of the given machine doesn`t fall below the
-// minHealthyCount
-func (r *WindowsMachineReconciler) isAllowedDeletion(ctx context.Context, machine *mapi.Machine) (bool, error) {
+// isAllowedDeletion determines if the number of unhealthy machines after deletion of the given machine doesn`t exceed
+// the given maxUnhealthyCount
+func (r *WindowsMachineReconciler) isAllowedDeletion(ctx context.Context, machine *mapi.Machine,
+	maxUnhealthyCount int32) (bool, error) {
 	if len(machine.OwnerReferences) == 0 {
 		return false, fmt.Errorf("machine has no owner reference")
 	}
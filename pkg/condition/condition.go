@@ -177,7 +177,7 @@ func patch(ctx context.Context, c client.Client, opCond *operators.OperatorCondi
 
 // wait repeatedly checks if the OperatorCondition resource's Status has been updated
 func wait(ctx context.Context, c client.Client, watchNamespace, condType string, expectedStatus meta.ConditionStatus) error {
-	err := kubeWait.Poll(retry.Interval, retry.ResourceChangeTimeout, func() (bool, error) {
+	err := kubeWait.Poll(retry.Get().Interval, retry.Get().ResourceChangeTimeout, func() (bool, error) {
 		opCond, err := get(ctx, c, watchNamespace)
 		if err != nil {
 			return false, err
@@ -30,6 +30,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
@@ -129,6 +130,7 @@ func (a *Approver) Approve(ctx context.Context) error {
 		return err
 	}
 	a.log.Info("CSR approved", "CSR", a.csr.Name)
+	metrics.CSRApprovals.Inc()
 	return nil
 }
 
@@ -171,10 +173,12 @@ func (a *Approver) validateCSRContents(ctx context.Context) (bool, error) {
 		if err != nil && !apierrors.IsNotFound(err) {
 			return false, fmt.Errorf("unable to get node %s: %w", nodeName, err)
 		} else if err == nil {
+			metrics.CSRDenials.Inc()
 			return false, fmt.Errorf("%s node already exists, cannot validate CSR: %s", nodeName, a.csr.Name)
 		}
 	} else {
 		if err := a.validateKubeletServingCSR(parsedCSR); err != nil {
+			metrics.CSRDenials.Inc()
 			return false, fmt.Errorf("unable to validate kubelet serving CSR: %s: %w", a.csr.Name, err)
 		}
 	}
@@ -204,14 +208,8 @@ func (a *Approver) validateNodeName(ctx context.Context, nodeName string) (bool,
 // provided in the instance list. If a match is found, it also validates if the node name complies with the DNS
 // RFC1123 naming convention for internet hosts.
 func (a *Approver) validateWithHostName(ctx context.Context, nodeName string, windowsInstances []*instance.Info) (bool, error) {
-	// Create a new signer using the private key secret
-	instanceSigner, err := signer.Create(ctx, kubeTypes.NamespacedName{Namespace: a.namespace,
-		Name: secrets.PrivateKeySecret}, a.client)
-	if err != nil {
-		return false, fmt.Errorf("unable to create signer from private key secret: %w", err)
-	}
 	// check if the node name matches any of the instances host names
-	hasEntry, err := matchesHostname(nodeName, windowsInstances, instanceSigner)
+	hasEntry, err := a.matchesHostname(ctx, nodeName, windowsInstances)
 	if err != nil {
 		return false, fmt.Errorf("unable to map node name to the host names of Windows instances: %w", err)
 	}
@@ -225,6 +223,7 @@ func (a *Approver) validateWithHostName(ctx context.Context, nodeName string, wi
 		a.recorder.Eventf(a.csr, core.EventTypeWarning, "NodeNameValidationFailed",
 			"node name %s does not comply with naming rules defined in RFC1123: "+
 				"Requirements for internet hosts", nodeName)
+		metrics.CSRDenials.Inc()
 		return false, fmt.Errorf("node name %s should comply with naming rules defined in RFC1123: "+
 			"Requirements for internet hosts", nodeName)
 	}
@@ -299,11 +298,22 @@ func hasUsages(csr *certificates.CertificateSigningRequest, usages []certificate
 }
 
 // matchesHostname returns true if given node name matches with host name of any of the instances present
-// in the given instance list
-func matchesHostname(nodeName string, windowsInstances []*instance.Info,
-	instanceSigner ssh.Signer) (bool, error) {
+// in the given instance list. Each instance is accessed with the signer created from its own key Secret, if it has one.
+func (a *Approver) matchesHostname(ctx context.Context, nodeName string,
+	windowsInstances []*instance.Info) (bool, error) {
+	hostKeys := secrets.NewHostKeyStore(a.client, a.namespace)
 	for _, instanceInfo := range windowsInstances {
-		hostName, err := findHostName(instanceInfo, instanceSigner)
+		instanceSigner, err := signer.ForInstance(ctx, a.client, a.namespace, instanceInfo)
+		if err != nil {
+			return false, err
+		}
+		if err = signer.ResolveJumpHosts(ctx, a.client, a.namespace, instanceInfo.JumpHosts); err != nil {
+			return false, err
+		}
+		if err = secrets.ResolveWinRM(ctx, a.client, a.namespace, instanceInfo.WinRM); err != nil {
+			return false, err
+		}
+		hostName, err := findHostName(instanceInfo, instanceSigner, hostKeys)
 		if err != nil {
 			return false, fmt.Errorf("unable to find host name for instance with address %s: %w",
 				instanceInfo.Address, err)
@@ -317,9 +327,10 @@ func matchesHostname(nodeName string, windowsInstances []*instance.Info,
 }
 
 // findHostName returns the actual host name of the instance by running the 'hostname' command
-func findHostName(instanceInfo *instance.Info, instanceSigner ssh.Signer) (string, error) {
+func findHostName(instanceInfo *instance.Info, instanceSigner ssh.Signer,
+	hostKeys windows.HostKeyStore) (string, error) {
 	// We don't need to pass most args here as we just need to be able to run commands on the instance.
-	win, err := windows.New("", instanceInfo, instanceSigner, nil)
+	win, err := windows.New("", instanceInfo, instanceSigner, hostKeys, nil)
 	if err != nil {
 		return "", fmt.Errorf("error instantiating Windows instance: %w", err)
 	}
@@ -33,6 +33,8 @@ import (
 
 	"golang.org/x/sys/windows"
 	"k8s.io/klog/v2"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/metrics"
 )
 
 // importedCABundleFile tracks all the certs that the operator has imported into the node's local trust store
@@ -263,6 +265,7 @@ func ensureCertsAreImported(store windows.Handle, expectedCerts, existingCerts [
 		if err := addCertToStore(store, cert); err != nil {
 			return false, err
 		}
+		metrics.CertificateImports.Inc()
 		certImported = true
 	}
 	return certImported, nil
@@ -278,6 +281,7 @@ func ensureCertsAreDeleted(store windows.Handle, expectedCerts, existingCerts []
 			if err := removeCertFromStore(store, cert); err != nil {
 				return false, err
 			}
+			metrics.CertificateRemovals.Inc()
 			certDeleted = true
 		}
 	}
@@ -32,7 +32,9 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/controller"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/envvar"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/manager"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/powershell"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/textfile"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
@@ -86,6 +88,8 @@ func Deconfigure(cfg *rest.Config, ctx context.Context, configMapNamespace strin
 	}
 
 	cleanupContainers()
+	removeMetricsFirewallRule()
+	removeTextfileMetrics()
 
 	if node != nil {
 		return metadata.RemoveVersionAnnotation(ctx, directClient, *node)
@@ -251,3 +255,18 @@ func cleanupContainers() {
 	cmdRunner.Run("Stop-Process -Force -Name containerd-shim-runhcs-v1")
 	return
 }
+
+// removeMetricsFirewallRule removes the firewall rule allowing inbound connections to the WICD metrics port
+func removeMetricsFirewallRule() {
+	cmdRunner := powershell.NewCommandRunner()
+	if out, err := cmdRunner.Run(metrics.RemoveFirewallRuleCmd()); err != nil {
+		klog.Errorf("error removing metrics firewall rule with output %s: %s", out, err)
+	}
+}
+
+// removeTextfileMetrics removes the textfile collector metrics synced by WICD, and the scripts generating them
+func removeTextfileMetrics() {
+	if err := textfile.Remove(windows.TextfileCollectorDir, windows.TextfileScriptsDir); err != nil {
+		klog.Errorf("error removing textfile collector metrics: %s", err)
+	}
+}
@@ -20,9 +20,12 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net"
+	"os"
 	"reflect"
 	"strings"
 	"time"
@@ -31,6 +34,7 @@ import (
 	"golang.org/x/sys/windows/svc/mgr"
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -51,19 +55,33 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/certs"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/envvar"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/manager"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/powershell"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/probe"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/textfile"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/winsvc"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodestatus"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
 
-// WICDController is the name of the WICD controller in logs and other outputs
-const WICDController = "WICD"
+const (
+	// WICDController is the name of the WICD controller in logs and other outputs
+	WICDController = "WICD"
+	// localSystemAccount is the account services run as by default
+	localSystemAccount = "LocalSystem"
+	// payloadRehashInterval is how long the cached checksum of a payload file is trusted. Files are hashed again once it
+	// has passed, so that files tampered with while keeping their size and modification time are still detected.
+	payloadRehashInterval = 10 * time.Minute
+)
 
 // Options contains a list of options available when creating a new ServiceController
 type Options struct {
@@ -116,6 +134,22 @@ type ServiceController struct {
 	caBundle       string
 	// recorder to generate events
 	recorder record.EventRecorder
+	// probeFailures holds the number of consecutive failed liveness checks of each service
+	probeFailures map[string]int
+	// expectedCommands holds the command each service was last expected to run with
+	expectedCommands map[string]string
+	// payloadChecksums holds the checksum of each payload file, so that files are only hashed again when they change or
+	// their checksum is too old to be trusted
+	payloadChecksums map[string]fileChecksum
+}
+
+// fileChecksum is the checksum of a file, along with the size and modification time of the file it was computed for
+type fileChecksum struct {
+	size     int64
+	modTime  time.Time
+	checksum string
+	// hashedAt is when the checksum was computed
+	hashedAt time.Time
 }
 
 // Bootstrap starts all Windows services marked as necessary for node bootstrapping as defined in the given data
@@ -155,14 +189,22 @@ func RunController(ctx context.Context, watchNamespace, kubeconfig, caBundle str
 		return fmt.Errorf("could not find node object associated with this instance: %w", err)
 	}
 
+	metricsOptions := metrics.ServerOptions(windows.TLSCertsPath)
+	if metricsOptions.BindAddress != "0" {
+		cmd := metrics.EnsureFirewallRuleCmd()
+		if out, err := powershell.NewCommandRunner().Run(cmd); err != nil {
+			klog.Errorf("error opening metrics port with output %s: %s", out, err)
+		}
+	}
 	ctrlMgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Cache: cache.Options{
 			DefaultNamespaces: map[string]cache.Config{
 				watchNamespace: {},
 			},
 		},
-		Scheme: directClient.Scheme(),
-		Logger: klog.NewKlogr(),
+		Metrics: metricsOptions,
+		Scheme:  directClient.Scheme(),
+		Logger:  klog.NewKlogr(),
 	})
 	if err != nil {
 		return fmt.Errorf("unable to start manager: %w", err)
@@ -175,6 +217,10 @@ func RunController(ctx context.Context, watchNamespace, kubeconfig, caBundle str
 	if err = sc.SetupWithManager(ctx, ctrlMgr); err != nil {
 		return err
 	}
+	if err = textfile.NewController(ctrlMgr.GetClient(), ctrlMgr.GetEventRecorderFor(WICDController), node.Name,
+		watchNamespace, powershell.NewCommandRunner()).SetupWithManager(ctrlMgr); err != nil {
+		return err
+	}
 	klog.Info("Starting manager, awaiting events")
 	if err := ctrlMgr.Start(ctx); err != nil {
 		return err
@@ -189,7 +235,9 @@ func NewServiceController(ctx context.Context, nodeName, watchNamespace string,
 		return nil, err
 	}
 	return &ServiceController{client: o.Client, Manager: o.Mgr, ctx: ctx, nodeName: nodeName, psCmdRunner: o.cmdRunner,
-		watchNamespace: watchNamespace, caBundle: o.caBundle, recorder: o.recorder}, nil
+		watchNamespace: watchNamespace, caBundle: o.caBundle, recorder: o.recorder,
+		probeFailures: make(map[string]int), expectedCommands: make(map[string]string),
+		payloadChecksums: make(map[string]fileChecksum)}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -221,10 +269,19 @@ func (sc *ServiceController) SetupWithManager(ctx context.Context, mgr ctrl.Mana
 		return !isAwaitingReboot(object)
 	})
 
-	// Keeping this on the longer side, as each reconciliation requires running each service's powershell scripts
-	// This value is based on CVO's resync period
-	reconcilePeriod := 2 * time.Minute
-	eventChan := newPeriodicEventGenerator(ctx, reconcilePeriod)
+	// The period defaults to 2 minutes, which is on the longer side, as each reconciliation requires running each
+	// service's powershell scripts. The default is based on CVO's resync period.
+	// The OperatorConfig is read directly from the API server before each period, so that changes to it take effect
+	// without restarting WICD.
+	apiReader := mgr.GetAPIReader()
+	eventChan := newPeriodicEventGenerator(ctx, func() time.Duration {
+		settings, err := operatorconfig.Get(ctx, apiReader)
+		if err != nil {
+			klog.Errorf("using default settings: %s", err)
+		}
+		retry.Set(settings.Retry)
+		return settings.WICDReconcilePeriod
+	})
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&core.Node{}, builder.WithPredicates(nodePredicate)).
@@ -243,6 +300,13 @@ func (sc *ServiceController) mapToCurrentNode(_ context.Context, _ client.Object
 // Reconcile fulfills the Reconciler interface
 func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (result ctrl.Result, reconcileErr error) {
 	klog.Infof("reconciling %s", req.NamespacedName)
+	start := time.Now()
+	defer func() {
+		metrics.ReconcileDuration.Observe(time.Since(start).Seconds())
+		if reconcileErr != nil {
+			metrics.ReconcileErrors.Inc()
+		}
+	}()
 	var node core.Node
 	err := sc.client.Get(sc.ctx, req.NamespacedName, &node)
 	if err != nil {
@@ -260,6 +324,11 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 		// node missing desired version annotation, don't requeue
 		return ctrl.Result{}, nil
 	}
+	status := &nodestatus.Status{DesiredVersion: desiredVersion}
+	var cmData *servicescm.Data
+	defer func() {
+		sc.publishStatus(node, status, cmData, reconcileErr)
+	}()
 
 	// Fetch the CM of the desired version
 	var cm core.ConfigMap
@@ -267,12 +336,13 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 		client.ObjectKey{Namespace: sc.watchNamespace, Name: servicescm.NamePrefix + desiredVersion}, &cm); err != nil {
 		return ctrl.Result{}, err
 	}
-	cmData, err := servicescm.Parse(cm.Data)
+	cmData, err = servicescm.Parse(cm.Data)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	awaitingRestart, err := sc.reconcileEnvVarsAndCerts(cmData.EnvironmentVars, cmData.WatchedEnvironmentVars, node)
+	awaitingRestart, err := sc.reconcileEnvVarsAndCerts(cmData.EnvironmentVars, cmData.WatchedEnvironmentVars, node,
+		status)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -281,10 +351,35 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 		klog.Info("waiting for reboot")
 		return ctrl.Result{}, nil
 	}
+	// Verify the payload files before starting the services running them
+	drifted, err := driftedFiles(cmData.Files, sc.payloadChecksums, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(drifted) != 0 {
+		// nothing more the controller can do until WMCO repairs the files
+		return ctrl.Result{}, sc.requestPayloadRepair(node, drifted)
+	}
+	if err = metadata.RemoveRepairAnnotation(sc.ctx, sc.client, node); err != nil {
+		return ctrl.Result{}, err
+	}
 	// Reconcile state of Windows services with the ConfigMap data
+	if err = sc.removeStaleAdditionalServices(cmData.Services); err != nil {
+		return ctrl.Result{}, err
+	}
 	if err = sc.reconcileServices(cmData.Services); err != nil {
 		return ctrl.Result{}, err
 	}
+	restarted, err := sc.probeServices(node, cmData.Services)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if restarted {
+		// Services depending on the restarted services were stopped along with them
+		if err = sc.reconcileServices(cmData.Services); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	if err = sc.waitUntilNodeReady(); err != nil {
 		return ctrl.Result{}, fmt.Errorf("error waiting for node to become ready")
@@ -297,21 +392,29 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 }
 
 // reconcileEnvVarsAndCerts ensures environment variables and certificates exist as expected, or are safely rectified.
-// Returns a boolean expressing whether the instance is awaiting a reboot.
+// Whether each is in sync is recorded in the given status. Returns a boolean expressing whether the instance is
+// awaiting a reboot.
 func (sc *ServiceController) reconcileEnvVarsAndCerts(envVars map[string]string, watchedEnvVars []string,
-	node core.Node) (bool, error) {
+	node core.Node, status *nodestatus.Status) (bool, error) {
 	envVarsUpdated, err := envvar.Reconcile(envVars, watchedEnvVars)
 	if err != nil {
 		return false, err
 	}
 	// Reconcile certs but only process the error after determining reboot status in case error happened after cert changes
 	certsUpdated, err := certs.Reconcile(sc.caBundle)
+	status.CertificatesSynced = !certsUpdated && err == nil
 	if certsUpdated || envVarsUpdated {
 		// If there's any changes, an instance restart is required to ensure all processes pick up the updates.
 		// Applying the reboot annotation results in an event picked up by WMCO's node controller to reboot the instance
 		if annotationErr := metadata.ApplyRebootAnnotation(sc.ctx, sc.client, node); annotationErr != nil {
 			return false, fmt.Errorf("error setting reboot annotation on node %s: %w", sc.nodeName, annotationErr)
 		}
+		if envVarsUpdated {
+			metrics.RebootRequests.WithLabelValues(metrics.RebootReasonEnvironmentVars).Inc()
+		}
+		if certsUpdated {
+			metrics.RebootRequests.WithLabelValues(metrics.RebootReasonCertificates).Inc()
+		}
 		if err == nil {
 			return true, nil
 		}
@@ -346,9 +449,58 @@ func (sc *ServiceController) reconcileEnvVarsAndCerts(envVars map[string]string,
 	if err != nil {
 		return true, fmt.Errorf("error waiting for environment vars to get picked up by processes: %w", err)
 	}
+	status.EnvironmentVarsSynced = true
 	return false, nil
 }
 
+// driftedFiles returns the paths of the given files which are missing from the instance, or whose contents do not
+// match their checksum. The checksums of the files are cached in the given map, and a file is only hashed again if
+// its size or modification time changed, or if its checksum was computed more than payloadRehashInterval before now.
+func driftedFiles(files []servicescm.FileInfo, checksums map[string]fileChecksum, now time.Time) ([]string, error) {
+	var drifted []string
+	for _, file := range files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				delete(checksums, file.Path)
+				drifted = append(drifted, file.Path)
+				continue
+			}
+			return nil, fmt.Errorf("error reading payload file %s: %w", file.Path, err)
+		}
+		cached, present := checksums[file.Path]
+		if !present || cached.size != info.Size() || !cached.modTime.Equal(info.ModTime()) ||
+			now.Sub(cached.hashedAt) >= payloadRehashInterval {
+			contents, err := os.ReadFile(file.Path)
+			if err != nil {
+				return nil, fmt.Errorf("error reading payload file %s: %w", file.Path, err)
+			}
+			cached = fileChecksum{size: info.Size(), modTime: info.ModTime(),
+				checksum: fmt.Sprintf("%x", sha256.Sum256(contents)), hashedAt: now}
+			checksums[file.Path] = cached
+		}
+		if cached.checksum != file.Checksum {
+			drifted = append(drifted, file.Path)
+		}
+	}
+	return drifted, nil
+}
+
+// requestPayloadRepair reports the given drifted payload files as an event on the node, and applies the repair
+// annotation to the node, which results in an event picked up by WMCO's node controller to copy the files again
+func (sc *ServiceController) requestPayloadRepair(node core.Node, drifted []string) error {
+	klog.Infof("payload files %v do not match their expected checksum, waiting for repair", drifted)
+	if _, present := node.Annotations[metadata.RepairAnnotation]; present {
+		return nil
+	}
+	sc.recorder.Eventf(&node, core.EventTypeWarning, "PayloadFileDrift",
+		"Payload files %s are missing or have been modified, requesting repair", strings.Join(drifted, ", "))
+	if err := metadata.ApplyRepairAnnotation(sc.ctx, sc.client, node); err != nil {
+		return fmt.Errorf("error setting repair annotation on node %s: %w", sc.nodeName, err)
+	}
+	return nil
+}
+
 // reconcileServices ensures that all the services passed in via the services slice are created, configured properly
 // and started
 func (sc *ServiceController) reconcileServices(services []servicescm.Service) error {
@@ -381,6 +533,255 @@ func (sc *ServiceController) reconcileServices(services []servicescm.Service) er
 	return nil
 }
 
+// probeServices runs the liveness checks of the given services, restarting the services whose check failed
+// consecutively as many times as the failure threshold of their probe. Restarts are reported as events on the given
+// node. Returns true if any service was restarted, in which case the services depending on it are stopped.
+func (sc *ServiceController) probeServices(node core.Node, services []servicescm.Service) (bool, error) {
+	restarted := false
+	for _, service := range services {
+		if service.LivenessProbe == nil {
+			delete(sc.probeFailures, service.Name)
+			continue
+		}
+		probeErr := probe.Run(*service.LivenessProbe, sc.psCmdRunner)
+		if probeErr == nil {
+			delete(sc.probeFailures, service.Name)
+			continue
+		}
+		sc.probeFailures[service.Name]++
+		failures := sc.probeFailures[service.Name]
+		klog.Infof("liveness check %d of service %s failed: %v", failures, service.Name, probeErr)
+		if failures < probe.FailureThreshold(*service.LivenessProbe) {
+			continue
+		}
+		sc.recorder.Eventf(&node, core.EventTypeWarning, "ServiceUnhealthy",
+			"Restarting service %s after %d failed liveness checks: %v", service.Name, failures, probeErr)
+		if err := sc.restartService(service.Name); err != nil {
+			return restarted, err
+		}
+		metrics.ServiceRestarts.WithLabelValues(service.Name, metrics.RestartReasonLivenessProbe).Inc()
+		delete(sc.probeFailures, service.Name)
+		restarted = true
+	}
+	return restarted, nil
+}
+
+// restartService stops the service with the given name, along with the services depending on it, and starts it again
+func (sc *ServiceController) restartService(name string) error {
+	service, err := sc.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	if err = sc.EnsureServiceState(service, svc.Stopped); err != nil {
+		return fmt.Errorf("error stopping service %s: %w", name, err)
+	}
+	if err = sc.EnsureServiceState(service, svc.Running); err != nil {
+		return fmt.Errorf("error starting service %s: %w", name, err)
+	}
+	klog.Infof("restarted service %s", name)
+	return nil
+}
+
+// publishStatus completes the given status with the state of the services defined in the given services ConfigMap
+// data and the given reconcile error, if any, and publishes it on the given node, along with the node conditions
+// describing the health of the instance's Windows components. The conditions are only published once the data is
+// known. Failing to publish the status does not fail the reconcile.
+func (sc *ServiceController) publishStatus(node core.Node, status *nodestatus.Status, cmData *servicescm.Data,
+	reconcileErr error) {
+	status.LastReconcileTime = meta.Now()
+	if reconcileErr != nil {
+		status.LastError = reconcileErr.Error()
+	}
+	var services []servicescm.Service
+	if cmData != nil {
+		services = cmData.Services
+	}
+	serviceStatuses, servicesErr := sc.serviceStatuses(services)
+	if servicesErr != nil {
+		klog.Errorf("error determining state of Windows services: %s", servicesErr)
+	}
+	status.Services = serviceStatuses
+	if err := nodestatus.Apply(sc.ctx, sc.client, node, status); err != nil {
+		klog.Errorf("error publishing status: %s", err)
+	}
+	if cmData == nil || servicesErr != nil {
+		return
+	}
+	if err := nodestatus.SetConditions(sc.ctx, sc.client, node, sc.nodeConditions(status)); err != nil {
+		klog.Errorf("error publishing node conditions: %s", err)
+	}
+}
+
+// nodeConditions returns the node conditions describing the health of the instance's Windows components, given its
+// status
+func (sc *ServiceController) nodeConditions(status *nodestatus.Status) []core.NodeCondition {
+	return []core.NodeCondition{
+		sc.servicesCondition(status),
+		sc.containerdCondition(status),
+		sc.hnsNetworkCondition(),
+		proxyEnvCondition(status),
+	}
+}
+
+// servicesCondition returns a condition which is true if all the services in the given status are running, and
+// passed their last liveness check
+func (sc *ServiceController) servicesCondition(status *nodestatus.Status) core.NodeCondition {
+	var unhealthy []string
+	for _, service := range status.Services {
+		if service.State != stateName(svc.Running) {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s is %s", service.Name, service.State))
+		} else if failures := sc.probeFailures[service.Name]; failures > 0 {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s failed %d liveness checks", service.Name, failures))
+		}
+	}
+	if len(unhealthy) != 0 {
+		return nodestatus.NewCondition(nodestatus.WindowsServicesHealthy, false, "ServicesUnhealthy",
+			strings.Join(unhealthy, ", "))
+	}
+	return nodestatus.NewCondition(nodestatus.WindowsServicesHealthy, true, "ServicesRunning",
+		"All Windows services are running")
+}
+
+// containerdCondition returns a condition which is true if the containerd service in the given status is running,
+// and serves its API
+func (sc *ServiceController) containerdCondition(status *nodestatus.Status) core.NodeCondition {
+	state := nodestatus.ServiceNotFound
+	for _, service := range status.Services {
+		if service.Name == windows.ContainerdServiceName {
+			state = service.State
+		}
+	}
+	if state != stateName(svc.Running) {
+		return nodestatus.NewCondition(nodestatus.ContainerdHealthy, false, "ContainerdNotRunning",
+			fmt.Sprintf("containerd service state is %s", state))
+	}
+	if err := probe.Run(servicescm.Probe{NamedPipe: windows.ContainerdPipe}, sc.psCmdRunner); err != nil {
+		return nodestatus.NewCondition(nodestatus.ContainerdHealthy, false, "ContainerdPipeUnavailable", err.Error())
+	}
+	return nodestatus.NewCondition(nodestatus.ContainerdHealthy, true, "ContainerdRunning",
+		"containerd is serving its API")
+}
+
+// hnsNetworkCondition returns a condition which is true if the HNS network of the hybrid overlay exists
+func (sc *ServiceController) hnsNetworkCondition() core.NodeCondition {
+	out, err := sc.psCmdRunner.Run(windows.GetHNSNetworkCmd(windows.OVNKubeOverlayNetwork))
+	if err != nil {
+		return nodestatus.NewCondition(nodestatus.HNSNetworkReady, false, "HNSNetworkNotFound",
+			fmt.Sprintf("error getting HNS network %s: %s", windows.OVNKubeOverlayNetwork, err))
+	}
+	if !strings.Contains(out, windows.OVNKubeOverlayNetwork) {
+		return nodestatus.NewCondition(nodestatus.HNSNetworkReady, false, "HNSNetworkNotFound",
+			fmt.Sprintf("HNS network %s does not exist", windows.OVNKubeOverlayNetwork))
+	}
+	return nodestatus.NewCondition(nodestatus.HNSNetworkReady, true, "HNSNetworkFound",
+		fmt.Sprintf("HNS network %s exists", windows.OVNKubeOverlayNetwork))
+}
+
+// proxyEnvCondition returns a condition which is true if the environment variables in the given status are synced
+func proxyEnvCondition(status *nodestatus.Status) core.NodeCondition {
+	if !status.EnvironmentVarsSynced {
+		return nodestatus.NewCondition(nodestatus.ProxyEnvSynced, false, "EnvironmentVarsNotSynced",
+			"Environment variables do not match the services ConfigMap, or are not picked up by all processes")
+	}
+	return nodestatus.NewCondition(nodestatus.ProxyEnvSynced, true, "EnvironmentVarsSynced",
+		"Environment variables match the services ConfigMap")
+}
+
+// serviceStatuses returns the state, actual and expected command of each of the given services
+func (sc *ServiceController) serviceStatuses(services []servicescm.Service) ([]nodestatus.ServiceStatus, error) {
+	existingSvcs, err := sc.GetServices()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine existing Windows services: %w", err)
+	}
+	var statuses []nodestatus.ServiceStatus
+	for _, service := range services {
+		serviceStatus := nodestatus.ServiceStatus{Name: service.Name, State: nodestatus.ServiceNotFound,
+			ExpectedCommand: sc.expectedCommands[service.Name]}
+		if _, present := existingSvcs[service.Name]; present {
+			if err = sc.describeService(&serviceStatus); err != nil {
+				return statuses, err
+			}
+		}
+		statuses = append(statuses, serviceStatus)
+	}
+	return statuses, nil
+}
+
+// describeService fills in the state and command of the service described by the given status
+func (sc *ServiceController) describeService(serviceStatus *nodestatus.ServiceStatus) error {
+	service, err := sc.OpenService(serviceStatus.Name)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	state, err := service.Query()
+	if err != nil {
+		return fmt.Errorf("error querying state of service %s: %w", serviceStatus.Name, err)
+	}
+	config, err := service.Config()
+	if err != nil {
+		return fmt.Errorf("error getting config of service %s: %w", serviceStatus.Name, err)
+	}
+	serviceStatus.State = stateName(state.State)
+	serviceStatus.Command = config.BinaryPathName
+	return nil
+}
+
+// stateName returns the name of the given Windows service state
+func stateName(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "Stopped"
+	case svc.StartPending:
+		return "StartPending"
+	case svc.StopPending:
+		return "StopPending"
+	case svc.Running:
+		return "Running"
+	case svc.ContinuePending:
+		return "ContinuePending"
+	case svc.PausePending:
+		return "PausePending"
+	case svc.Paused:
+		return "Paused"
+	}
+	return fmt.Sprintf("Unknown(%d)", state)
+}
+
+// removeStaleAdditionalServices removes the additional services given by the cluster admin which are not in the
+// services slice anymore
+func (sc *ServiceController) removeStaleAdditionalServices(services []servicescm.Service) error {
+	expected := make(map[string]struct{})
+	for _, service := range services {
+		expected[service.Name] = struct{}{}
+	}
+	existingSvcs, err := sc.GetServices()
+	if err != nil {
+		return fmt.Errorf("could not determine existing Windows services: %w", err)
+	}
+	for name := range existingSvcs {
+		if _, present := expected[name]; present {
+			continue
+		}
+		winSvcObj, err := sc.OpenService(name)
+		// WICD is not able to access some system services, which cannot be additional services
+		if err != nil {
+			continue
+		}
+		config, err := winSvcObj.Config()
+		winSvcObj.Close()
+		if err != nil || !strings.HasPrefix(config.Description, windows.AdditionalServiceTag+" ") {
+			continue
+		}
+		if err := sc.DeleteService(name); err != nil {
+			return fmt.Errorf("error removing additional service %s: %w", name, err)
+		}
+		klog.Infof("removed additional service %s", name)
+	}
+	return nil
+}
+
 // reconcileService ensures the given service is running and configured according to the expected definition given
 func (sc *ServiceController) reconcileService(service winsvc.Service, expected servicescm.Service) error {
 	config, err := service.Config()
@@ -391,6 +792,7 @@ func (sc *ServiceController) reconcileService(service winsvc.Service, expected s
 	if err != nil {
 		return err
 	}
+	sc.expectedCommands[expected.Name] = cmd
 
 	updateRequired := false
 	if config.BinaryPathName != cmd {
@@ -399,6 +801,9 @@ func (sc *ServiceController) reconcileService(service winsvc.Service, expected s
 	}
 
 	expectedDescription := fmt.Sprintf("%s %s", windows.ManagedTag, expected.Name)
+	if expected.Additional {
+		expectedDescription = fmt.Sprintf("%s %s", windows.AdditionalServiceTag, expected.Name)
+	}
 	if config.Description != expectedDescription {
 		config.Description = expectedDescription
 		updateRequired = true
@@ -409,8 +814,28 @@ func (sc *ServiceController) reconcileService(service winsvc.Service, expected s
 		updateRequired = true
 	}
 
+	startType, delayedAutoStart := startTypeConfig(expected.StartType)
+	if config.StartType != startType || config.DelayedAutoStart != delayedAutoStart {
+		config.StartType = startType
+		config.DelayedAutoStart = delayedAutoStart
+		updateRequired = true
+	}
+
+	account := expected.Account
+	if account == "" {
+		account = localSystemAccount
+	}
+	if !strings.EqualFold(config.ServiceStartName, account) {
+		config.ServiceStartName = account
+		updateRequired = true
+	}
+
 	if updateRequired {
 		klog.Infof("updating service %s", expected.Name)
+		status, err := service.Query()
+		if err != nil {
+			return fmt.Errorf("error querying service state: %w", err)
+		}
 		// Always ensure the service isn't running before updating its config, just to be safe
 		if err := sc.EnsureServiceState(service, svc.Stopped); err != nil {
 			return err
@@ -419,11 +844,70 @@ func (sc *ServiceController) reconcileService(service winsvc.Service, expected s
 		if err != nil {
 			return fmt.Errorf("error updating service config: %w", err)
 		}
+		if status.State == svc.Running {
+			metrics.ServiceRestarts.WithLabelValues(expected.Name, metrics.RestartReasonConfigChanged).Inc()
+		}
+	}
+	if err := reconcileRecoveryActions(service, expected); err != nil {
+		return err
 	}
 	// always ensure service is started
 	return sc.EnsureServiceState(service, svc.Running)
 }
 
+// startTypeConfig returns the Windows service manager start type of the given start type, and whether the start is
+// delayed
+func startTypeConfig(startType servicescm.StartType) (uint32, bool) {
+	switch startType {
+	case servicescm.StartTypeAutomatic:
+		return mgr.StartAutomatic, false
+	case servicescm.StartTypeDelayedAutomatic:
+		return mgr.StartAutomatic, true
+	default:
+		return mgr.StartManual, false
+	}
+}
+
+// reconcileRecoveryActions ensures the Windows service manager takes the expected actions when the service fails.
+// Recovery actions are applied without restarting the service.
+func reconcileRecoveryActions(service winsvc.Service, expected servicescm.Service) error {
+	actions, err := service.RecoveryActions()
+	if err != nil {
+		return fmt.Errorf("error getting recovery actions of service %s: %w", expected.Name, err)
+	}
+	var expectedActions []mgr.RecoveryAction
+	for _, action := range expected.RecoveryActions {
+		actionType := mgr.NoAction
+		if action.Type == servicescm.RecoveryActionRestart {
+			actionType = mgr.ServiceRestart
+		}
+		expectedActions = append(expectedActions, mgr.RecoveryAction{Type: actionType,
+			Delay: time.Duration(action.DelaySeconds) * time.Second})
+	}
+	if len(expectedActions) == 0 {
+		if len(actions) == 0 {
+			return nil
+		}
+		klog.Infof("removing recovery actions of service %s", expected.Name)
+		if err = service.ResetRecoveryActions(); err != nil {
+			return fmt.Errorf("error removing recovery actions of service %s: %w", expected.Name, err)
+		}
+		return nil
+	}
+	resetPeriod, err := service.ResetPeriod()
+	if err != nil {
+		return fmt.Errorf("error getting recovery reset period of service %s: %w", expected.Name, err)
+	}
+	if reflect.DeepEqual(actions, expectedActions) && resetPeriod == expected.RecoveryResetPeriod {
+		return nil
+	}
+	klog.Infof("updating recovery actions of service %s", expected.Name)
+	if err = service.SetRecoveryActions(expectedActions, expected.RecoveryResetPeriod); err != nil {
+		return fmt.Errorf("error updating recovery actions of service %s: %w", expected.Name, err)
+	}
+	return nil
+}
+
 // expectedServiceCommand returns the full command that the given service should run with
 func (sc *ServiceController) expectedServiceCommand(expected servicescm.Service) (string, error) {
 	var nodeVars, psVars map[string]string
@@ -493,7 +977,9 @@ func (sc *ServiceController) resolvePowershellVariables(svc servicescm.Service)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to resolve variables in path")
 		}
+		start := time.Now()
 		out, err := sc.psCmdRunner.Run(script.Path)
+		metrics.PowershellPreScriptDuration.WithLabelValues(svc.Name).Observe(time.Since(start).Seconds())
 		if err != nil {
 			return nil, fmt.Errorf("could not run PowerShell script %s: %w", script.Path, err)
 		}
@@ -535,20 +1021,21 @@ func (sc *ServiceController) waitUntilNodeReady() error {
 		})
 }
 
-// newPeriodicEventGenerator returns a channel which will have an empty event sent on it at an interval specified by the
-// given period
-func newPeriodicEventGenerator(ctx context.Context, period time.Duration) <-chan event.GenericEvent {
+// newPeriodicEventGenerator returns a channel which will have an empty event sent on it at an interval returned by the
+// given period function. The function is called before each interval, allowing the period to change over time.
+func newPeriodicEventGenerator(ctx context.Context, period func() time.Duration) <-chan event.GenericEvent {
 	eventChan := make(chan event.GenericEvent)
 	go func() {
-		ticker := time.NewTicker(period)
-		defer ticker.Stop()
+		timer := time.NewTimer(period())
+		defer timer.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				close(eventChan)
 				return
-			case <-ticker.C:
+			case <-timer.C:
 				eventChan <- event.GenericEvent{}
+				timer.Reset(period())
 			}
 		}
 	}()
@@ -562,6 +1049,9 @@ func NewDirectClient(cfg *rest.Config) (client.Client, error) {
 	if err := clientgoscheme.AddToScheme(clientScheme); err != nil {
 		return nil, err
 	}
+	if err := wmcov1.AddToScheme(clientScheme); err != nil {
+		return nil, err
+	}
 
 	directClient, err := client.New(cfg, client.Options{Scheme: clientScheme})
 	if err != nil {
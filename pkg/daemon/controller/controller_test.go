@@ -4,10 +4,14 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,6 +20,7 @@ import (
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -23,6 +28,7 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/fake"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/manager"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodestatus"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
@@ -41,6 +47,10 @@ func (f *fakePSCmdRunner) Run(cmd string) (string, error) {
 	return result, nil
 }
 
+func (f *fakePSCmdRunner) RunContext(_ context.Context, cmd string) (string, error) {
+	return f.Run(cmd)
+}
+
 func TestResolveNodeVariables(t *testing.T) {
 	testIO := []struct {
 		name            string
@@ -288,7 +298,9 @@ func TestReconcileService(t *testing.T) {
 		service               *fake.FakeService
 		expectedService       servicescm.Service
 		expectedServiceConfig mgr.Config
-		expectErr             bool
+		// expectedRecoveryActions are the recovery actions the service is expected to have after reconciliation
+		expectedRecoveryActions []mgr.RecoveryAction
+		expectErr               bool
 	}{
 		{
 			name: "Service stub updated",
@@ -308,9 +320,11 @@ func TestReconcileService(t *testing.T) {
 				Dependencies:           nil,
 			},
 			expectedServiceConfig: mgr.Config{
-				BinaryPathName: "fakeservice",
-				Dependencies:   nil,
-				Description:    "OpenShift managed fakeservice",
+				BinaryPathName:   "fakeservice",
+				Dependencies:     nil,
+				Description:      "OpenShift managed fakeservice",
+				StartType:        mgr.StartManual,
+				ServiceStartName: "LocalSystem",
 			},
 			expectErr: false,
 		},
@@ -333,10 +347,45 @@ func TestReconcileService(t *testing.T) {
 				Dependencies:           nil,
 			},
 			expectedServiceConfig: mgr.Config{
-				BinaryPathName: "fakeservice",
-				Dependencies:   nil,
-				Description:    "OpenShift managed fakeservice",
+				BinaryPathName:   "fakeservice",
+				Dependencies:     nil,
+				Description:      "OpenShift managed fakeservice",
+				StartType:        mgr.StartManual,
+				ServiceStartName: "LocalSystem",
+			},
+			expectErr: false,
+		},
+		{
+			name: "Service start type, account and recovery actions corrected",
+			service: fake.NewFakeService(
+				"fakeservice",
+				mgr.Config{
+					BinaryPathName:   "fakeservice",
+					Description:      "OpenShift managed fakeservice",
+					StartType:        mgr.StartManual,
+					ServiceStartName: "LocalSystem",
+				},
+				svc.Status{
+					State: svc.Running,
+				}),
+			expectedService: servicescm.Service{
+				Name:      "fakeservice",
+				Command:   "fakeservice",
+				StartType: servicescm.StartTypeDelayedAutomatic,
+				Account:   "NT AUTHORITY\\LocalService",
+				RecoveryActions: []servicescm.RecoveryAction{{Type: servicescm.RecoveryActionRestart, DelaySeconds: 5},
+					{Type: servicescm.RecoveryActionNone}},
+				RecoveryResetPeriod: 600,
+			},
+			expectedServiceConfig: mgr.Config{
+				BinaryPathName:   "fakeservice",
+				Description:      "OpenShift managed fakeservice",
+				StartType:        mgr.StartAutomatic,
+				DelayedAutoStart: true,
+				ServiceStartName: "NT AUTHORITY\\LocalService",
 			},
+			expectedRecoveryActions: []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+				{Type: mgr.NoAction}},
 			expectErr: false,
 		},
 		{
@@ -361,9 +410,11 @@ func TestReconcileService(t *testing.T) {
 				Dependencies:         nil,
 			},
 			expectedServiceConfig: mgr.Config{
-				BinaryPathName: "fakeservice --node-name=node -v",
-				Dependencies:   nil,
-				Description:    "OpenShift managed fakeservice",
+				BinaryPathName:   "fakeservice --node-name=node -v",
+				Dependencies:     nil,
+				Description:      "OpenShift managed fakeservice",
+				StartType:        mgr.StartManual,
+				ServiceStartName: "LocalSystem",
 			},
 			expectErr: false,
 		},
@@ -389,9 +440,11 @@ func TestReconcileService(t *testing.T) {
 				Dependencies: nil,
 			},
 			expectedServiceConfig: mgr.Config{
-				BinaryPathName: "fakeservice --ip_example=127.0.0.1 -v",
-				Dependencies:   nil,
-				Description:    "OpenShift managed fakeservice",
+				BinaryPathName:   "fakeservice --ip_example=127.0.0.1 -v",
+				Dependencies:     nil,
+				Description:      "OpenShift managed fakeservice",
+				StartType:        mgr.StartManual,
+				ServiceStartName: "LocalSystem",
 			},
 			expectErr: false,
 		},
@@ -420,9 +473,11 @@ func TestReconcileService(t *testing.T) {
 				Dependencies: nil,
 			},
 			expectedServiceConfig: mgr.Config{
-				BinaryPathName: "fakeservice --node-name=node --ip_example=127.0.0.1 -v",
-				Dependencies:   nil,
-				Description:    "OpenShift managed fakeservice",
+				BinaryPathName:   "fakeservice --node-name=node --ip_example=127.0.0.1 -v",
+				Dependencies:     nil,
+				Description:      "OpenShift managed fakeservice",
+				StartType:        mgr.StartManual,
+				ServiceStartName: "LocalSystem",
 			},
 			expectErr: false,
 		},
@@ -452,6 +507,9 @@ func TestReconcileService(t *testing.T) {
 			actualConfig, err := test.service.Config()
 			require.NoError(t, err)
 			assert.Equal(t, test.expectedServiceConfig, actualConfig)
+			actualRecoveryActions, err := test.service.RecoveryActions()
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedRecoveryActions, actualRecoveryActions)
 			serviceStatus, _ := test.service.Query()
 			assert.Equal(t, svc.Running, serviceStatus.State)
 		})
@@ -766,8 +824,9 @@ func TestReconcile(t *testing.T) {
 
 			winSvcMgr := fake.NewTestMgr(test.existingServices)
 			c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
-				Client: clientfake.NewClientBuilder().WithObjects(clusterObjs...).Build(),
-				Mgr:    winSvcMgr,
+				Client: clientfake.NewClientBuilder().WithObjects(clusterObjs...).
+					WithStatusSubresource(&core.Node{}).Build(),
+				Mgr: winSvcMgr,
 				cmdRunner: &fakePSCmdRunner{
 					map[string]string{
 						"[Environment]::GetEnvironmentVariable('HTTP_PROXY', 'Process')":  test.existingEnvVars["HTTP_PROXY"],
@@ -796,6 +855,144 @@ func TestReconcile(t *testing.T) {
 			} else {
 				assert.True(t, exists, "expected reboot annotation to be applied on node")
 			}
+
+			status, err := nodestatus.Get(node)
+			require.NoError(t, err)
+			require.NotNil(t, status)
+			assert.Equal(t, desiredVersion, status.DesiredVersion)
+			assert.Empty(t, status.LastError)
+			require.Len(t, status.Services, len(test.configMapServices))
+			if !exists {
+				for _, serviceStatus := range status.Services {
+					assert.Equal(t, "Running", serviceStatus.State)
+					assert.Equal(t, serviceStatus.ExpectedCommand, serviceStatus.Command)
+				}
+			}
+			conditions := make(map[core.NodeConditionType]core.ConditionStatus)
+			for _, condition := range node.Status.Conditions {
+				conditions[condition.Type] = condition.Status
+			}
+			assert.Equal(t, core.ConditionTrue, conditions[core.NodeReady])
+			assert.Equal(t, core.ConditionTrue, conditions[nodestatus.WindowsServicesHealthy])
+			assert.Equal(t, core.ConditionFalse, conditions[nodestatus.HNSNetworkReady])
+			assert.Equal(t, core.ConditionFalse, conditions[nodestatus.ContainerdHealthy])
+			if exists {
+				assert.Equal(t, core.ConditionFalse, conditions[nodestatus.ProxyEnvSynced])
+			}
+		})
+	}
+}
+
+func TestRemoveStaleAdditionalServices(t *testing.T) {
+	existing := func(name, description string) *fake.FakeService {
+		return fake.NewFakeService(name, mgr.Config{Description: description}, svc.Status{State: svc.Running})
+	}
+	winSvcMgr := fake.NewTestMgr(map[string]*fake.FakeService{
+		"kubelet":   existing("kubelet", windows.ManagedTag+" kubelet"),
+		"agent":     existing("agent", windows.AdditionalServiceTag+" agent"),
+		"old-agent": existing("old-agent", windows.AdditionalServiceTag+" old-agent"),
+		"system":    existing("system", "system service"),
+	})
+	c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
+		Client: clientfake.NewClientBuilder().Build(),
+		Mgr:    winSvcMgr,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, c.removeStaleAdditionalServices([]servicescm.Service{{Name: "kubelet"},
+		{Name: "agent", Additional: true}}))
+	services, err := winSvcMgr.GetServices()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"kubelet": {}, "agent": {}, "system": {}}, services)
+}
+
+func TestProbeServices(t *testing.T) {
+	running := func(name string) *fake.FakeService {
+		return fake.NewFakeService(name, mgr.Config{}, svc.Status{State: svc.Running})
+	}
+	winSvcMgr := fake.NewTestMgr(map[string]*fake.FakeService{
+		"healthy":   running("healthy"),
+		"unhealthy": running("unhealthy"),
+		"unprobed":  running("unprobed"),
+	})
+	recorder := record.NewFakeRecorder(10)
+	c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
+		Client:    clientfake.NewClientBuilder().Build(),
+		Mgr:       winSvcMgr,
+		cmdRunner: &fakePSCmdRunner{results: map[string]string{"Test-Healthy": "True"}},
+		recorder:  recorder,
+	})
+	require.NoError(t, err)
+	services := []servicescm.Service{
+		{Name: "healthy", LivenessProbe: &servicescm.Probe{PowershellCommand: "Test-Healthy"}},
+		{Name: "unhealthy", LivenessProbe: &servicescm.Probe{PowershellCommand: "Test-Unhealthy",
+			FailureThreshold: 2}},
+		{Name: "unprobed"},
+	}
+
+	// The unhealthy service is not restarted until it fails as many checks as its failure threshold
+	restarted, err := c.probeServices(core.Node{}, services)
+	require.NoError(t, err)
+	assert.False(t, restarted)
+	assert.Equal(t, map[string]int{"unhealthy": 1}, c.probeFailures)
+	assert.Empty(t, recorder.Events)
+
+	restarted, err = c.probeServices(core.Node{}, services)
+	require.NoError(t, err)
+	assert.True(t, restarted)
+	assert.Empty(t, c.probeFailures)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "ServiceUnhealthy")
+	unhealthy, err := winSvcMgr.OpenService("unhealthy")
+	require.NoError(t, err)
+	status, err := unhealthy.Query()
+	require.NoError(t, err)
+	assert.Equal(t, svc.Running, status.State)
+}
+
+func TestServicesCondition(t *testing.T) {
+	testCases := []struct {
+		name           string
+		services       []nodestatus.ServiceStatus
+		probeFailures  map[string]int
+		expectedStatus core.ConditionStatus
+	}{
+		{
+			name:           "all running",
+			services:       []nodestatus.ServiceStatus{{Name: "kubelet", State: "Running"}},
+			expectedStatus: core.ConditionTrue,
+		},
+		{
+			name: "service stopped",
+			services: []nodestatus.ServiceStatus{{Name: "kubelet", State: "Running"},
+				{Name: "kube-proxy", State: "Stopped"}},
+			expectedStatus: core.ConditionFalse,
+		},
+		{
+			name:           "service not found",
+			services:       []nodestatus.ServiceStatus{{Name: "kubelet", State: nodestatus.ServiceNotFound}},
+			expectedStatus: core.ConditionFalse,
+		},
+		{
+			name:           "service failing liveness checks",
+			services:       []nodestatus.ServiceStatus{{Name: "kubelet", State: "Running"}},
+			probeFailures:  map[string]int{"kubelet": 1},
+			expectedStatus: core.ConditionFalse,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
+				Client: clientfake.NewClientBuilder().Build(),
+				Mgr:    fake.NewTestMgr(nil),
+			})
+			require.NoError(t, err)
+			if test.probeFailures != nil {
+				c.probeFailures = test.probeFailures
+			}
+			condition := c.servicesCondition(&nodestatus.Status{Services: test.services})
+			assert.Equal(t, nodestatus.WindowsServicesHealthy, condition.Type)
+			assert.Equal(t, test.expectedStatus, condition.Status)
 		})
 	}
 }
@@ -946,6 +1143,93 @@ func TestFindNodeByAddress(t *testing.T) {
 	}
 }
 
+func TestDriftedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kubelet.exe")
+	require.NoError(t, os.WriteFile(path, []byte("kubelet"), 0644))
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte("kubelet")))
+
+	testIO := []struct {
+		name     string
+		files    []servicescm.FileInfo
+		expected []string
+	}{
+		{
+			name:     "no files",
+			files:    nil,
+			expected: nil,
+		},
+		{
+			name:     "matching checksum",
+			files:    []servicescm.FileInfo{{Path: path, Checksum: checksum}},
+			expected: nil,
+		},
+		{
+			name:     "modified file",
+			files:    []servicescm.FileInfo{{Path: path, Checksum: "0123"}},
+			expected: []string{path},
+		},
+		{
+			name: "missing file",
+			files: []servicescm.FileInfo{{Path: path, Checksum: checksum},
+				{Path: filepath.Join(dir, "kube-proxy.exe"), Checksum: checksum}},
+			expected: []string{filepath.Join(dir, "kube-proxy.exe")},
+		},
+	}
+	for _, test := range testIO {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := driftedFiles(test.files, make(map[string]fileChecksum), time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	t.Run("checksums are cached until the file changes", func(t *testing.T) {
+		now := time.Now()
+		checksums := make(map[string]fileChecksum)
+		files := []servicescm.FileInfo{{Path: path, Checksum: checksum}}
+		drifted, err := driftedFiles(files, checksums, now)
+		require.NoError(t, err)
+		assert.Empty(t, drifted)
+		require.Contains(t, checksums, path)
+
+		// A cached checksum is reused while the size and modification time of the file are unchanged
+		cached := checksums[path]
+		cached.checksum = "0123"
+		checksums[path] = cached
+		drifted, err = driftedFiles(files, checksums, now)
+		require.NoError(t, err)
+		assert.Equal(t, []string{path}, drifted)
+
+		require.NoError(t, os.Chtimes(path, time.Now(), cached.modTime.Add(time.Second)))
+		drifted, err = driftedFiles(files, checksums, now)
+		require.NoError(t, err)
+		assert.Empty(t, drifted)
+	})
+
+	t.Run("files are hashed again once their checksum is too old", func(t *testing.T) {
+		now := time.Now()
+		checksums := make(map[string]fileChecksum)
+		files := []servicescm.FileInfo{{Path: path, Checksum: checksum}}
+		_, err := driftedFiles(files, checksums, now)
+		require.NoError(t, err)
+
+		// Tampering which keeps the size and modification time of the file is not seen through the cache
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		tampered := make([]byte, info.Size())
+		require.NoError(t, os.WriteFile(path, tampered, 0644))
+		require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+		drifted, err := driftedFiles(files, checksums, now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Empty(t, drifted)
+
+		drifted, err = driftedFiles(files, checksums, now.Add(payloadRehashInterval))
+		require.NoError(t, err)
+		assert.Equal(t, []string{path}, drifted)
+	})
+}
+
 func TestSlicesEquivalent(t *testing.T) {
 	testIO := []struct {
 		name     string
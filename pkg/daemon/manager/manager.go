@@ -191,7 +191,7 @@ func New() (Manager, error) {
 
 // waitForProcessToStop waits until the process has exited
 func waitForProcessToStop(process windows.Handle) error {
-	return wait.PollImmediate(retry.WindowsAPIInterval, retry.ResourceChangeTimeout, func() (done bool, err error) {
+	return wait.PollImmediate(retry.Get().WindowsAPIInterval, retry.Get().ResourceChangeTimeout, func() (done bool, err error) {
 		var exitCode uint32
 		if err := windows.GetExitCodeProcess(process, &exitCode); err != nil {
 			// unexpected error, most likely related to permissions
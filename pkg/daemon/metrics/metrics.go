@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+)
+
+const (
+	// namespace prefixes the name of all WICD metrics
+	namespace = "wicd"
+	// certName is the name of the TLS certificate file in the certificate directory
+	certName = "tls.crt"
+	// keyName is the name of the TLS key file in the certificate directory
+	keyName = "tls.key"
+
+	// RestartReasonLivenessProbe is the reason of service restarts due to failed liveness checks
+	RestartReasonLivenessProbe = "LivenessProbeFailed"
+	// RestartReasonConfigChanged is the reason of service restarts due to a change of their configuration
+	RestartReasonConfigChanged = "ConfigChanged"
+	// RebootReasonEnvironmentVars is the reason of reboot requests due to changed environment variables
+	RebootReasonEnvironmentVars = "EnvironmentVars"
+	// RebootReasonCertificates is the reason of reboot requests due to changed trusted CA certificates
+	RebootReasonCertificates = "Certificates"
+	// firewallRuleName is the name of the firewall rule allowing inbound connections to the metrics port
+	firewallRuleName = "WICDMetrics"
+)
+
+var (
+	// ReconcileDuration observes the time taken by each reconcile of the Windows services
+	ReconcileDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time taken to reconcile the Windows services of the instance",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 12),
+	})
+	// ReconcileErrors counts the reconciles of the Windows services which failed
+	ReconcileErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Number of reconciles of the Windows services which failed",
+	})
+	// ServiceRestarts counts the restarts of each Windows service by WICD
+	ServiceRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "service_restarts_total",
+		Help:      "Number of times WICD restarted a Windows service",
+	}, []string{"service", "reason"})
+	// PowershellPreScriptDuration observes the time taken by the PowerShell pre-scripts of each Windows service
+	PowershellPreScriptDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "powershell_prescript_duration_seconds",
+		Help:      "Time taken to run the PowerShell pre-scripts of a Windows service",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 10),
+	}, []string{"service"})
+	// CertificateImports counts the certificates imported into the trust store of the instance
+	CertificateImports = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "certificate_imports_total",
+		Help:      "Number of certificates imported into the trust store of the instance",
+	})
+	// CertificateRemovals counts the certificates removed from the trust store of the instance
+	CertificateRemovals = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "certificate_removals_total",
+		Help:      "Number of certificates removed from the trust store of the instance",
+	})
+	// RebootRequests counts the requests to reboot the instance
+	RebootRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reboot_requests_total",
+		Help:      "Number of times WICD requested the instance to be rebooted",
+	}, []string{"reason"})
+	// TextfileRepairs counts the textfile collector files restored after being modified or removed outside of WICD
+	TextfileRepairs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "textfile_repairs_total",
+		Help:      "Number of textfile collector files restored by WICD after being modified or removed",
+	})
+	// TextfileScriptFailures counts the failed runs of each script generating textfile collector metrics
+	TextfileScriptFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "textfile_script_failures_total",
+		Help:      "Number of failed runs of a PowerShell script generating textfile collector metrics",
+	}, []string{"script"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(ReconcileDuration, ReconcileErrors, ServiceRestarts,
+		PowershellPreScriptDuration, CertificateImports, CertificateRemovals, RebootRequests, TextfileRepairs,
+		TextfileScriptFailures)
+}
+
+// ServerOptions returns the options of the metrics server of WICD's manager, serving metrics over TLS with the
+// certificate and key in the given directory. These are the same as the ones used by windows_exporter. Metrics are not
+// served if the certificate or key does not exist, as the manager would fail to start.
+func ServerOptions(certDir string) metricsserver.Options {
+	for _, name := range []string{certName, keyName} {
+		if _, err := os.Stat(filepath.Join(certDir, name)); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				klog.Infof("not serving metrics, %s does not exist in %s", name, certDir)
+			} else {
+				klog.Errorf("not serving metrics, error finding %s in %s: %s", name, certDir, err)
+			}
+			return metricsserver.Options{BindAddress: "0"}
+		}
+	}
+	return metricsserver.Options{
+		BindAddress:   fmt.Sprintf(":%d", metrics.WICDPort),
+		SecureServing: true,
+		CertDir:       certDir,
+		CertName:      certName,
+		KeyName:       keyName,
+	}
+}
+
+// EnsureFirewallRuleCmd returns the PowerShell command creating the firewall rule which allows inbound connections to
+// the metrics port, if it does not exist. Edge traversal is blocked on a rule created by a previous version with it
+// allowed, as the metrics port is only scraped from within the cluster.
+func EnsureFirewallRuleCmd() string {
+	return fmt.Sprintf("if (Get-NetFirewallRule -DisplayName %s -ErrorAction SilentlyContinue) { "+
+		"Set-NetFirewallRule -DisplayName %s -EdgeTraversalPolicy Block } else { "+
+		"New-NetFirewallRule -DisplayName %s -Direction Inbound -Action Allow -Protocol TCP -LocalPort %d }",
+		firewallRuleName, firewallRuleName, firewallRuleName, metrics.WICDPort)
+}
+
+// RemoveFirewallRuleCmd returns the PowerShell command removing the firewall rule which allows inbound connections to
+// the metrics port, if it exists
+func RemoveFirewallRuleCmd() string {
+	return fmt.Sprintf("Remove-NetFirewallRule -DisplayName %s -ErrorAction SilentlyContinue", firewallRuleName)
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerOptions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		files           []string
+		expectedServing bool
+	}{
+		{
+			name:            "certificate and key present",
+			files:           []string{certName, keyName},
+			expectedServing: true,
+		},
+		{
+			name:  "key missing",
+			files: []string{certName},
+		},
+		{
+			name: "certificate directory empty",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			certDir := t.TempDir()
+			for _, name := range test.files {
+				require.NoError(t, os.WriteFile(filepath.Join(certDir, name), []byte("data"), 0600))
+			}
+			options := ServerOptions(certDir)
+			if test.expectedServing {
+				assert.Equal(t, ":9183", options.BindAddress)
+				assert.True(t, options.SecureServing)
+				assert.Equal(t, certDir, options.CertDir)
+			} else {
+				assert.Equal(t, "0", options.BindAddress)
+			}
+		})
+	}
+}
+
+func TestEnsureFirewallRuleCmd(t *testing.T) {
+	cmd := EnsureFirewallRuleCmd()
+	assert.Contains(t, cmd, "-LocalPort 9183")
+	// The metrics port is only scraped from within the cluster
+	assert.NotContains(t, cmd, "-EdgeTraversalPolicy Allow")
+}
@@ -1,13 +1,22 @@
 package powershell
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"time"
 )
 
+// waitDelay bounds the time waited for the output of a killed command, as it may be held open by processes the
+// command started
+const waitDelay = 5 * time.Second
+
 // CommandRunner runs a given powershell command
 type CommandRunner interface {
 	Run(string) (string, error)
+	// RunContext runs the command, killing it if the context is done before it completes
+	RunContext(context.Context, string) (string, error)
 }
 
 // commandRunner implements the CommandRunner interface
@@ -15,7 +24,15 @@ type commandRunner struct{}
 
 // Run runs the command with the PowerShell on PATH
 func (r *commandRunner) Run(cmd string) (string, error) {
-	out, err := exec.Command("powershell", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", cmd).CombinedOutput()
+	return r.RunContext(context.Background(), cmd)
+}
+
+// RunContext runs the command with the PowerShell on PATH, killing the PowerShell process if the context is done
+// before it completes
+func (r *commandRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	command := exec.CommandContext(ctx, "powershell", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", cmd)
+	command.WaitDelay = waitDelay
+	out, err := command.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("error running command with output %s: %w", string(out), err)
 	}
@@ -26,3 +43,15 @@ func (r *commandRunner) Run(cmd string) (string, error) {
 func NewCommandRunner() *commandRunner {
 	return &commandRunner{}
 }
+
+// RunWithTimeout runs the command with the given runner, killing it if it does not complete within the timeout. The
+// command is no longer running once this returns.
+func RunWithTimeout(r CommandRunner, cmd string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := r.RunContext(ctx, cmd)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("timed out after %s", timeout)
+	}
+	return out, err
+}
@@ -0,0 +1,102 @@
+package probe
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/powershell"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+)
+
+const (
+	// defaultTimeout is the time after which a check fails, if the probe does not specify one
+	defaultTimeout = 5 * time.Second
+	// defaultFailureThreshold is the number of consecutive failed checks after which a service is restarted, if the
+	// probe does not specify one
+	defaultFailureThreshold = 3
+)
+
+// FailureThreshold returns the number of consecutive failed checks of the given probe after which its service must be
+// restarted
+func FailureThreshold(p servicescm.Probe) int {
+	if p.FailureThreshold == 0 {
+		return defaultFailureThreshold
+	}
+	return int(p.FailureThreshold)
+}
+
+// Run runs the check of the given probe, returning an error describing why the check failed, if it did. PowerShell
+// checks are run with the given command runner.
+func Run(p servicescm.Probe, cmdRunner powershell.CommandRunner) error {
+	timeout := defaultTimeout
+	if p.TimeoutSeconds != 0 {
+		timeout = time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	switch {
+	case p.TCPPort != 0:
+		return checkTCP(p.TCPPort, timeout)
+	case p.HTTPGet != "":
+		return checkHTTP(p.HTTPGet, timeout)
+	case p.NamedPipe != "":
+		return checkNamedPipe(p.NamedPipe)
+	case p.PowershellCommand != "":
+		return checkPowershell(p.PowershellCommand, timeout, cmdRunner)
+	}
+	return fmt.Errorf("probe has no check")
+}
+
+// checkTCP ensures a TCP connection can be opened to the given port on the loopback address
+func checkTCP(port uint16, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))), timeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to port %d: %w", port, err)
+	}
+	return conn.Close()
+}
+
+// checkHTTP ensures a GET request to the given URL returns a success or redirect status. As with kubelet HTTP probes,
+// the certificate of HTTPS endpoints is not verified.
+func checkHTTP(url string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			Proxy:           nil,
+		},
+		// Redirects are not followed, as they may point away from the instance
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("error sending request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("request to %s returned status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// checkNamedPipe ensures the named pipe with the given path exists
+func checkNamedPipe(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("error finding named pipe %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkPowershell ensures the given PowerShell command succeeds within the timeout. The command is killed if it times
+// out.
+func checkPowershell(cmd string, timeout time.Duration, cmdRunner powershell.CommandRunner) error {
+	if _, err := powershell.RunWithTimeout(cmdRunner, cmd, timeout); err != nil {
+		return fmt.Errorf("error running PowerShell command %s: %w", cmd, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+)
+
+// fakeRunner is a PowerShell command runner which returns err after waiting for delay
+type fakeRunner struct {
+	delay time.Duration
+	err   error
+	// stopped is set if the command was stopped before completing
+	stopped bool
+}
+
+func (r *fakeRunner) Run(cmd string) (string, error) {
+	return r.RunContext(context.Background(), cmd)
+}
+
+func (r *fakeRunner) RunContext(ctx context.Context, _ string) (string, error) {
+	select {
+	case <-time.After(r.delay):
+		return "", r.err
+	case <-ctx.Done():
+		r.stopped = true
+		return "", ctx.Err()
+	}
+}
+
+func TestRun(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	openPort := uint16(listener.Addr().(*net.TCPAddr).Port)
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedPort := uint16(closedListener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, closedListener.Close())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "http://example.invalid/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	pipe := filepath.Join(t.TempDir(), "pipe")
+	require.NoError(t, os.WriteFile(pipe, nil, 0644))
+
+	testCases := []struct {
+		name        string
+		probe       servicescm.Probe
+		runner      *fakeRunner
+		expectedErr bool
+	}{
+		{
+			name:  "open TCP port",
+			probe: servicescm.Probe{TCPPort: openPort},
+		},
+		{
+			name:        "closed TCP port",
+			probe:       servicescm.Probe{TCPPort: closedPort},
+			expectedErr: true,
+		},
+		{
+			name:  "HTTP success",
+			probe: servicescm.Probe{HTTPGet: server.URL + "/healthz"},
+		},
+		{
+			name:  "HTTP redirect",
+			probe: servicescm.Probe{HTTPGet: server.URL + "/moved"},
+		},
+		{
+			name:        "HTTP error",
+			probe:       servicescm.Probe{HTTPGet: server.URL + "/error"},
+			expectedErr: true,
+		},
+		{
+			name:  "existing named pipe",
+			probe: servicescm.Probe{NamedPipe: pipe},
+		},
+		{
+			name:        "missing named pipe",
+			probe:       servicescm.Probe{NamedPipe: pipe + "-missing"},
+			expectedErr: true,
+		},
+		{
+			name:   "PowerShell success",
+			probe:  servicescm.Probe{PowershellCommand: "Get-Service kubelet"},
+			runner: &fakeRunner{},
+		},
+		{
+			name:        "PowerShell failure",
+			probe:       servicescm.Probe{PowershellCommand: "Get-Service kubelet"},
+			runner:      &fakeRunner{err: fmt.Errorf("service not found")},
+			expectedErr: true,
+		},
+		{
+			name:        "PowerShell timeout",
+			probe:       servicescm.Probe{PowershellCommand: "Get-Service kubelet", TimeoutSeconds: 1},
+			runner:      &fakeRunner{delay: 2 * time.Second},
+			expectedErr: true,
+		},
+		{
+			name:        "no check",
+			probe:       servicescm.Probe{},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := Run(test.probe, test.runner)
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPowershellTimeoutStopsCommand(t *testing.T) {
+	runner := &fakeRunner{delay: time.Minute}
+	err := Run(servicescm.Probe{PowershellCommand: "Get-Service kubelet", TimeoutSeconds: 1}, runner)
+	assert.Error(t, err)
+	assert.True(t, runner.stopped)
+}
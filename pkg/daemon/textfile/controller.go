@@ -0,0 +1,131 @@
+package textfile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/metrics"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/powershell"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+const (
+	// controllerName is the name of the controller in logs and other outputs
+	controllerName = "textfile"
+	// resyncPeriod is the interval at which files are checked for drift, if no script is due before
+	resyncPeriod = 2 * time.Minute
+)
+
+// Controller syncs the textfile collector metrics given in the ConfigMap onto the instance
+type Controller struct {
+	client    client.Client
+	recorder  record.EventRecorder
+	nodeName  string
+	namespace string
+	syncer    *Syncer
+	// spec is the last valid spec given in the ConfigMap. It is kept in place while the ConfigMap is invalid.
+	spec *Spec
+	// invalidVersion is the resource version of the last invalid ConfigMap reported, so that it is only reported once
+	invalidVersion string
+}
+
+// NewController returns a Controller syncing the ConfigMap in the given namespace onto the instance associated with
+// the given node. Scripts are run with the given command runner.
+func NewController(c client.Client, recorder record.EventRecorder, nodeName, namespace string,
+	cmdRunner powershell.CommandRunner) *Controller {
+	return &Controller{client: c, recorder: recorder, nodeName: nodeName, namespace: namespace,
+		syncer: NewSyncer(windows.TextfileCollectorDir, windows.TextfileScriptsDir, cmdRunner)}
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (c *Controller) SetupWithManager(mgr ctrl.Manager) error {
+	cmPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return object.GetNamespace() == c.namespace && object.GetName() == ConfigMap
+	})
+	// An event is sent on start, so that files left behind by a ConfigMap deleted while WICD was not running are removed
+	startEvent := make(chan event.GenericEvent, 1)
+	startEvent <- event.GenericEvent{
+		Object: &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Namespace: c.namespace, Name: ConfigMap}}}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(controllerName).
+		For(&core.ConfigMap{}, builder.WithPredicates(cmPredicate)).
+		WatchesRawSource(source.Channel(startEvent, &handler.EnqueueRequestForObject{})).
+		Complete(c)
+}
+
+// Reconcile fulfills the Reconciler interface
+func (c *Controller) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var cm core.ConfigMap
+	if err := c.client.Get(ctx, req.NamespacedName, &cm); err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// All managed files are removed when the ConfigMap does not exist
+		c.spec = &Spec{}
+	} else if spec, err := Parse(cm.Data); err != nil {
+		if cm.ResourceVersion != c.invalidVersion {
+			c.invalidVersion = cm.ResourceVersion
+			c.recordEvent(ctx, "InvalidTextfileMetrics",
+				"Keeping the current textfile collector metrics, ConfigMap %s is invalid: %v", ConfigMap, err)
+		}
+	} else {
+		c.spec = spec
+	}
+	if c.spec == nil {
+		// The ConfigMap has been invalid since WICD started, files on the instance are left as they are
+		return ctrl.Result{RequeueAfter: resyncPeriod}, nil
+	}
+
+	result, err := c.syncer.Sync(c.spec)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("error syncing textfile collector metrics: %w", err)
+	}
+	if len(result.Repaired) > 0 {
+		metrics.TextfileRepairs.Add(float64(len(result.Repaired)))
+		c.recordEvent(ctx, "TextfileMetricsDrift", "Textfile collector files %s were missing or modified, restored",
+			strings.Join(result.Repaired, ", "))
+	}
+	failed := make([]string, 0, len(result.ScriptErrors))
+	for name := range result.ScriptErrors {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		metrics.TextfileScriptFailures.WithLabelValues(name).Inc()
+		c.recordEvent(ctx, "TextfileScriptFailed", "Script %s generating textfile collector metrics failed: %v",
+			name, result.ScriptErrors[name])
+	}
+
+	requeueAfter := resyncPeriod
+	if result.NextRun > 0 && result.NextRun < requeueAfter {
+		requeueAfter = result.NextRun
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// recordEvent records a warning event with the given reason and message on the node associated with the instance
+func (c *Controller) recordEvent(ctx context.Context, reason, messageFmt string, args ...interface{}) {
+	klog.Errorf(messageFmt, args...)
+	var node core.Node
+	if err := c.client.Get(ctx, client.ObjectKey{Name: c.nodeName}, &node); err != nil {
+		klog.Errorf("unable to record %s event on node %s: %s", reason, c.nodeName, err)
+		return
+	}
+	c.recorder.Eventf(&node, core.EventTypeWarning, reason, messageFmt, args...)
+}
@@ -0,0 +1,304 @@
+package textfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/powershell"
+)
+
+const (
+	// ConfigMap is the name of the ConfigMap through which cluster admins give the textfile collector metrics to
+	// distribute to Windows nodes
+	ConfigMap = "windows-exporter-textfile-metrics"
+	// promSuffix is the suffix of the keys holding metrics files, and of the files generated by scripts
+	promSuffix = ".prom"
+	// managedPrefix prefixes the name of the metrics files written by WICD, so that they can be told apart from the
+	// files put in the textfile collector directory by other means
+	managedPrefix = "wicd_"
+	// scriptSuffix is the suffix of the keys holding PowerShell scripts generating metrics files
+	scriptSuffix = ".ps1"
+	// intervalSuffix is the suffix of the keys holding the interval at which a script is run
+	intervalSuffix = ".interval"
+	// DefaultScriptInterval is the interval at which scripts are run, if the ConfigMap does not specify one
+	DefaultScriptInterval = 5 * time.Minute
+	// minScriptInterval is the shortest interval at which scripts can be run
+	minScriptInterval = 30 * time.Second
+	// defaultScriptTimeout is the time after which a script run fails
+	defaultScriptTimeout = time.Minute
+)
+
+// nameRegex matches the valid names of metrics files and scripts, without their suffix
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Script is a PowerShell script whose output is written to the textfile collector directory
+type Script struct {
+	// Name is the name of the script, without its suffix. Its output is written to wicd_<Name>.prom.
+	Name string
+	// Content is the content of the script
+	Content string
+	// Interval is the interval at which the script is run
+	Interval time.Duration
+}
+
+// Spec is the expected content of the textfile collector directory
+type Spec struct {
+	// Files holds the content of each static metrics file, keyed by file name
+	Files map[string]string
+	// Scripts are the scripts generating metrics files, sorted by name
+	Scripts []Script
+}
+
+// Parse returns the Spec described by the given ConfigMap data. Each key is either:
+// <name>.prom: a metrics file, written as is to wicd_<name>.prom in the textfile collector directory
+// <name>.ps1: a PowerShell script, whose output is written to wicd_<name>.prom
+// <name>.interval: the interval at which the <name>.ps1 script is run, as a duration such as 30s or 10m
+func Parse(data map[string]string) (*Spec, error) {
+	spec := &Spec{Files: make(map[string]string)}
+	scripts := make(map[string]string)
+	intervals := make(map[string]time.Duration)
+	for key, value := range data {
+		suffix := filepath.Ext(key)
+		name := strings.TrimSuffix(key, suffix)
+		if !nameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid key %s, names can only contain alphanumerics, '-' and '_'", key)
+		}
+		switch suffix {
+		case promSuffix:
+			spec.Files[key] = value
+		case scriptSuffix:
+			scripts[name] = value
+		case intervalSuffix:
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interval of script %s: %w", name, err)
+			}
+			if interval < minScriptInterval {
+				return nil, fmt.Errorf("interval of script %s must be at least %s", name, minScriptInterval)
+			}
+			intervals[name] = interval
+		default:
+			return nil, fmt.Errorf("invalid key %s, expected a %s, %s or %s suffix", key, promSuffix, scriptSuffix,
+				intervalSuffix)
+		}
+	}
+	for name := range intervals {
+		if _, present := scripts[name]; !present {
+			return nil, fmt.Errorf("interval given for missing script %s%s", name, scriptSuffix)
+		}
+	}
+	for name, content := range scripts {
+		if _, present := spec.Files[name+promSuffix]; present {
+			return nil, fmt.Errorf("%s%s is both given and generated by script %s%s", name, promSuffix, name,
+				scriptSuffix)
+		}
+		interval, present := intervals[name]
+		if !present {
+			interval = DefaultScriptInterval
+		}
+		spec.Scripts = append(spec.Scripts, Script{Name: name, Content: content, Interval: interval})
+	}
+	sort.Slice(spec.Scripts, func(i, j int) bool {
+		return spec.Scripts[i].Name < spec.Scripts[j].Name
+	})
+	return spec, nil
+}
+
+// metricsFileName returns the name of the metrics file written by WICD for the file or script with the given name
+func metricsFileName(name string) string {
+	return managedPrefix + name + promSuffix
+}
+
+// SyncResult describes the changes made by a sync
+type SyncResult struct {
+	// Repaired lists the files which were modified or removed since they were last synced, and have been restored
+	Repaired []string
+	// ScriptErrors holds the error of each script which failed to run, keyed by script name
+	ScriptErrors map[string]error
+	// NextRun is the time until the next script is due to run, zero if there are no scripts
+	NextRun time.Duration
+}
+
+// Syncer keeps the content of the textfile collector directory and of the scripts directory in line with a Spec. The
+// scripts directory is owned by the Syncer, any file it does not expect is removed from it. In the textfile collector
+// directory, only the files written by WICD are managed, other files are left as they are.
+type Syncer struct {
+	metricsDir    string
+	scriptsDir    string
+	cmdRunner     powershell.CommandRunner
+	scriptTimeout time.Duration
+	// synced holds the content last written to each file, keyed by path
+	synced map[string]string
+	// lastRuns holds the time each script was last run, keyed by script name
+	lastRuns map[string]time.Time
+	// now returns the current time
+	now func() time.Time
+}
+
+// NewSyncer returns a Syncer writing metrics files to metricsDir and scripts to scriptsDir. Scripts are run with the
+// given command runner.
+func NewSyncer(metricsDir, scriptsDir string, cmdRunner powershell.CommandRunner) *Syncer {
+	return &Syncer{metricsDir: metricsDir, scriptsDir: scriptsDir, cmdRunner: cmdRunner,
+		scriptTimeout: defaultScriptTimeout, synced: make(map[string]string), lastRuns: make(map[string]time.Time),
+		now: time.Now}
+}
+
+// Sync writes the files of the given spec, runs the scripts which are due, and removes all other managed files from
+// the directories. Files which were modified or removed since they were last synced are restored, generated files are
+// restored to the last output of their script.
+func (s *Syncer) Sync(spec *Spec) (*SyncResult, error) {
+	for _, dir := range []string{s.metricsDir, s.scriptsDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("error creating directory %s: %w", dir, err)
+		}
+	}
+	result := &SyncResult{ScriptErrors: make(map[string]error)}
+	expectedMetrics := make(map[string]bool)
+	for name, content := range spec.Files {
+		fileName := metricsFileName(strings.TrimSuffix(name, promSuffix))
+		expectedMetrics[fileName] = true
+		if err := s.ensureFile(filepath.Join(s.metricsDir, fileName), content, result); err != nil {
+			return nil, err
+		}
+	}
+
+	expectedScripts := make(map[string]bool)
+	lastRuns := make(map[string]time.Time)
+	now := s.now()
+	for _, script := range spec.Scripts {
+		scriptPath := filepath.Join(s.scriptsDir, script.Name+scriptSuffix)
+		outputPath := filepath.Join(s.metricsDir, metricsFileName(script.Name))
+		expectedScripts[script.Name+scriptSuffix] = true
+		expectedMetrics[metricsFileName(script.Name)] = true
+
+		// A new or changed script is run right away
+		lastRun, ran := s.lastRuns[script.Name]
+		if previous, synced := s.synced[scriptPath]; !synced || previous != script.Content {
+			ran = false
+		}
+		if err := s.ensureFile(scriptPath, script.Content, result); err != nil {
+			return nil, err
+		}
+		if output, generated := s.synced[outputPath]; generated {
+			if err := s.ensureFile(outputPath, output, result); err != nil {
+				return nil, err
+			}
+		}
+		if !ran || now.Sub(lastRun) >= script.Interval {
+			lastRun = now
+			if err := s.runScript(scriptPath, outputPath); err != nil {
+				result.ScriptErrors[script.Name] = err
+			}
+		}
+		lastRuns[script.Name] = lastRun
+		if untilDue := script.Interval - now.Sub(lastRun); result.NextRun == 0 || untilDue < result.NextRun {
+			result.NextRun = untilDue
+		}
+	}
+	// Scripts which are not expected anymore are forgotten, so that they are run right away if they are added back
+	s.lastRuns = lastRuns
+
+	if err := s.removeUnexpected(s.metricsDir, managedPrefix, expectedMetrics); err != nil {
+		return nil, err
+	}
+	if err := s.removeUnexpected(s.scriptsDir, "", expectedScripts); err != nil {
+		return nil, err
+	}
+	sort.Strings(result.Repaired)
+	return result, nil
+}
+
+// ensureFile writes the given content to the file at the given path, if it differs. The file is added to the repaired
+// files of the given result if it was missing or modified since it was last synced.
+func (s *Syncer) ensureFile(path, content string, result *SyncResult) error {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if err == nil && string(current) == content {
+		s.synced[path] = content
+		return nil
+	}
+	if previous, synced := s.synced[path]; synced && previous == content {
+		result.Repaired = append(result.Repaired, filepath.Base(path))
+	}
+	if err = writeFile(path, content); err != nil {
+		return err
+	}
+	s.synced[path] = content
+	return nil
+}
+
+// runScript runs the script at the given path, and writes its output to the file at outputPath. The output file is
+// left as is if the script fails. A script running for longer than the script timeout is killed, so that no run of
+// the script is left in progress once this returns.
+func (s *Syncer) runScript(scriptPath, outputPath string) error {
+	out, err := powershell.RunWithTimeout(s.cmdRunner, fmt.Sprintf("& '%s'", scriptPath), s.scriptTimeout)
+	if err != nil {
+		return fmt.Errorf("error running script %s: %w", scriptPath, err)
+	}
+	if err = writeFile(outputPath, out); err != nil {
+		return err
+	}
+	s.synced[outputPath] = out
+	return nil
+}
+
+// removeUnexpected removes the entries of the given directory whose name starts with prefix and is not in expected
+func (s *Syncer) removeUnexpected(dir, prefix string, expected map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error listing directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) || expected[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err = os.RemoveAll(path); err != nil {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+		delete(s.synced, path)
+	}
+	return nil
+}
+
+// writeFile replaces the content of the file at the given path. The content is written to a temporary file which is
+// then renamed, so that windows_exporter never reads a partially written file.
+func writeFile(path, content string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for %s: %w", path, err)
+	}
+	_, err = tmp.WriteString(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Remove removes the metrics files written by WICD from the given textfile collector directory, and the given scripts
+// directory
+func Remove(metricsDir, scriptsDir string) error {
+	if _, err := NewSyncer(metricsDir, scriptsDir, nil).Sync(&Spec{}); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(scriptsDir); err != nil {
+		return fmt.Errorf("error removing %s: %w", scriptsDir, err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package textfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRunner is a PowerShell command runner which returns out or err, after waiting for delay
+type fakeRunner struct {
+	out   string
+	err   error
+	delay time.Duration
+	// runs counts the commands run
+	runs int
+}
+
+func (r *fakeRunner) Run(cmd string) (string, error) {
+	return r.RunContext(context.Background(), cmd)
+}
+
+func (r *fakeRunner) RunContext(ctx context.Context, _ string) (string, error) {
+	r.runs++
+	select {
+	case <-time.After(r.delay):
+		return r.out, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        map[string]string
+		expected    *Spec
+		expectedErr bool
+	}{
+		{
+			name:     "empty",
+			expected: &Spec{Files: map[string]string{}},
+		},
+		{
+			name: "files and scripts",
+			data: map[string]string{
+				"static.prom":         "static_metric 1\n",
+				"disk-usage.ps1":      "Write-Output 'disk_usage 2'",
+				"disk-usage.interval": "1m",
+				"app_health.ps1":      "Write-Output 'app_health 1'",
+			},
+			expected: &Spec{
+				Files: map[string]string{"static.prom": "static_metric 1\n"},
+				Scripts: []Script{
+					{Name: "app_health", Content: "Write-Output 'app_health 1'", Interval: DefaultScriptInterval},
+					{Name: "disk-usage", Content: "Write-Output 'disk_usage 2'", Interval: time.Minute},
+				},
+			},
+		},
+		{
+			name:        "invalid name",
+			data:        map[string]string{"..\\static.prom": "static_metric 1\n"},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown suffix",
+			data:        map[string]string{"static.txt": "static_metric 1\n"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid interval",
+			data:        map[string]string{"script.ps1": "", "script.interval": "often"},
+			expectedErr: true,
+		},
+		{
+			name:        "interval too short",
+			data:        map[string]string{"script.ps1": "", "script.interval": "1s"},
+			expectedErr: true,
+		},
+		{
+			name:        "interval of a missing script",
+			data:        map[string]string{"script.interval": "1m"},
+			expectedErr: true,
+		},
+		{
+			name:        "file given and generated",
+			data:        map[string]string{"script.ps1": "", "script.prom": "static_metric 1\n"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := Parse(test.data)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, spec)
+		})
+	}
+}
+
+// readDir returns the content of each file in the given directory, keyed by file name
+func readDir(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = string(content)
+	}
+	return files
+}
+
+func TestSync(t *testing.T) {
+	metricsDir := filepath.Join(t.TempDir(), "textfile_inputs")
+	scriptsDir := filepath.Join(t.TempDir(), "textfile_scripts")
+	runner := &fakeRunner{out: "generated_metric 1\n"}
+	syncer := NewSyncer(metricsDir, scriptsDir, runner)
+	now := time.Now()
+	syncer.now = func() time.Time { return now }
+	spec := &Spec{
+		Files:   map[string]string{"static.prom": "static_metric 1\n"},
+		Scripts: []Script{{Name: "generated", Content: "Write-Output 'generated_metric 1'", Interval: time.Minute}},
+	}
+
+	// Files not written by WICD are left as they are
+	require.NoError(t, os.MkdirAll(metricsDir, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(metricsDir, "manual.prom"), []byte("manual 1\n"), 0644))
+
+	// Files are written and scripts are run on the first sync
+	result, err := syncer.Sync(spec)
+	require.NoError(t, err)
+	assert.Empty(t, result.Repaired)
+	assert.Empty(t, result.ScriptErrors)
+	assert.Equal(t, time.Minute, result.NextRun)
+	assert.Equal(t, 1, runner.runs)
+	assert.Equal(t, map[string]string{"wicd_static.prom": "static_metric 1\n",
+		"wicd_generated.prom": "generated_metric 1\n", "manual.prom": "manual 1\n"}, readDir(t, metricsDir))
+	assert.Equal(t, map[string]string{"generated.ps1": "Write-Output 'generated_metric 1'"}, readDir(t, scriptsDir))
+
+	// Modified, removed and unexpected files are repaired, scripts which are not due are not run
+	require.NoError(t, os.WriteFile(filepath.Join(metricsDir, "wicd_static.prom"), []byte("modified 1\n"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(metricsDir, "wicd_generated.prom")))
+	require.NoError(t, os.WriteFile(filepath.Join(metricsDir, "wicd_unexpected.prom"), []byte("unexpected 1\n"),
+		0644))
+	now = now.Add(20 * time.Second)
+	result, err = syncer.Sync(spec)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wicd_generated.prom", "wicd_static.prom"}, result.Repaired)
+	assert.Equal(t, 40*time.Second, result.NextRun)
+	assert.Equal(t, 1, runner.runs)
+	assert.Equal(t, map[string]string{"wicd_static.prom": "static_metric 1\n",
+		"wicd_generated.prom": "generated_metric 1\n", "manual.prom": "manual 1\n"}, readDir(t, metricsDir))
+
+	// Due scripts are run, and the output of failed scripts is left as is
+	runner.err = fmt.Errorf("script failed")
+	now = now.Add(time.Minute)
+	result, err = syncer.Sync(spec)
+	require.NoError(t, err)
+	assert.Contains(t, result.ScriptErrors, "generated")
+	assert.Equal(t, 2, runner.runs)
+	assert.Equal(t, "generated_metric 1\n", readDir(t, metricsDir)["wicd_generated.prom"])
+
+	// Changed scripts are run right away
+	runner.err = nil
+	runner.out = "generated_metric 2\n"
+	spec.Scripts[0].Content = "Write-Output 'generated_metric 2'"
+	result, err = syncer.Sync(spec)
+	require.NoError(t, err)
+	assert.Empty(t, result.Repaired)
+	assert.Equal(t, 3, runner.runs)
+	assert.Equal(t, "generated_metric 2\n", readDir(t, metricsDir)["wicd_generated.prom"])
+
+	// Scripts which time out are stopped, and fail
+	runner.delay = time.Minute
+	syncer.scriptTimeout = 10 * time.Millisecond
+	now = now.Add(time.Minute)
+	start := time.Now()
+	result, err = syncer.Sync(spec)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), runner.delay)
+	assert.Contains(t, result.ScriptErrors, "generated")
+
+	// All files written by WICD are removed when the spec is empty
+	result, err = syncer.Sync(&Spec{})
+	require.NoError(t, err)
+	assert.Zero(t, result.NextRun)
+	assert.Equal(t, map[string]string{"manual.prom": "manual 1\n"}, readDir(t, metricsDir))
+	assert.Empty(t, readDir(t, scriptsDir))
+}
+
+func TestRemove(t *testing.T) {
+	metricsDir := t.TempDir()
+	scriptsDir := filepath.Join(t.TempDir(), "textfile_scripts")
+	_, err := NewSyncer(metricsDir, scriptsDir, &fakeRunner{out: "generated_metric 1\n"}).Sync(&Spec{
+		Files:   map[string]string{"static.prom": "static_metric 1\n"},
+		Scripts: []Script{{Name: "generated", Interval: time.Minute}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(metricsDir, "manual.prom"), []byte("manual 1\n"), 0644))
+
+	require.NoError(t, Remove(metricsDir, scriptsDir))
+	assert.Equal(t, map[string]string{"manual.prom": "manual 1\n"}, readDir(t, metricsDir))
+	assert.NoDirExists(t, scriptsDir)
+}
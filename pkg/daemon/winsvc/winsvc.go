@@ -20,11 +20,15 @@ type Service interface {
 	Query() (svc.Status, error)
 	UpdateConfig(mgr.Config) error
 	ListDependentServices(status svc.ActivityStatus) ([]string, error)
+	RecoveryActions() ([]mgr.RecoveryAction, error)
+	SetRecoveryActions([]mgr.RecoveryAction, uint32) error
+	ResetRecoveryActions() error
+	ResetPeriod() (uint32, error)
 }
 
 // WaitForState retries until the services reaches the expected state, or reaches timeout
 func WaitForState(service Service, state svc.State) error {
-	return wait.PollImmediate(retry.WindowsAPIInterval, retry.ResourceChangeTimeout, func() (bool, error) {
+	return wait.PollImmediate(retry.Get().WindowsAPIInterval, retry.Get().ResourceChangeTimeout, func() (bool, error) {
 		status, err := service.Query()
 		if err != nil {
 			return false, fmt.Errorf("error querying service state: %w", err)
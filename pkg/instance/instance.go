@@ -1,10 +1,17 @@
 package instance
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
+	"golang.org/x/crypto/ssh"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/version"
@@ -23,10 +30,286 @@ type Info struct {
 	NewHostname string
 	// SetNodeIP indicates if the instance should have the node-ip arg set when bootstrapping.
 	SetNodeIP bool
+	// NodeIP overrides the IPv4 address the instance's Node is registered with. An empty value means the address is
+	// discovered on the instance.
+	NodeIP string
+	// SSHPort is the port the instance's SSH server is listening on. A zero value means the default port is used.
+	SSHPort int
+	// SSHOptions are the parameters used when connecting to the instance over SSH
+	SSHOptions SSHOptions
+	// KeySecret is the name of the Secret in the operator namespace holding the private key used to SSH into the
+	// instance. Empty if the cloud private key Secret is used.
+	KeySecret string
+	// JumpHosts are the SSH servers that connections to the instance are tunnelled through, in the order they are
+	// dialed. Empty if the instance is reached directly.
+	JumpHosts []JumpHost
+	// WinRM being set means that the instance is connected to over WinRM instead of SSH. SSHPort, KeySecret and
+	// JumpHosts do not apply to such instances.
+	WinRM *WinRM
+	// Labels are additional labels that should be applied to the instance's Node.
+	Labels map[string]string
+	// Taints are taints that should be applied to the instance's Node.
+	Taints []core.Taint
+	// MachineName is the name of the Machine backing the instance. Empty for BYOH instances.
+	MachineName string
 	// Node is an optional pointer to the Node object associated with the instance, if it has one.
 	Node *core.Node
 }
 
+// SSHOptions are the parameters used when connecting to an instance over SSH. A zero value for any option means its
+// default is used.
+type SSHOptions struct {
+	// DialTimeout is the maximum time a single connection attempt, including the SSH handshake, may take. There is no
+	// limit by default.
+	DialTimeout time.Duration
+	// KeepaliveInterval is how often a keepalive request is sent over an established connection. Keepalive requests
+	// are not sent by default.
+	KeepaliveInterval time.Duration
+	// RetryInterval is the wait time between connection attempts. Defaults to one minute.
+	RetryInterval time.Duration
+	// RetryTimeout is the total time spent attempting to connect. Defaults to the operator's retry timeout.
+	RetryTimeout time.Duration
+}
+
+// JumpHost is an SSH server that connections to an instance are tunnelled through
+type JumpHost struct {
+	// Address is the network address of the jump host
+	Address string
+	// Port is the port the jump host's SSH server is listening on. A zero value means the default port is used.
+	Port int
+	// Username is the name of the user to SSH into the jump host as
+	Username string
+	// KeySecret is the name of the Secret in the operator namespace holding the private key used to authenticate
+	// against the jump host
+	KeySecret string
+	// Signer is created from the private key held by KeySecret. It must be set before connecting to the instance.
+	Signer ssh.Signer
+}
+
+// HostKeyID returns the ID the jump host's SSH host key is pinned under, in the form <address>_<port>
+func (j JumpHost) HostKeyID() string {
+	port := defaultSSHPort
+	if j.Port != 0 {
+		port = j.Port
+	}
+	return fmt.Sprintf("%s_%d", j.Address, port)
+}
+
+// String returns the jump host in the form <username>@<address>[:<port>]/<key secret>, which can be parsed by
+// ParseJumpHosts
+func (j JumpHost) String() string {
+	address := j.Address
+	if j.Port != 0 {
+		address = net.JoinHostPort(j.Address, strconv.Itoa(j.Port))
+	}
+	return fmt.Sprintf("%s@%s/%s", j.Username, address, j.KeySecret)
+}
+
+// FormatJumpHosts returns the given jump hosts as a comma separated list, which can be parsed by ParseJumpHosts
+func FormatJumpHosts(jumpHosts []JumpHost) string {
+	var formatted []string
+	for _, jumpHost := range jumpHosts {
+		formatted = append(formatted, jumpHost.String())
+	}
+	return strings.Join(formatted, ",")
+}
+
+// ParseJumpHosts parses a comma separated list of jump hosts, each in the form
+// <username>@<address>[:<port>]/<key secret>
+func ParseJumpHosts(value string) ([]JumpHost, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var jumpHosts []JumpHost
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		username, rest, foundUser := strings.Cut(item, "@")
+		address, keySecret, foundSecret := strings.Cut(rest, "/")
+		if !foundUser || !foundSecret || username == "" || address == "" {
+			return nil, fmt.Errorf("jump host %q must be in the form <username>@<address>[:<port>]/<key secret>", item)
+		}
+		jumpHost := JumpHost{Address: address, Username: username, KeySecret: keySecret}
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			jumpHost.Address = host
+			jumpHost.Port, err = strconv.Atoi(port)
+			if err != nil || jumpHost.Port < 1 || jumpHost.Port > 65535 {
+				return nil, fmt.Errorf("jump host %q port must be a number between 1 and 65535", item)
+			}
+		}
+		if errs := validation.IsDNS1123Subdomain(keySecret); len(errs) > 0 {
+			return nil, fmt.Errorf("jump host %q key secret is not a valid Secret name: %s", item,
+				strings.Join(errs, ", "))
+		}
+		jumpHosts = append(jumpHosts, jumpHost)
+	}
+	return jumpHosts, nil
+}
+
+// WinRMAuth is the method used to authenticate against an instance's WinRM service
+type WinRMAuth string
+
+const (
+	// WinRMAuthNTLM authenticates as the instance's user with NTLM, using the password held by the credentials Secret
+	WinRMAuthNTLM WinRMAuth = "ntlm"
+	// WinRMAuthCertificate authenticates with the client certificate held by the credentials Secret, which must be
+	// mapped to the instance's user
+	WinRMAuthCertificate WinRMAuth = "certificate"
+)
+
+// WinRM holds the parameters used to connect to an instance over WinRM. Only HTTPS listeners are supported.
+type WinRM struct {
+	// Port is the port the instance's WinRM HTTPS listener is listening on. A zero value means the default port is
+	// used.
+	Port int
+	// Auth is the method used to authenticate against the instance
+	Auth WinRMAuth
+	// CredentialsSecret is the name of the Secret in the operator namespace holding the credentials used to
+	// authenticate against the instance
+	CredentialsSecret string
+	// Credentials are read from CredentialsSecret. They must be set before connecting to the instance.
+	Credentials *WinRMCredentials
+}
+
+// WinRMCredentials are the credentials used to connect to an instance over WinRM
+type WinRMCredentials struct {
+	// Password is the password of the instance's user, used for NTLM authentication
+	Password string
+	// Certificate is the client certificate used for certificate authentication
+	Certificate *tls.Certificate
+	// RootCAs are used to verify the certificate presented by the instance. If nil, the certificate's public key is
+	// pinned the first time it is presented instead.
+	RootCAs *x509.CertPool
+}
+
+const (
+	// winRMAuthOption is the WinRM string key for Auth
+	winRMAuthOption = "auth"
+	// winRMSecretOption is the WinRM string key for CredentialsSecret
+	winRMSecretOption = "secret"
+	// winRMPortOption is the WinRM string key for Port
+	winRMPortOption = "port"
+)
+
+// String returns the WinRM parameters as a comma separated list of <option>=<value> pairs, which can be parsed by
+// ParseWinRM
+func (w WinRM) String() string {
+	s := fmt.Sprintf("%s=%s,%s=%s", winRMAuthOption, w.Auth, winRMSecretOption, w.CredentialsSecret)
+	if w.Port != 0 {
+		s += fmt.Sprintf(",%s=%d", winRMPortOption, w.Port)
+	}
+	return s
+}
+
+// ParseWinRM parses a comma separated list of <option>=<value> pairs, as returned by WinRM.String
+func ParseWinRM(value string) (*WinRM, error) {
+	w := &WinRM{}
+	for _, pair := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("WinRM option %q must be in the form <option>=<value>", pair)
+		}
+		switch key {
+		case winRMAuthOption:
+			w.Auth = WinRMAuth(val)
+		case winRMSecretOption:
+			w.CredentialsSecret = val
+		case winRMPortOption:
+			port, err := strconv.Atoi(val)
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("WinRM port %q must be a number between 1 and 65535", val)
+			}
+			w.Port = port
+		default:
+			return nil, fmt.Errorf("unknown WinRM option %q", key)
+		}
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Validate returns an error if the authentication method or the credentials Secret name are invalid
+func (w WinRM) Validate() error {
+	switch w.Auth {
+	case WinRMAuthNTLM, WinRMAuthCertificate:
+	default:
+		return fmt.Errorf("WinRM authentication method %q must be one of %s, %s", w.Auth, WinRMAuthNTLM,
+			WinRMAuthCertificate)
+	}
+	if errs := validation.IsDNS1123Subdomain(w.CredentialsSecret); len(errs) > 0 {
+		return fmt.Errorf("WinRM credentials secret %q is not a valid Secret name: %s", w.CredentialsSecret,
+			strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+const (
+	// defaultSSHPort is the port an instance's SSH server listens on when SSHPort is not set
+	defaultSSHPort = 22
+	// DefaultWinRMPort is the port an instance's WinRM HTTPS listener listens on when WinRM.Port is not set
+	DefaultWinRMPort = 5986
+	// sshDialTimeoutOption is the SSHOptions string key for DialTimeout
+	sshDialTimeoutOption = "dialTimeout"
+	// sshKeepaliveIntervalOption is the SSHOptions string key for KeepaliveInterval
+	sshKeepaliveIntervalOption = "keepaliveInterval"
+	// sshRetryIntervalOption is the SSHOptions string key for RetryInterval
+	sshRetryIntervalOption = "retryInterval"
+	// sshRetryTimeoutOption is the SSHOptions string key for RetryTimeout
+	sshRetryTimeoutOption = "retryTimeout"
+)
+
+// String returns the options that are set as a comma separated list of <option>=<duration> pairs, which can be
+// parsed by ParseSSHOptions
+func (o SSHOptions) String() string {
+	var options []string
+	for _, option := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{sshDialTimeoutOption, o.DialTimeout},
+		{sshKeepaliveIntervalOption, o.KeepaliveInterval},
+		{sshRetryIntervalOption, o.RetryInterval},
+		{sshRetryTimeoutOption, o.RetryTimeout},
+	} {
+		if option.value != 0 {
+			options = append(options, option.key+"="+option.value.String())
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+// ParseSSHOptions parses a comma separated list of <option>=<duration> pairs, as returned by SSHOptions.String
+func ParseSSHOptions(value string) (SSHOptions, error) {
+	var o SSHOptions
+	if value == "" {
+		return o, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(pair, "=")
+		if !found {
+			return SSHOptions{}, fmt.Errorf("SSH option %q must be in the form <option>=<duration>", pair)
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return SSHOptions{}, fmt.Errorf("SSH option %s has invalid duration %q", key, val)
+		}
+		switch key {
+		case sshDialTimeoutOption:
+			o.DialTimeout = d
+		case sshKeepaliveIntervalOption:
+			o.KeepaliveInterval = d
+		case sshRetryIntervalOption:
+			o.RetryInterval = d
+		case sshRetryTimeoutOption:
+			o.RetryTimeout = d
+		default:
+			return SSHOptions{}, fmt.Errorf("unknown SSH option %q", key)
+		}
+	}
+	return o, nil
+}
+
 // NewInfo returns a new Info. newHostname being set means that the instance's hostname should be
 // changed. An empty value is a no-op.
 func NewInfo(address, username, newHostname string, setNodeIP bool, node *core.Node) (*Info, error) {
@@ -38,6 +321,30 @@ func NewInfo(address, username, newHostname string, setNodeIP bool, node *core.N
 		SetNodeIP: setNodeIP, Node: node}, nil
 }
 
+// HasAddress returns true if the given address is the instance's address, its IPv4 address, or its Node IP override
+func (i *Info) HasAddress(address string) bool {
+	return address == i.Address || address == i.IPv4Address || (i.NodeIP != "" && address == i.NodeIP)
+}
+
+// HostKeyID returns the ID the instance's SSH host key, or WinRM certificate key, is pinned under. Machine instances
+// are identified by their Machine's name, as the addresses of deleted Machines are reused. BYOH instances are
+// identified by their address and SSH or WinRM port, in the form <address>_<port>.
+func (i *Info) HostKeyID() string {
+	if i.MachineName != "" {
+		return i.MachineName
+	}
+	port := defaultSSHPort
+	if i.WinRM != nil {
+		port = DefaultWinRMPort
+		if i.WinRM.Port != 0 {
+			port = i.WinRM.Port
+		}
+	} else if i.SSHPort != 0 {
+		port = i.SSHPort
+	}
+	return fmt.Sprintf("%s_%d", i.Address, port)
+}
+
 // UpToDate returns true if the instance was configured by the current WMCO version
 func (i *Info) UpToDate() bool {
 	if i.Node == nil {
@@ -2,8 +2,10 @@ package instance
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -105,3 +107,219 @@ func TestUpgradeRequired(t *testing.T) {
 		})
 	}
 }
+
+func TestHasAddress(t *testing.T) {
+	withOverride := Info{Address: "localhost", IPv4Address: "127.0.0.1", NodeIP: "10.0.0.1"}
+	withoutOverride := Info{Address: "localhost", IPv4Address: "127.0.0.1"}
+
+	testCases := []struct {
+		name        string
+		input       Info
+		address     string
+		expectedOut bool
+	}{
+		{name: "Address", input: withoutOverride, address: "localhost", expectedOut: true},
+		{name: "IPv4 address", input: withoutOverride, address: "127.0.0.1", expectedOut: true},
+		{name: "Node IP override", input: withOverride, address: "10.0.0.1", expectedOut: true},
+		{name: "Unrelated address", input: withOverride, address: "10.0.0.2", expectedOut: false},
+		{name: "Empty address without override", input: withoutOverride, address: "", expectedOut: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedOut, test.input.HasAddress(test.address))
+		})
+	}
+}
+
+func TestHostKeyID(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       Info
+		expectedOut string
+	}{
+		{name: "Default port", input: Info{Address: "10.0.0.1"}, expectedOut: "10.0.0.1_22"},
+		{name: "Custom port", input: Info{Address: "host.example.com", SSHPort: 2222},
+			expectedOut: "host.example.com_2222"},
+		{name: "Machine", input: Info{Address: "10.0.0.1", MachineName: "winworker-abcde"},
+			expectedOut: "winworker-abcde"},
+		{name: "WinRM default port", input: Info{Address: "10.0.0.1", SSHPort: 2222, WinRM: &WinRM{}},
+			expectedOut: "10.0.0.1_5986"},
+		{name: "WinRM custom port", input: Info{Address: "10.0.0.1", WinRM: &WinRM{Port: 15986}},
+			expectedOut: "10.0.0.1_15986"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectedOut, test.input.HostKeyID())
+		})
+	}
+}
+
+func TestSSHOptions(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expectedOut SSHOptions
+		expectedErr bool
+	}{
+		{
+			name:        "Empty",
+			input:       "",
+			expectedOut: SSHOptions{},
+		},
+		{
+			name:  "All options",
+			input: "dialTimeout=30s,keepaliveInterval=15s,retryInterval=10s,retryTimeout=5m0s",
+			expectedOut: SSHOptions{DialTimeout: 30 * time.Second, KeepaliveInterval: 15 * time.Second,
+				RetryInterval: 10 * time.Second, RetryTimeout: 5 * time.Minute},
+		},
+		{
+			name:        "Some options",
+			input:       "keepaliveInterval=1m0s",
+			expectedOut: SSHOptions{KeepaliveInterval: time.Minute},
+		},
+		{
+			name:        "Unknown option",
+			input:       "timeout=30s",
+			expectedErr: true,
+		},
+		{
+			name:        "Invalid duration",
+			input:       "dialTimeout=soon",
+			expectedErr: true,
+		},
+		{
+			name:        "Missing duration",
+			input:       "dialTimeout",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ParseSSHOptions(test.input)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOut, out)
+			assert.Equal(t, test.input, out.String())
+		})
+	}
+}
+
+func TestJumpHosts(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expectedOut []JumpHost
+		expectedErr bool
+	}{
+		{
+			name:        "Empty",
+			input:       "",
+			expectedOut: nil,
+		},
+		{
+			name:        "Default port",
+			input:       "core@bastion.example.com/bastion-key",
+			expectedOut: []JumpHost{{Address: "bastion.example.com", Username: "core", KeySecret: "bastion-key"}},
+		},
+		{
+			name:  "Multiple jump hosts",
+			input: "core@bastion.example.com:2222/bastion-key,Administrator@10.0.0.1/inner-key",
+			expectedOut: []JumpHost{
+				{Address: "bastion.example.com", Port: 2222, Username: "core", KeySecret: "bastion-key"},
+				{Address: "10.0.0.1", Username: "Administrator", KeySecret: "inner-key"},
+			},
+		},
+		{
+			name:        "Missing username",
+			input:       "bastion.example.com/bastion-key",
+			expectedErr: true,
+		},
+		{
+			name:        "Missing key secret",
+			input:       "core@bastion.example.com",
+			expectedErr: true,
+		},
+		{
+			name:        "Invalid key secret",
+			input:       "core@bastion.example.com/Bastion_Key",
+			expectedErr: true,
+		},
+		{
+			name:        "Invalid port",
+			input:       "core@bastion.example.com:70000/bastion-key",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ParseJumpHosts(test.input)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOut, out)
+			assert.Equal(t, test.input, FormatJumpHosts(out))
+		})
+	}
+}
+
+func TestWinRM(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expectedOut *WinRM
+		expectedErr bool
+	}{
+		{
+			name:        "NTLM",
+			input:       "auth=ntlm,secret=winrm-credentials",
+			expectedOut: &WinRM{Auth: WinRMAuthNTLM, CredentialsSecret: "winrm-credentials"},
+		},
+		{
+			name:        "Certificate with port",
+			input:       "auth=certificate,secret=winrm-credentials,port=15986",
+			expectedOut: &WinRM{Auth: WinRMAuthCertificate, CredentialsSecret: "winrm-credentials", Port: 15986},
+		},
+		{
+			name:        "Unknown authentication method",
+			input:       "auth=basic,secret=winrm-credentials",
+			expectedErr: true,
+		},
+		{
+			name:        "Missing secret",
+			input:       "auth=ntlm",
+			expectedErr: true,
+		},
+		{
+			name:        "Invalid port",
+			input:       "auth=ntlm,secret=winrm-credentials,port=0",
+			expectedErr: true,
+		},
+		{
+			name:        "Unknown option",
+			input:       "auth=ntlm,secret=winrm-credentials,user=Administrator",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ParseWinRM(test.input)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOut, out)
+			assert.Equal(t, test.input, out.String())
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
@@ -23,8 +24,33 @@ const (
 	DesiredVersionAnnotation = "windowsmachineconfig.openshift.io/desired-version"
 	// RebootAnnotation indicates the node's underlying instance needs to be restarted
 	RebootAnnotation = "windowsmachineconfig.openshift.io/reboot-required"
+	// RepairAnnotation indicates payload files on the node's underlying instance do not match their expected checksum,
+	// and must be copied to the instance again
+	RepairAnnotation = "windowsmachineconfig.openshift.io/repair-required"
 	// UpgradingLabel indicates the node's underlying instance is performing an upgrade
 	UpgradingLabel = "windowsmachineconfig.openshift.io/upgrading"
+	// WICDStatusAnnotation holds the state of the Windows services and configuration of the node's underlying instance,
+	// as last reported by WICD
+	WICDStatusAnnotation = "windowsmachineconfig.openshift.io/wicd-status"
+	// PhaseAnnotation indicates the configuration phase the object's underlying instance is in
+	PhaseAnnotation = "windowsmachineconfig.openshift.io/phase"
+	// PhaseTimeAnnotation indicates when the object's underlying instance entered its current configuration phase
+	PhaseTimeAnnotation = "windowsmachineconfig.openshift.io/phase-transition-time"
+	// PhaseErrorAnnotation describes the configuration phase that failed, and the error it failed with
+	PhaseErrorAnnotation = "windowsmachineconfig.openshift.io/phase-error"
+	// RollbackVersionAnnotation indicates the version of WMCO that configured the node before its ongoing upgrade, which
+	// the node is rolled back to if the upgrade fails
+	RollbackVersionAnnotation = "windowsmachineconfig.openshift.io/rollback-version"
+	// RolledBackAnnotation indicates the version of WMCO whose upgrade of the node failed and was rolled back
+	RolledBackAnnotation = "windowsmachineconfig.openshift.io/rolled-back-from"
+	// CanaryAnnotation indicates the version of WMCO whose rollout the node was picked as a canary for
+	CanaryAnnotation = "windowsmachineconfig.openshift.io/canary-for"
+	// InstanceLabelsAnnotation holds the comma separated keys of the labels applied to the node from the description of
+	// its instance
+	InstanceLabelsAnnotation = "windowsmachineconfig.openshift.io/instance-labels"
+	// InstanceTaintsAnnotation holds the comma separated <key>:<effect> of the taints applied to the node from the
+	// description of its instance
+	InstanceTaintsAnnotation = "windowsmachineconfig.openshift.io/instance-taints"
 )
 
 // generatePatch creates a patch applying the given operation onto each given annotation key and value
@@ -111,6 +137,33 @@ func ApplyLabelsAndAnnotations(ctx context.Context, c client.Client, node core.N
 	return nil
 }
 
+// GeneratePhasePatch creates a merge patch setting the phase annotations to the given values. The phase error
+// annotation is removed if failure is empty.
+func GeneratePhasePatch(phase, failure string, transitionTime time.Time) ([]byte, error) {
+	annotations := map[string]*string{
+		PhaseAnnotation:      &phase,
+		PhaseErrorAnnotation: nil,
+	}
+	timestamp := transitionTime.UTC().Format(time.RFC3339)
+	annotations[PhaseTimeAnnotation] = &timestamp
+	if failure != "" {
+		annotations[PhaseErrorAnnotation] = &failure
+	}
+	return json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+}
+
+// ApplyPhaseAnnotations applies annotations describing the given configuration phase to the given object
+func ApplyPhaseAnnotations(ctx context.Context, c client.Client, obj client.Object, phase, failure string) error {
+	patchData, err := GeneratePhasePatch(phase, failure, time.Now())
+	if err != nil {
+		return fmt.Errorf("error creating phase patch request: %w", err)
+	}
+	if err = c.Patch(ctx, obj, client.RawPatch(kubeTypes.MergePatchType, patchData)); err != nil {
+		return fmt.Errorf("unable to apply patch data %s on %s: %w", patchData, obj.GetName(), err)
+	}
+	return nil
+}
+
 // ApplyVersionAnnotation applies this operator's version as the version annotation to the given Node
 func ApplyVersionAnnotation(ctx context.Context, c client.Client, node core.Node, value string) error {
 	return ApplyLabelsAndAnnotations(ctx, c, node, nil, map[string]string{VersionAnnotation: value})
@@ -126,6 +179,12 @@ func ApplyRebootAnnotation(ctx context.Context, c client.Client, node core.Node)
 	return ApplyLabelsAndAnnotations(ctx, c, node, nil, map[string]string{RebootAnnotation: ""})
 }
 
+// ApplyRepairAnnotation applies an annotation to the given Node communicating that payload files on the instance must
+// be repaired
+func ApplyRepairAnnotation(ctx context.Context, c client.Client, node core.Node) error {
+	return ApplyLabelsAndAnnotations(ctx, c, node, nil, map[string]string{RepairAnnotation: ""})
+}
+
 // RemoveVersionAnnotation clears the version annotation from the node object, indicating the node is not configured
 func RemoveVersionAnnotation(ctx context.Context, c client.Client, node core.Node) error {
 	if _, present := node.GetAnnotations()[VersionAnnotation]; present {
@@ -141,6 +200,31 @@ func RemoveVersionAnnotation(ctx context.Context, c client.Client, node core.Nod
 	return nil
 }
 
+// ApplyRollbackVersionAnnotation applies the given version as the version the Node is rolled back to if its upgrade
+// fails
+func ApplyRollbackVersionAnnotation(ctx context.Context, c client.Client, node core.Node, value string) error {
+	return ApplyLabelsAndAnnotations(ctx, c, node, nil, map[string]string{RollbackVersionAnnotation: value})
+}
+
+// RemoveRollbackVersionAnnotation clears the rollback version annotation from the node, indicating the node does not
+// have to be rolled back. If rolledBackFrom is not empty, the node is annotated as rolled back from that version.
+func RemoveRollbackVersionAnnotation(ctx context.Context, c client.Client, node *core.Node,
+	rolledBackFrom string) error {
+	annotations := map[string]*string{RollbackVersionAnnotation: nil}
+	if rolledBackFrom != "" {
+		annotations[RolledBackAnnotation] = &rolledBackFrom
+	}
+	patchData, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{
+		"annotations": annotations}})
+	if err != nil {
+		return fmt.Errorf("error creating rollback annotations patch request: %w", err)
+	}
+	if err = c.Patch(ctx, node, client.RawPatch(kubeTypes.MergePatchType, patchData)); err != nil {
+		return fmt.Errorf("error updating rollback annotations on node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
+
 // RemoveVersionAnnotation clears the reboot annotation from the node, indicating the instance no longer needs a restart
 func RemoveRebootAnnotation(ctx context.Context, c client.Client, node core.Node) error {
 	if _, present := node.GetAnnotations()[RebootAnnotation]; present {
@@ -157,10 +241,11 @@ func RemoveRebootAnnotation(ctx context.Context, c client.Client, node core.Node
 }
 
 // WaitForVersionAnnotation checks if the node object has equivalent version and desiredVersion annotations.
-// Waits for retry.Interval seconds and returns an error if the version annotation does not appear in that time frame.
+// Checks every retry interval and returns an error if the version annotation does not appear within the retry timeout
+// of the current retry settings.
 func WaitForVersionAnnotation(ctx context.Context, c client.Client, nodeName string) error {
 	node := &core.Node{}
-	err := wait.Poll(retry.Interval, retry.Timeout, func() (bool, error) {
+	err := wait.Poll(retry.Get().Interval, retry.Get().Timeout, func() (bool, error) {
 		err := c.Get(ctx, kubeTypes.NamespacedName{Name: nodeName}, node)
 		if err != nil {
 			return false, err
@@ -178,10 +263,26 @@ func WaitForVersionAnnotation(ctx context.Context, c client.Client, nodeName str
 	return nil
 }
 
+// RemoveRepairAnnotation clears the repair annotation from the node, indicating the payload files on the instance are
+// as expected
+func RemoveRepairAnnotation(ctx context.Context, c client.Client, node core.Node) error {
+	if _, present := node.GetAnnotations()[RepairAnnotation]; present {
+		patchData, err := GenerateRemovePatch([]string{}, []string{RepairAnnotation})
+		if err != nil {
+			return fmt.Errorf("error creating repair annotation remove request: %w", err)
+		}
+		err = c.Patch(ctx, &node, client.RawPatch(kubeTypes.JSONPatchType, patchData))
+		if err != nil {
+			return fmt.Errorf("error removing repair annotation from node %s: %w", node.GetName(), err)
+		}
+	}
+	return nil
+}
+
 // WaitForRebootAnnotationRemoval waits for the reboot annotation to be cleared from the node
 func WaitForRebootAnnotationRemoval(ctx context.Context, c client.Client, nodeName string) error {
 	node := &core.Node{}
-	err := wait.Poll(retry.Interval, retry.Timeout, func() (bool, error) {
+	err := wait.Poll(retry.Get().Interval, retry.Get().Timeout, func() (bool, error) {
 		err := c.Get(ctx, kubeTypes.NamespacedName{Name: nodeName}, node)
 		if err != nil {
 			return false, nil
@@ -202,7 +303,11 @@ func RemoveUpgradingLabel(ctx context.Context, c client.Client, node *core.Node)
 }
 
 // ApplyUpgradingLabel applies the upgrading label to the given node reference indicating the instance
-// is performing an upgrade
-func ApplyUpgradingLabel(ctx context.Context, c client.Client, node *core.Node) error {
-	return ApplyLabelsAndAnnotations(ctx, c, *node, map[string]string{UpgradingLabel: "true"}, nil)
+// is performing an upgrade. If canaryFor is not empty, the node is also annotated as a canary of that version.
+func ApplyUpgradingLabel(ctx context.Context, c client.Client, node *core.Node, canaryFor string) error {
+	var annotations map[string]string
+	if canaryFor != "" {
+		annotations = map[string]string{CanaryAnnotation: canaryFor}
+	}
+	return ApplyLabelsAndAnnotations(ctx, c, *node, map[string]string{UpgradingLabel: "true"}, annotations)
 }
@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -138,3 +139,38 @@ func TestGeneratePatch(t *testing.T) {
 		})
 	}
 }
+
+func TestGeneratePhasePatch(t *testing.T) {
+	transitionTime := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name        string
+		phase       string
+		failure     string
+		expectedOut string
+	}{
+		{
+			name:  "phase without failure",
+			phase: "Bootstrapping",
+			expectedOut: `{"metadata":{"annotations":{` +
+				`"windowsmachineconfig.openshift.io/phase":"Bootstrapping",` +
+				`"windowsmachineconfig.openshift.io/phase-error":null,` +
+				`"windowsmachineconfig.openshift.io/phase-transition-time":"2023-03-01T12:00:00Z"}}}`,
+		},
+		{
+			name:    "failed phase",
+			phase:   "Failed",
+			failure: "Bootstrapping: error",
+			expectedOut: `{"metadata":{"annotations":{` +
+				`"windowsmachineconfig.openshift.io/phase":"Failed",` +
+				`"windowsmachineconfig.openshift.io/phase-error":"Bootstrapping: error",` +
+				`"windowsmachineconfig.openshift.io/phase-transition-time":"2023-03-01T12:00:00Z"}}}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := GeneratePhasePatch(test.phase, test.failure, transitionTime)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expectedOut, string(out))
+		})
+	}
+}
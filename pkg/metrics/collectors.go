@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	core "k8s.io/api/core/v1"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+)
+
+const (
+	// namespace prefixes the name of all WMCO metrics
+	namespace = "wmco"
+
+	// TypeMachine is the type label value of instances backed by a Machine
+	TypeMachine = "Machine"
+	// TypeBYOH is the type label value of BYOH instances
+	TypeBYOH = "BYOH"
+	// OperationConfigure is the operation label value of the configuration of instances which are not yet nodes
+	OperationConfigure = "configure"
+	// OperationUpgrade is the operation label value of the upgrade of nodes configured by a previous WMCO version
+	OperationUpgrade = "upgrade"
+)
+
+var (
+	// ConfigurationDuration observes the time taken to successfully configure or upgrade an instance
+	ConfigurationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "node_configuration_duration_seconds",
+		Help:      "Time taken to configure or upgrade a Windows instance as a node",
+		Buckets:   prometheus.ExponentialBuckets(30, 2, 8),
+	}, []string{"type", "operation"})
+	// ConfigurationFailures counts the failures of each configuration phase
+	ConfigurationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "node_configuration_failures_total",
+		Help:      "Number of times a configuration phase of a Windows instance failed",
+	}, []string{"phase"})
+	// UpgradeOutdatedNodes is the number of Windows nodes left to upgrade to the current WMCO version
+	UpgradeOutdatedNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upgrade_outdated_nodes",
+		Help:      "Number of Windows nodes which are not yet upgraded to the current WMCO version",
+	})
+	// UpgradeRolloutState is set to 1 for the current state of the upgrade rollout, other states are not published
+	UpgradeRolloutState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upgrade_rollout_state",
+		Help:      "State of the rollout of the current WMCO version to the Windows nodes",
+	}, []string{"reason"})
+	// Nodes is the number of Windows nodes configured by each WMCO version
+	Nodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "nodes",
+		Help:      "Number of Windows nodes per WMCO version annotation",
+	}, []string{"version"})
+	// CSRApprovals counts the CSRs approved by WMCO
+	CSRApprovals = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "csr_approvals_total",
+		Help:      "Number of CSRs of BYOH instances approved by WMCO",
+	})
+	// CSRDenials counts the CSRs of BYOH instances which WMCO refused to approve as their contents are invalid
+	CSRDenials = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "csr_denials_total",
+		Help:      "Number of CSRs of BYOH instances which WMCO refused to approve as their contents are invalid",
+	})
+	// SSHDialFailures counts the failed attempts to connect to an instance over SSH
+	SSHDialFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_dial_failures_total",
+		Help:      "Number of failed attempts to connect to a Windows instance over SSH",
+	})
+	// SSHAuthErrors counts the SSH connections to an instance which were refused as the key is not authorized
+	SSHAuthErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_auth_errors_total",
+		Help:      "Number of SSH connections to a Windows instance which failed to authenticate",
+	})
+)
+
+// RegisterCollectors registers the WMCO collectors with the controller-runtime registry, so they are served by the
+// metrics endpoint of the operator
+func RegisterCollectors() {
+	ctrlmetrics.Registry.MustRegister(ConfigurationDuration, ConfigurationFailures, UpgradeOutdatedNodes,
+		UpgradeRolloutState, Nodes, CSRApprovals, CSRDenials, SSHDialFailures, SSHAuthErrors)
+}
+
+// RecordRollout publishes the given state of the upgrade rollout and the number of nodes left to upgrade
+func RecordRollout(reason string, outdated int) {
+	UpgradeRolloutState.Reset()
+	UpgradeRolloutState.WithLabelValues(reason).Set(1)
+	UpgradeOutdatedNodes.Set(float64(outdated))
+}
+
+// RecordNodeVersions publishes the number of the given Windows nodes configured by each WMCO version. Nodes without
+// a version annotation are not configured yet, and are left out.
+func RecordNodeVersions(nodes []core.Node) {
+	Nodes.Reset()
+	for _, node := range nodes {
+		if version, present := node.GetAnnotations()[metadata.VersionAnnotation]; present {
+			Nodes.WithLabelValues(version).Inc()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+)
+
+// gaugeValues returns the values of the gauges of the given collector, keyed by the value of the given label
+func gaugeValues(t *testing.T, collector prometheus.Collector, label string) map[string]float64 {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(collector))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			key := ""
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label {
+					key = pair.GetValue()
+				}
+			}
+			values[key] = metric.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestRecordNodeVersions(t *testing.T) {
+	node := func(name string, annotations map[string]string) core.Node {
+		return core.Node{ObjectMeta: meta.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+	// Nodes of a version which is gone must not be reported anymore
+	RecordNodeVersions([]core.Node{node("old", map[string]string{metadata.VersionAnnotation: "8.0.0"})})
+	RecordNodeVersions([]core.Node{
+		node("a", map[string]string{metadata.VersionAnnotation: "9.0.0"}),
+		node("b", map[string]string{metadata.VersionAnnotation: "9.0.0"}),
+		node("c", map[string]string{metadata.VersionAnnotation: "10.0.0"}),
+		node("unconfigured", nil),
+	})
+	assert.Equal(t, map[string]float64{"9.0.0": 2, "10.0.0": 1}, gaugeValues(t, Nodes, "version"))
+}
+
+func TestRecordRollout(t *testing.T) {
+	RecordRollout("RollingOut", 3)
+	RecordRollout("Paused", 2)
+	assert.Equal(t, map[string]float64{"Paused": 1}, gaugeValues(t, UpgradeRolloutState, "reason"))
+	assert.Equal(t, map[string]float64{"": 2}, gaugeValues(t, UpgradeOutdatedNodes, "reason"))
+}
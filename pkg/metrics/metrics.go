@@ -8,4 +8,13 @@ const (
 	// WindowsMetricsResource is the name for objects created for Prometheus monitoring
 	// by current operator version. Its name is defined through the bundle manifests
 	WindowsMetricsResource = "windows-exporter"
+	// WICDPort is the port number on which WICD exposes its metrics
+	WICDPort int32 = 9183
+	// WICDJob is the job label of the metrics scraped from WICD
+	WICDJob = "windows-instance-config-daemon"
+	// OperatorMetricsResource is the name of the Service exposing the operator metrics, and of the serviceMonitor
+	// scraping them. The Service is defined through the bundle manifests
+	OperatorMetricsResource = "windows-machine-config-operator-metrics"
+	// OperatorPortName is the name of the Service port on which the operator metrics are exposed
+	OperatorPortName = "https"
 )
@@ -29,6 +29,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/ignition"
@@ -38,6 +39,8 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/registries"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
@@ -85,10 +88,23 @@ type nodeConfig struct {
 	additionalAnnotations map[string]string
 	// additionalLabels are extra labels that should be applied to configured nodes
 	additionalLabels map[string]string
+	// instanceLabels are the labels given in the description of the instance, which are also part of additionalLabels
+	instanceLabels map[string]string
+	// taints are taints that should be applied to configured nodes
+	taints []core.Taint
+	// nodeIP is the IP the node is registered with, if it overrides the address discovered on the instance
+	nodeIP string
 	// platformType holds the name of the platform where cluster is deployed
 	platformType configv1.PlatformType
 	// wmcoNamespace is the namespace WMCO is deployed to
 	wmcoNamespace string
+	// phaseRecorder publishes the configuration phase of the instance, in addition to the node annotations
+	phaseRecorder PhaseRecorder
+	// failedPhase is the phase the last call to Configure failed in, if any
+	failedPhase wmcov1.InstancePhase
+	// rollbackOnFailure indicates the instance is rolled back if its upgrade fails, so the payload files replaced by
+	// the upgrade are backed up
+	rollbackOnFailure bool
 }
 
 // ErrWriter is a wrapper to enable error-level logging inside kubectl drainer implementation
@@ -116,7 +132,7 @@ func (ow OutWriter) Write(p []byte) (n int, err error) {
 // NewNodeConfig creates a new instance of nodeConfig to be used by the caller.
 // hostName having a value will result in the VM's hostname being changed to the given value.
 func NewNodeConfig(c client.Client, clientset *kubernetes.Clientset, clusterServiceCIDR, wmcoNamespace string,
-	instanceInfo *instance.Info, signer ssh.Signer, additionalLabels,
+	instanceInfo *instance.Info, instanceSigner ssh.Signer, additionalLabels,
 	additionalAnnotations map[string]string, platformType configv1.PlatformType) (*nodeConfig, error) {
 
 	if err := cluster.ValidateCIDR(clusterServiceCIDR); err != nil {
@@ -130,19 +146,44 @@ func NewNodeConfig(c client.Client, clientset *kubernetes.Clientset, clusterServ
 	}
 
 	log := ctrl.Log.WithName(fmt.Sprintf("nc %s", instanceInfo.Address))
-	win, err := windows.New(clusterDNS, instanceInfo, signer, &platformType)
+	if err := signer.ResolveJumpHosts(context.Background(), c, wmcoNamespace, instanceInfo.JumpHosts); err != nil {
+		return nil, err
+	}
+	if err := secrets.ResolveWinRM(context.Background(), c, wmcoNamespace, instanceInfo.WinRM); err != nil {
+		return nil, err
+	}
+	win, err := windows.New(clusterDNS, instanceInfo, instanceSigner, secrets.NewHostKeyStore(c, wmcoNamespace),
+		&platformType)
 	if err != nil {
 		return nil, fmt.Errorf("error instantiating Windows instance from VM: %w", err)
 	}
 
 	return &nodeConfig{client: c, k8sclientset: clientset, Windows: win, node: instanceInfo.Node,
 		platformType: platformType, wmcoNamespace: wmcoNamespace, clusterServiceCIDR: clusterServiceCIDR,
-		publicKeyHash: CreatePubKeyHashAnnotation(signer.PublicKey()), log: log, additionalLabels: additionalLabels,
-		additionalAnnotations: additionalAnnotations}, nil
+		publicKeyHash: CreatePubKeyHashAnnotation(instanceSigner.PublicKey()), log: log,
+		additionalLabels: additionalLabels, additionalAnnotations: additionalAnnotations,
+		instanceLabels: instanceInfo.Labels, taints: instanceInfo.Taints, nodeIP: instanceInfo.NodeIP}, nil
 }
 
-// Configure configures the Windows VM to make it a Windows worker node
+// Configure configures the Windows VM to make it a Windows worker node. The configuration phase is published as the
+// instance moves through the process.
 func (nc *nodeConfig) Configure(ctx context.Context) error {
+	var phase wmcov1.InstancePhase
+	err := nc.configure(ctx, func(p wmcov1.InstancePhase) {
+		phase = p
+		nc.recordPhase(ctx, p, nil)
+	})
+	if err != nil {
+		nc.failedPhase = phase
+		nc.recordPhase(ctx, phase, err)
+		return err
+	}
+	nc.recordPhase(ctx, wmcov1.PhaseReady, nil)
+	return nil
+}
+
+// configure performs the steps of Configure, calling enterPhase as each configuration phase is started
+func (nc *nodeConfig) configure(ctx context.Context, enterPhase func(wmcov1.InstancePhase)) error {
 	drainHelper := nc.newDrainHelper(ctx)
 	// If a Node object exists already, it implies that we are reconfiguring and we should cordon the node
 	if nc.node != nil {
@@ -152,31 +193,22 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 		}
 	}
 
-	if err := nc.createBootstrapFiles(ctx); err != nil {
-		return err
-	}
-	if err := nc.createTLSCerts(ctx); err != nil {
-		return err
-	}
-	if err := nc.createRegistryConfigFiles(ctx); err != nil {
-		return err
-	}
-	if err := nc.SyncTrustedCABundle(ctx); err != nil {
-		return err
-	}
-	wicdKC, err := nc.generateWICDKubeconfig(ctx)
+	enterPhase(wmcov1.PhaseTransferringPayload)
+	wicdKC, err := nc.transferPayload(ctx)
 	if err != nil {
 		return err
 	}
 
+	enterPhase(wmcov1.PhaseBootstrapping)
 	wmcoVersion := version.Get()
 	// Start all required services to bootstrap a node object using WICD
-	if err := nc.Windows.Bootstrap(ctx, wmcoVersion, nc.wmcoNamespace, wicdKC); err != nil {
+	if err := nc.Windows.Bootstrap(wmcoVersion, nc.wmcoNamespace); err != nil {
 		return fmt.Errorf("bootstrapping the Windows instance failed: %w", err)
 	}
 
 	// Perform rest of the configuration with the kubelet running
 	err = func() error {
+		enterPhase(wmcov1.PhaseWaitingForNode)
 		if nc.node == nil {
 			// populate node object in nodeConfig in the case of a new Windows instance
 			if err := nc.setNode(ctx, false); err != nil {
@@ -200,7 +232,11 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 			return fmt.Errorf("error updating public key hash and additional annotations on node %s: %w",
 				nc.node.GetName(), err)
 		}
+		if err := nc.applyInstanceLabelsAndTaints(ctx); err != nil {
+			return fmt.Errorf("error applying labels and taints to node %s: %w", nc.node.GetName(), err)
+		}
 
+		enterPhase(wmcov1.PhaseConfiguringWICD)
 		if err := nc.Windows.ConfigureWICD(nc.wmcoNamespace, wicdKC); err != nil {
 			return fmt.Errorf("configuring WICD failed: %w", err)
 		}
@@ -209,6 +245,7 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 			return fmt.Errorf("error updating desired version annotation on node %s: %w", nc.node.GetName(), err)
 		}
 
+		enterPhase(wmcov1.PhaseWaitingForVersion)
 		// Wait for version annotation. This prevents uncordoning the node until all node services and networks are up
 		if err := metadata.WaitForVersionAnnotation(ctx, nc.client, nc.node.Name); err != nil {
 			return fmt.Errorf("error waiting for proper %s annotation for node %s: %w", metadata.VersionAnnotation,
@@ -244,6 +281,368 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 	return err
 }
 
+// Upgrade upgrades the instance, configured by the given previous WMCO version, to the current version. When the
+// services ConfigMap of the previous version exists, the instance is upgraded in place: only the files and Windows
+// services which differ between the versions are replaced, and the HNS networks are kept unless the network
+// configuration changed. If it does not exist, the instance is deconfigured and configured again. Any other error
+// getting it is returned, so that the upgrade is retried. The configuration phase is published as the instance moves
+// through the process.
+func (nc *nodeConfig) Upgrade(ctx context.Context, previousVersion string) error {
+	if nc.node == nil {
+		return fmt.Errorf("instance does not a have an associated node to upgrade")
+	}
+	previous, err := nc.getServicesData(ctx, previousVersion)
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			// Other errors may be transient, and must not turn the upgrade into a reconfiguration
+			return err
+		}
+		nc.log.Info("unable to upgrade in place, reconfiguring", "node", nc.node.GetName(), "error", err)
+		if err := nc.Deconfigure(ctx); err != nil {
+			return err
+		}
+		return nc.Configure(ctx)
+	}
+	var phase wmcov1.InstancePhase
+	err = nc.upgrade(ctx, previous, func(p wmcov1.InstancePhase) {
+		phase = p
+		nc.recordPhase(ctx, p, nil)
+	})
+	if err != nil {
+		nc.failedPhase = phase
+		nc.recordPhase(ctx, phase, err)
+		return err
+	}
+	nc.recordPhase(ctx, wmcov1.PhaseReady, nil)
+	return nil
+}
+
+// upgrade performs the steps of an in-place Upgrade from the given services ConfigMap data, calling enterPhase as each
+// configuration phase is started
+func (nc *nodeConfig) upgrade(ctx context.Context, previous *servicescm.Data,
+	enterPhase func(wmcov1.InstancePhase)) error {
+	enterPhase(wmcov1.PhaseTransferringPayload)
+	drainHelper := nc.newDrainHelper(ctx)
+	if err := drain.RunCordonOrUncordon(drainHelper, nc.node, true); err != nil {
+		return fmt.Errorf("unable to cordon node %s: %w", nc.node.GetName(), err)
+	}
+	if err := drain.RunNodeDrain(drainHelper, nc.node.GetName()); err != nil {
+		return fmt.Errorf("unable to drain node %s: %w", nc.node.GetName(), err)
+	}
+
+	current, err := nc.getServicesData(ctx, version.Get())
+	if err != nil {
+		return err
+	}
+	bootstrapFiles, err := nc.bootstrapFiles(ctx)
+	if err != nil {
+		return err
+	}
+	changedFiles, err := nc.Windows.ChangedPayloadFiles()
+	if err != nil {
+		return err
+	}
+	for path, data := range bootstrapFiles {
+		exists, err := nc.Windows.FileExists(path, fmt.Sprintf("%x", sha256.Sum256([]byte(data))))
+		if err != nil {
+			return fmt.Errorf("error checking if file '%s' exists on the Windows VM: %w", path, err)
+		}
+		if !exists {
+			changedFiles = append(changedFiles, path)
+		}
+	}
+	diff := servicescm.NewDiff(previous, current, withContainerd(changedFiles))
+	removeNetworks := networkChanged(diff)
+	nc.log.Info("upgrading in place", "updated services", diff.Updated, "restarted services", diff.Restarted,
+		"removed services", diff.Removed, "changed files", diff.ChangedFiles, "keeping HNS networks", !removeNetworks)
+	if nc.rollbackOnFailure {
+		if err := nc.Windows.BackupPayloadFiles(diff.ChangedFiles); err != nil {
+			return err
+		}
+	}
+	if err := nc.Windows.UpdatePayload(ctx, diff.Restarted, diff.Removed, removeNetworks); err != nil {
+		return fmt.Errorf("updating the payload on the Windows instance failed: %w", err)
+	}
+	if err := nc.write(bootstrapFiles); err != nil {
+		return err
+	}
+	if err := nc.createTLSCerts(ctx); err != nil {
+		return err
+	}
+	if err := nc.createRegistryConfigFiles(ctx); err != nil {
+		return err
+	}
+	if err := nc.SyncTrustedCABundle(ctx); err != nil {
+		return err
+	}
+	wicdKC, err := nc.generateWICDKubeconfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// WICD updates the changed services and starts the stopped ones, as it reconciles the services with the services
+	// ConfigMap of the desired version
+	enterPhase(wmcov1.PhaseConfiguringWICD)
+	if err := nc.Windows.ConfigureWICD(nc.wmcoNamespace, wicdKC); err != nil {
+		return fmt.Errorf("configuring WICD failed: %w", err)
+	}
+	if err := metadata.ApplyDesiredVersionAnnotation(ctx, nc.client, *nc.node, version.Get()); err != nil {
+		return fmt.Errorf("error updating desired version annotation on node %s: %w", nc.node.GetName(), err)
+	}
+
+	enterPhase(wmcov1.PhaseWaitingForVersion)
+	if err := metadata.WaitForVersionAnnotation(ctx, nc.client, nc.node.Name); err != nil {
+		return fmt.Errorf("error waiting for proper %s annotation for node %s: %w", metadata.VersionAnnotation,
+			nc.node.GetName(), err)
+	}
+	if err := nc.setNode(ctx, false); err != nil {
+		return fmt.Errorf("error getting node object: %w", err)
+	}
+	if err := drain.RunCordonOrUncordon(drainHelper, nc.node, false); err != nil {
+		return fmt.Errorf("error uncordoning the node %s: %w", nc.node.GetName(), err)
+	}
+	if err := metadata.RemoveUpgradingLabel(ctx, nc.client, nc.node); err != nil {
+		return fmt.Errorf("error removing upgrading label from node %s: %w", nc.node.GetName(), err)
+	}
+	if nc.rollbackOnFailure {
+		if err := nc.Windows.RemovePayloadBackup(); err != nil {
+			return err
+		}
+	}
+	nc.log.Info("instance has been upgraded in place", "version", nc.node.Annotations[metadata.VersionAnnotation])
+	return nil
+}
+
+// withContainerd returns the given changed file paths, along with the containerd binary if any of the files are in the
+// containerd directory. Files in the containerd directory, such as the containerd shim, are run by containerd.
+func withContainerd(changedFiles []string) []string {
+	for _, path := range changedFiles {
+		if strings.HasPrefix(strings.ToLower(path), strings.ToLower(windows.ContainerdDir+"\\")) {
+			return append(changedFiles, windows.ContainerdPath)
+		}
+	}
+	return changedFiles
+}
+
+// RepairPayload copies the payload files whose contents on the instance differ from the payload of this operator
+// version to the instance again. The services running the files are stopped while they are replaced, and started
+// again by WICD.
+func (nc *nodeConfig) RepairPayload(ctx context.Context) error {
+	if nc.node == nil {
+		return fmt.Errorf("payload repair of the instance requires an associated node")
+	}
+	changedFiles, err := nc.Windows.ChangedPayloadFiles()
+	if err != nil {
+		return err
+	}
+	if len(changedFiles) != 0 {
+		if err := nc.repairPayload(ctx, changedFiles); err != nil {
+			return err
+		}
+	}
+	return metadata.RemoveRepairAnnotation(ctx, nc.client, *nc.node)
+}
+
+// repairPayload replaces the given payload files on the instance, draining the node while they are replaced
+func (nc *nodeConfig) repairPayload(ctx context.Context, changedFiles []string) error {
+	current, err := nc.getServicesData(ctx, version.Get())
+	if err != nil {
+		return err
+	}
+	diff := servicescm.NewDiff(current, current, withContainerd(changedFiles))
+	nc.log.Info("repairing payload", "changed files", diff.ChangedFiles, "restarted services", diff.Restarted)
+
+	drainHelper := nc.newDrainHelper(ctx)
+	if err := drain.RunCordonOrUncordon(drainHelper, nc.node, true); err != nil {
+		return fmt.Errorf("unable to cordon node %s: %w", nc.node.GetName(), err)
+	}
+	if err := drain.RunNodeDrain(drainHelper, nc.node.GetName()); err != nil {
+		return fmt.Errorf("unable to drain node %s: %w", nc.node.GetName(), err)
+	}
+	if err := nc.Windows.UpdatePayload(ctx, diff.Restarted, nil, false); err != nil {
+		return fmt.Errorf("updating the payload on the Windows instance failed: %w", err)
+	}
+	wicdKC, err := nc.generateWICDKubeconfig(ctx)
+	if err != nil {
+		return err
+	}
+	if err := nc.Windows.ConfigureWICD(nc.wmcoNamespace, wicdKC); err != nil {
+		return fmt.Errorf("configuring WICD failed: %w", err)
+	}
+	if err := drain.RunCordonOrUncordon(drainHelper, nc.node, false); err != nil {
+		return fmt.Errorf("error uncordoning the node %s: %w", nc.node.GetName(), err)
+	}
+	return nil
+}
+
+// networkChanged returns true if the HNS networks of the instance must be created again for the given changes. The
+// networks are created by hybrid-overlay, and the HNS endpoint of the node by the network configuration script.
+func networkChanged(diff *servicescm.Diff) bool {
+	if diff.Affects(windows.HybridOverlayServiceName) {
+		return true
+	}
+	for _, path := range diff.ChangedFiles {
+		if strings.EqualFold(path, windows.HNSPSModule) || strings.EqualFold(path, windows.NetworkConfScriptPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// getServicesData returns the data of the services ConfigMap of the given WMCO version
+func (nc *nodeConfig) getServicesData(ctx context.Context, wmcoVersion string) (*servicescm.Data, error) {
+	cm := &core.ConfigMap{}
+	if err := nc.client.Get(ctx, types.NamespacedName{Namespace: nc.wmcoNamespace,
+		Name: servicescm.NamePrefix + wmcoVersion}, cm); err != nil {
+		return nil, fmt.Errorf("unable to get services ConfigMap of version %s: %w", wmcoVersion, err)
+	}
+	return servicescm.Parse(cm.Data)
+}
+
+// transferPayload generates the files required to configure the instance and copies them to it along with the
+// payload, returning the kubeconfig WICD runs with
+func (nc *nodeConfig) transferPayload(ctx context.Context) (string, error) {
+	if err := nc.createBootstrapFiles(ctx); err != nil {
+		return "", err
+	}
+	if err := nc.createTLSCerts(ctx); err != nil {
+		return "", err
+	}
+	if err := nc.createRegistryConfigFiles(ctx); err != nil {
+		return "", err
+	}
+	if err := nc.SyncTrustedCABundle(ctx); err != nil {
+		return "", err
+	}
+	wicdKC, err := nc.generateWICDKubeconfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := nc.Windows.TransferPayload(ctx, nc.wmcoNamespace, wicdKC); err != nil {
+		return "", fmt.Errorf("transferring the payload to the Windows instance failed: %w", err)
+	}
+	return wicdKC, nil
+}
+
+// SetRollbackOnFailure sets whether the instance is rolled back with Rollback if its upgrade fails. If it is, the
+// payload files replaced by an in-place upgrade are backed up on the instance, so that they can be restored.
+func (nc *nodeConfig) SetRollbackOnFailure(rollbackOnFailure bool) {
+	nc.rollbackOnFailure = rollbackOnFailure
+}
+
+// Rollback configures the node services described by the services ConfigMap of the given previous WMCO version, so
+// that a node which failed its upgrade with cause is back in service. The payload files replaced by the upgrade are
+// restored from their backup, so that the node services run the binaries of the previous version. WICD itself keeps
+// running at the current version. Once rolled back, the node is annotated as such and published as Failed with cause.
+func (nc *nodeConfig) Rollback(ctx context.Context, previousVersion string, cause error) error {
+	if nc.node == nil {
+		return fmt.Errorf("instance does not a have an associated node to roll back")
+	}
+	nc.log.Info("rolling back", "node", nc.node.GetName(), "version", previousVersion)
+	nc.recordPhase(ctx, wmcov1.PhaseRollingBack, nil)
+	if err := nc.rollback(ctx, previousVersion); err != nil {
+		nc.recordPhase(ctx, wmcov1.PhaseRollingBack, err)
+		return err
+	}
+	failedPhase := nc.failedPhase
+	if failedPhase == "" {
+		failedPhase = wmcov1.PhaseConnecting
+	}
+	nc.recordPhase(ctx, failedPhase, fmt.Errorf("rolled back to version %s: %w", previousVersion, cause))
+	return nil
+}
+
+// rollback performs the steps of Rollback
+func (nc *nodeConfig) rollback(ctx context.Context, previousVersion string) error {
+	wicdKC, err := nc.generateWICDKubeconfig(ctx)
+	if err != nil {
+		return err
+	}
+	if err := nc.Windows.RestorePayloadFiles(nc.wmcoNamespace, wicdKC); err != nil {
+		return err
+	}
+	if err := nc.Windows.Bootstrap(previousVersion, nc.wmcoNamespace); err != nil {
+		return fmt.Errorf("bootstrapping the Windows instance failed: %w", err)
+	}
+	if err := nc.Windows.ConfigureWICD(nc.wmcoNamespace, wicdKC); err != nil {
+		return fmt.Errorf("configuring WICD failed: %w", err)
+	}
+	// WICD configures the node services from the services ConfigMap of the desired version
+	if err := metadata.ApplyDesiredVersionAnnotation(ctx, nc.client, *nc.node, previousVersion); err != nil {
+		return fmt.Errorf("error updating desired version annotation on node %s: %w", nc.node.GetName(), err)
+	}
+	if err := metadata.WaitForVersionAnnotation(ctx, nc.client, nc.node.Name); err != nil {
+		return fmt.Errorf("error waiting for proper %s annotation for node %s: %w", metadata.VersionAnnotation,
+			nc.node.GetName(), err)
+	}
+	if err := nc.setNode(ctx, false); err != nil {
+		return fmt.Errorf("error getting node object: %w", err)
+	}
+	if err := drain.RunCordonOrUncordon(nc.newDrainHelper(ctx), nc.node, false); err != nil {
+		return fmt.Errorf("error uncordoning the node %s: %w", nc.node.GetName(), err)
+	}
+	if err := metadata.RemoveUpgradingLabel(ctx, nc.client, nc.node); err != nil {
+		return fmt.Errorf("error removing upgrading label from node %s: %w", nc.node.GetName(), err)
+	}
+	if err := metadata.RemoveRollbackVersionAnnotation(ctx, nc.client, nc.node, version.Get()); err != nil {
+		return err
+	}
+	nc.log.Info("instance has been rolled back", "version", previousVersion)
+	return nil
+}
+
+// applyInstanceLabelsAndTaints ensures the node has the labels and taints specified for the instance, and none of the
+// ones which were specified for it before but are not anymore
+func (nc *nodeConfig) applyInstanceLabelsAndTaints(ctx context.Context) error {
+	_, labelsApplied := nc.node.GetAnnotations()[metadata.InstanceLabelsAnnotation]
+	_, taintsApplied := nc.node.GetAnnotations()[metadata.InstanceTaintsAnnotation]
+	if len(nc.instanceLabels) == 0 && len(nc.taints) == 0 && !labelsApplied && !taintsApplied {
+		return nil
+	}
+	node, err := ApplyInstanceLabelsAndTaints(ctx, nc.client, nc.node.GetName(), nc.instanceLabels, nc.taints)
+	if err != nil {
+		return err
+	}
+	nc.node = node
+	return nil
+}
+
+// ApplyInstanceLabelsAndTaints ensures the node with the given name has the given labels and taints specified for its
+// instance, and none of the ones which were specified for it before but are not anymore. The node is returned.
+func ApplyInstanceLabelsAndTaints(ctx context.Context, c client.Client, nodeName string, labels map[string]string,
+	taints []core.Taint) (*core.Node, error) {
+	node := &core.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return nil, err
+	}
+	patchBase := client.MergeFrom(node.DeepCopy())
+	if !nodeutil.ApplyInstanceLabelsAndTaints(node, labels, taints) {
+		return node, nil
+	}
+	if err := c.Patch(ctx, node, patchBase); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// ApplyInstanceAnnotations ensures the node with the given name has the given annotations, and none of the given
+// managed annotations which are not given anymore. The node is returned.
+func ApplyInstanceAnnotations(ctx context.Context, c client.Client, nodeName string, annotations map[string]string,
+	managed []string) (*core.Node, error) {
+	node := &core.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return nil, err
+	}
+	patchBase := client.MergeFrom(node.DeepCopy())
+	if !nodeutil.ApplyInstanceAnnotations(node, annotations, managed) {
+		return node, nil
+	}
+	if err := c.Patch(ctx, node, patchBase); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
 // safeReboot safely restarts the underlying instance, first cordoning and draining the associated node.
 // Waits for reboot to take effect before uncordoning the node.
 func (nc *nodeConfig) SafeReboot(ctx context.Context) error {
@@ -327,20 +726,29 @@ func (nc *nodeConfig) createWICDServiceAccountTokenSecret(ctx context.Context) (
 
 // createBootstrapFiles creates all prerequisite files on the node required to start kubelet using latest ignition spec
 func (nc *nodeConfig) createBootstrapFiles(ctx context.Context) error {
-	filePathsToContents := make(map[string]string)
-	filePathsToContents, err := nc.createFilesFromIgnition(ctx)
+	filePathsToContents, err := nc.bootstrapFiles(ctx)
 	if err != nil {
 		return err
 	}
+	return nc.write(filePathsToContents)
+}
+
+// bootstrapFiles returns the contents and write locations on the instance of all prerequisite files required to start
+// kubelet
+func (nc *nodeConfig) bootstrapFiles(ctx context.Context) (map[string]string, error) {
+	filePathsToContents, err := nc.createFilesFromIgnition(ctx)
+	if err != nil {
+		return nil, err
+	}
 	filePathsToContents[windows.BootstrapKubeconfigPath], err = nc.generateBootstrapKubeconfig(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	filePathsToContents[windows.KubeletConfigPath], err = createKubeletConf(nc.clusterServiceCIDR)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nc.write(filePathsToContents)
+	return filePathsToContents, nil
 }
 
 // write outputs the data to the path on the underlying Windows instance for each given pair. Creates files if needed.
@@ -450,8 +858,8 @@ func createKubeletConf(clusterServiceCIDR string) (string, error) {
 // nodeConfig object. If quickCheck is set, the function does a quicker check for the node which is useful in the node
 // reconfiguration case.
 func (nc *nodeConfig) setNode(ctx context.Context, quickCheck bool) error {
-	retryInterval := retry.Interval
-	retryTimeout := retry.Timeout
+	retryInterval := retry.Get().Interval
+	retryTimeout := retry.Get().Timeout
 	if quickCheck {
 		retryInterval = 10 * time.Second
 		retryTimeout = 30 * time.Second
@@ -473,6 +881,13 @@ func (nc *nodeConfig) setNode(ctx context.Context, quickCheck bool) error {
 			nc.node = node
 			return true, nil
 		}
+		// a node registered with an overridden IP may not report the address used to configure it
+		if nc.nodeIP != "" {
+			if node := nodeutil.FindByAddress(nc.nodeIP, nodes); node != nil {
+				nc.node = node
+				return true, nil
+			}
+		}
 		return false, nil
 	})
 	if err != nil {
@@ -502,6 +917,16 @@ func (nc *nodeConfig) Deconfigure(ctx context.Context) error {
 	if nc.node == nil {
 		return fmt.Errorf("instance does not a have an associated node to deconfigure")
 	}
+	nc.recordPhase(ctx, wmcov1.PhaseDeconfiguring, nil)
+	if err := nc.deconfigure(ctx); err != nil {
+		nc.recordPhase(ctx, wmcov1.PhaseDeconfiguring, err)
+		return err
+	}
+	return nil
+}
+
+// deconfigure performs the steps of Deconfigure
+func (nc *nodeConfig) deconfigure(ctx context.Context) error {
 	nc.log.Info("deconfiguring")
 	// Cordon and drain the Node before we interact with the instance
 	drainHelper := nc.newDrainHelper(ctx)
@@ -1,6 +1,7 @@
 package nodeconfig
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,6 +9,9 @@ import (
 	core "k8s.io/api/core/v1"
 	config "k8s.io/kubelet/config/v1"
 	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
 
 func TestNewKubeConfigFromSecret(t *testing.T) {
@@ -148,3 +152,38 @@ func TestModifyCredentialProviderConfig(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, expected, output)
 }
+
+func TestNetworkChanged(t *testing.T) {
+	testCases := []struct {
+		name     string
+		diff     *servicescm.Diff
+		expected bool
+	}{
+		{
+			name:     "no changes",
+			diff:     &servicescm.Diff{},
+			expected: false,
+		},
+		{
+			name: "hybrid-overlay restarted for a new binary",
+			diff: &servicescm.Diff{Restarted: []string{windows.HybridOverlayServiceName},
+				ChangedFiles: []string{strings.ToLower(windows.HybridOverlayPath)}},
+			expected: false,
+		},
+		{
+			name:     "hybrid-overlay definition changed",
+			diff:     &servicescm.Diff{Updated: []string{windows.HybridOverlayServiceName}},
+			expected: true,
+		},
+		{
+			name:     "network configuration script changed",
+			diff:     &servicescm.Diff{ChangedFiles: []string{strings.ToLower(windows.NetworkConfScriptPath)}},
+			expected: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, networkChanged(test.diff))
+		})
+	}
+}
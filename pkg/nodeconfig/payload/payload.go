@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"strings"
+	"sync"
 )
 
 // Payload files
@@ -296,21 +297,37 @@ Compare-And-Replace-Config -ConfigPath $kubeProxyConfigPath -NewConfigContent $k
 `
 )
 
+var (
+	// checksumsMu guards checksums
+	checksumsMu sync.Mutex
+	// checksums holds the SHA256 checksum of each file read by NewFileInfo, keyed by path. The payload does not change
+	// for the lifetime of the operator, so each file is only read and hashed once.
+	checksums = make(map[string]string)
+)
+
 // FileInfo contains information about a file
 type FileInfo struct {
 	Path   string
 	SHA256 string
 }
 
-// NewFileInfo returns a pointer to a FileInfo object created from the specified file
+// NewFileInfo returns a pointer to a FileInfo object created from the specified file. The checksum of the file is
+// computed the first time it is requested, and reused afterwards.
 func NewFileInfo(path string) (*FileInfo, error) {
-	contents, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not get contents of file: %w", err)
+	checksumsMu.Lock()
+	defer checksumsMu.Unlock()
+	checksum, present := checksums[path]
+	if !present {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not get contents of file: %w", err)
+		}
+		checksum = fmt.Sprintf("%x", sha256.Sum256(contents))
+		checksums[path] = checksum
 	}
 	return &FileInfo{
 		Path:   path,
-		SHA256: fmt.Sprintf("%x", sha256.Sum256(contents)),
+		SHA256: checksum,
 	}, nil
 }
 
@@ -321,7 +338,14 @@ func PopulateNetworkConfScript(clusterCIDR, hnsNetworkName, hnsPSModulePath, cni
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(NetworkConfigurationScript, []byte(scriptContents), fs.ModePerm)
+	if err = ioutil.WriteFile(NetworkConfigurationScript, []byte(scriptContents), fs.ModePerm); err != nil {
+		return err
+	}
+	// The script is generated, its checksum must be computed from the new contents
+	checksumsMu.Lock()
+	defer checksumsMu.Unlock()
+	delete(checksums, NetworkConfigurationScript)
+	return nil
 }
 
 // generateNetworkConfigScript generates the contents of the .ps1 file responsible for CNI configuration
@@ -1,6 +1,10 @@
 package payload
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -227,3 +231,20 @@ Compare-And-Replace-Config -ConfigPath $kubeProxyConfigPath -NewConfigContent $k
 	require.NoError(t, err)
 	assert.Equal(t, string(expectedOut), actual)
 }
+
+func TestNewFileInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubelet.exe")
+	require.NoError(t, os.WriteFile(path, []byte("kubelet"), 0644))
+	info, err := NewFileInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte("kubelet"))), info.SHA256)
+
+	// The checksum is computed once, the payload does not change while the operator runs
+	require.NoError(t, os.Remove(path))
+	cached, err := NewFileInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, info, cached)
+
+	_, err = NewFileInfo(filepath.Join(t.TempDir(), "missing.exe"))
+	assert.Error(t, err)
+}
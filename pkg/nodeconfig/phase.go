@@ -0,0 +1,78 @@
+package nodeconfig
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+)
+
+// PhaseRecorder publishes the configuration phase of an instance on an object other than its Node, such as the
+// Machine or WindowsInstance associated with the instance
+type PhaseRecorder interface {
+	// RecordPhase publishes that the instance has entered the given phase. If err is not nil, the given phase failed
+	// with err and the instance should be published as Failed.
+	RecordPhase(ctx context.Context, phase wmcov1.InstancePhase, err error) error
+}
+
+// annotationPhaseRecorder publishes the configuration phase of an instance as annotations on an object
+type annotationPhaseRecorder struct {
+	client client.Client
+	obj    client.Object
+}
+
+// NewAnnotationPhaseRecorder returns a PhaseRecorder which publishes the configuration phase as annotations on the
+// given object
+func NewAnnotationPhaseRecorder(c client.Client, obj client.Object) PhaseRecorder {
+	return &annotationPhaseRecorder{client: c, obj: obj}
+}
+
+// RecordPhase applies the phase annotations to the object. If err is not nil, the phase annotation is set to Failed
+// and the phase error annotation describes the phase that failed.
+func (a *annotationPhaseRecorder) RecordPhase(ctx context.Context, phase wmcov1.InstancePhase, err error) error {
+	publishedPhase, failure := string(phase), ""
+	if err != nil {
+		publishedPhase = string(wmcov1.PhaseFailed)
+		failure = fmt.Sprintf("%s: %s", phase, err)
+	}
+	return metadata.ApplyPhaseAnnotations(ctx, a.client, a.obj, publishedPhase, failure)
+}
+
+// RecordPhase publishes the given configuration phase on the given node and with the given recorder, when they are not
+// nil. If err is not nil, the instance is published as Failed along with the phase that failed. Failures to publish
+// are logged, as they should not interrupt the configuration of the instance.
+func RecordPhase(ctx context.Context, c client.Client, log logr.Logger, node *core.Node, recorder PhaseRecorder,
+	phase wmcov1.InstancePhase, err error) {
+	if err != nil {
+		log.Info("phase failed", "phase", phase, "error", err)
+		metrics.ConfigurationFailures.WithLabelValues(string(phase)).Inc()
+	} else {
+		log.V(1).Info("entering phase", "phase", phase)
+	}
+	if node != nil {
+		if err := NewAnnotationPhaseRecorder(c, node).RecordPhase(ctx, phase, err); err != nil {
+			log.Error(err, "unable to publish phase on node", "node", node.GetName(), "phase", phase)
+		}
+	}
+	if recorder != nil {
+		if err := recorder.RecordPhase(ctx, phase, err); err != nil {
+			log.Error(err, "unable to publish phase", "phase", phase)
+		}
+	}
+}
+
+// SetPhaseRecorder sets the recorder the configuration phase is published with, in addition to the node annotations
+func (nc *nodeConfig) SetPhaseRecorder(recorder PhaseRecorder) {
+	nc.phaseRecorder = recorder
+}
+
+// recordPhase publishes the given configuration phase of the instance. If err is not nil, the phase failed with err.
+func (nc *nodeConfig) recordPhase(ctx context.Context, phase wmcov1.InstancePhase, err error) {
+	RecordPhase(ctx, nc.client, nc.log, nc.node, nc.phaseRecorder, phase, err)
+}
@@ -0,0 +1,72 @@
+package nodestatus
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// WindowsServicesHealthy indicates the Windows services defined in the services ConfigMap are running and passing
+	// their liveness checks
+	WindowsServicesHealthy core.NodeConditionType = "WindowsServicesHealthy"
+	// HNSNetworkReady indicates the HNS network of the hybrid overlay exists
+	HNSNetworkReady core.NodeConditionType = "HNSNetworkReady"
+	// ContainerdHealthy indicates the containerd service is running and serving its API
+	ContainerdHealthy core.NodeConditionType = "ContainerdHealthy"
+	// ProxyEnvSynced indicates the environment variables of the instance, including the cluster-wide proxy settings, are
+	// set and picked up by its processes
+	ProxyEnvSynced core.NodeConditionType = "ProxyEnvSynced"
+)
+
+// NewCondition returns a node condition of the given type, which is true if ok is, with the given reason and message
+func NewCondition(conditionType core.NodeConditionType, ok bool, reason, message string) core.NodeCondition {
+	status := core.ConditionFalse
+	if ok {
+		status = core.ConditionTrue
+	}
+	return core.NodeCondition{Type: conditionType, Status: status, Reason: reason, Message: message}
+}
+
+// SetConditions patches the status of the given node with the given conditions, leaving its other conditions as they
+// are. The transition time of a condition is kept if its status does not change. The node is only patched if a
+// condition is added, or its status, reason or message changes, so that its heartbeat time is when it last changed.
+func SetConditions(ctx context.Context, c client.Client, node core.Node, conditions []core.NodeCondition) error {
+	patched := node.DeepCopy()
+	now := meta.Now()
+	changed := false
+	for _, condition := range conditions {
+		condition.LastHeartbeatTime = now
+		condition.LastTransitionTime = now
+		replaced := false
+		for i, existing := range patched.Status.Conditions {
+			if existing.Type != condition.Type {
+				continue
+			}
+			replaced = true
+			if existing.Status == condition.Status && existing.Reason == condition.Reason &&
+				existing.Message == condition.Message {
+				break
+			}
+			if existing.Status == condition.Status {
+				condition.LastTransitionTime = existing.LastTransitionTime
+			}
+			patched.Status.Conditions[i] = condition
+			changed = true
+		}
+		if !replaced {
+			patched.Status.Conditions = append(patched.Status.Conditions, condition)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := c.Status().Patch(ctx, patched, client.StrategicMergeFrom(&node)); err != nil {
+		return fmt.Errorf("unable to set conditions on node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package nodestatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSetConditions(t *testing.T) {
+	transitionTime := meta.NewTime(time.Unix(1700000000, 0))
+	node := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node"},
+		Status: core.NodeStatus{Conditions: []core.NodeCondition{
+			{Type: core.NodeReady, Status: core.ConditionTrue, LastTransitionTime: transitionTime},
+			{Type: ContainerdHealthy, Status: core.ConditionTrue, LastTransitionTime: transitionTime},
+			{Type: ProxyEnvSynced, Status: core.ConditionTrue, LastTransitionTime: transitionTime},
+		}},
+	}
+	c := clientfake.NewClientBuilder().WithObjects(node).WithStatusSubresource(node).Build()
+
+	require.NoError(t, SetConditions(context.Background(), c, *node, []core.NodeCondition{
+		NewCondition(ContainerdHealthy, true, "ContainerdRunning", "containerd is running"),
+		NewCondition(ProxyEnvSynced, false, "EnvironmentVarsNotSynced", "waiting for reboot"),
+		NewCondition(HNSNetworkReady, true, "HNSNetworkFound", "network found"),
+	}))
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: "node"}, node))
+
+	conditions := make(map[core.NodeConditionType]core.NodeCondition)
+	for _, condition := range node.Status.Conditions {
+		conditions[condition.Type] = condition
+	}
+	require.Len(t, conditions, 4)
+	assert.Equal(t, core.ConditionTrue, conditions[core.NodeReady].Status)
+	// Conditions whose status is unchanged keep their transition time
+	assert.Equal(t, core.ConditionTrue, conditions[ContainerdHealthy].Status)
+	assert.Equal(t, "ContainerdRunning", conditions[ContainerdHealthy].Reason)
+	assert.True(t, transitionTime.Time.Equal(conditions[ContainerdHealthy].LastTransitionTime.Time))
+	assert.Equal(t, core.ConditionFalse, conditions[ProxyEnvSynced].Status)
+	assert.False(t, transitionTime.Time.Equal(conditions[ProxyEnvSynced].LastTransitionTime.Time))
+	assert.Equal(t, core.ConditionTrue, conditions[HNSNetworkReady].Status)
+
+	// Conditions which are unchanged do not update the node
+	resourceVersion := node.ResourceVersion
+	require.NoError(t, SetConditions(context.Background(), c, *node, []core.NodeCondition{
+		NewCondition(ContainerdHealthy, true, "ContainerdRunning", "containerd is running"),
+		NewCondition(HNSNetworkReady, true, "HNSNetworkFound", "network found"),
+	}))
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: "node"}, node))
+	assert.Equal(t, resourceVersion, node.ResourceVersion)
+
+	// A change of message updates the condition, keeping its transition time
+	require.NoError(t, SetConditions(context.Background(), c, *node, []core.NodeCondition{
+		NewCondition(ContainerdHealthy, true, "ContainerdRunning", "containerd is serving its API"),
+	}))
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: "node"}, node))
+	assert.NotEqual(t, resourceVersion, node.ResourceVersion)
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == ContainerdHealthy {
+			assert.Equal(t, "containerd is serving its API", condition.Message)
+			assert.True(t, transitionTime.Time.Equal(condition.LastTransitionTime.Time))
+		}
+	}
+}
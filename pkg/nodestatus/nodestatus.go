@@ -0,0 +1,86 @@
+package nodestatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+)
+
+// ServiceNotFound is the state of a service which does not exist on the instance
+const ServiceNotFound = "NotFound"
+
+// ServiceStatus describes the state of a Windows service defined in the services ConfigMap
+type ServiceStatus struct {
+	// Name is the name of the service
+	Name string `json:"name"`
+	// State is the state of the service, such as Running or Stopped, or NotFound if the service does not exist
+	State string `json:"state"`
+	// Command is the command the service runs with
+	Command string `json:"command,omitempty"`
+	// ExpectedCommand is the command the service should run with, once the variables in its definition are resolved
+	ExpectedCommand string `json:"expectedCommand,omitempty"`
+}
+
+// Status describes the state of the Windows services and configuration of a node's underlying instance, as reported by
+// WICD at the end of each reconcile
+type Status struct {
+	// DesiredVersion is the version of the services ConfigMap the instance was reconciled against
+	DesiredVersion string `json:"desiredVersion,omitempty"`
+	// LastReconcileTime is when WICD last reconciled the instance with a change in its status
+	LastReconcileTime meta.Time `json:"lastReconcileTime"`
+	// LastError is the error the last reconcile failed with, if any
+	LastError string `json:"lastError,omitempty"`
+	// Services describes the state of each service defined in the services ConfigMap
+	Services []ServiceStatus `json:"services,omitempty"`
+	// EnvironmentVarsSynced indicates the environment variables set on the instance, and picked up by its processes,
+	// match the services ConfigMap
+	EnvironmentVarsSynced bool `json:"environmentVarsSynced"`
+	// CertificatesSynced indicates the trusted CA certificates of the instance match the cluster's trusted CA bundle
+	CertificatesSynced bool `json:"certificatesSynced"`
+}
+
+// Get returns the status last reported by WICD on the given node, or nil if WICD has not reported any
+func Get(node *core.Node) (*Status, error) {
+	value, present := node.GetAnnotations()[metadata.WICDStatusAnnotation]
+	if !present {
+		return nil, nil
+	}
+	var status Status
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		return nil, fmt.Errorf("error parsing WICD status of node %s: %w", node.GetName(), err)
+	}
+	return &status, nil
+}
+
+// Apply sets the given status as the WICD status of the given node. The node is not patched if its current status only
+// differs from the given one by its reconcile time, so that reconciles which change nothing do not update the node.
+func Apply(ctx context.Context, c client.Client, node core.Node, status *Status) error {
+	// A status which cannot be parsed is overwritten
+	if current, err := Get(&node); err == nil && current != nil {
+		current.LastReconcileTime = status.LastReconcileTime
+		if equality.Semantic.DeepEqual(current, status) {
+			return nil
+		}
+	}
+	value, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("error marshalling WICD status: %w", err)
+	}
+	patchData, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{
+		"annotations": map[string]string{metadata.WICDStatusAnnotation: string(value)}}})
+	if err != nil {
+		return fmt.Errorf("error creating WICD status patch request: %w", err)
+	}
+	if err = c.Patch(ctx, &node, client.RawPatch(kubeTypes.MergePatchType, patchData)); err != nil {
+		return fmt.Errorf("unable to apply WICD status on node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
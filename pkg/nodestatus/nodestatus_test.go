@@ -0,0 +1,65 @@
+package nodestatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+)
+
+func TestApplyAndGet(t *testing.T) {
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"}}
+	c := clientfake.NewClientBuilder().WithObjects(node).Build()
+
+	status, err := Get(node)
+	require.NoError(t, err)
+	assert.Nil(t, status)
+
+	expected := &Status{
+		DesiredVersion:    "1.0.0",
+		LastReconcileTime: meta.NewTime(time.Unix(1700000000, 0)),
+		LastError:         "error reconciling services",
+		Services: []ServiceStatus{
+			{Name: "kubelet", State: "Running", Command: "kubelet.exe", ExpectedCommand: "kubelet.exe"},
+			{Name: "kube-proxy", State: ServiceNotFound, ExpectedCommand: "kube-proxy.exe"},
+		},
+		CertificatesSynced: true,
+	}
+	require.NoError(t, Apply(context.Background(), c, *node, expected))
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: "node"}, node))
+	status, err = Get(node)
+	require.NoError(t, err)
+	assert.True(t, expected.LastReconcileTime.Equal(&status.LastReconcileTime))
+	status.LastReconcileTime = expected.LastReconcileTime
+	assert.Equal(t, expected, status)
+
+	// A status which only differs by its reconcile time does not update the node
+	resourceVersion := node.ResourceVersion
+	unchanged := *expected
+	unchanged.LastReconcileTime = meta.NewTime(time.Unix(1700000600, 0))
+	require.NoError(t, Apply(context.Background(), c, *node, &unchanged))
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: "node"}, node))
+	assert.Equal(t, resourceVersion, node.ResourceVersion)
+
+	changed := unchanged
+	changed.LastError = ""
+	require.NoError(t, Apply(context.Background(), c, *node, &changed))
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Name: "node"}, node))
+	assert.NotEqual(t, resourceVersion, node.ResourceVersion)
+	status, err = Get(node)
+	require.NoError(t, err)
+	assert.Empty(t, status.LastError)
+	assert.True(t, changed.LastReconcileTime.Equal(&status.LastReconcileTime))
+
+	node.Annotations[metadata.WICDStatusAnnotation] = "invalid"
+	_, err = Get(node)
+	assert.Error(t, err)
+}
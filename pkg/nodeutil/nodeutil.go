@@ -1,7 +1,12 @@
 package nodeutil
 
 import (
+	"sort"
+	"strings"
+
 	core "k8s.io/api/core/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 )
 
 // FindByAddress returns a pointer to the node within the given list with an address matching the given address, or
@@ -16,3 +21,150 @@ func FindByAddress(address string, nodes *core.NodeList) *core.Node {
 	}
 	return nil
 }
+
+// MergeTaints returns the given existing taints with the desired taints added to them, and a boolean indicating if the
+// result differs from the existing taints. A desired taint replaces any existing taint with the same key and effect.
+func MergeTaints(existing, desired []core.Taint) ([]core.Taint, bool) {
+	merged := append([]core.Taint{}, existing...)
+	changed := false
+	for _, taint := range desired {
+		found := false
+		for i := range merged {
+			if !merged[i].MatchTaint(&taint) {
+				continue
+			}
+			found = true
+			if merged[i].Value != taint.Value {
+				merged[i].Value = taint.Value
+				changed = true
+			}
+			break
+		}
+		if !found {
+			merged = append(merged, taint)
+			changed = true
+		}
+	}
+	return merged, changed
+}
+
+// ApplyInstanceLabelsAndTaints sets the labels and taints given in the description of the instance of the given node
+// on it, and removes the labels and taints that were previously given for the instance but are not anymore. The labels
+// and taints given for the instance are recorded in annotations, so that labels and taints set on the node by other
+// means are left as they are. Returns true if the node was changed.
+func ApplyInstanceLabelsAndTaints(node *core.Node, labels map[string]string, taints []core.Taint) bool {
+	changed := false
+	for _, key := range splitKeys(node.GetAnnotations()[metadata.InstanceLabelsAnnotation]) {
+		if _, given := labels[key]; given {
+			continue
+		}
+		if _, present := node.Labels[key]; present {
+			delete(node.Labels, key)
+			changed = true
+		}
+	}
+	labelKeys := make([]string, 0, len(labels))
+	for key, value := range labels {
+		labelKeys = append(labelKeys, key)
+		if current, present := node.Labels[key]; present && current == value {
+			continue
+		}
+		if node.Labels == nil {
+			node.Labels = make(map[string]string)
+		}
+		node.Labels[key] = value
+		changed = true
+	}
+
+	given := make(map[string]bool, len(taints))
+	taintKeys := make([]string, 0, len(taints))
+	for _, taint := range taints {
+		given[taintKey(taint)] = true
+		taintKeys = append(taintKeys, taintKey(taint))
+	}
+	previous := make(map[string]bool)
+	for _, key := range splitKeys(node.GetAnnotations()[metadata.InstanceTaintsAnnotation]) {
+		previous[key] = true
+	}
+	var kept []core.Taint
+	for _, taint := range node.Spec.Taints {
+		if previous[taintKey(taint)] && !given[taintKey(taint)] {
+			continue
+		}
+		kept = append(kept, taint)
+	}
+	merged, taintsChanged := MergeTaints(kept, taints)
+	if taintsChanged || len(kept) != len(node.Spec.Taints) {
+		node.Spec.Taints = merged
+		changed = true
+	}
+
+	if setKeysAnnotation(node, metadata.InstanceLabelsAnnotation, labelKeys) {
+		changed = true
+	}
+	if setKeysAnnotation(node, metadata.InstanceTaintsAnnotation, taintKeys) {
+		changed = true
+	}
+	return changed
+}
+
+// ApplyInstanceAnnotations sets the given annotations on the given node, and removes the annotations with one of the
+// given managed keys which are not given anymore. Annotations with other keys are left as they are. Returns true if
+// the node was changed.
+func ApplyInstanceAnnotations(node *core.Node, annotations map[string]string, managed []string) bool {
+	changed := false
+	for _, key := range managed {
+		if _, given := annotations[key]; given {
+			continue
+		}
+		if _, present := node.Annotations[key]; present {
+			delete(node.Annotations, key)
+			changed = true
+		}
+	}
+	for key, value := range annotations {
+		if current, present := node.Annotations[key]; present && current == value {
+			continue
+		}
+		if node.Annotations == nil {
+			node.Annotations = make(map[string]string)
+		}
+		node.Annotations[key] = value
+		changed = true
+	}
+	return changed
+}
+
+// taintKey identifies the given taint by its key and effect, as a node cannot have two taints with the same key and
+// effect
+func taintKey(taint core.Taint) string {
+	return taint.Key + ":" + string(taint.Effect)
+}
+
+// splitKeys returns the keys held in the given comma separated list
+func splitKeys(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// setKeysAnnotation sets the annotation with the given name on the node to the given keys, sorted and comma separated.
+// The annotation is removed if there are no keys. Returns true if the annotation was changed.
+func setKeysAnnotation(node *core.Node, name string, keys []string) bool {
+	sort.Strings(keys)
+	value := strings.Join(keys, ",")
+	current, present := node.Annotations[name]
+	if value == "" {
+		delete(node.Annotations, name)
+		return present
+	}
+	if present && current == value {
+		return false
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	node.Annotations[name] = value
+	return true
+}
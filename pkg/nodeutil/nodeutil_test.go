@@ -6,6 +6,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 )
 
 func TestFindNode(t *testing.T) {
@@ -77,3 +79,180 @@ func TestFindNode(t *testing.T) {
 	}
 
 }
+
+func TestMergeTaints(t *testing.T) {
+	noSchedule := core.Taint{Key: "os", Value: "windows", Effect: core.TaintEffectNoSchedule}
+	noExecute := core.Taint{Key: "os", Value: "windows", Effect: core.TaintEffectNoExecute}
+	testCases := []struct {
+		name            string
+		existing        []core.Taint
+		desired         []core.Taint
+		expectedOut     []core.Taint
+		expectedChanged bool
+	}{
+		{
+			name:            "nothing desired",
+			existing:        []core.Taint{noSchedule},
+			desired:         nil,
+			expectedOut:     []core.Taint{noSchedule},
+			expectedChanged: false,
+		},
+		{
+			name:            "already present",
+			existing:        []core.Taint{noSchedule},
+			desired:         []core.Taint{noSchedule},
+			expectedOut:     []core.Taint{noSchedule},
+			expectedChanged: false,
+		},
+		{
+			name:            "new taint",
+			existing:        []core.Taint{noSchedule},
+			desired:         []core.Taint{noExecute},
+			expectedOut:     []core.Taint{noSchedule, noExecute},
+			expectedChanged: true,
+		},
+		{
+			name:            "value changed",
+			existing:        []core.Taint{noSchedule},
+			desired:         []core.Taint{{Key: "os", Value: "win", Effect: core.TaintEffectNoSchedule}},
+			expectedOut:     []core.Taint{{Key: "os", Value: "win", Effect: core.TaintEffectNoSchedule}},
+			expectedChanged: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, changed := MergeTaints(test.existing, test.desired)
+			assert.Equal(t, test.expectedOut, out)
+			assert.Equal(t, test.expectedChanged, changed)
+		})
+	}
+}
+
+func TestApplyInstanceLabelsAndTaints(t *testing.T) {
+	noSchedule := core.Taint{Key: "os", Value: "windows", Effect: core.TaintEffectNoSchedule}
+	noExecute := core.Taint{Key: "os", Value: "windows", Effect: core.TaintEffectNoExecute}
+	other := core.Taint{Key: "other", Effect: core.TaintEffectNoSchedule}
+	node := func(labels, annotations map[string]string, taints ...core.Taint) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Labels: labels, Annotations: annotations},
+			Spec: core.NodeSpec{Taints: taints}}
+	}
+	testCases := []struct {
+		name            string
+		node            *core.Node
+		labels          map[string]string
+		taints          []core.Taint
+		expectedNode    *core.Node
+		expectedChanged bool
+	}{
+		{
+			name:            "nothing given",
+			node:            node(map[string]string{"other": "x"}, nil, other),
+			expectedNode:    node(map[string]string{"other": "x"}, nil, other),
+			expectedChanged: false,
+		},
+		{
+			name:   "labels and taints applied",
+			node:   node(map[string]string{"other": "x"}, nil, other),
+			labels: map[string]string{"tier": "web", "zone": "a"},
+			taints: []core.Taint{noSchedule},
+			expectedNode: node(map[string]string{"other": "x", "tier": "web", "zone": "a"},
+				map[string]string{metadata.InstanceLabelsAnnotation: "tier,zone",
+					metadata.InstanceTaintsAnnotation: "os:NoSchedule"}, other, noSchedule),
+			expectedChanged: true,
+		},
+		{
+			name: "already applied",
+			node: node(map[string]string{"tier": "web"}, map[string]string{metadata.InstanceLabelsAnnotation: "tier",
+				metadata.InstanceTaintsAnnotation: "os:NoSchedule"}, noSchedule),
+			labels: map[string]string{"tier": "web"},
+			taints: []core.Taint{noSchedule},
+			expectedNode: node(map[string]string{"tier": "web"},
+				map[string]string{metadata.InstanceLabelsAnnotation: "tier",
+					metadata.InstanceTaintsAnnotation: "os:NoSchedule"}, noSchedule),
+			expectedChanged: false,
+		},
+		{
+			name: "labels and taints no longer given are removed",
+			node: node(map[string]string{"other": "x", "tier": "web", "zone": "a"},
+				map[string]string{metadata.InstanceLabelsAnnotation: "tier,zone",
+					metadata.InstanceTaintsAnnotation: "os:NoExecute,os:NoSchedule"}, other, noSchedule, noExecute),
+			labels: map[string]string{"zone": "b"},
+			taints: []core.Taint{noSchedule},
+			expectedNode: node(map[string]string{"other": "x", "zone": "b"},
+				map[string]string{metadata.InstanceLabelsAnnotation: "zone",
+					metadata.InstanceTaintsAnnotation: "os:NoSchedule"}, other, noSchedule),
+			expectedChanged: true,
+		},
+		{
+			name: "all removed",
+			node: node(map[string]string{"other": "x", "tier": "web"},
+				map[string]string{metadata.InstanceLabelsAnnotation: "tier",
+					metadata.InstanceTaintsAnnotation: "os:NoSchedule"}, other, noSchedule),
+			expectedNode:    node(map[string]string{"other": "x"}, map[string]string{}, other),
+			expectedChanged: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			changed := ApplyInstanceLabelsAndTaints(test.node, test.labels, test.taints)
+			assert.Equal(t, test.expectedChanged, changed)
+			assert.Equal(t, test.expectedNode, test.node)
+		})
+	}
+}
+
+func TestApplyInstanceAnnotations(t *testing.T) {
+	managed := []string{"port", "options", "jump-hosts"}
+	node := func(annotations map[string]string) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: annotations}}
+	}
+	testCases := []struct {
+		name            string
+		node            *core.Node
+		annotations     map[string]string
+		expectedNode    *core.Node
+		expectedChanged bool
+	}{
+		{
+			name:            "nothing given",
+			node:            node(map[string]string{"other": "x"}),
+			expectedNode:    node(map[string]string{"other": "x"}),
+			expectedChanged: false,
+		},
+		{
+			name:            "annotations applied",
+			node:            node(nil),
+			annotations:     map[string]string{"port": "2222", "options": "user=admin"},
+			expectedNode:    node(map[string]string{"port": "2222", "options": "user=admin"}),
+			expectedChanged: true,
+		},
+		{
+			name:            "already applied",
+			node:            node(map[string]string{"other": "x", "port": "2222"}),
+			annotations:     map[string]string{"port": "2222"},
+			expectedNode:    node(map[string]string{"other": "x", "port": "2222"}),
+			expectedChanged: false,
+		},
+		{
+			name:            "changed value updated",
+			node:            node(map[string]string{"port": "2222"}),
+			annotations:     map[string]string{"port": "2223"},
+			expectedNode:    node(map[string]string{"port": "2223"}),
+			expectedChanged: true,
+		},
+		{
+			name:            "annotations no longer given are removed",
+			node:            node(map[string]string{"other": "x", "port": "2222", "jump-hosts": "bastion"}),
+			annotations:     map[string]string{"port": "2222"},
+			expectedNode:    node(map[string]string{"other": "x", "port": "2222"}),
+			expectedChanged: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			changed := ApplyInstanceAnnotations(test.node, test.annotations, managed)
+			assert.Equal(t, test.expectedChanged, changed)
+			assert.Equal(t, test.expectedNode, test.node)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package operatorconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
+)
+
+const (
+	// DefaultMaxParallelUpgrades is the maximum number of nodes that can be upgraded in parallel when not configured
+	DefaultMaxParallelUpgrades = 1
+	// DefaultMaxUnhealthyCount is the maximum number of unhealthy Machines allowed in a MachineSet when not configured
+	DefaultMaxUnhealthyCount = 1
+	// DefaultWICDReconcilePeriod is how often WICD reconciles the Windows services when not configured
+	DefaultWICDReconcilePeriod = 2 * time.Minute
+	// DefaultCanaryCount is the number of canary nodes upgraded ahead of the others when not configured
+	DefaultCanaryCount = 1
+	// DefaultCanarySoakPeriod is how long canary nodes must stay Ready after their upgrade when not configured
+	DefaultCanarySoakPeriod = 30 * time.Minute
+)
+
+// Settings are the operator settings in effect, with defaults applied for anything not configured
+type Settings struct {
+	// MaxParallelUpgrades is the maximum number of nodes that can be upgraded in parallel
+	MaxParallelUpgrades int
+	// MaxUnhealthyCount is the maximum number of unhealthy Machines allowed in a Windows MachineSet
+	MaxUnhealthyCount int32
+	// DebugLogging indicates if debug logging has been requested
+	DebugLogging bool
+	// WICDReconcilePeriod is how often WICD reconciles the Windows services
+	WICDReconcilePeriod time.Duration
+	// Retry holds the wait times used when retrying operations
+	Retry retry.Settings
+	// UpgradeStrategy describes how nodes are rolled over to a new operator version
+	UpgradeStrategy UpgradeStrategy
+	// WindowsExporter configures windows_exporter on top of the collectors and flags set by the operator
+	WindowsExporter WindowsExporter
+}
+
+// WindowsExporter configures windows_exporter on top of the collectors and flags set by the operator
+type WindowsExporter struct {
+	// AdditionalCollectors are the collectors enabled alongside the default ones
+	AdditionalCollectors []string
+	// CollectorFlags are collector-specific flags, keyed by flag name without the leading dashes
+	CollectorFlags map[string]string
+	// ScrapeTimeoutMargin is subtracted from the scrape timeout given by Prometheus. Zero means the windows_exporter
+	// default is used.
+	ScrapeTimeoutMargin time.Duration
+}
+
+// UpgradeStrategy describes how nodes are rolled over to a new operator version
+type UpgradeStrategy struct {
+	// MaxUnavailable is the maximum number of nodes that can be upgraded at the same time. When nil, the
+	// MaxParallelUpgrades setting applies.
+	MaxUnavailable *intstr.IntOrString
+	// Groups are the sets of nodes with an upgrade budget of their own
+	Groups []wmcov1.UpgradeGroup
+	// Order lists the rules deciding which nodes are upgraded first, by decreasing precedence
+	Order []wmcov1.UpgradeOrder
+	// Paused indicates nodes must not start upgrading
+	Paused bool
+	// Canary describes the nodes upgraded ahead of the others, or is nil if there are none
+	Canary *Canary
+	// RollbackOnFailure indicates nodes failing their in-place upgrade are rolled back to their previous version
+	RollbackOnFailure bool
+}
+
+// Canary describes the nodes upgraded ahead of the others
+type Canary struct {
+	// Selector selects the nodes that can be used as canaries
+	Selector meta.LabelSelector
+	// Count is the number of selected nodes used as canaries
+	Count int
+	// SoakPeriod is how long the canaries must stay Ready after their upgrade before the other nodes are upgraded
+	SoakPeriod time.Duration
+}
+
+// MaxUnavailable returns the maximum number of nodes that can be upgraded at the same time, as a number or percentage
+func (s Settings) MaxUnavailable() intstr.IntOrString {
+	if s.UpgradeStrategy.MaxUnavailable != nil {
+		return *s.UpgradeStrategy.MaxUnavailable
+	}
+	return intstr.FromInt(s.MaxParallelUpgrades)
+}
+
+// Defaults returns the Settings used when the OperatorConfig does not exist
+func Defaults() Settings {
+	return Settings{
+		MaxParallelUpgrades: DefaultMaxParallelUpgrades,
+		MaxUnhealthyCount:   DefaultMaxUnhealthyCount,
+		WICDReconcilePeriod: DefaultWICDReconcilePeriod,
+		Retry:               retry.DefaultSettings(),
+	}
+}
+
+// FromSpec returns the Settings described by the given spec, with defaults applied for any unset field
+func FromSpec(spec *wmcov1.OperatorConfigSpec) Settings {
+	settings := Defaults()
+	if spec == nil {
+		return settings
+	}
+	if spec.MaxParallelUpgrades != nil && *spec.MaxParallelUpgrades > 0 {
+		settings.MaxParallelUpgrades = int(*spec.MaxParallelUpgrades)
+	}
+	if spec.MaxUnhealthyCount != nil && *spec.MaxUnhealthyCount >= 0 {
+		settings.MaxUnhealthyCount = *spec.MaxUnhealthyCount
+	}
+	settings.DebugLogging = spec.DebugLogging
+	setDuration(&settings.WICDReconcilePeriod, spec.WICDReconcilePeriod)
+	if spec.Retry != nil {
+		setDuration(&settings.Retry.Interval, spec.Retry.Interval)
+		setDuration(&settings.Retry.Timeout, spec.Retry.Timeout)
+		setDuration(&settings.Retry.ResourceChangeTimeout, spec.Retry.ResourceChangeTimeout)
+		setDuration(&settings.Retry.WindowsAPIInterval, spec.Retry.WindowsAPIInterval)
+	}
+	if spec.UpgradeStrategy != nil {
+		settings.UpgradeStrategy = UpgradeStrategy{MaxUnavailable: spec.UpgradeStrategy.MaxUnavailable,
+			Groups: spec.UpgradeStrategy.Groups, Order: spec.UpgradeStrategy.Order, Paused: spec.UpgradeStrategy.Paused,
+			RollbackOnFailure: spec.UpgradeStrategy.RollbackOnFailure}
+		if canary := spec.UpgradeStrategy.Canary; canary != nil {
+			settings.UpgradeStrategy.Canary = &Canary{Selector: canary.Selector, Count: DefaultCanaryCount,
+				SoakPeriod: DefaultCanarySoakPeriod}
+			if canary.Count != nil && *canary.Count > 0 {
+				settings.UpgradeStrategy.Canary.Count = int(*canary.Count)
+			}
+			setDuration(&settings.UpgradeStrategy.Canary.SoakPeriod, canary.SoakPeriod)
+		}
+	}
+	if spec.WindowsExporter != nil {
+		settings.WindowsExporter = WindowsExporter{AdditionalCollectors: spec.WindowsExporter.AdditionalCollectors,
+			CollectorFlags: spec.WindowsExporter.CollectorFlags}
+		setDuration(&settings.WindowsExporter.ScrapeTimeoutMargin, spec.WindowsExporter.ScrapeTimeoutMargin)
+	}
+	return settings
+}
+
+// Get returns the Settings described by the OperatorConfig singleton, or the defaults if it does not exist
+func Get(ctx context.Context, c client.Reader) (Settings, error) {
+	config := &wmcov1.OperatorConfig{}
+	err := c.Get(ctx, types.NamespacedName{Name: wmcov1.OperatorConfigName}, config)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return Defaults(), nil
+		}
+		return Defaults(), fmt.Errorf("unable to get OperatorConfig %s: %w", wmcov1.OperatorConfigName, err)
+	}
+	return FromSpec(&config.Spec), nil
+}
+
+// setDuration sets target to the given duration if it is set and positive
+func setDuration(target *time.Duration, d *meta.Duration) {
+	if d != nil && d.Duration > 0 {
+		*target = d.Duration
+	}
+}
@@ -0,0 +1,195 @@
+package operatorconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestFromSpec(t *testing.T) {
+	maxUnavailable := intstr.FromString("25%")
+	canarySelector := meta.LabelSelector{MatchLabels: map[string]string{"canary": "true"}}
+	testCases := []struct {
+		name     string
+		spec     *wmcov1.OperatorConfigSpec
+		expected Settings
+	}{
+		{
+			name:     "nil spec",
+			spec:     nil,
+			expected: Defaults(),
+		},
+		{
+			name:     "empty spec",
+			spec:     &wmcov1.OperatorConfigSpec{},
+			expected: Defaults(),
+		},
+		{
+			name: "all fields set",
+			spec: &wmcov1.OperatorConfigSpec{
+				MaxParallelUpgrades: int32Ptr(3),
+				MaxUnhealthyCount:   int32Ptr(0),
+				DebugLogging:        true,
+				WICDReconcilePeriod: &meta.Duration{Duration: 30 * time.Second},
+				Retry: &wmcov1.RetrySettings{
+					Interval:              &meta.Duration{Duration: time.Second},
+					Timeout:               &meta.Duration{Duration: time.Minute},
+					ResourceChangeTimeout: &meta.Duration{Duration: 30 * time.Second},
+					WindowsAPIInterval:    &meta.Duration{Duration: 2 * time.Second},
+				},
+			},
+			expected: Settings{
+				MaxParallelUpgrades: 3,
+				MaxUnhealthyCount:   0,
+				DebugLogging:        true,
+				WICDReconcilePeriod: 30 * time.Second,
+				Retry: retry.Settings{
+					Interval:              time.Second,
+					Timeout:               time.Minute,
+					ResourceChangeTimeout: 30 * time.Second,
+					WindowsAPIInterval:    2 * time.Second,
+				},
+			},
+		},
+		{
+			name: "upgrade strategy",
+			spec: &wmcov1.OperatorConfigSpec{
+				MaxParallelUpgrades: int32Ptr(3),
+				UpgradeStrategy: &wmcov1.UpgradeStrategy{MaxUnavailable: &maxUnavailable,
+					Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderBYOHFirst}},
+			},
+			expected: func() Settings {
+				s := Defaults()
+				s.MaxParallelUpgrades = 3
+				s.UpgradeStrategy = UpgradeStrategy{MaxUnavailable: &maxUnavailable,
+					Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderBYOHFirst}}
+				return s
+			}(),
+		},
+		{
+			name: "canary defaults",
+			spec: &wmcov1.OperatorConfigSpec{UpgradeStrategy: &wmcov1.UpgradeStrategy{Paused: true,
+				RollbackOnFailure: true, Canary: &wmcov1.UpgradeCanary{Selector: canarySelector, Count: int32Ptr(0)}}},
+			expected: func() Settings {
+				s := Defaults()
+				s.UpgradeStrategy = UpgradeStrategy{Paused: true, RollbackOnFailure: true,
+					Canary: &Canary{Selector: canarySelector, Count: DefaultCanaryCount,
+						SoakPeriod: DefaultCanarySoakPeriod}}
+				return s
+			}(),
+		},
+		{
+			name: "canary",
+			spec: &wmcov1.OperatorConfigSpec{UpgradeStrategy: &wmcov1.UpgradeStrategy{
+				Canary: &wmcov1.UpgradeCanary{Selector: canarySelector, Count: int32Ptr(3),
+					SoakPeriod: &meta.Duration{Duration: time.Hour}}}},
+			expected: func() Settings {
+				s := Defaults()
+				s.UpgradeStrategy = UpgradeStrategy{Canary: &Canary{Selector: canarySelector, Count: 3,
+					SoakPeriod: time.Hour}}
+				return s
+			}(),
+		},
+		{
+			name: "windows_exporter",
+			spec: &wmcov1.OperatorConfigSpec{WindowsExporter: &wmcov1.WindowsExporterSettings{
+				AdditionalCollectors: []string{"iis", "process"},
+				CollectorFlags:       map[string]string{"collector.process.include": "^w3wp$"},
+				ScrapeTimeoutMargin:  &meta.Duration{Duration: 2 * time.Second}}},
+			expected: func() Settings {
+				s := Defaults()
+				s.WindowsExporter = WindowsExporter{AdditionalCollectors: []string{"iis", "process"},
+					CollectorFlags:      map[string]string{"collector.process.include": "^w3wp$"},
+					ScrapeTimeoutMargin: 2 * time.Second}
+				return s
+			}(),
+		},
+		{
+			name: "invalid values are ignored",
+			spec: &wmcov1.OperatorConfigSpec{
+				MaxParallelUpgrades: int32Ptr(0),
+				MaxUnhealthyCount:   int32Ptr(-1),
+				WICDReconcilePeriod: &meta.Duration{Duration: -time.Second},
+				Retry:               &wmcov1.RetrySettings{Interval: &meta.Duration{}},
+				WindowsExporter:     &wmcov1.WindowsExporterSettings{ScrapeTimeoutMargin: &meta.Duration{}},
+			},
+			expected: Defaults(),
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, FromSpec(test.spec))
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, wmcov1.AddToScheme(scheme))
+
+	testCases := []struct {
+		name     string
+		objects  []*wmcov1.OperatorConfig
+		expected Settings
+	}{
+		{
+			name:     "no OperatorConfig",
+			expected: Defaults(),
+		},
+		{
+			name: "OperatorConfig with a different name",
+			objects: []*wmcov1.OperatorConfig{{
+				ObjectMeta: meta.ObjectMeta{Name: "other"},
+				Spec:       wmcov1.OperatorConfigSpec{MaxParallelUpgrades: int32Ptr(5)},
+			}},
+			expected: Defaults(),
+		},
+		{
+			name: "OperatorConfig singleton",
+			objects: []*wmcov1.OperatorConfig{{
+				ObjectMeta: meta.ObjectMeta{Name: wmcov1.OperatorConfigName},
+				Spec:       wmcov1.OperatorConfigSpec{MaxParallelUpgrades: int32Ptr(5)},
+			}},
+			expected: func() Settings {
+				s := Defaults()
+				s.MaxParallelUpgrades = 5
+				return s
+			}(),
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			for _, obj := range test.objects {
+				builder = builder.WithObjects(obj)
+			}
+			settings, err := Get(context.TODO(), builder.Build())
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, settings)
+		})
+	}
+}
+
+func TestMaxUnavailable(t *testing.T) {
+	settings := Defaults()
+	settings.MaxParallelUpgrades = 2
+	assert.Equal(t, intstr.FromInt(2), settings.MaxUnavailable())
+
+	maxUnavailable := intstr.FromString("10%")
+	settings.UpgradeStrategy.MaxUnavailable = &maxUnavailable
+	assert.Equal(t, maxUnavailable, settings.MaxUnavailable())
+}
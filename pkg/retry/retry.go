@@ -1,16 +1,70 @@
 package retry
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 const (
 	// Count is the number of times we will retry an API call
 	Count = 20
-	// WindowsAPIInterval is the wait time between calls to the Windows OS API in case of failure
+	// WindowsAPIInterval is the default wait time between calls to the Windows OS API in case of failure
 	WindowsAPIInterval = 5 * time.Second
-	// Interval is the wait time between API calls on a failure
+	// Interval is the default wait time between API calls on a failure
 	Interval = 15 * time.Second
-	// Timeout is the total time we will wait for an event to occur.
+	// Timeout is the default total time we will wait for an event to occur.
 	Timeout = time.Minute * 10
-	// ResourceChangeTimeout is the total time waited for a change (create/update/delete) to take place
+	// ResourceChangeTimeout is the default total time waited for a change (create/update/delete) to take place
 	ResourceChangeTimeout = time.Minute * 2
 )
+
+// Settings holds the wait times used when retrying operations
+type Settings struct {
+	// WindowsAPIInterval is the wait time between calls to the Windows OS API in case of failure
+	WindowsAPIInterval time.Duration
+	// Interval is the wait time between API calls on a failure
+	Interval time.Duration
+	// Timeout is the total time we will wait for an event to occur
+	Timeout time.Duration
+	// ResourceChangeTimeout is the total time waited for a change (create/update/delete) to take place
+	ResourceChangeTimeout time.Duration
+}
+
+// current holds the Settings in use, nil until Set is called
+var current atomic.Pointer[Settings]
+
+// DefaultSettings returns the Settings used when none have been set
+func DefaultSettings() Settings {
+	return Settings{
+		WindowsAPIInterval:    WindowsAPIInterval,
+		Interval:              Interval,
+		Timeout:               Timeout,
+		ResourceChangeTimeout: ResourceChangeTimeout,
+	}
+}
+
+// Get returns the Settings currently in use
+func Get() Settings {
+	if s := current.Load(); s != nil {
+		return *s
+	}
+	return DefaultSettings()
+}
+
+// Set replaces the Settings in use. Any non-positive wait time is replaced with its default.
+func Set(s Settings) {
+	defaults := DefaultSettings()
+	if s.WindowsAPIInterval <= 0 {
+		s.WindowsAPIInterval = defaults.WindowsAPIInterval
+	}
+	if s.Interval <= 0 {
+		s.Interval = defaults.Interval
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = defaults.Timeout
+	}
+	if s.ResourceChangeTimeout <= 0 {
+		s.ResourceChangeTimeout = defaults.ResourceChangeTimeout
+	}
+	current.Store(&s)
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	k8sretry "k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// HostKeysSecret is the name of the secret holding the SSH host keys pinned for Windows instances. Each key within the
+// secret is the ID of an instance, and each value is the instance's host key in authorized_keys format.
+const HostKeysSecret = "windows-instance-host-keys"
+
+// HostKeyStore pins the SSH host keys of Windows instances in the HostKeysSecret
+type HostKeyStore struct {
+	client    client.Client
+	namespace string
+}
+
+// NewHostKeyStore returns a HostKeyStore backed by the HostKeysSecret in the given namespace
+func NewHostKeyStore(c client.Client, namespace string) *HostKeyStore {
+	return &HostKeyStore{client: c, namespace: namespace}
+}
+
+// Pin records key as the host key of the instance identified by id, unless a host key is already pinned for it. The
+// host key pinned for the instance is returned. The secret is created if it does not exist.
+func (s *HostKeyStore) Pin(ctx context.Context, id string, key ssh.PublicKey) (ssh.PublicKey, error) {
+	var pinned ssh.PublicKey
+	// Concurrent pins are retried, so that a key pinned by another reconciler is never overwritten
+	err := k8sretry.OnError(k8sretry.DefaultRetry, func(err error) bool {
+		return k8sapierrors.IsConflict(err) || k8sapierrors.IsAlreadyExists(err)
+	}, func() error {
+		secret := &core.Secret{}
+		err := s.client.Get(ctx, kubeTypes.NamespacedName{Namespace: s.namespace, Name: HostKeysSecret}, secret)
+		if err != nil {
+			if !k8sapierrors.IsNotFound(err) {
+				return err
+			}
+			pinned = key
+			return s.client.Create(ctx, &core.Secret{
+				ObjectMeta: meta.ObjectMeta{Name: HostKeysSecret, Namespace: s.namespace},
+				Data:       map[string][]byte{id: ssh.MarshalAuthorizedKey(key)},
+			})
+		}
+		if data, present := secret.Data[id]; present {
+			pinned, _, _, _, err = ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				return fmt.Errorf("invalid host key pinned for %s: %w", id, err)
+			}
+			return nil
+		}
+		patchBase := client.MergeFromWithOptions(secret.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[id] = ssh.MarshalAuthorizedKey(key)
+		pinned = key
+		return s.client.Patch(ctx, secret, patchBase)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pin host key in secret %s/%s: %w", s.namespace, HostKeysSecret, err)
+	}
+	return pinned, nil
+}
+
+// Unpin removes the host key pinned for the instance identified by id, if any, so that the next host key presented by
+// the instance is trusted
+func (s *HostKeyStore) Unpin(ctx context.Context, id string) error {
+	secret := &core.Secret{}
+	err := s.client.Get(ctx, kubeTypes.NamespacedName{Namespace: s.namespace, Name: HostKeysSecret}, secret)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if _, present := secret.Data[id]; !present {
+		return nil
+	}
+	patchBase := client.MergeFrom(secret.DeepCopy())
+	delete(secret.Data, id)
+	if err = s.client.Patch(ctx, secret, patchBase); err != nil {
+		return fmt.Errorf("unable to unpin host key for %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestHostKey returns a new ed25519 SSH public key
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return key
+}
+
+func TestHostKeyStore(t *testing.T) {
+	ctx := context.Background()
+	namespace := "openshift-windows-machine-config-operator"
+	c := fake.NewClientBuilder().Build()
+	store := NewHostKeyStore(c, namespace)
+	firstKey := newTestHostKey(t)
+	secondKey := newTestHostKey(t)
+
+	// The first key presented for an ID is pinned, creating the secret
+	pinned, err := store.Pin(ctx, "10.0.0.1_22", firstKey)
+	require.NoError(t, err)
+	assert.Equal(t, firstKey.Marshal(), pinned.Marshal())
+
+	// A different key does not replace the pinned key
+	pinned, err = store.Pin(ctx, "10.0.0.1_22", secondKey)
+	require.NoError(t, err)
+	assert.Equal(t, firstKey.Marshal(), pinned.Marshal())
+
+	// Keys are pinned per ID
+	pinned, err = store.Pin(ctx, "winworker-abcde", secondKey)
+	require.NoError(t, err)
+	assert.Equal(t, secondKey.Marshal(), pinned.Marshal())
+
+	secret := &core.Secret{}
+	require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: HostKeysSecret}, secret))
+	assert.Equal(t, ssh.MarshalAuthorizedKey(firstKey), secret.Data["10.0.0.1_22"])
+	assert.Equal(t, ssh.MarshalAuthorizedKey(secondKey), secret.Data["winworker-abcde"])
+
+	// Unpinning allows a new key to be pinned, without affecting other IDs
+	require.NoError(t, store.Unpin(ctx, "10.0.0.1_22"))
+	pinned, err = store.Pin(ctx, "10.0.0.1_22", secondKey)
+	require.NoError(t, err)
+	assert.Equal(t, secondKey.Marshal(), pinned.Marshal())
+	pinned, err = store.Pin(ctx, "winworker-abcde", firstKey)
+	require.NoError(t, err)
+	assert.Equal(t, secondKey.Marshal(), pinned.Marshal())
+
+	// Unpinning an ID with no pinned key is a no-op
+	assert.NoError(t, store.Unpin(ctx, "10.0.0.2_22"))
+}
+
+func TestHostKeyStoreUnpinWithoutSecret(t *testing.T) {
+	store := NewHostKeyStore(fake.NewClientBuilder().Build(), "openshift-windows-machine-config-operator")
+	assert.NoError(t, store.Unpin(context.Background(), "10.0.0.1_22"))
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+const (
+	// WinRMPasswordKey is the key of the WinRM credentials Secret holding the password used for NTLM authentication
+	WinRMPasswordKey = "password"
+	// WinRMCAKey is the key of the WinRM credentials Secret holding the PEM encoded CA bundle used to verify the
+	// certificate presented by the instance. Optional.
+	WinRMCAKey = "ca.crt"
+)
+
+// ResolveWinRM sets the credentials of the given WinRM parameters from the WinRM credentials Secret in the given
+// namespace. It is a no-op if winRM is nil. For NTLM authentication the Secret must hold the password of the
+// instance's user, for certificate authentication it must be a kubernetes.io/tls Secret holding the client
+// certificate and its private key.
+func ResolveWinRM(ctx context.Context, c client.Client, namespace string, winRM *instance.WinRM) error {
+	if winRM == nil {
+		return nil
+	}
+	secret := &core.Secret{}
+	if err := c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: winRM.CredentialsSecret},
+		secret); err != nil {
+		return fmt.Errorf("unable to get WinRM credentials secret %s: %w", winRM.CredentialsSecret, err)
+	}
+	credentials := &instance.WinRMCredentials{}
+	switch winRM.Auth {
+	case instance.WinRMAuthNTLM:
+		password, ok := secret.Data[WinRMPasswordKey]
+		if !ok {
+			return fmt.Errorf("WinRM credentials secret %s missing '%s' key", winRM.CredentialsSecret,
+				WinRMPasswordKey)
+		}
+		credentials.Password = string(password)
+	case instance.WinRMAuthCertificate:
+		certificate, err := tls.X509KeyPair(secret.Data[core.TLSCertKey], secret.Data[core.TLSPrivateKeyKey])
+		if err != nil {
+			return fmt.Errorf("invalid client certificate in WinRM credentials secret %s: %w",
+				winRM.CredentialsSecret, err)
+		}
+		credentials.Certificate = &certificate
+	default:
+		return fmt.Errorf("unsupported WinRM authentication method %q", winRM.Auth)
+	}
+	if ca, present := secret.Data[WinRMCAKey]; present {
+		credentials.RootCAs = x509.NewCertPool()
+		if !credentials.RootCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no valid certificates in '%s' key of WinRM credentials secret %s", WinRMCAKey,
+				winRM.CredentialsSecret)
+		}
+	}
+	winRM.Credentials = credentials
+	return nil
+}
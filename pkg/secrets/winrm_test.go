@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// newTestKeyPair returns a PEM encoded self-signed certificate and its private key
+func newTestKeyPair(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "winrm-client"},
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestResolveWinRM(t *testing.T) {
+	namespace := "openshift-windows-machine-config-operator"
+	cert, key := newTestKeyPair(t)
+	c := fake.NewClientBuilder().WithObjects(
+		&core.Secret{ObjectMeta: meta.ObjectMeta{Name: "password", Namespace: namespace},
+			Data: map[string][]byte{WinRMPasswordKey: []byte("P@ssw0rd"), WinRMCAKey: cert}},
+		&core.Secret{ObjectMeta: meta.ObjectMeta{Name: "client-cert", Namespace: namespace},
+			Data: map[string][]byte{core.TLSCertKey: cert, core.TLSPrivateKeyKey: key}},
+		&core.Secret{ObjectMeta: meta.ObjectMeta{Name: "invalid-ca", Namespace: namespace},
+			Data: map[string][]byte{WinRMPasswordKey: []byte("P@ssw0rd"), WinRMCAKey: []byte("not a cert")}},
+	).Build()
+
+	testCases := []struct {
+		name        string
+		input       *instance.WinRM
+		expectedErr bool
+	}{
+		{name: "nil", input: nil},
+		{name: "NTLM", input: &instance.WinRM{Auth: instance.WinRMAuthNTLM, CredentialsSecret: "password"}},
+		{name: "certificate",
+			input: &instance.WinRM{Auth: instance.WinRMAuthCertificate, CredentialsSecret: "client-cert"}},
+		{name: "certificate without key pair", expectedErr: true,
+			input: &instance.WinRM{Auth: instance.WinRMAuthCertificate, CredentialsSecret: "password"}},
+		{name: "NTLM without password", expectedErr: true,
+			input: &instance.WinRM{Auth: instance.WinRMAuthNTLM, CredentialsSecret: "client-cert"}},
+		{name: "invalid CA", expectedErr: true,
+			input: &instance.WinRM{Auth: instance.WinRMAuthNTLM, CredentialsSecret: "invalid-ca"}},
+		{name: "missing secret", expectedErr: true,
+			input: &instance.WinRM{Auth: instance.WinRMAuthNTLM, CredentialsSecret: "missing"}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := ResolveWinRM(context.Background(), c, namespace, test.input)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if test.input == nil {
+				return
+			}
+			require.NotNil(t, test.input.Credentials)
+			switch test.input.Auth {
+			case instance.WinRMAuthNTLM:
+				assert.Equal(t, "P@ssw0rd", test.input.Credentials.Password)
+				assert.NotNil(t, test.input.Credentials.RootCAs)
+			case instance.WinRMAuthCertificate:
+				assert.NotNil(t, test.input.Credentials.Certificate)
+				assert.Nil(t, test.input.Credentials.RootCAs)
+			}
+		})
+	}
+}
@@ -3,6 +3,10 @@ package services
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	config "github.com/openshift/api/config/v1"
@@ -10,6 +14,7 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/ignition"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
@@ -22,28 +27,34 @@ const (
 	// hostnameOverrideVar is the variable that should be replaced with the value of the desired instance hostname
 	hostnameOverrideVar = "HOSTNAME_OVERRIDE"
 	NodeIPVar           = "NODE_IP"
+	// collectorFlagPrefix is the prefix of the windows_exporter flags which can be set by the cluster admin
+	collectorFlagPrefix = "collector."
+)
+
+var (
+	// defaultWindowsExporterCollectors are the windows_exporter collectors that are always enabled
+	defaultWindowsExporterCollectors = []string{"cpu", "cs", "logical_disk", "net", "os", "service", "system",
+		"textfile", "container", "memory", "cpu_info"}
+	// collectorNameRegex matches valid windows_exporter collector names
+	collectorNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_.]*$`)
+	// flagNameRegex matches valid windows_exporter flag names
+	flagNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_.-]*$`)
+	// reservedCollectorFlags are the collector flags which cannot be set, as WICD relies on their default values. The
+	// textfile collector must read from the directory WICD syncs textfile metrics to.
+	reservedCollectorFlags = []string{"collector.textfile.directory", "collector.textfile.directories"}
 )
 
 // GenerateManifest returns the expected state of the Windows service configmap. If debug is true, debug logging
-// will be enabled for services that support it.
+// will be enabled for services that support it. The given windows_exporter settings are applied on top of the default
+// collectors and flags, and must have been validated with ValidateWindowsExporterSettings.
 func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort string, platform config.PlatformType,
-	debug bool) (*servicescm.Data, error) {
-	windowsExporterServiceCommand := fmt.Sprintf("%s --collectors.enabled "+
-		"cpu,cs,logical_disk,net,os,service,system,textfile,container,memory,cpu_info --web.config.file %s",
-		windows.WindowsExporterPath, windows.TLSConfPath)
+	debug bool, exporterSettings operatorconfig.WindowsExporter) (*servicescm.Data, error) {
 	kubeletConfiguration, err := getKubeletServiceConfiguration(kubeletArgsFromIgnition, debug, platform)
 	if err != nil {
 		return nil, fmt.Errorf("could not determine kubelet service configuration spec: %w", err)
 	}
-	services := &[]servicescm.Service{{
-		Name:                   windows.WindowsExporterServiceName,
-		Command:                windowsExporterServiceCommand,
-		NodeVariablesInCommand: nil,
-		PowershellPreScripts:   nil,
-		Dependencies:           nil,
-		Bootstrap:              false,
-		Priority:               2,
-	},
+	services := &[]servicescm.Service{
+		windowsExporterConfiguration(exporterSettings),
 		containerdConfiguration(debug),
 		kubeletConfiguration,
 		hybridOverlayConfiguration(vxlanPort, debug),
@@ -53,8 +64,10 @@ func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort strin
 	if platform == config.AzurePlatformType {
 		*services = append(*services, azureCloudNodeManagerConfiguration())
 	}
-	// TODO: All payload filenames and checksums must be added here https://issues.redhat.com/browse/WINC-847
-	files := &[]servicescm.FileInfo{}
+	files, err := payloadFiles(platform)
+	if err != nil {
+		return nil, err
+	}
 	var watchedEnvVars []string
 	for _, envVar := range cluster.WatchedEnvironmentVars {
 		watchedEnvVars = append(watchedEnvVars, envVar)
@@ -62,6 +75,80 @@ func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort strin
 	return servicescm.NewData(services, files, cluster.GetProxyVars(), watchedEnvVars)
 }
 
+// ValidateWindowsExporterSettings returns an error if the given windows_exporter settings cannot be applied. Only
+// collector-specific flags can be set, so that the flags set by the operator cannot be overridden, and their values
+// cannot contain whitespace or double quotes, as they would break the service command. The textfile collector
+// directory cannot be changed.
+func ValidateWindowsExporterSettings(settings operatorconfig.WindowsExporter) error {
+	for _, collector := range settings.AdditionalCollectors {
+		if !collectorNameRegex.MatchString(collector) {
+			return fmt.Errorf("invalid windows_exporter collector name %q", collector)
+		}
+	}
+	for flag, value := range settings.CollectorFlags {
+		if !strings.HasPrefix(flag, collectorFlagPrefix) || !flagNameRegex.MatchString(flag) {
+			return fmt.Errorf("invalid windows_exporter flag %q, only %s flags can be set", flag, collectorFlagPrefix)
+		}
+		if slices.Contains(reservedCollectorFlags, flag) {
+			return fmt.Errorf("windows_exporter flag %s cannot be set", flag)
+		}
+		if strings.ContainsAny(value, " \t\r\n\"") {
+			return fmt.Errorf("value of windows_exporter flag %s cannot contain whitespace or double quotes", flag)
+		}
+	}
+	return nil
+}
+
+// windowsExporterConfiguration returns the service specification for windows_exporter, with the given settings
+// applied on top of the default collectors and flags
+func windowsExporterConfiguration(settings operatorconfig.WindowsExporter) servicescm.Service {
+	collectors := append([]string{}, defaultWindowsExporterCollectors...)
+	for _, collector := range settings.AdditionalCollectors {
+		if !slices.Contains(collectors, collector) {
+			collectors = append(collectors, collector)
+		}
+	}
+	cmd := fmt.Sprintf("%s --collectors.enabled %s --web.config.file %s", windows.WindowsExporterPath,
+		strings.Join(collectors, ","), windows.TLSConfPath)
+	// Flags are sorted so that the command is the same every time the manifest is generated
+	flags := make([]string, 0, len(settings.CollectorFlags))
+	for flag := range settings.CollectorFlags {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		cmd += fmt.Sprintf(" --%s=%s", flag, settings.CollectorFlags[flag])
+	}
+	if settings.ScrapeTimeoutMargin > 0 {
+		cmd += " --scrape.timeout-margin=" + strconv.FormatFloat(settings.ScrapeTimeoutMargin.Seconds(), 'f', -1, 64)
+	}
+	return servicescm.Service{
+		Name:                   windows.WindowsExporterServiceName,
+		Command:                cmd,
+		NodeVariablesInCommand: nil,
+		PowershellPreScripts:   nil,
+		Dependencies:           nil,
+		Bootstrap:              false,
+		Priority:               2,
+	}
+}
+
+// payloadFiles returns the path and checksum of each payload file copied to Windows instances, sorted by path
+func payloadFiles(platform config.PlatformType) (*[]servicescm.FileInfo, error) {
+	checksums, err := windows.PayloadFiles(&platform)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine payload file checksums: %w", err)
+	}
+	files := []servicescm.FileInfo{}
+	for path, checksum := range checksums {
+		files = append(files, servicescm.FileInfo{Path: path, Checksum: checksum})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return &files, nil
+}
+
 // containerdConfiguration returns the service specification for the Windows containerd service
 func containerdConfiguration(debug bool) servicescm.Service {
 	containerdServiceCmd := fmt.Sprintf("%s --config %s --log-file %s --run-service",
@@ -222,7 +309,8 @@ func getKubeletServiceConfiguration(argsFromIginition map[string]string, debug b
 		kubeletServiceCmd += fmt.Sprintf(" %s", arg)
 	}
 
-	// explicitly set node ip and resolves to the first IPv4 address of the default gateway
+	// explicitly set node ip and resolves to the IP given in the node IP override file if it exists, otherwise to the
+	// first IPv4 address of the default gateway
 	kubeletServiceCmd = fmt.Sprintf("%s --node-ip=%s", kubeletServiceCmd, NodeIPVar)
 	if platform == config.AWSPlatformType {
 		kubeletServiceCmd = fmt.Sprintf("%s --image-credential-provider-bin-dir=%s --image-credential-provider-config=%s",
@@ -230,8 +318,9 @@ func getKubeletServiceConfiguration(argsFromIginition map[string]string, debug b
 	}
 	preScripts = append(preScripts, servicescm.PowershellPreScript{
 		VariableName: NodeIPVar,
-		Path: "(Get-NetRoute -DestinationPrefix '0.0.0.0/0' | " +
-			"Get-NetIpAddress -AddressFamily IPv4 -ifIndex {$_.ifIndex}[0]).IPAddress",
+		Path: "if (Test-Path " + windows.NodeIPOverridePath + ") {(Get-Content -Raw " + windows.NodeIPOverridePath +
+			").Trim()} else {(Get-NetRoute -DestinationPrefix '0.0.0.0/0' | " +
+			"Get-NetIpAddress -AddressFamily IPv4 -ifIndex {$_.ifIndex}[0]).IPAddress}",
 	})
 	return servicescm.Service{
 		Name:                   windows.KubeletServiceName,
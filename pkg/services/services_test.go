@@ -2,9 +2,13 @@ package services
 
 import (
 	"testing"
+	"time"
 
 	config "github.com/openshift/api/config/v1"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
 
 func TestGetHostnameCmd(t *testing.T) {
@@ -41,3 +45,86 @@ func TestGetHostnameCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestWindowsExporterConfiguration(t *testing.T) {
+	defaultCmd := windows.WindowsExporterPath + " --collectors.enabled " +
+		"cpu,cs,logical_disk,net,os,service,system,textfile,container,memory,cpu_info --web.config.file " +
+		windows.TLSConfPath
+	tests := []struct {
+		name     string
+		settings operatorconfig.WindowsExporter
+		expected string
+	}{
+		{
+			name:     "defaults",
+			expected: defaultCmd,
+		},
+		{
+			name: "additional collectors",
+			settings: operatorconfig.WindowsExporter{
+				AdditionalCollectors: []string{"iis", "process", "cpu"},
+			},
+			expected: windows.WindowsExporterPath + " --collectors.enabled " +
+				"cpu,cs,logical_disk,net,os,service,system,textfile,container,memory,cpu_info,iis,process " +
+				"--web.config.file " + windows.TLSConfPath,
+		},
+		{
+			name: "flags and scrape timeout margin",
+			settings: operatorconfig.WindowsExporter{
+				CollectorFlags: map[string]string{"collector.process.include": "^(w3wp|sqlservr)$",
+					"collector.iis.app-include": "^Default$"},
+				ScrapeTimeoutMargin: 1500 * time.Millisecond,
+			},
+			expected: defaultCmd + " --collector.iis.app-include=^Default$ " +
+				"--collector.process.include=^(w3wp|sqlservr)$ --scrape.timeout-margin=1.5",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.NoError(t, ValidateWindowsExporterSettings(test.settings))
+			service := windowsExporterConfiguration(test.settings)
+			assert.Equal(t, windows.WindowsExporterServiceName, service.Name)
+			assert.Equal(t, test.expected, service.Command)
+		})
+	}
+}
+
+func TestValidateWindowsExporterSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings operatorconfig.WindowsExporter
+	}{
+		{
+			name:     "invalid collector name",
+			settings: operatorconfig.WindowsExporter{AdditionalCollectors: []string{"iis --web.listen-address"}},
+		},
+		{
+			name:     "flag outside of the collector namespace",
+			settings: operatorconfig.WindowsExporter{CollectorFlags: map[string]string{"web.config.file": "x"}},
+		},
+		{
+			name:     "flag name with a value",
+			settings: operatorconfig.WindowsExporter{CollectorFlags: map[string]string{"collector.a=b": "x"}},
+		},
+		{
+			name: "textfile collector directory",
+			settings: operatorconfig.WindowsExporter{
+				CollectorFlags: map[string]string{"collector.textfile.directories": "C:\\metrics"}},
+		},
+		{
+			name: "flag value with whitespace",
+			settings: operatorconfig.WindowsExporter{
+				CollectorFlags: map[string]string{"collector.process.include": "a --web.config.file=x"}},
+		},
+		{
+			name: "flag value with a double quote",
+			settings: operatorconfig.WindowsExporter{
+				CollectorFlags: map[string]string{"collector.process.include": "\"a"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Error(t, ValidateWindowsExporterSettings(test.settings))
+		})
+	}
+}
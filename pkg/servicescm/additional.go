@@ -0,0 +1,64 @@
+package servicescm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AdditionalServicesConfigMap is the name of the ConfigMap through which cluster admins define Windows services to be
+// managed on every Windows instance, along with the services required by the node. Its services key holds a Service
+// object JSON array.
+const AdditionalServicesConfigMap = "windows-additional-services"
+
+// ParseAdditionalServices returns the services defined in the data of the additional services ConfigMap
+func ParseAdditionalServices(dataFromCM map[string]string) ([]Service, error) {
+	value, ok := dataFromCM[servicesKey]
+	if !ok {
+		return nil, fmt.Errorf("expected key %s does not exist", servicesKey)
+	}
+	var services []Service
+	if err := json.Unmarshal([]byte(value), &services); err != nil {
+		return nil, fmt.Errorf("unable to parse services: %w", err)
+	}
+	for i := range services {
+		services[i].Additional = true
+	}
+	return services, nil
+}
+
+// WithAdditionalServices returns a copy of the data with the given additional services added to it. Additional
+// services cannot be bootstrap services, nor replace any of the services already defined.
+func (cmData *Data) WithAdditionalServices(additional []Service) (*Data, error) {
+	services := append([]Service{}, cmData.Services...)
+	names := make(map[string]struct{})
+	for _, svc := range services {
+		names[svc.Name] = struct{}{}
+	}
+	for _, svc := range additional {
+		if svc.Name == "" {
+			return nil, fmt.Errorf("additional service with command %q has no name", svc.Command)
+		}
+		if _, present := names[svc.Name]; present {
+			return nil, fmt.Errorf("additional service %s is already defined", svc.Name)
+		}
+		if svc.Bootstrap {
+			return nil, fmt.Errorf("additional service %s cannot be a bootstrap service", svc.Name)
+		}
+		names[svc.Name] = struct{}{}
+		svc.Additional = true
+		services = append(services, svc)
+	}
+	files := append([]FileInfo{}, cmData.Files...)
+	return NewData(&services, &files, cmData.EnvironmentVars, cmData.WatchedEnvironmentVars)
+}
+
+// AdditionalServices returns the services of the data which were given by the cluster admin
+func (cmData *Data) AdditionalServices() []Service {
+	var additional []Service
+	for _, svc := range cmData.Services {
+		if svc.Additional {
+			additional = append(additional, svc)
+		}
+	}
+	return additional
+}
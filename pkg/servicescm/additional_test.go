@@ -0,0 +1,119 @@
+package servicescm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAdditionalServices(t *testing.T) {
+	testCases := []struct {
+		name        string
+		data        map[string]string
+		expected    []Service
+		expectedErr bool
+	}{
+		{
+			name:        "missing services key",
+			data:        map[string]string{"files": "[]"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid JSON",
+			data:        map[string]string{servicesKey: "{"},
+			expectedErr: true,
+		},
+		{
+			name: "valid services",
+			data: map[string]string{servicesKey: `[{"name":"log-agent","path":"C:\\agent\\agent.exe","priority":3}]`},
+			expected: []Service{{Name: "log-agent", Command: "C:\\agent\\agent.exe", Priority: 3,
+				Additional: true}},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			services, err := ParseAdditionalServices(test.data)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, services)
+		})
+	}
+}
+
+func TestWithAdditionalServices(t *testing.T) {
+	containerd := Service{Name: "containerd", Command: "containerd.exe", Bootstrap: true, Priority: 0}
+	kubelet := Service{Name: "kubelet", Command: "kubelet.exe", Dependencies: []string{"containerd"},
+		Bootstrap: true, Priority: 1}
+	exporter := Service{Name: "windows_exporter", Command: "windows_exporter.exe", Priority: 2}
+	data := &Data{Services: []Service{containerd, kubelet, exporter}, Files: []FileInfo{}}
+
+	testCases := []struct {
+		name        string
+		additional  []Service
+		expected    []Service
+		expectedErr bool
+	}{
+		{
+			name:     "no additional services",
+			expected: []Service{containerd, kubelet, exporter},
+		},
+		{
+			name: "additional services ordered by priority",
+			additional: []Service{{Name: "security-agent", Command: "agent.exe", Priority: 4},
+				{Name: "log-agent", Command: "log.exe", Dependencies: []string{"containerd"}, Priority: 3}},
+			expected: []Service{containerd, kubelet, exporter,
+				{Name: "log-agent", Command: "log.exe", Dependencies: []string{"containerd"}, Priority: 3,
+					Additional: true},
+				{Name: "security-agent", Command: "agent.exe", Priority: 4, Additional: true}},
+		},
+		{
+			name:        "replaces a service",
+			additional:  []Service{{Name: "kubelet", Command: "agent.exe", Priority: 3}},
+			expectedErr: true,
+		},
+		{
+			name: "duplicate services",
+			additional: []Service{{Name: "log-agent", Command: "log.exe", Priority: 3},
+				{Name: "log-agent", Command: "log.exe", Priority: 4}},
+			expectedErr: true,
+		},
+		{
+			name:        "missing name",
+			additional:  []Service{{Command: "log.exe", Priority: 3}},
+			expectedErr: true,
+		},
+		{
+			name:        "bootstrap service",
+			additional:  []Service{{Name: "log-agent", Command: "log.exe", Bootstrap: true, Priority: 0}},
+			expectedErr: true,
+		},
+		{
+			name:        "priority overlapping bootstrap services",
+			additional:  []Service{{Name: "log-agent", Command: "log.exe", Priority: 0}},
+			expectedErr: true,
+		},
+		{
+			name: "cyclical dependencies",
+			additional: []Service{{Name: "a", Command: "a.exe", Dependencies: []string{"b"}, Priority: 3},
+				{Name: "b", Command: "b.exe", Dependencies: []string{"a"}, Priority: 3}},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			merged, err := data.WithAdditionalServices(test.additional)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, merged.Services)
+			assert.Equal(t, []Service{containerd, kubelet, exporter}, data.Services)
+			assert.Len(t, merged.AdditionalServices(), len(test.additional))
+		})
+	}
+}
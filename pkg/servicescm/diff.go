@@ -0,0 +1,158 @@
+package servicescm
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff describes the changes to the Windows services of an instance between the services ConfigMap data of two WMCO
+// versions
+type Diff struct {
+	// Updated are the names of the services which are new or whose definition changed
+	Updated []string
+	// Restarted are the names of the services which must be stopped while the instance is upgraded: updated services,
+	// services running a changed file, and the services depending on them. Dependent services are listed first, so the
+	// services can be stopped in order.
+	Restarted []string
+	// Removed are the names of the services which are no longer defined, listed in the order they can be stopped in
+	Removed []string
+	// ChangedFiles are the paths of the files on the instance whose contents change, in lower case. Changes to the
+	// environment variables are not part of the diff, as WICD applies them and reboots the instance itself.
+	ChangedFiles []string
+}
+
+// NewDiff returns the changes between the old and new data. changedFiles are the paths of files on the instance whose
+// contents change, in addition to the files whose checksum differs between the old and new data, if the old data
+// records any.
+func NewDiff(old, new *Data, changedFiles []string) *Diff {
+	diff := &Diff{}
+
+	files := make(map[string]struct{})
+	for _, path := range changedFiles {
+		files[strings.ToLower(path)] = struct{}{}
+	}
+	// Data from operator versions which did not record the payload files has no checksums to compare against
+	if len(old.Files) != 0 {
+		oldChecksums, newChecksums := checksums(old.Files), checksums(new.Files)
+		for path, checksum := range newChecksums {
+			if oldChecksum, present := oldChecksums[path]; !present || oldChecksum != checksum {
+				files[path] = struct{}{}
+			}
+		}
+		for path := range oldChecksums {
+			if _, present := newChecksums[path]; !present {
+				files[path] = struct{}{}
+			}
+		}
+	}
+	for path := range files {
+		diff.ChangedFiles = append(diff.ChangedFiles, path)
+	}
+	sort.Strings(diff.ChangedFiles)
+
+	oldServices := make(map[string]Service)
+	for _, svc := range old.Services {
+		oldServices[svc.Name] = svc
+	}
+	newServices := make(map[string]Service)
+	for _, svc := range new.Services {
+		newServices[svc.Name] = svc
+	}
+	restarted := make(map[string]struct{})
+	for _, svc := range new.Services {
+		if oldSvc, present := oldServices[svc.Name]; !present || !reflect.DeepEqual(oldSvc, svc) {
+			diff.Updated = append(diff.Updated, svc.Name)
+			restarted[svc.Name] = struct{}{}
+		} else if runsAny(svc, diff.ChangedFiles) {
+			restarted[svc.Name] = struct{}{}
+		}
+	}
+	var removed []Service
+	for _, svc := range old.Services {
+		if _, present := newServices[svc.Name]; !present {
+			removed = append(removed, svc)
+			// Services depending on a removed service are stopped along with it
+			restarted[svc.Name] = struct{}{}
+		}
+	}
+	// Services cannot be stopped while the services depending on them are running
+	for changed := true; changed; {
+		changed = false
+		for _, svc := range new.Services {
+			if _, present := restarted[svc.Name]; present {
+				continue
+			}
+			for _, dependency := range svc.Dependencies {
+				if _, present := restarted[dependency]; present {
+					restarted[svc.Name] = struct{}{}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	var restartedServices []Service
+	for _, svc := range new.Services {
+		if _, present := restarted[svc.Name]; present {
+			restartedServices = append(restartedServices, svc)
+		}
+	}
+	diff.Restarted = stopOrder(restartedServices)
+	diff.Removed = stopOrder(removed)
+	sort.Strings(diff.Updated)
+	return diff
+}
+
+// Affects returns true if the given service is updated or removed
+func (d *Diff) Affects(name string) bool {
+	for _, names := range [][]string{d.Updated, d.Removed} {
+		for _, svc := range names {
+			if svc == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checksums returns a map of the lower case path of each given file to its checksum
+func checksums(files []FileInfo) map[string]string {
+	pathToChecksum := make(map[string]string)
+	for _, file := range files {
+		pathToChecksum[strings.ToLower(file.Path)] = file.Checksum
+	}
+	return pathToChecksum
+}
+
+// runsAny returns true if the command or PowerShell pre-scripts of the given service reference any of the given paths,
+// which must be lower case
+func runsAny(svc Service, paths []string) bool {
+	for _, path := range paths {
+		if strings.Contains(strings.ToLower(svc.Command), path) {
+			return true
+		}
+		for _, script := range svc.PowershellPreScripts {
+			if strings.Contains(strings.ToLower(script.Path), path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopOrder returns the names of the given services in the order they can be stopped in. As services are created in
+// increasing order of priority, after the services they depend on, they are stopped in decreasing order of priority.
+func stopOrder(services []Service) []string {
+	sort.SliceStable(services, func(i, j int) bool {
+		if services[i].Priority != services[j].Priority {
+			return services[i].Priority > services[j].Priority
+		}
+		return services[i].Name < services[j].Name
+	})
+	var names []string
+	for _, svc := range services {
+		names = append(names, svc.Name)
+	}
+	return names
+}
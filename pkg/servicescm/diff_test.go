@@ -0,0 +1,94 @@
+package servicescm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDiff(t *testing.T) {
+	containerd := Service{Name: "containerd", Command: "C:\\k\\containerd\\containerd.exe", Priority: 0}
+	kubelet := Service{Name: "kubelet", Command: "C:\\k\\kubelet.exe --config=C:\\k\\kubelet.conf",
+		Dependencies: []string{"containerd"}, Priority: 1}
+	hybridOverlay := Service{Name: "hybrid-overlay-node", Command: "C:\\k\\hybrid-overlay-node.exe",
+		Dependencies: []string{"kubelet"}, Priority: 2}
+	kubeProxy := Service{Name: "kube-proxy", Command: "C:\\k\\kube-proxy.exe",
+		PowershellPreScripts: []PowershellPreScript{{Path: "C:\\Temp\\network-conf.ps1"}},
+		Dependencies:         []string{"hybrid-overlay-node"}, Priority: 3}
+	exporter := Service{Name: "windows_exporter", Command: "C:\\k\\windows_exporter.exe", Priority: 2}
+	services := []Service{containerd, kubelet, hybridOverlay, kubeProxy, exporter}
+	updatedExporter := exporter
+	updatedExporter.Command += " --debug"
+
+	testCases := []struct {
+		name         string
+		old          *Data
+		new          *Data
+		changedFiles []string
+		expected     *Diff
+	}{
+		{
+			name:     "no changes",
+			old:      &Data{Services: services},
+			new:      &Data{Services: services},
+			expected: &Diff{},
+		},
+		{
+			name:     "service definition changed",
+			old:      &Data{Services: services},
+			new:      &Data{Services: []Service{containerd, kubelet, hybridOverlay, kubeProxy, updatedExporter}},
+			expected: &Diff{Updated: []string{"windows_exporter"}, Restarted: []string{"windows_exporter"}},
+		},
+		{
+			name:         "changed binary restarts dependent services",
+			old:          &Data{Services: services},
+			new:          &Data{Services: services},
+			changedFiles: []string{"C:\\k\\kubelet.exe"},
+			expected: &Diff{Restarted: []string{"kube-proxy", "hybrid-overlay-node", "kubelet"},
+				ChangedFiles: []string{"c:\\k\\kubelet.exe"}},
+		},
+		{
+			name:         "changed pre-script",
+			old:          &Data{Services: services},
+			new:          &Data{Services: services},
+			changedFiles: []string{"C:\\Temp\\network-conf.ps1"},
+			expected: &Diff{Restarted: []string{"kube-proxy"},
+				ChangedFiles: []string{"c:\\temp\\network-conf.ps1"}},
+		},
+		{
+			name: "file checksums",
+			old: &Data{Services: services, Files: []FileInfo{{Path: "C:\\k\\kubelet.exe", Checksum: "a"},
+				{Path: "C:\\k\\csi-proxy.exe", Checksum: "a"}, {Path: "C:\\k\\kube-proxy.exe", Checksum: "a"}}},
+			new: &Data{Services: services, Files: []FileInfo{{Path: "C:\\k\\kubelet.exe", Checksum: "a"},
+				{Path: "C:\\k\\kube-proxy.exe", Checksum: "b"}}},
+			expected: &Diff{Restarted: []string{"kube-proxy"},
+				ChangedFiles: []string{"c:\\k\\csi-proxy.exe", "c:\\k\\kube-proxy.exe"}},
+		},
+		{
+			name:     "file checksums not recorded by previous version",
+			old:      &Data{Services: services},
+			new:      &Data{Services: services, Files: []FileInfo{{Path: "C:\\k\\kubelet.exe", Checksum: "a"}}},
+			expected: &Diff{},
+		},
+		{
+			name:     "service removed",
+			old:      &Data{Services: services},
+			new:      &Data{Services: []Service{containerd, kubelet, hybridOverlay, kubeProxy}},
+			expected: &Diff{Removed: []string{"windows_exporter"}},
+		},
+		{
+			// WICD applies environment variables and reboots the instance itself
+			name: "environment variables changed",
+			old:  &Data{Services: services, WatchedEnvironmentVars: []string{"HTTP_PROXY"}},
+			new: &Data{Services: services, WatchedEnvironmentVars: []string{"HTTP_PROXY"},
+				EnvironmentVars: map[string]string{"HTTP_PROXY": "http://proxy"}},
+			expected: &Diff{},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			diff := NewDiff(test.old, test.new, test.changedFiles)
+			assert.Equal(t, test.expected, diff)
+		})
+	}
+}
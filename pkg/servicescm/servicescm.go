@@ -62,6 +62,55 @@ type PowershellPreScript struct {
 	NodeArgs []NodeCmdArg
 }
 
+// StartType describes when the Windows service manager starts a service
+type StartType string
+
+const (
+	// StartTypeAutomatic services are started by the Windows service manager during system startup
+	StartTypeAutomatic StartType = "Automatic"
+	// StartTypeDelayedAutomatic services are started by the Windows service manager shortly after the automatic
+	// services, once the system has started
+	StartTypeDelayedAutomatic StartType = "DelayedAutomatic"
+	// StartTypeManual services are only started on request, by WICD as it reconciles the services
+	StartTypeManual StartType = "Manual"
+)
+
+// RecoveryActionType is an action taken by the Windows service manager when a service fails
+type RecoveryActionType string
+
+const (
+	// RecoveryActionRestart restarts the service
+	RecoveryActionRestart RecoveryActionType = "Restart"
+	// RecoveryActionNone takes no action
+	RecoveryActionNone RecoveryActionType = "None"
+)
+
+// RecoveryAction describes an action taken by the Windows service manager when a service fails
+type RecoveryAction struct {
+	// Type is the action to take
+	Type RecoveryActionType `json:"type"`
+	// DelaySeconds is the time to wait before taking the action
+	DelaySeconds uint32 `json:"delaySeconds,omitempty"`
+}
+
+// Probe describes a check of the liveness of a service. Exactly one of TCPPort, HTTPGet, NamedPipe and
+// PowershellCommand must be set.
+type Probe struct {
+	// TCPPort is a port on the instance's loopback address which accepts TCP connections while the service is alive
+	TCPPort uint16 `json:"tcpPort,omitempty"`
+	// HTTPGet is a URL which responds to GET requests with a success or redirect status while the service is alive
+	HTTPGet string `json:"httpGet,omitempty"`
+	// NamedPipe is the path of a named pipe, such as \\.\pipe\containerd-containerd, which exists while the service
+	// is alive
+	NamedPipe string `json:"namedPipe,omitempty"`
+	// PowershellCommand is a PowerShell command which succeeds while the service is alive
+	PowershellCommand string `json:"powershellCommand,omitempty"`
+	// TimeoutSeconds is the time after which the check fails. Defaults to 5 seconds.
+	TimeoutSeconds uint32 `json:"timeoutSeconds,omitempty"`
+	// FailureThreshold is the number of consecutive failed checks after which the service is restarted. Defaults to 3.
+	FailureThreshold uint32 `json:"failureThreshold,omitempty"`
+}
+
 // Service represents the configuration spec of a Windows service
 type Service struct {
 	// Name is the name of the Windows service
@@ -81,6 +130,21 @@ type Service struct {
 	// Priority is a non-negative integer that will be used to order the creation of the services.
 	// Priority 0 is created first
 	Priority uint `json:"priority"`
+	// Additional indicates the service was given by the cluster admin through the additional services ConfigMap
+	Additional bool `json:"additional,omitempty"`
+	// RecoveryActions are the actions taken, in order, each time the service fails. The last action is repeated on
+	// further failures, until the failure count is reset. No action is taken if empty.
+	RecoveryActions []RecoveryAction `json:"recoveryActions,omitempty"`
+	// RecoveryResetPeriod is the time in seconds without failures after which the failure count of the service is reset
+	RecoveryResetPeriod uint32 `json:"recoveryResetPeriod,omitempty"`
+	// StartType is when the service is started by the Windows service manager. Defaults to Manual.
+	StartType StartType `json:"startType,omitempty"`
+	// Account is the name of the account the service runs as, which must not require a password, such as
+	// NT AUTHORITY\LocalService or a group managed service account. Defaults to LocalSystem.
+	Account string `json:"account,omitempty"`
+	// LivenessProbe is checked periodically while the service is running. The service is restarted if the check fails
+	// consecutively. The service is only checked to be running if nil.
+	LivenessProbe *Probe `json:"livenessProbe,omitempty"`
 }
 
 // FileInfo contains the path and checksum of a file copied to an instance by WMCO
@@ -253,6 +317,11 @@ func (cmData *Data) GetBootstrapServices() []Service {
 // validate ensures the given object represents a valid services ConfigMap, ensuring bootstrap services are defined to
 // always start before controller services.
 func (cmData *Data) validate() error {
+	for _, svc := range cmData.Services {
+		if err := svc.validateSettings(); err != nil {
+			return err
+		}
+	}
 	if err := validateDependencies(cmData.Services); err != nil {
 		return err
 	}
@@ -309,6 +378,33 @@ func contains[S ~[]E, E any](slice S, target E) bool {
 	return false
 }
 
+// validateSettings ensures the start type, recovery actions and liveness probe of the service are supported
+func (s *Service) validateSettings() error {
+	switch s.StartType {
+	case "", StartTypeAutomatic, StartTypeDelayedAutomatic, StartTypeManual:
+	default:
+		return fmt.Errorf("service %s has unsupported start type %s", s.Name, s.StartType)
+	}
+	for _, action := range s.RecoveryActions {
+		if action.Type != RecoveryActionRestart && action.Type != RecoveryActionNone {
+			return fmt.Errorf("service %s has unsupported recovery action %s", s.Name, action.Type)
+		}
+	}
+	if s.LivenessProbe != nil {
+		checks := 0
+		for _, set := range []bool{s.LivenessProbe.TCPPort != 0, s.LivenessProbe.HTTPGet != "",
+			s.LivenessProbe.NamedPipe != "", s.LivenessProbe.PowershellCommand != ""} {
+			if set {
+				checks++
+			}
+		}
+		if checks != 1 {
+			return fmt.Errorf("liveness probe of service %s must have exactly one check", s.Name)
+		}
+	}
+	return nil
+}
+
 // validateDependencies ensures that no bootstrap service depends on a non-bootstrap service or node object
 // and ensures there is no cyclical dependency chain
 func validateDependencies(services []Service) error {
@@ -751,3 +751,57 @@ func TestValidatePriorities(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSettings(t *testing.T) {
+	testCases := []struct {
+		name        string
+		service     Service
+		expectedErr bool
+	}{
+		{
+			name:    "defaults",
+			service: Service{Name: "svc"},
+		},
+		{
+			name: "all settings",
+			service: Service{Name: "svc", StartType: StartTypeDelayedAutomatic, Account: "NT AUTHORITY\\LocalService",
+				RecoveryActions: []RecoveryAction{{Type: RecoveryActionRestart, DelaySeconds: 10},
+					{Type: RecoveryActionNone}}, RecoveryResetPeriod: 600},
+		},
+		{
+			name:        "unsupported start type",
+			service:     Service{Name: "svc", StartType: "Disabled"},
+			expectedErr: true,
+		},
+		{
+			name:    "liveness probe",
+			service: Service{Name: "svc", LivenessProbe: &Probe{TCPPort: 10248, FailureThreshold: 5}},
+		},
+		{
+			name:        "liveness probe without check",
+			service:     Service{Name: "svc", LivenessProbe: &Probe{TimeoutSeconds: 1}},
+			expectedErr: true,
+		},
+		{
+			name: "liveness probe with several checks",
+			service: Service{Name: "svc", LivenessProbe: &Probe{TCPPort: 10248,
+				HTTPGet: "http://127.0.0.1:10248/healthz"}},
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported recovery action",
+			service:     Service{Name: "svc", RecoveryActions: []RecoveryAction{{Type: "Reboot"}}},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.service.validateSettings()
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
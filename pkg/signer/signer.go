@@ -8,6 +8,7 @@ import (
 	kubeTypes "k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 )
 
@@ -23,3 +24,33 @@ func Create(ctx context.Context, secret kubeTypes.NamespacedName, c client.Clien
 	}
 	return signer, nil
 }
+
+// ForInstance creates the signer used to SSH into the given instance, from the private key held by the instance's key
+// Secret in the given namespace. Instances without a key Secret of their own use the cloud private key Secret.
+func ForInstance(ctx context.Context, c client.Client, namespace string, instanceInfo *instance.Info) (ssh.Signer,
+	error) {
+	keySecret := secrets.PrivateKeySecret
+	if instanceInfo.KeySecret != "" {
+		keySecret = instanceInfo.KeySecret
+	}
+	signer, err := Create(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: keySecret}, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create signer for instance %s from secret %s: %w", instanceInfo.Address,
+			keySecret, err)
+	}
+	return signer, nil
+}
+
+// ResolveJumpHosts sets the signer of each of the given jump hosts, created from the private key held by the jump
+// host's key Secret in the given namespace
+func ResolveJumpHosts(ctx context.Context, c client.Client, namespace string, jumpHosts []instance.JumpHost) error {
+	for i := range jumpHosts {
+		signer, err := Create(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: jumpHosts[i].KeySecret}, c)
+		if err != nil {
+			return fmt.Errorf("unable to create signer for jump host %s from secret %s: %w", jumpHosts[i].Address,
+				jumpHosts[i].KeySecret, err)
+		}
+		jumpHosts[i].Signer = signer
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package upgrade
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+const (
+	// ReasonComplete means every Windows node has been upgraded to the current operator version
+	ReasonComplete = "Complete"
+	// ReasonPaused means the rollout has been paused through the upgrade strategy
+	ReasonPaused = "Paused"
+	// ReasonCanaryUpgrading means only the canary nodes are being upgraded
+	ReasonCanaryUpgrading = "CanaryUpgrading"
+	// ReasonCanarySoaking means the canary nodes have been upgraded, and must stay Ready for the soak period
+	ReasonCanarySoaking = "CanarySoaking"
+	// ReasonCanaryFailed means the rollout has halted, as a canary node failed its upgrade or is not Ready
+	ReasonCanaryFailed = "CanaryFailed"
+	// ReasonRollingOut means Windows nodes are being upgraded
+	ReasonRollingOut = "RollingOut"
+)
+
+// Rollout describes the progress of the upgrade of the Windows nodes to the current operator version
+type Rollout struct {
+	// Reason is a CamelCase identifier of the state of the rollout
+	Reason string
+	// Message describes the state of the rollout
+	Message string
+	// RequeueAfter is the time after which the state of the rollout changes without any node changing, if non-zero
+	RequeueAfter time.Duration
+	// Outdated is the number of Windows nodes left to upgrade, including the nodes being upgraded
+	Outdated int
+	// canaries holds the names of the canary nodes
+	canaries map[string]struct{}
+}
+
+// Progressing returns true if Windows nodes can be upgraded
+func (r *Rollout) Progressing() bool {
+	return r.Reason != ReasonComplete && r.Reason != ReasonPaused && r.Reason != ReasonCanaryFailed
+}
+
+// Allows returns nil if the rollout allows the given node to start upgrading, or an error describing why it cannot
+func (r *Rollout) Allows(node *core.Node) error {
+	switch r.Reason {
+	case ReasonPaused:
+		return fmt.Errorf("cannot mark node %s as upgrading: %s", node.GetName(), r.Message)
+	case ReasonCanaryUpgrading, ReasonCanarySoaking, ReasonCanaryFailed:
+		if !r.IsCanary(node) {
+			return fmt.Errorf("cannot mark node %s as upgrading: %s", node.GetName(), r.Message)
+		}
+	}
+	return nil
+}
+
+// IsCanary returns true if the given node is one of the canary nodes of the rollout
+func (r *Rollout) IsCanary(node *core.Node) bool {
+	_, canary := r.canaries[node.GetName()]
+	return canary
+}
+
+// GetRollout returns the state of the rollout of the current operator version to the given Windows nodes, as of now
+func GetRollout(nodes []core.Node, settings operatorconfig.Settings, isBYOH func(*core.Node) bool,
+	now time.Time) (*Rollout, error) {
+	outdated := 0
+	for i := range nodes {
+		if isOutdated(&nodes[i]) {
+			outdated++
+		}
+	}
+	if outdated == 0 {
+		return &Rollout{Reason: ReasonComplete,
+			Message: fmt.Sprintf("all Windows nodes are at version %s", version.Get())}, nil
+	}
+	if settings.UpgradeStrategy.Paused {
+		return &Rollout{Reason: ReasonPaused, Outdated: outdated,
+			Message: fmt.Sprintf("upgrades are paused with %d Windows nodes left to upgrade", outdated)}, nil
+	}
+	rollingOut := &Rollout{Reason: ReasonRollingOut, Outdated: outdated,
+		Message: fmt.Sprintf("%d Windows nodes left to upgrade", outdated)}
+	if settings.UpgradeStrategy.Canary == nil {
+		return rollingOut, nil
+	}
+
+	canaries, err := selectCanaries(nodes, settings, isBYOH)
+	if err != nil {
+		return nil, err
+	}
+	rollout := &Rollout{Outdated: outdated, canaries: make(map[string]struct{})}
+	var failed, upgrading []string
+	var soakedAt time.Time
+	for _, canary := range canaries {
+		rollout.canaries[canary.GetName()] = struct{}{}
+		switch {
+		case canary.GetAnnotations()[metadata.PhaseAnnotation] == string(wmcov1.PhaseFailed):
+			failed = append(failed, canary.GetName())
+		case isOutdated(canary):
+			upgrading = append(upgrading, canary.GetName())
+		case !isReady(canary):
+			failed = append(failed, canary.GetName())
+		default:
+			readyAt := phaseTransitionTime(canary).Add(settings.UpgradeStrategy.Canary.SoakPeriod)
+			if readyAt.After(soakedAt) {
+				soakedAt = readyAt
+			}
+		}
+	}
+	switch {
+	case len(failed) != 0:
+		rollout.Reason = ReasonCanaryFailed
+		rollout.Message = fmt.Sprintf("upgrades are halted as canary nodes %s failed", strings.Join(failed, ", "))
+	case len(upgrading) != 0:
+		rollout.Reason = ReasonCanaryUpgrading
+		rollout.Message = fmt.Sprintf("waiting for canary nodes %s to be upgraded", strings.Join(upgrading, ", "))
+	case now.Before(soakedAt):
+		rollout.Reason = ReasonCanarySoaking
+		rollout.Message = fmt.Sprintf("waiting for canary nodes to stay Ready until %s",
+			soakedAt.UTC().Format(time.RFC3339))
+		rollout.RequeueAfter = soakedAt.Sub(now)
+	default:
+		rollingOut.canaries = rollout.canaries
+		return rollingOut, nil
+	}
+	return rollout, nil
+}
+
+// selectCanaries returns the canary nodes of the rollout. Nodes annotated as canaries of the current version keep
+// their place, so that the canary set is stable across reconciles, and the remaining places go to the outdated nodes
+// matching the canary selector, following the upgrade order. Nodes which are already at the current version without
+// having been upgraded as canaries are never picked, as their soak would not vouch for the current version.
+func selectCanaries(nodes []core.Node, settings operatorconfig.Settings,
+	isBYOH func(*core.Node) bool) ([]*core.Node, error) {
+	canary := settings.UpgradeStrategy.Canary
+	selector, err := meta.LabelSelectorAsSelector(&canary.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid canary selector: %w", err)
+	}
+	var selected, candidates []*core.Node
+	for i := range nodes {
+		canaryFor, annotated := nodes[i].GetAnnotations()[metadata.CanaryAnnotation]
+		switch {
+		case annotated && canaryFor == version.Get():
+			selected = append(selected, &nodes[i])
+		case selector.Matches(labels.Set(nodes[i].GetLabels())) && isOutdated(&nodes[i]):
+			candidates = append(candidates, &nodes[i])
+		}
+	}
+	sortNodes(selected, settings.UpgradeStrategy.Order, isBYOH)
+	sortNodes(candidates, settings.UpgradeStrategy.Order, isBYOH)
+	selected = append(selected, candidates...)
+	if len(selected) > canary.Count {
+		selected = selected[:canary.Count]
+	}
+	return selected, nil
+}
+
+// isOutdated returns true if the given node is upgrading or was configured by a previous operator version
+func isOutdated(node *core.Node) bool {
+	if isUpgrading(node) {
+		return true
+	}
+	nodeVersion, present := node.GetAnnotations()[metadata.VersionAnnotation]
+	return present && nodeVersion != version.Get()
+}
+
+// phaseTransitionTime returns the time the given node entered its current configuration phase, or the zero time if it
+// is not known
+func phaseTransitionTime(node *core.Node) time.Time {
+	transitionTime, err := time.Parse(time.RFC3339, node.GetAnnotations()[metadata.PhaseTimeAnnotation])
+	if err != nil {
+		return time.Time{}
+	}
+	return transitionTime
+}
@@ -0,0 +1,183 @@
+package upgrade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+// upgradedNode returns the given node upgraded to the current version, having entered the given phase at phaseTime
+func upgradedNode(node core.Node, phase wmcov1.InstancePhase, phaseTime time.Time) core.Node {
+	node.Annotations = map[string]string{metadata.VersionAnnotation: version.Get(),
+		metadata.PhaseAnnotation: string(phase), metadata.PhaseTimeAnnotation: phaseTime.UTC().Format(time.RFC3339)}
+	return node
+}
+
+// canaryNode returns the given node annotated as a canary of the current version
+func canaryNode(node core.Node) core.Node {
+	annotations := map[string]string{metadata.CanaryAnnotation: version.Get()}
+	for key, value := range node.Annotations {
+		annotations[key] = value
+	}
+	node.Annotations = annotations
+	return node
+}
+
+// notReady returns the given node with its Ready condition set to False
+func notReady(node core.Node) core.Node {
+	node.Status.Conditions = []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionFalse}}
+	return node
+}
+
+func TestGetRollout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	canaryLabels := map[string]string{"canary": "true"}
+	settings := func(paused bool, canaryCount int) operatorconfig.Settings {
+		s := operatorconfig.Defaults()
+		s.UpgradeStrategy.Paused = paused
+		if canaryCount > 0 {
+			s.UpgradeStrategy.Canary = &operatorconfig.Canary{Count: canaryCount, SoakPeriod: time.Hour,
+				Selector: meta.LabelSelector{MatchLabels: canaryLabels}}
+		}
+		return s
+	}
+
+	testCases := []struct {
+		name           string
+		nodes          []core.Node
+		settings       operatorconfig.Settings
+		expectedReason string
+		// allowed and blocked are the names of nodes that the rollout allows, or not, to start upgrading
+		allowed      []string
+		blocked      []string
+		requeueAfter time.Duration
+	}{
+		{
+			name: "complete",
+			nodes: []core.Node{upgradedNode(testNode("a", 0, false, nil), wmcov1.PhaseReady, now),
+				upgradedNode(testNode("b", 0, false, canaryLabels), wmcov1.PhaseReady, now)},
+			settings:       settings(true, 1),
+			expectedReason: ReasonComplete,
+		},
+		{
+			name:           "paused",
+			nodes:          []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, canaryLabels)},
+			settings:       settings(true, 1),
+			expectedReason: ReasonPaused,
+			blocked:        []string{"a", "b"},
+		},
+		{
+			name:           "rolling out without canaries",
+			nodes:          []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, nil)},
+			settings:       settings(false, 0),
+			expectedReason: ReasonRollingOut,
+			allowed:        []string{"a", "b"},
+		},
+		{
+			name: "canary upgrading",
+			nodes: []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, canaryLabels),
+				testNode("c", 0, false, canaryLabels)},
+			settings:       settings(false, 1),
+			expectedReason: ReasonCanaryUpgrading,
+			allowed:        []string{"b"},
+			blocked:        []string{"a", "c"},
+		},
+		{
+			name: "canary soaking",
+			nodes: []core.Node{testNode("a", 0, false, nil),
+				canaryNode(upgradedNode(testNode("b", 0, false, canaryLabels), wmcov1.PhaseReady, now.Add(-time.Minute)))},
+			settings:       settings(false, 1),
+			expectedReason: ReasonCanarySoaking,
+			blocked:        []string{"a"},
+			requeueAfter:   59 * time.Minute,
+		},
+		{
+			name: "canary soaked",
+			nodes: []core.Node{testNode("a", 0, false, nil),
+				canaryNode(upgradedNode(testNode("b", 0, false, canaryLabels), wmcov1.PhaseReady, now.Add(-2*time.Hour)))},
+			settings:       settings(false, 1),
+			expectedReason: ReasonRollingOut,
+			allowed:        []string{"a"},
+		},
+		{
+			name: "canary failed",
+			nodes: []core.Node{testNode("a", 0, false, nil),
+				canaryNode(upgradedNode(testNode("b", 0, true, canaryLabels), wmcov1.PhaseFailed, now))},
+			settings:       settings(false, 1),
+			expectedReason: ReasonCanaryFailed,
+			allowed:        []string{"b"},
+			blocked:        []string{"a"},
+		},
+		{
+			name: "canary not ready after upgrade",
+			nodes: []core.Node{testNode("a", 0, false, nil),
+				notReady(canaryNode(upgradedNode(testNode("b", 0, false, canaryLabels), wmcov1.PhaseReady, now)))},
+			settings:       settings(false, 1),
+			expectedReason: ReasonCanaryFailed,
+			blocked:        []string{"a"},
+		},
+		{
+			name: "canary nodes already up to date",
+			nodes: []core.Node{testNode("a", 0, false, nil),
+				upgradedNode(testNode("b", 0, false, canaryLabels), wmcov1.PhaseReady, now.Add(-time.Minute)),
+				testNode("c", 0, false, canaryLabels)},
+			settings:       settings(false, 1),
+			expectedReason: ReasonCanaryUpgrading,
+			allowed:        []string{"c"},
+			blocked:        []string{"a", "b"},
+		},
+		{
+			name: "no outdated canary nodes",
+			nodes: []core.Node{testNode("a", 0, false, nil),
+				upgradedNode(testNode("b", 0, false, canaryLabels), wmcov1.PhaseReady, now.Add(-time.Minute))},
+			settings:       settings(false, 1),
+			expectedReason: ReasonRollingOut,
+			allowed:        []string{"a"},
+		},
+		{
+			name: "canary kept once upgraded",
+			nodes: []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, canaryLabels),
+				canaryNode(upgradedNode(testNode("c", 0, false, canaryLabels), wmcov1.PhaseReady,
+					now.Add(-time.Minute)))},
+			settings:       settings(false, 1),
+			expectedReason: ReasonCanarySoaking,
+			blocked:        []string{"a", "b"},
+			requeueAfter:   59 * time.Minute,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rollout, err := GetRollout(test.nodes, test.settings, isBYOH, now)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedReason, rollout.Reason)
+			assert.Equal(t, test.requeueAfter, rollout.RequeueAfter)
+			outdated := 0
+			for i := range test.nodes {
+				node := &test.nodes[i]
+				if isOutdated(node) {
+					outdated++
+				}
+				for _, name := range test.allowed {
+					if node.GetName() == name {
+						assert.NoError(t, rollout.Allows(node), name)
+					}
+				}
+				for _, name := range test.blocked {
+					if node.GetName() == name {
+						assert.Error(t, rollout.Allows(node), name)
+					}
+				}
+			}
+			assert.Equal(t, outdated, rollout.Outdated)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package upgrade
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+// budget is the number of nodes of a set that can be upgraded at the same time
+type budget struct {
+	// name identifies the set of nodes in errors
+	name     string
+	selector labels.Selector
+	// available is the number of nodes of the set that can still start upgrading
+	available int
+}
+
+// CanStart returns nil if the given node can start upgrading under the upgrade strategy of the given settings, or an
+// error describing why it has to wait. canary is true if the node starts upgrading as a canary of the rollout. nodes is the list of all Windows nodes, isBYOH tells BYOH nodes apart from
+// Machine-backed nodes. Nodes cannot start upgrading while the rollout is paused, and only canary nodes can while the
+// rollout is in its canary phase.
+//
+// When the strategy has ordering rules, upgrade slots are handed out to the nodes waiting for an upgrade in that
+// order, so a node only starts upgrading once every node ahead of it has been given a slot, or cannot be given one due
+// to the budget of one of its groups. Otherwise slots are handed out as nodes ask for them.
+func CanStart(node *core.Node, nodes []core.Node, settings operatorconfig.Settings,
+	isBYOH func(*core.Node) bool) (canary bool, err error) {
+	if isUpgrading(node) {
+		return false, nil
+	}
+	rollout, err := GetRollout(nodes, settings, isBYOH, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if err = rollout.Allows(node); err != nil {
+		return false, err
+	}
+	canary = rollout.IsCanary(node)
+	budgets, err := newBudgets(nodes, settings)
+	if err != nil {
+		return false, err
+	}
+	// Nodes that are already upgrading take up their slots
+	for i := range nodes {
+		if isUpgrading(&nodes[i]) {
+			reserve(budgets, &nodes[i])
+		}
+	}
+
+	waiting := []*core.Node{node}
+	if len(settings.UpgradeStrategy.Order) != 0 {
+		waiting = waitingNodes(node, nodes)
+		sortNodes(waiting, settings.UpgradeStrategy.Order, isBYOH)
+	}
+	ahead := 0
+	for _, candidate := range waiting {
+		exhausted := exhaustedBudget(budgets, candidate)
+		if candidate.GetName() == node.GetName() {
+			if exhausted != nil {
+				return false, fmt.Errorf("cannot mark node %s as upgrading, maximum number of upgrading nodes reached "+
+					"for %s (%d nodes waiting ahead of it)", node.GetName(), exhausted.name, ahead)
+			}
+			return canary, nil
+		}
+		if exhausted == nil {
+			reserve(budgets, candidate)
+		}
+		ahead++
+	}
+	return canary, nil
+}
+
+// newBudgets returns the overall budget followed by the budget of each group of the upgrade strategy
+func newBudgets(nodes []core.Node, settings operatorconfig.Settings) ([]*budget, error) {
+	overall, err := scaledBudget(settings.MaxUnavailable(), len(nodes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxUnavailable: %w", err)
+	}
+	budgets := []*budget{{name: "all Windows nodes", selector: labels.Everything(), available: overall}}
+	for _, group := range settings.UpgradeStrategy.Groups {
+		selector, err := meta.LabelSelectorAsSelector(&group.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector for upgrade group %s: %w", group.Name, err)
+		}
+		members := 0
+		for i := range nodes {
+			if selector.Matches(labels.Set(nodes[i].GetLabels())) {
+				members++
+			}
+		}
+		available, err := scaledBudget(group.MaxUnavailable, members)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxUnavailable for upgrade group %s: %w", group.Name, err)
+		}
+		budgets = append(budgets, &budget{name: "group " + group.Name, selector: selector, available: available})
+	}
+	return budgets, nil
+}
+
+// scaledBudget returns the number of nodes out of total described by maxUnavailable. At least one node is allowed,
+// so that upgrades always make progress.
+func scaledBudget(maxUnavailable intstr.IntOrString, total int) (int, error) {
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, total, false)
+	if err != nil {
+		return 0, err
+	}
+	if value < 1 {
+		return 1, nil
+	}
+	return value, nil
+}
+
+// exhaustedBudget returns the first budget applying to the given node with no slots available, or nil if the node can
+// start upgrading
+func exhaustedBudget(budgets []*budget, node *core.Node) *budget {
+	for _, b := range budgets {
+		if b.selector.Matches(labels.Set(node.GetLabels())) && b.available <= 0 {
+			return b
+		}
+	}
+	return nil
+}
+
+// reserve takes up a slot in each budget applying to the given node
+func reserve(budgets []*budget, node *core.Node) {
+	for _, b := range budgets {
+		if b.selector.Matches(labels.Set(node.GetLabels())) {
+			b.available--
+		}
+	}
+}
+
+// isUpgrading returns true if the given node is marked as upgrading
+func isUpgrading(node *core.Node) bool {
+	return node.GetLabels()[metadata.UpgradingLabel] == "true"
+}
+
+// IsRolledBack returns true if the upgrade of the given node to the current operator version failed and was rolled
+// back. Such nodes are not upgraded again until the rolled-back-from annotation is removed.
+func IsRolledBack(node *core.Node) bool {
+	rolledBackFrom, present := node.GetAnnotations()[metadata.RolledBackAnnotation]
+	return present && rolledBackFrom == version.Get()
+}
+
+// waitingNodes returns the given node, and the Ready nodes configured by a previous operator version which have not
+// started upgrading. Nodes which are not Ready are left out, as they may not be reachable and would hold on to a slot,
+// as are nodes which were rolled back.
+func waitingNodes(node *core.Node, nodes []core.Node) []*core.Node {
+	waiting := []*core.Node{node}
+	for i := range nodes {
+		if nodes[i].GetName() == node.GetName() || isUpgrading(&nodes[i]) || !isReady(&nodes[i]) ||
+			IsRolledBack(&nodes[i]) {
+			continue
+		}
+		nodeVersion, present := nodes[i].GetAnnotations()[metadata.VersionAnnotation]
+		if present && nodeVersion != version.Get() {
+			waiting = append(waiting, &nodes[i])
+		}
+	}
+	return waiting
+}
+
+// isReady returns true if the given node has the Ready condition set to True
+func isReady(node *core.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == core.NodeReady {
+			return condition.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
+
+// sortNodes sorts the given nodes in the order they should be upgraded in, according to the given rules. Nodes that
+// are equal under every rule are sorted by name.
+func sortNodes(nodes []*core.Node, order []wmcov1.UpgradeOrder, isBYOH func(*core.Node) bool) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		for _, rule := range order {
+			switch rule {
+			case wmcov1.UpgradeOrderBYOHFirst, wmcov1.UpgradeOrderMachinesFirst:
+				if isBYOH(a) == isBYOH(b) {
+					continue
+				}
+				return isBYOH(a) == (rule == wmcov1.UpgradeOrderBYOHFirst)
+			case wmcov1.UpgradeOrderOldestFirst, wmcov1.UpgradeOrderNewestFirst:
+				created, otherCreated := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+				if created.Equal(&otherCreated) {
+					continue
+				}
+				return created.Before(&otherCreated) == (rule == wmcov1.UpgradeOrderOldestFirst)
+			}
+		}
+		return a.GetName() < b.GetName()
+	})
+}
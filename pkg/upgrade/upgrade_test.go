@@ -0,0 +1,192 @@
+package upgrade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/operatorconfig"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+// testNode returns a Ready node configured by a previous operator version, created age ago
+func testNode(name string, age time.Duration, upgrading bool, labels map[string]string) core.Node {
+	nodeLabels := map[string]string{}
+	for key, value := range labels {
+		nodeLabels[key] = value
+	}
+	if upgrading {
+		nodeLabels[metadata.UpgradingLabel] = "true"
+	}
+	return core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: name, Labels: nodeLabels,
+			CreationTimestamp: meta.NewTime(time.Unix(1700000000, 0).Add(-age)),
+			Annotations:       map[string]string{metadata.VersionAnnotation: "previous-version"}},
+		Status: core.NodeStatus{Conditions: []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionTrue}}},
+	}
+}
+
+func isBYOH(node *core.Node) bool {
+	return node.GetLabels()["byoh"] == "true"
+}
+
+func TestCanStart(t *testing.T) {
+	byoh := map[string]string{"byoh": "true"}
+	pool := func(name string) map[string]string { return map[string]string{"pool": name} }
+	percent := func(value string) *intstr.IntOrString {
+		v := intstr.FromString(value)
+		return &v
+	}
+	settings := func(maxParallel int, strategy operatorconfig.UpgradeStrategy) operatorconfig.Settings {
+		s := operatorconfig.Defaults()
+		s.MaxParallelUpgrades = maxParallel
+		s.UpgradeStrategy = strategy
+		return s
+	}
+
+	testCases := []struct {
+		name        string
+		node        string
+		nodes       []core.Node
+		settings    operatorconfig.Settings
+		expectedErr bool
+	}{
+		{
+			name:     "default allows a single node",
+			node:     "a",
+			nodes:    []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, nil)},
+			settings: operatorconfig.Defaults(),
+		},
+		{
+			name:        "default blocks a second node",
+			node:        "a",
+			nodes:       []core.Node{testNode("a", 0, false, nil), testNode("b", 0, true, nil)},
+			settings:    operatorconfig.Defaults(),
+			expectedErr: true,
+		},
+		{
+			name:     "node already upgrading",
+			node:     "a",
+			nodes:    []core.Node{testNode("a", 0, true, nil), testNode("b", 0, true, nil)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{}),
+		},
+		{
+			name: "percentage of nodes",
+			node: "c",
+			nodes: []core.Node{testNode("a", 0, true, nil), testNode("b", 0, false, nil),
+				testNode("c", 0, false, nil), testNode("d", 0, false, nil)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{MaxUnavailable: percent("50%")}),
+		},
+		{
+			name: "percentage of nodes exhausted",
+			node: "c",
+			nodes: []core.Node{testNode("a", 0, true, nil), testNode("b", 0, true, nil),
+				testNode("c", 0, false, nil), testNode("d", 0, false, nil)},
+			settings:    settings(1, operatorconfig.UpgradeStrategy{MaxUnavailable: percent("50%")}),
+			expectedErr: true,
+		},
+		{
+			name:     "percentage rounding to zero allows one node",
+			node:     "a",
+			nodes:    []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, nil)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{MaxUnavailable: percent("10%")}),
+		},
+		{
+			name:        "invalid percentage",
+			node:        "a",
+			nodes:       []core.Node{testNode("a", 0, false, nil)},
+			settings:    settings(1, operatorconfig.UpgradeStrategy{MaxUnavailable: percent("ten")}),
+			expectedErr: true,
+		},
+		{
+			name: "group budget exhausted",
+			node: "b",
+			nodes: []core.Node{testNode("a", 0, true, pool("x")), testNode("b", 0, false, pool("x")),
+				testNode("c", 0, false, pool("y"))},
+			settings: settings(3, operatorconfig.UpgradeStrategy{Groups: []wmcov1.UpgradeGroup{{Name: "x",
+				Selector: meta.LabelSelector{MatchLabels: pool("x")}, MaxUnavailable: intstr.FromInt(1)}}}),
+			expectedErr: true,
+		},
+		{
+			name: "other group unaffected",
+			node: "c",
+			nodes: []core.Node{testNode("a", 0, true, pool("x")), testNode("b", 0, false, pool("x")),
+				testNode("c", 0, false, pool("y"))},
+			settings: settings(3, operatorconfig.UpgradeStrategy{Groups: []wmcov1.UpgradeGroup{{Name: "x",
+				Selector: meta.LabelSelector{MatchLabels: pool("x")}, MaxUnavailable: intstr.FromInt(1)}}}),
+		},
+		{
+			name:  "BYOH first",
+			node:  "a",
+			nodes: []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, byoh)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{
+				Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderBYOHFirst}}),
+			expectedErr: true,
+		},
+		{
+			name:  "BYOH node goes first",
+			node:  "b",
+			nodes: []core.Node{testNode("a", 0, false, nil), testNode("b", 0, false, byoh)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{
+				Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderBYOHFirst}}),
+		},
+		{
+			name:  "oldest first",
+			node:  "a",
+			nodes: []core.Node{testNode("a", time.Hour, false, nil), testNode("b", 2*time.Hour, false, nil)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{
+				Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderOldestFirst}}),
+			expectedErr: true,
+		},
+		{
+			name:  "newest first",
+			node:  "a",
+			nodes: []core.Node{testNode("a", time.Hour, false, nil), testNode("b", 2*time.Hour, false, nil)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{
+				Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderNewestFirst}}),
+		},
+		{
+			name: "rolled back node does not hold a slot",
+			node: "b",
+			nodes: []core.Node{func() core.Node {
+				node := testNode("a", 2*time.Hour, false, nil)
+				node.Annotations[metadata.RolledBackAnnotation] = version.Get()
+				return node
+			}(), testNode("b", time.Hour, false, nil)},
+			settings: settings(1, operatorconfig.UpgradeStrategy{
+				Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderOldestFirst}}),
+		},
+		{
+			name: "node ahead blocked by its group does not hold a slot",
+			node: "c",
+			nodes: []core.Node{testNode("a", 0, true, pool("x")), testNode("b", 0, false, pool("x")),
+				testNode("c", 0, false, nil)},
+			settings: settings(2, operatorconfig.UpgradeStrategy{
+				Order: []wmcov1.UpgradeOrder{wmcov1.UpgradeOrderOldestFirst},
+				Groups: []wmcov1.UpgradeGroup{{Name: "x", Selector: meta.LabelSelector{MatchLabels: pool("x")},
+					MaxUnavailable: intstr.FromInt(1)}}}),
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var node *core.Node
+			for i := range test.nodes {
+				if test.nodes[i].GetName() == test.node {
+					node = &test.nodes[i]
+				}
+			}
+			_, err := CanStart(node, test.nodes, test.settings, isBYOH)
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package windows
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -13,24 +17,59 @@ import (
 	"golang.org/x/crypto/ssh"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 )
 
-// sshPort is the default SSH port
-const sshPort = "22"
+const (
+	// sshPort is the default SSH port
+	sshPort = "22"
+	// sshRetryInterval is the default wait time between SSH connection attempts
+	sshRetryInterval = time.Minute
+	// sshHealthCheckTimeout is the time a VM has to answer the keepalive request checking a connection is alive
+	sshHealthCheckTimeout = 10 * time.Second
+)
 
 // AuthErr occurs when our authentication into the VM is rejected
 type AuthErr struct {
-	err string
+	// protocol is the protocol used to connect to the VM
+	protocol string
+	err      string
 }
 
 func (e *AuthErr) Error() string {
-	return fmt.Sprintf("SSH authentication failed: %s", e.err)
+	return fmt.Sprintf("%s authentication failed: %s", e.protocol, e.err)
+}
+
+// newAuthErr returns a new AuthErr for the given protocol
+func newAuthErr(protocol string, err error) *AuthErr {
+	return &AuthErr{protocol: protocol, err: err.Error()}
+}
+
+// HostKeyMismatchErr occurs when the SSH host key, or WinRM certificate key, presented by the VM does not match the
+// host key pinned for it
+type HostKeyMismatchErr struct {
+	// ID identifies the instance the host key is pinned for
+	ID string
+	// Address is the address of the VM that presented the host key
+	Address string
+	// Pinned is the SHA256 fingerprint of the pinned host key
+	Pinned string
+	// Presented is the SHA256 fingerprint of the host key presented by the VM
+	Presented string
 }
 
-// newAuthErr returns a new AuthErr
-func newAuthErr(err error) *AuthErr {
-	return &AuthErr{err: err.Error()}
+func (e *HostKeyMismatchErr) Error() string {
+	return fmt.Sprintf("host key %s presented by %s does not match the host key %s pinned for %s", e.Presented,
+		e.Address, e.Pinned, e.ID)
+}
+
+// HostKeyStore persists the SSH host keys pinned for instances
+type HostKeyStore interface {
+	// Pin records key as the host key of the instance identified by id, unless a host key is already pinned for it.
+	// The host key pinned for the instance is returned.
+	Pin(ctx context.Context, id string, key ssh.PublicKey) (ssh.PublicKey, error)
 }
 
 type connectivity interface {
@@ -38,12 +77,10 @@ type connectivity interface {
 	init() error
 	// run executes the given command on the remote system
 	run(cmd string) (string, error)
-	// createSFTPClient initializes an SFTP client from the existing SSH client. Caller should close the connection.
-	createSFTPClient() (*sftp.Client, error)
 	// transfer reads from reader and creates a file in the remote VM directory, creating the remote directory if needed
-	transfer(*sftp.Client, io.Reader, string, string) error
+	transfer(io.Reader, string, string) error
 	// transferFiles transfers the given files to a given remote directory
-	transferFiles(*sftp.Client, map[string][]byte, string) error
+	transferFiles(map[string][]byte, string) error
 }
 
 // sshConnectivity encapsulates the information needed to connect to the Windows VM over ssh
@@ -52,19 +89,52 @@ type sshConnectivity struct {
 	username string
 	// ipAddress is the VM's IP address
 	ipAddress string
+	// port is the port the VM's SSH server is listening on
+	port string
 	// signer is used for authenticating against the VM
 	signer ssh.Signer
+	// options are the connection parameters
+	options instance.SSHOptions
+	// jumpHosts are the SSH servers the connection to the VM is tunnelled through, in the order they are dialed
+	jumpHosts []instance.JumpHost
+	// hostKeyID identifies the VM in hostKeys
+	hostKeyID string
+	// hostKeys holds the host key pinned for the VM. The first host key presented by the VM is pinned.
+	hostKeys HostKeyStore
+	// mu guards sshClient, jumpClients and stopKeepalive, as the connectivity is shared by concurrent reconciles
+	// through the pool
+	mu sync.RWMutex
 	// sshClient is the client used to access the Windows VM via ssh
 	sshClient *ssh.Client
-	log       logr.Logger
+	// jumpClients are the clients connected to the jump hosts sshClient is tunnelled through, in the order they were
+	// dialed
+	jumpClients []*ssh.Client
+	// active is the number of operations in progress over the connection, guarded by mu
+	active int
+	// lastUsed is the time an operation over the connection last started or ended, guarded by mu
+	lastUsed time.Time
+	// stopKeepalive stops the keepalive requests sent over sshClient, nil if none are being sent
+	stopKeepalive chan struct{}
+	log           logr.Logger
 }
 
-// newSshConnectivity returns an instance of sshConnectivity
-func newSshConnectivity(username, ipAddress string, signer ssh.Signer, logger logr.Logger) (connectivity, error) {
+// newSshConnectivity returns an instance of sshConnectivity. If port is empty, the default SSH port is used. The host
+// key presented by the VM is verified against the key pinned for hostKeyID in hostKeys, and the host keys of the jump
+// hosts against the keys pinned for their own IDs.
+func newSshConnectivity(username, ipAddress, port string, signer ssh.Signer, options instance.SSHOptions,
+	jumpHosts []instance.JumpHost, hostKeyID string, hostKeys HostKeyStore, logger logr.Logger) (connectivity, error) {
+	if port == "" {
+		port = sshPort
+	}
 	c := &sshConnectivity{
 		username:  username,
 		ipAddress: ipAddress,
+		port:      port,
 		signer:    signer,
+		options:   options,
+		jumpHosts: jumpHosts,
+		hostKeyID: hostKeyID,
+		hostKeys:  hostKeys,
 		log:       logger,
 	}
 	if err := c.init(); err != nil {
@@ -75,46 +145,261 @@ func newSshConnectivity(username, ipAddress string, signer ssh.Signer, logger lo
 
 // init initialises the key based SSH client
 func (c *sshConnectivity) init() error {
-	if c.username == "" || c.ipAddress == "" || c.signer == nil {
+	if c.username == "" || c.ipAddress == "" || c.signer == nil || c.hostKeyID == "" || c.hostKeys == nil {
 		return fmt.Errorf("incomplete sshConnectivity information: %v", c)
 	}
+	for _, jumpHost := range c.jumpHosts {
+		if jumpHost.Username == "" || jumpHost.Address == "" || jumpHost.Signer == nil {
+			return fmt.Errorf("incomplete jump host information: %v", jumpHost)
+		}
+	}
 
 	config := &ssh.ClientConfig{
 		User: c.username,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(c.signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: c.hostKeyCallback(c.hostKeyID, c.ipAddress),
+		Timeout:         c.options.DialTimeout,
+	}
+	retryInterval := sshRetryInterval
+	if c.options.RetryInterval > 0 {
+		retryInterval = c.options.RetryInterval
+	}
+	retryTimeout := retry.Get().Timeout
+	if c.options.RetryTimeout > 0 {
+		retryTimeout = c.options.RetryTimeout
 	}
 	var err error
 	var sshClient *ssh.Client
+	var jumpClients []*ssh.Client
 	// Retry if we are unable to create a client as the VM could still be executing the steps in its user data
-	err = wait.PollImmediate(time.Minute, retry.Timeout, func() (bool, error) {
-		sshClient, err = ssh.Dial("tcp", c.ipAddress+":"+sshPort, config)
+	err = wait.PollImmediate(retryInterval, retryTimeout, func() (bool, error) {
+		sshClient, jumpClients, err = c.dial(config)
 		if err == nil {
 			return true, nil
 		}
 		c.log.V(1).Info("SSH dial", "IP Address", c.ipAddress, "error", err)
+		metrics.SSHDialFailures.Inc()
 		if strings.Contains(err.Error(), "unable to authenticate") {
+			metrics.SSHAuthErrors.Inc()
 			// Authentication failure is a special case that must be handled differently
-			return false, newAuthErr(err)
+			return false, newAuthErr("SSH", err)
+		}
+		var mismatchErr *HostKeyMismatchErr
+		if errors.As(err, &mismatchErr) {
+			// The VM presented a host key that cannot be trusted, retrying will not change that
+			return false, mismatchErr
 		}
 		return false, nil
 	})
 	if err != nil {
 		return fmt.Errorf("unable to connect to Windows VM %s: %w", c.ipAddress, err)
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The clients being replaced, if any, are no longer used
+	c.closeClients()
 	c.sshClient = sshClient
+	c.jumpClients = jumpClients
+	c.startKeepalive()
 	return nil
 }
 
+// client returns the current SSH client
+func (c *sshConnectivity) client() *ssh.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sshClient
+}
+
+// alive returns true if the VM answers a keepalive request sent over the current SSH client within the health check
+// timeout
+func (c *sshConnectivity) alive() bool {
+	client := c.client()
+	if client == nil {
+		return false
+	}
+	answered := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		answered <- err
+	}()
+	select {
+	case err := <-answered:
+		return err == nil
+	case <-time.After(sshHealthCheckTimeout):
+		return false
+	}
+}
+
+// use marks the start of an operation over the connection, and returns a function marking its end. Connections with
+// operations in progress are never closed for being idle.
+func (c *sshConnectivity) use() func() {
+	c.markUsed(1)
+	return func() { c.markUsed(-1) }
+}
+
+// markUsed refreshes the time the connection was last used, and adds delta to the number of operations in progress
+func (c *sshConnectivity) markUsed(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active += delta
+	c.lastUsed = time.Now()
+}
+
+// idle returns the time since the connection was last used, or zero if operations are in progress over it
+func (c *sshConnectivity) idle() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.active > 0 {
+		return 0
+	}
+	return time.Since(c.lastUsed)
+}
+
+// close stops the keepalive requests and closes the current SSH client, along with the clients of its jump hosts
+func (c *sshConnectivity) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopKeepalive != nil {
+		close(c.stopKeepalive)
+		c.stopKeepalive = nil
+	}
+	c.closeClients()
+}
+
+// closeClients closes the current SSH client, then the clients of its jump hosts in the reverse order they were
+// dialed. The caller must hold mu.
+func (c *sshConnectivity) closeClients() {
+	if c.sshClient != nil {
+		c.sshClient.Close()
+		c.sshClient = nil
+	}
+	closeReverse(c.jumpClients)
+	c.jumpClients = nil
+}
+
+// closeReverse closes the given clients, from the last to the first
+func closeReverse(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// dial connects to the VM with the given client config, tunnelling the connection through the jump hosts, if any. It
+// returns the client connected to the VM and the clients connected to the jump hosts, which must be closed along with
+// it.
+func (c *sshConnectivity) dial(config *ssh.ClientConfig) (*ssh.Client, []*ssh.Client, error) {
+	var clients []*ssh.Client
+	for _, jumpHost := range c.jumpHosts {
+		port := sshPort
+		if jumpHost.Port != 0 {
+			port = strconv.Itoa(jumpHost.Port)
+		}
+		jumpConfig := &ssh.ClientConfig{
+			User:            jumpHost.Username,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(jumpHost.Signer)},
+			HostKeyCallback: c.hostKeyCallback(jumpHost.HostKeyID(), jumpHost.Address),
+			Timeout:         c.options.DialTimeout,
+		}
+		client, err := c.dialThrough(clients, net.JoinHostPort(jumpHost.Address, port), jumpConfig)
+		if err != nil {
+			// Every client is closed if a connection further down the chain fails, as it would otherwise be leaked
+			closeReverse(clients)
+			return nil, nil, fmt.Errorf("unable to connect to jump host %s: %w", jumpHost.Address, err)
+		}
+		clients = append(clients, client)
+	}
+	client, err := c.dialThrough(clients, net.JoinHostPort(c.ipAddress, c.port), config)
+	if err != nil {
+		closeReverse(clients)
+		return nil, nil, err
+	}
+	return client, clients, nil
+}
+
+// dialThrough connects to the given address over SSH. The connection is tunnelled through the last of the given
+// clients, or made directly if there are none.
+func (c *sshConnectivity) dialThrough(clients []*ssh.Client, address string,
+	config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(clients) == 0 {
+		return ssh.Dial("tcp", address, config)
+	}
+	ctx := context.Background()
+	if c.options.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.DialTimeout)
+		defer cancel()
+	}
+	conn, err := clients[len(clients)-1].DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open tunnel to %s: %w", address, err)
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// hostKeyCallback returns an ssh.HostKeyCallback which accepts the host key presented by the server at the given
+// address only if it matches the host key pinned for the given ID. If no host key has been pinned yet, the presented
+// key is trusted and pinned.
+func (c *sshConnectivity) hostKeyCallback(id, address string) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		pinned, err := c.hostKeys.Pin(context.Background(), id, key)
+		if err != nil {
+			return fmt.Errorf("unable to get host key pinned for %s: %w", id, err)
+		}
+		if !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+			return &HostKeyMismatchErr{ID: id, Address: address, Pinned: ssh.FingerprintSHA256(pinned),
+				Presented: ssh.FingerprintSHA256(key)}
+		}
+		return nil
+	}
+}
+
+// startKeepalive sends keepalive requests over the current SSH client at the configured interval, until the client
+// is replaced or the connection is lost. Any keepalive requests sent over a previous client are stopped. The caller
+// must hold mu.
+func (c *sshConnectivity) startKeepalive() {
+	if c.stopKeepalive != nil {
+		close(c.stopKeepalive)
+		c.stopKeepalive = nil
+	}
+	if c.options.KeepaliveInterval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	c.stopKeepalive = stop
+	go func(client *ssh.Client) {
+		ticker := time.NewTicker(c.options.KeepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+					c.log.V(1).Info("SSH keepalive failed", "IP Address", c.ipAddress, "error", err)
+					return
+				}
+			}
+		}
+	}(c.sshClient)
+}
+
 // run instantiates a new SSH session and runs the command on the VM and returns the combined stdout and stderr output
 func (c *sshConnectivity) run(cmd string) (string, error) {
-	if c.sshClient == nil {
+	defer c.use()()
+	sshClient := c.client()
+	if sshClient == nil {
 		return "", fmt.Errorf("run cannot be called with nil SSH client")
 	}
 
-	session, err := c.sshClient.NewSession()
+	session, err := sshClient.NewSession()
 	if err != nil {
 		return "", err
 	}
@@ -130,19 +415,32 @@ func (c *sshConnectivity) run(cmd string) (string, error) {
 	return string(out), err
 }
 
+// createSFTPClient initializes an SFTP client from the existing SSH client. Caller should close the connection.
 func (c *sshConnectivity) createSFTPClient() (*sftp.Client, error) {
-	if c.sshClient == nil {
+	sshClient := c.client()
+	if sshClient == nil {
 		return nil, fmt.Errorf("cannot be called with nil SSH client")
 	}
 
-	sftpClient, err := sftp.NewClient(c.sshClient)
+	sftpClient, err := sftp.NewClient(sshClient)
 	if err != nil {
 		return nil, err
 	}
 	return sftpClient, nil
 }
 
-func (c *sshConnectivity) transfer(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
+func (c *sshConnectivity) transfer(reader io.Reader, filename, remoteDir string) error {
+	defer c.use()()
+	sftpClient, err := c.createSFTPClient()
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer c.closeSFTPClient(sftpClient)
+	return c.sftpTransfer(sftpClient, reader, filename, remoteDir)
+}
+
+// sftpTransfer reads from reader and creates a file in the remote VM directory using the given SFTP client
+func (c *sshConnectivity) sftpTransfer(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
 	if sftpClient == nil {
 		return fmt.Errorf("transfer cannot be called with nil SFTP client")
 	}
@@ -171,7 +469,30 @@ func (c *sshConnectivity) transfer(sftpClient *sftp.Client, reader io.Reader, fi
 	return nil
 }
 
-func (c *sshConnectivity) transferFiles(sftpClient *sftp.Client, files map[string][]byte, remoteDir string) error {
+func (c *sshConnectivity) transferFiles(files map[string][]byte, remoteDir string) error {
+	defer c.use()()
+	sftpClient, err := c.createSFTPClient()
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer c.closeSFTPClient(sftpClient)
+	// A single SFTP client is used for all the files
+	return transferEach(files, remoteDir, func(reader io.Reader, filename, writeDir string) error {
+		return c.sftpTransfer(sftpClient, reader, filename, writeDir)
+	})
+}
+
+// closeSFTPClient closes the given SFTP client, logging any error
+func (c *sshConnectivity) closeSFTPClient(sftpClient *sftp.Client) {
+	if err := sftpClient.Close(); err != nil {
+		c.log.Error(err, "error closing SFTP connection")
+	}
+}
+
+// transferEach calls transfer for each of the given files, with the remote directory the file should be written into.
+// The keys of files are paths relative to remoteDir.
+func transferEach(files map[string][]byte, remoteDir string,
+	transfer func(reader io.Reader, filename, writeDir string) error) error {
 	for workingPath, content := range files {
 		reader := bytes.NewReader(content)
 
@@ -182,7 +503,7 @@ func (c *sshConnectivity) transferFiles(sftpClient *sftp.Client, files map[strin
 		writeDir := dstPath[:splitIndex]
 		filename := dstPath[splitIndex+1:]
 
-		err := c.transfer(sftpClient, reader, filename, writeDir)
+		err := transfer(reader, filename, writeDir)
 		if err != nil {
 			return fmt.Errorf("failed to transfer file %s to %s: %w", filename, writeDir, err)
 		}
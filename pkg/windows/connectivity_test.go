@@ -0,0 +1,329 @@
+package windows
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// testSSHServer is an SSH server listening on localhost, which accepts the given client key, forwards TCP
+// connections and runs no commands
+type testSSHServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	// hostKey is the host key presented by the server
+	hostKey ssh.PublicKey
+	// keepalives is the number of keepalive requests received
+	keepalives atomic.Int32
+	// forwards is the number of TCP connections forwarded
+	forwards atomic.Int32
+	// connections is the number of SSH connections established
+	connections atomic.Int32
+}
+
+// newTestSSHServer returns a running testSSHServer which accepts connections authenticated with the given signer
+func newTestSSHServer(t *testing.T, clientSigner ssh.Signer) *testSSHServer {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	authorizedKey := string(clientSigner.PublicKey().Marshal())
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != authorizedKey {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testSSHServer{listener: listener, config: config, hostKey: hostSigner.PublicKey()}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+// serve accepts connections until the listener is closed
+func (s *testSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			s.connections.Add(1)
+			go func() {
+				for newChannel := range channels {
+					if newChannel.ChannelType() != "direct-tcpip" {
+						newChannel.Reject(ssh.Prohibited, "not supported")
+						continue
+					}
+					go s.forward(newChannel)
+				}
+			}()
+			for req := range requests {
+				if req.Type == "keepalive@openssh.com" {
+					s.keepalives.Add(1)
+				}
+				if req.WantReply {
+					req.Reply(true, nil)
+				}
+			}
+		}()
+	}
+}
+
+// forward connects the given direct-tcpip channel to the address it requests
+func (s *testSSHServer) forward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.forwards.Add(1)
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+	}()
+	io.Copy(conn, channel)
+	conn.Close()
+}
+
+// port returns the port the server is listening on
+func (s *testSSHServer) port() string {
+	return strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// testHostKeyStore is an in-memory HostKeyStore
+type testHostKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]ssh.PublicKey
+}
+
+func newTestHostKeyStore() *testHostKeyStore {
+	return &testHostKeyStore{keys: map[string]ssh.PublicKey{}}
+}
+
+func (s *testHostKeyStore) Pin(_ context.Context, id string, key ssh.PublicKey) (ssh.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pinned, present := s.keys[id]; present {
+		return pinned, nil
+	}
+	s.keys[id] = key
+	return key, nil
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestNewSshConnectivity(t *testing.T) {
+	signer := newTestSigner(t)
+	server := newTestSSHServer(t, signer)
+
+	t.Run("connects to a non-default port", func(t *testing.T) {
+		conn, err := newSshConnectivity("core", "127.0.0.1", server.port(), signer,
+			instance.SSHOptions{DialTimeout: 5 * time.Second}, nil, "test", newTestHostKeyStore(), logr.Discard())
+		require.NoError(t, err)
+		assert.Equal(t, server.port(), conn.(*sshConnectivity).port)
+	})
+
+	t.Run("sends keepalive requests", func(t *testing.T) {
+		_, err := newSshConnectivity("core", "127.0.0.1", server.port(), signer,
+			instance.SSHOptions{KeepaliveInterval: 10 * time.Millisecond}, nil, "test", newTestHostKeyStore(), logr.Discard())
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool { return server.keepalives.Load() >= 2 }, 5*time.Second,
+			10*time.Millisecond)
+	})
+
+	t.Run("authentication failure is not retried", func(t *testing.T) {
+		start := time.Now()
+		_, err := newSshConnectivity("core", "127.0.0.1", server.port(), newTestSigner(t),
+			instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}, nil, "test", newTestHostKeyStore(), logr.Discard())
+		require.Error(t, err)
+		var authErr *AuthErr
+		assert.ErrorAs(t, err, &authErr)
+		assert.Less(t, time.Since(start), 30*time.Second)
+	})
+
+	t.Run("gives up after the retry timeout", func(t *testing.T) {
+		// Reserve a port with nothing listening on it
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		closedPort := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+		require.NoError(t, listener.Close())
+
+		start := time.Now()
+		_, err = newSshConnectivity("core", "127.0.0.1", closedPort, signer,
+			instance.SSHOptions{RetryInterval: 50 * time.Millisecond, RetryTimeout: 300 * time.Millisecond},
+			nil, "test", newTestHostKeyStore(), logr.Discard())
+		require.Error(t, err)
+		assert.Less(t, time.Since(start), 30*time.Second)
+	})
+}
+
+func TestHostKeyPinning(t *testing.T) {
+	signer := newTestSigner(t)
+	server := newTestSSHServer(t, signer)
+	hostKeys := newTestHostKeyStore()
+	options := instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}
+
+	t.Run("first host key is pinned", func(t *testing.T) {
+		_, err := newSshConnectivity("core", "127.0.0.1", server.port(), signer, options, nil, "instance", hostKeys,
+			logr.Discard())
+		require.NoError(t, err)
+		require.Contains(t, hostKeys.keys, "instance")
+		assert.Equal(t, server.hostKey.Marshal(), hostKeys.keys["instance"].Marshal())
+	})
+
+	t.Run("pinned host key is accepted", func(t *testing.T) {
+		_, err := newSshConnectivity("core", "127.0.0.1", server.port(), signer, options, nil, "instance", hostKeys,
+			logr.Discard())
+		assert.NoError(t, err)
+	})
+
+	t.Run("changed host key is rejected without retrying", func(t *testing.T) {
+		impostor := newTestSSHServer(t, signer)
+		start := time.Now()
+		_, err := newSshConnectivity("core", "127.0.0.1", impostor.port(), signer, options, nil, "instance", hostKeys,
+			logr.Discard())
+		require.Error(t, err)
+		var mismatchErr *HostKeyMismatchErr
+		require.ErrorAs(t, err, &mismatchErr)
+		assert.Equal(t, "instance", mismatchErr.ID)
+		assert.Equal(t, ssh.FingerprintSHA256(server.hostKey), mismatchErr.Pinned)
+		assert.Equal(t, ssh.FingerprintSHA256(impostor.hostKey), mismatchErr.Presented)
+		assert.Less(t, time.Since(start), 30*time.Second)
+		// The pin is left untouched
+		assert.Equal(t, server.hostKey.Marshal(), hostKeys.keys["instance"].Marshal())
+	})
+}
+
+func TestJumpHosts(t *testing.T) {
+	signer := newTestSigner(t)
+	target := newTestSSHServer(t, signer)
+	bastionSigner := newTestSigner(t)
+	bastion := newTestSSHServer(t, bastionSigner)
+	innerSigner := newTestSigner(t)
+	inner := newTestSSHServer(t, innerSigner)
+	hostKeys := newTestHostKeyStore()
+	bastionPort, err := strconv.Atoi(bastion.port())
+	require.NoError(t, err)
+	innerPort, err := strconv.Atoi(inner.port())
+	require.NoError(t, err)
+
+	t.Run("connection is tunnelled through each jump host", func(t *testing.T) {
+		jumpHosts := []instance.JumpHost{
+			{Address: "127.0.0.1", Port: bastionPort, Username: "bastion", Signer: bastionSigner},
+			{Address: "127.0.0.1", Port: innerPort, Username: "inner", Signer: innerSigner},
+		}
+		conn, err := newSshConnectivity("core", "127.0.0.1", target.port(), signer, instance.SSHOptions{}, jumpHosts,
+			"instance", hostKeys, logr.Discard())
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), bastion.forwards.Load())
+		assert.Equal(t, int32(1), inner.forwards.Load())
+		// The host key of every server in the chain is pinned
+		assert.Equal(t, target.hostKey.Marshal(), hostKeys.keys["instance"].Marshal())
+		assert.Equal(t, bastion.hostKey.Marshal(), hostKeys.keys[jumpHosts[0].HostKeyID()].Marshal())
+		assert.Equal(t, inner.hostKey.Marshal(), hostKeys.keys[jumpHosts[1].HostKeyID()].Marshal())
+
+		// The jump host clients are closed when the connection is re-initialized, and when it is closed
+		sshConn := conn.(*sshConnectivity)
+		firstJumpClients := sshConn.jumpClients
+		require.Len(t, firstJumpClients, 2)
+		require.NoError(t, sshConn.init())
+		for _, client := range firstJumpClients {
+			assert.Error(t, client.Wait())
+		}
+		secondJumpClients := sshConn.jumpClients
+		require.Len(t, secondJumpClients, 2)
+		sshConn.close()
+		assert.Empty(t, sshConn.jumpClients)
+		for _, client := range secondJumpClients {
+			assert.Error(t, client.Wait())
+		}
+	})
+
+	t.Run("jump host authentication failure is not retried", func(t *testing.T) {
+		jumpHosts := []instance.JumpHost{
+			{Address: "127.0.0.1", Port: bastionPort, Username: "bastion", Signer: newTestSigner(t)},
+		}
+		_, err := newSshConnectivity("core", "127.0.0.1", target.port(), signer,
+			instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}, jumpHosts, "instance",
+			hostKeys, logr.Discard())
+		require.Error(t, err)
+		var authErr *AuthErr
+		assert.ErrorAs(t, err, &authErr)
+	})
+
+	t.Run("jump host without a signer is rejected", func(t *testing.T) {
+		jumpHosts := []instance.JumpHost{{Address: "127.0.0.1", Port: bastionPort, Username: "bastion"}}
+		_, err := newSshConnectivity("core", "127.0.0.1", target.port(), signer, instance.SSHOptions{}, jumpHosts,
+			"instance", hostKeys, logr.Discard())
+		assert.Error(t, err)
+	})
+}
+
+func TestStartKeepaliveStopsPreviousKeepalive(t *testing.T) {
+	signer := newTestSigner(t)
+	server := newTestSSHServer(t, signer)
+
+	conn, err := newSshConnectivity("core", "127.0.0.1", server.port(), signer,
+		instance.SSHOptions{KeepaliveInterval: time.Hour}, nil, "test", newTestHostKeyStore(), logr.Discard())
+	require.NoError(t, err)
+	c := conn.(*sshConnectivity)
+	first := c.stopKeepalive
+	require.NotNil(t, first)
+
+	require.NoError(t, c.init())
+	select {
+	case <-first:
+	default:
+		t.Fatal("keepalive for the replaced client was not stopped")
+	}
+	assert.NotNil(t, c.stopKeepalive)
+}
@@ -0,0 +1,253 @@
+package windows
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLM message flags, as defined in MS-NLMP section 2.2.2.5
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	// ntlmFlags are the flags requested by the client. Message integrity and confidentiality are not negotiated, as
+	// they are provided by TLS.
+	ntlmFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	// ntlmAvTimestamp is the ID of the AV pair holding the server's time in the challenge's target info
+	ntlmAvTimestamp = 7
+	// ntlmAuthenticateHeaderLength is the length of the fixed part of an AUTHENTICATE message, without the optional
+	// version and MIC fields
+	ntlmAuthenticateHeaderLength = 64
+	// windowsEpochOffset is the number of 100ns intervals between January 1, 1601 and the Unix epoch
+	windowsEpochOffset = 116444736000000000
+)
+
+// ntlmSignature is the signature every NTLM message starts with
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmChallenge holds the fields of an NTLM CHALLENGE message used to authenticate
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+// ntlmTransport is an http.RoundTripper that authenticates each request with NTLMv2, using the Negotiate HTTP
+// authentication scheme. The handshake is bound to the underlying connection, so the given transport must reuse
+// connections.
+type ntlmTransport struct {
+	// domain is the domain of the user, empty for local users
+	domain string
+	// username is the name of the user to authenticate as
+	username string
+	// password is the password of the user
+	password  string
+	transport http.RoundTripper
+}
+
+// newNTLMTransport returns an ntlmTransport authenticating as the given user over the given transport. The username
+// may be qualified with a domain, in the form <domain>\<username>.
+func newNTLMTransport(username, password string, transport http.RoundTripper) *ntlmTransport {
+	domain := ""
+	if i := strings.Index(username, "\\"); i >= 0 {
+		domain, username = username[:i], username[i+1:]
+	}
+	return &ntlmTransport{domain: domain, username: username, password: password, transport: transport}
+}
+
+// RoundTrip sends a NEGOTIATE message without the request body, then sends the request with the AUTHENTICATE
+// message computed from the CHALLENGE message returned by the server
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	negotiateReq := req.Clone(req.Context())
+	negotiateReq.Body = http.NoBody
+	negotiateReq.ContentLength = 0
+	negotiateReq.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	resp, err := t.transport.RoundTrip(negotiateReq)
+	if err != nil {
+		return nil, err
+	}
+	// The body must be drained for the connection to be reused for the rest of the handshake
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, fmt.Errorf("expected NTLM challenge, got HTTP status %s", resp.Status)
+	}
+	challengeMsg, err := findNegotiateToken(resp.Header)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := parseNTLMChallenge(challengeMsg)
+	if err != nil {
+		return nil, err
+	}
+	clientChallenge := make([]byte, 8)
+	if _, err = rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	authenticateMsg, err := ntlmAuthenticateMessage(challenge, t.domain, t.username, t.password, clientChallenge,
+		time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	authReq := req.Clone(req.Context())
+	authReq.Body = io.NopCloser(bytes.NewReader(body))
+	authReq.ContentLength = int64(len(body))
+	authReq.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(authenticateMsg))
+	return t.transport.RoundTrip(authReq)
+}
+
+// findNegotiateToken returns the decoded token of the Negotiate or NTLM challenge in the given response headers
+func findNegotiateToken(header http.Header) ([]byte, error) {
+	for _, value := range header.Values("WWW-Authenticate") {
+		scheme, token, found := strings.Cut(value, " ")
+		if !found || (!strings.EqualFold(scheme, "Negotiate") && !strings.EqualFold(scheme, "NTLM")) {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	}
+	return nil, fmt.Errorf("no NTLM challenge in response")
+}
+
+// ntlmNegotiateMessage returns an NTLM NEGOTIATE message, without domain or workstation
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmFlags)
+	return msg
+}
+
+// parseNTLMChallenge parses an NTLM CHALLENGE message
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 48 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, fmt.Errorf("invalid NTLM challenge message")
+	}
+	length := int(binary.LittleEndian.Uint16(msg[40:]))
+	offset := int(binary.LittleEndian.Uint32(msg[44:]))
+	if offset+length > len(msg) {
+		return nil, fmt.Errorf("NTLM challenge target info out of bounds")
+	}
+	return &ntlmChallenge{flags: binary.LittleEndian.Uint32(msg[20:]), serverChallenge: msg[24:32],
+		targetInfo: msg[offset : offset+length]}, nil
+}
+
+// ntlmAuthenticateMessage returns the NTLM AUTHENTICATE message answering the given challenge with NTLMv2 responses
+func ntlmAuthenticateMessage(challenge *ntlmChallenge, domain, username, password string, clientChallenge []byte,
+	now time.Time) ([]byte, error) {
+	if challenge.flags&ntlmNegotiateUnicode == 0 {
+		return nil, fmt.Errorf("NTLM server does not support Unicode")
+	}
+	// The server's time is used if given, in which case the LMv2 response must not be sent
+	timestamp, serverTime := findAvPair(challenge.targetInfo, ntlmAvTimestamp)
+	if !serverTime {
+		timestamp = make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestamp, uint64(now.UnixNano()/100+windowsEpochOffset))
+	}
+	key := ntowfv2(domain, username, password)
+	ntResponse, lmResponse := ntlmv2Responses(key, challenge.serverChallenge, clientChallenge, timestamp,
+		challenge.targetInfo)
+	if serverTime {
+		lmResponse = make([]byte, 24)
+	}
+
+	fields := [][]byte{lmResponse, ntResponse, encodeUTF16LE(domain), encodeUTF16LE(username), nil, nil}
+	msg := make([]byte, ntlmAuthenticateHeaderLength)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	// Each field is described by its length, maximum length and offset, followed by the negotiated flags
+	for i, field := range fields {
+		binary.LittleEndian.PutUint16(msg[12+8*i:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[14+8*i:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[16+8*i:], uint32(len(msg)))
+		msg = append(msg, field...)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], challenge.flags&ntlmFlags)
+	return msg, nil
+}
+
+// findAvPair returns the value of the AV pair with the given ID in the given target info
+func findAvPair(targetInfo []byte, id uint16) ([]byte, bool) {
+	for len(targetInfo) >= 4 {
+		pairID := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if pairID == 0 || len(targetInfo) < 4+length {
+			break
+		}
+		if pairID == id {
+			return targetInfo[4 : 4+length], true
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return nil, false
+}
+
+// ntowfv2 returns the NTLMv2 response key of the given user, as defined in MS-NLMP section 3.3.2
+func ntowfv2(domain, username, password string) []byte {
+	hash := md4.New()
+	hash.Write(encodeUTF16LE(password))
+	return hmacMD5(hash.Sum(nil), encodeUTF16LE(strings.ToUpper(username)+domain))
+}
+
+// ntlmv2Responses returns the NTLMv2 and LMv2 responses to the given server challenge, as defined in MS-NLMP section
+// 3.3.2
+func ntlmv2Responses(key, serverChallenge, clientChallenge, timestamp, targetInfo []byte) ([]byte, []byte) {
+	var temp []byte
+	temp = append(temp, 1, 1, 0, 0, 0, 0, 0, 0)
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+	ntProof := hmacMD5(key, serverChallenge, temp)
+	lmResponse := append(hmacMD5(key, serverChallenge, clientChallenge), clientChallenge...)
+	return append(ntProof, temp...), lmResponse
+}
+
+// hmacMD5 returns the HMAC-MD5 of the concatenation of the given data with the given key
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// encodeUTF16LE returns the given string encoded as UTF-16LE
+func encodeUTF16LE(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[2*i:], r)
+	}
+	return b
+}
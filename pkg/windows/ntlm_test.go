@@ -0,0 +1,49 @@
+package windows
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mustDecodeHex returns the bytes described by the given hex string
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// TestNTLMv2 checks the NTLMv2 computations against the examples in MS-NLMP section 4.2.4
+func TestNTLMv2(t *testing.T) {
+	key := ntowfv2("Domain", "User", "Password")
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(key))
+
+	serverChallenge := mustDecodeHex(t, "0123456789abcdef")
+	clientChallenge := mustDecodeHex(t, "aaaaaaaaaaaaaaaa")
+	// MsvAvNbDomainName "Domain", MsvAvNbComputerName "Server", MsvAvEOL
+	targetInfo := mustDecodeHex(t, "02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+	ntResponse, lmResponse := ntlmv2Responses(key, serverChallenge, clientChallenge, make([]byte, 8), targetInfo)
+	assert.Equal(t, "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa", hex.EncodeToString(lmResponse))
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(ntResponse[:16]))
+}
+
+func TestNTLMAuthenticateMessage(t *testing.T) {
+	challenge, err := parseNTLMChallenge(testChallengeMessage())
+	require.NoError(t, err)
+	assert.Equal(t, testServerChallenge, challenge.serverChallenge)
+
+	msg, err := ntlmAuthenticateMessage(challenge, "WORKGROUP", "Administrator", "P@ssw0rd",
+		mustDecodeHex(t, "aaaaaaaaaaaaaaaa"), time.Unix(0, 0))
+	require.NoError(t, err)
+	assert.Equal(t, ntlmSignature, msg[:8])
+	// The user name field points to the UTF-16LE encoded user name
+	length := int(msg[36]) | int(msg[37])<<8
+	offset := int(msg[40]) | int(msg[41])<<8
+	assert.Equal(t, "Administrator", decodeUTF16LE(msg[offset:offset+length]))
+
+	_, err = parseNTLMChallenge([]byte("NTLMSSP\x00"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// sshConnectionMaxIdle is the time after which pooled SSH connections that have not been used are closed. Connections
+// are used each time they are checked out of the pool, and by each command run and file transfer.
+const sshConnectionMaxIdle = 10 * time.Minute
+
+// sshConnections is the pool of SSH connections shared by every Windows instance created with New
+var sshConnections = newConnectionPool(sshConnectionMaxIdle)
+
+// pooledConnection is an SSH connection held by a connectionPool
+type pooledConnection struct {
+	// instanceKey identifies the instance the connection is to, regardless of the credentials used
+	instanceKey string
+	conn        *sshConnectivity
+	// defaultShellPowerShell indicates if the default SSH shell of the instance is PowerShell
+	defaultShellPowerShell bool
+}
+
+// connectionPool holds SSH connections to instances, so that an instance is not dialed again each time it is
+// interacted with. Connections are keyed by the instance they are to and the credentials used to authenticate.
+type connectionPool struct {
+	mu          sync.Mutex
+	connections map[string]*pooledConnection
+	// maxIdle is the time after which unused connections are closed
+	maxIdle time.Duration
+}
+
+// newConnectionPool returns an empty connectionPool closing connections unused for maxIdle
+func newConnectionPool(maxIdle time.Duration) *connectionPool {
+	return &connectionPool{connections: make(map[string]*pooledConnection), maxIdle: maxIdle}
+}
+
+// sshPoolKeys returns the keys identifying the instance an SSH connection is to, and the credentials and options used
+// to connect to it. The private keys are identified by the fingerprints of their public keys.
+func sshPoolKeys(instanceInfo *instance.Info, signer ssh.Signer) (string, string) {
+	instanceKey := fmt.Sprintf("%s@%s_%d/%s", instanceInfo.Username, instanceInfo.Address, instanceInfo.SSHPort,
+		instanceInfo.HostKeyID())
+	credentials := []string{fingerprint(signer), instanceInfo.SSHOptions.String()}
+	for _, jumpHost := range instanceInfo.JumpHosts {
+		instanceKey += " via " + jumpHost.String()
+		credentials = append(credentials, fingerprint(jumpHost.Signer))
+	}
+	return instanceKey, strings.Join(credentials, " ")
+}
+
+// fingerprint returns the SHA256 fingerprint of the public key of the given signer, or an empty string if it is nil
+func fingerprint(signer ssh.Signer) string {
+	if signer == nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+// get returns the pooled connection to the instance identified by instanceKey authenticated with the credentials
+// identified by credentialsKey, if it is still alive. Otherwise a new connection is created with dial and pooled.
+// Connections to the instance using other credentials are closed, as the credentials have been rotated, and so are all
+// connections to the instance if dial fails to authenticate.
+func (p *connectionPool) get(instanceKey, credentialsKey string,
+	dial func() (*pooledConnection, error)) (*pooledConnection, error) {
+	key := instanceKey + " " + credentialsKey
+	p.mu.Lock()
+	p.evict(func(pooledKey string, pooled *pooledConnection) bool {
+		return (pooled.instanceKey == instanceKey && pooledKey != key) || pooled.conn.idle() > p.maxIdle
+	})
+	pooled := p.connections[key]
+	p.mu.Unlock()
+
+	// The health of the connection is checked without holding the lock, as the request may take time
+	if pooled != nil && pooled.conn.alive() {
+		pooled.conn.markUsed(0)
+		return pooled, nil
+	}
+	if pooled != nil {
+		pooled.conn.log.V(1).Info("evicting dead SSH connection")
+		p.remove(key, pooled)
+	}
+
+	pooled, err := dial()
+	if err != nil {
+		var authErr *AuthErr
+		if errors.As(err, &authErr) {
+			p.mu.Lock()
+			p.evict(func(_ string, pooled *pooledConnection) bool { return pooled.instanceKey == instanceKey })
+			p.mu.Unlock()
+		}
+		return nil, err
+	}
+	pooled.instanceKey = instanceKey
+	pooled.conn.markUsed(0)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, present := p.connections[key]; present {
+		// Another reconcile created a connection in the meantime, which is used instead
+		pooled.conn.close()
+		existing.conn.markUsed(0)
+		return existing, nil
+	}
+	p.connections[key] = pooled
+	return pooled, nil
+}
+
+// remove closes the given connection and removes it from the pool, unless it was already replaced
+func (p *connectionPool) remove(key string, pooled *pooledConnection) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connections[key] == pooled {
+		delete(p.connections, key)
+	}
+	pooled.conn.close()
+}
+
+// evict closes and removes the connections matching the given function. The caller must hold mu.
+func (p *connectionPool) evict(matches func(string, *pooledConnection) bool) {
+	for key, pooled := range p.connections {
+		if matches(key, pooled) {
+			pooled.conn.close()
+			delete(p.connections, key)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package windows
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// testDial returns a function dialing the given server with the given signer, counting the number of calls
+func testDial(server *testSSHServer, signer ssh.Signer, calls *int) func() (*pooledConnection, error) {
+	return func() (*pooledConnection, error) {
+		*calls++
+		conn, err := newSshConnectivity("core", "127.0.0.1", server.port(), signer,
+			instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}, nil, "test",
+			newTestHostKeyStore(), logr.Discard())
+		if err != nil {
+			return nil, err
+		}
+		return &pooledConnection{conn: conn.(*sshConnectivity)}, nil
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	signer := newTestSigner(t)
+	server := newTestSSHServer(t, signer)
+
+	t.Run("live connection is reused", func(t *testing.T) {
+		pool := newConnectionPool(time.Hour)
+		calls := 0
+		first, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		second, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		assert.Same(t, first, second)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("dead connection is replaced", func(t *testing.T) {
+		pool := newConnectionPool(time.Hour)
+		calls := 0
+		first, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		require.NoError(t, first.conn.client().Close())
+		second, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		assert.NotSame(t, first, second)
+		assert.Equal(t, 2, calls)
+		assert.True(t, second.conn.alive())
+	})
+
+	t.Run("rotated key evicts connections made with the previous key", func(t *testing.T) {
+		pool := newConnectionPool(time.Hour)
+		calls := 0
+		first, err := pool.get("instance", "old-key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		other, err := pool.get("other-instance", "old-key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		_, err = pool.get("instance", "new-key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		assert.Nil(t, first.conn.client())
+		assert.Len(t, pool.connections, 2)
+		// Connections to other instances are not affected
+		assert.True(t, other.conn.alive())
+	})
+
+	t.Run("authentication failure evicts every connection to the instance", func(t *testing.T) {
+		pool := newConnectionPool(time.Hour)
+		calls := 0
+		first, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		_, err = pool.get("instance", "rejected-key", testDial(server, newTestSigner(t), &calls))
+		var authErr *AuthErr
+		require.ErrorAs(t, err, &authErr)
+		assert.Nil(t, first.conn.client())
+		assert.Empty(t, pool.connections)
+	})
+
+	t.Run("idle connections are closed", func(t *testing.T) {
+		pool := newConnectionPool(time.Millisecond)
+		calls := 0
+		first, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		_, err = pool.get("other-instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		assert.Nil(t, first.conn.client())
+		assert.Len(t, pool.connections, 1)
+	})
+
+	t.Run("connections in use are not closed", func(t *testing.T) {
+		pool := newConnectionPool(time.Millisecond)
+		calls := 0
+		first, err := pool.get("instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		done := first.conn.use()
+		time.Sleep(10 * time.Millisecond)
+		_, err = pool.get("other-instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		assert.True(t, first.conn.alive())
+		assert.Len(t, pool.connections, 2)
+
+		// The connection is closed once it has been idle for long enough after its last use
+		done()
+		time.Sleep(10 * time.Millisecond)
+		_, err = pool.get("other-instance", "key", testDial(server, signer, &calls))
+		require.NoError(t, err)
+		assert.Nil(t, first.conn.client())
+	})
+}
+
+func TestSSHPoolKeys(t *testing.T) {
+	signer := newTestSigner(t)
+	instanceInfo := &instance.Info{Address: "10.0.0.1", Username: "core"}
+	instanceKey, credentialsKey := sshPoolKeys(instanceInfo, signer)
+
+	rotatedInstanceKey, rotatedCredentialsKey := sshPoolKeys(instanceInfo, newTestSigner(t))
+	assert.Equal(t, instanceKey, rotatedInstanceKey)
+	assert.NotEqual(t, credentialsKey, rotatedCredentialsKey)
+
+	otherUserKey, _ := sshPoolKeys(&instance.Info{Address: "10.0.0.1", Username: "Administrator"}, signer)
+	assert.NotEqual(t, instanceKey, otherUserKey)
+
+	jumpHostInfo := &instance.Info{Address: "10.0.0.1", Username: "core",
+		JumpHosts: []instance.JumpHost{{Address: "bastion", Username: "core", KeySecret: "bastion-key"}}}
+	jumpHostKey, _ := sshPoolKeys(jumpHostInfo, signer)
+	assert.NotEqual(t, instanceKey, jumpHostKey)
+}
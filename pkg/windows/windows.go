@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/go-logr/logr"
@@ -33,6 +35,10 @@ const (
 	HNSPSModule = remoteDir + "\\hns.psm1"
 	// K8sDir is the remote kubernetes executable directory
 	K8sDir = "C:\\k"
+	// payloadBackupDir is the remote directory the payload files replaced by an in-place upgrade are backed up to, so
+	// that they can be restored if the upgrade is rolled back. The paths of the backed up files are mirrored within
+	// it, without the colon of their drive.
+	payloadBackupDir = K8sDir + "\\payload-backup"
 	// CredentialProviderConfig is the config file for the credential provider
 	CredentialProviderConfig = K8sDir + "\\credential-provider-config.yaml"
 	// KubeconfigPath is the remote location of the kubelet's kubeconfig
@@ -53,6 +59,11 @@ const (
 	CniConfDir = cniDir + "\\config"
 	// ContainerdDir is the directory for storing Containerd binary
 	ContainerdDir = K8sDir + "\\containerd"
+	// TextfileCollectorDir is the directory the textfile collector of windows_exporter reads metrics from. This is the
+	// default directory of the collector, as windows_exporter is in K8sDir.
+	TextfileCollectorDir = K8sDir + "\\textfile_inputs"
+	// TextfileScriptsDir is the directory of the PowerShell scripts generating textfile collector metrics
+	TextfileScriptsDir = K8sDir + "\\textfile_scripts"
 	// TLSDir is the directory for storing WMCO tls certs
 	TLSDir = K8sDir + "\\tls"
 	// TLSConfPath is the location of TLS config files
@@ -70,6 +81,8 @@ const (
 	ContainerdLogPath = containerdLogDir + "\\containerd.log"
 	// ContainerdServiceName is containerd Windows service name
 	ContainerdServiceName = "containerd"
+	// ContainerdPipe is the named pipe containerd serves its API on
+	ContainerdPipe = "\\\\.\\pipe\\containerd-containerd"
 	// WicdServiceName is the Windows service name for WICD
 	WicdServiceName = "windows-instance-config-daemon"
 	// wicdPath is the path to the WICD executable
@@ -135,10 +148,16 @@ const (
 	// ManagedTag indicates that the service being described is managed by OpenShift. This ensures that all services
 	// created as part of Node configuration can be searched for by checking their description for this string
 	ManagedTag = "OpenShift managed"
+	// AdditionalServiceTag indicates that the service being described is an additional service given by the cluster
+	// admin, which is removed from instances once it is no longer defined
+	AdditionalServiceTag = ManagedTag + " additional service"
 	// containersFeatureName is the name of the Windows feature that is required to be enabled on the Windows instance.
 	containersFeatureName = "Containers"
 	// WICDKubeconfigPath is the path of the kubeconfig used by WICD
 	WICDKubeconfigPath = K8sDir + "\\wicd-kubeconfig"
+	// NodeIPOverridePath is the path of the file holding the IP the node should be registered with, if the IP
+	// discovered on the instance should not be used
+	NodeIPOverridePath = K8sDir + "\\node-ip"
 	// TrustedCABundlePath is the location of the trusted CA bundle file
 	TrustedCABundlePath = K8sDir + "\\ca-bundle.crt"
 	// GetHostnameFQDNCommand is the PowerShell command to get the FQDN hostname of the Windows instance
@@ -198,6 +217,20 @@ func createPayload(platform *config.PlatformType) (map[*payload.FileInfo]string,
 	return files, nil
 }
 
+// PayloadFiles returns the path on a Windows instance of each payload file copied to it, mapped to the SHA256 checksum
+// of the file. Note this does not include the WICD binary.
+func PayloadFiles(platform *config.PlatformType) (map[string]string, error) {
+	files, err := createPayload(platform)
+	if err != nil {
+		return nil, err
+	}
+	checksums := make(map[string]string)
+	for file, dest := range files {
+		checksums[dest+"\\"+filepath.Base(file.Path)] = file.SHA256
+	}
+	return checksums, nil
+}
+
 // getFilesToTransfer returns the properly populated filesToTransfer map. Note this does not include the WICD binary.
 func getFilesToTransfer(platform *config.PlatformType) map[string]string {
 	srcDestPairs := map[string]string{
@@ -264,8 +297,25 @@ type Windows interface {
 	Run(string, bool) (string, error)
 	// RebootAndReinitialize reboots the instance and re-initializes the Windows SSH client
 	RebootAndReinitialize(context.Context) error
-	// Bootstrap prepares the Windows instance and runs the WICD bootstrap command
-	Bootstrap(context.Context, string, string, string) error
+	// TransferPayload prepares the Windows instance and transfers the files required to configure it
+	TransferPayload(context.Context, string, string) error
+	// ChangedPayloadFiles returns the paths on the Windows instance of the payload files which are missing or differ
+	// from the payload
+	ChangedPayloadFiles() ([]string, error)
+	// UpdatePayload updates the payload on a configured Windows instance in place. The WICD service and the given
+	// services to stop are stopped, in order, and the given services to remove are removed before the changed files are
+	// transferred. HNS networks are only removed if the bool is set.
+	UpdatePayload(context.Context, []string, []string, bool) error
+	// BackupPayloadFiles copies the given payload files which exist on the Windows instance to a backup directory,
+	// replacing any previous backup. The WICD binary is not backed up, as WICD always runs at the current version.
+	BackupPayloadFiles([]string) error
+	// RestorePayloadFiles copies the payload files backed up by BackupPayloadFiles back to their paths, and removes
+	// the backup. The WICD service and the services using the files are stopped beforehand.
+	RestorePayloadFiles(string, string) error
+	// RemovePayloadBackup removes the payload files backed up by BackupPayloadFiles, if any
+	RemovePayloadBackup() error
+	// Bootstrap runs the WICD bootstrap command. TransferPayload must be called beforehand.
+	Bootstrap(string, string) error
 	// ConfigureWICD ensures that the Windows Instance Config Daemon is running on the node
 	ConfigureWICD(string, string) error
 	// RemoveFilesAndNetworks removes all files and networks created by WMCO
@@ -293,13 +343,44 @@ type windows struct {
 	filesToTransfer map[*payload.FileInfo]string
 }
 
-// New returns a new Windows instance constructed from the given WindowsVM
-func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, platform *config.PlatformType) (Windows, error) {
+// New returns a new Windows instance constructed from the given WindowsVM. The instance is connected to over WinRM if
+// its WinRM parameters are set, and over SSH otherwise. SSH connections are pooled, so that a live connection to the
+// instance made with the same credentials is reused. The SSH host key, or WinRM certificate key, presented by the
+// instance is verified against the host key pinned for it in hostKeys.
+func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, hostKeys HostKeyStore,
+	platform *config.PlatformType) (Windows, error) {
 	log := ctrl.Log.WithName(fmt.Sprintf("wc %s", instanceInfo.Address))
-	log.V(1).Info("initializing SSH connection")
-	conn, err := newSshConnectivity(instanceInfo.Username, instanceInfo.Address, signer, log)
-	if err != nil {
-		return nil, fmt.Errorf("unable to setup VM %s sshConnectivity: %w", instanceInfo.Address, err)
+	var conn connectivity
+	var defaultShellPowerShell bool
+	var err error
+	if instanceInfo.WinRM != nil {
+		log.V(1).Info("initializing WinRM connection")
+		conn, err = newWinRMConnectivity(instanceInfo.Username, instanceInfo.Address, *instanceInfo.WinRM,
+			instanceInfo.SSHOptions, instanceInfo.HostKeyID(), hostKeys, log)
+		if err != nil {
+			return nil, fmt.Errorf("unable to setup VM %s winRMConnectivity: %w", instanceInfo.Address, err)
+		}
+		defaultShellPowerShell = defaultShellPowershell(conn)
+	} else {
+		instanceKey, credentialsKey := sshPoolKeys(instanceInfo, signer)
+		pooled, err := sshConnections.get(instanceKey, credentialsKey, func() (*pooledConnection, error) {
+			log.V(1).Info("initializing SSH connection")
+			port := ""
+			if instanceInfo.SSHPort != 0 {
+				port = strconv.Itoa(instanceInfo.SSHPort)
+			}
+			sshConn, err := newSshConnectivity(instanceInfo.Username, instanceInfo.Address, port, signer,
+				instanceInfo.SSHOptions, instanceInfo.JumpHosts, instanceInfo.HostKeyID(), hostKeys, log)
+			if err != nil {
+				return nil, err
+			}
+			return &pooledConnection{conn: sshConn.(*sshConnectivity),
+				defaultShellPowerShell: defaultShellPowershell(sshConn)}, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to setup VM %s sshConnectivity: %w", instanceInfo.Address, err)
+		}
+		conn, defaultShellPowerShell = pooled.conn, pooled.defaultShellPowerShell
 	}
 
 	files, err := createPayload(platform)
@@ -312,7 +393,7 @@ func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, plat
 			clusterDNS:             clusterDNS,
 			instance:               instanceInfo,
 			log:                    log,
-			defaultShellPowerShell: defaultShellPowershell(conn),
+			defaultShellPowerShell: defaultShellPowerShell,
 			filesToTransfer:        files,
 		},
 		nil
@@ -361,17 +442,7 @@ func (vm *windows) EnsureFileContent(contents []byte, filename string, remoteDir
 	}
 	vm.log.V(1).Info("copy", "file content", filename, "remote dir", remoteDir)
 
-	c, err := vm.interact.createSFTPClient()
-	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %w", err)
-	}
-	defer func() {
-		if err := c.Close(); err != nil {
-			vm.log.Error(err, "error closing SFTP connection")
-		}
-	}()
-
-	if err := vm.interact.transfer(c, bytes.NewReader(contents), filename, remoteDir); err != nil {
+	if err := vm.interact.transfer(bytes.NewReader(contents), filename, remoteDir); err != nil {
 		return fmt.Errorf("unable to copy %s content to remote dir %s: %w", filename, remoteDir, err)
 	}
 	return nil
@@ -399,17 +470,7 @@ func (vm *windows) EnsureFile(file *payload.FileInfo, remoteDir string) error {
 	}()
 	vm.log.V(1).Info("copy", "local file", file.Path, "remote dir", remoteDir)
 
-	c, err := vm.interact.createSFTPClient()
-	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %w", err)
-	}
-	defer func() {
-		if err := c.Close(); err != nil {
-			vm.log.Error(err, "error closing SFTP connection")
-		}
-	}()
-
-	if err := vm.interact.transfer(c, f, filepath.Base(file.Path), remoteDir); err != nil {
+	if err := vm.interact.transfer(f, filepath.Base(file.Path), remoteDir); err != nil {
 		return fmt.Errorf("unable to transfer %s to remote dir %s: %w", file.Path, remoteDir, err)
 	}
 	return nil
@@ -448,20 +509,7 @@ func (vm *windows) ReplaceDir(files map[string][]byte, remoteDir string) error {
 		return fmt.Errorf("unable to create remote directory %s, out: %s: %w", remoteDir, out, err)
 	}
 
-	sftpClient, err := vm.interact.createSFTPClient()
-	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %w", err)
-	}
-	defer func() {
-		if err := sftpClient.Close(); err != nil {
-			vm.log.Error(err, "error closing SFTP connection")
-		}
-	}()
-
-	if err = vm.interact.transferFiles(sftpClient, files, remoteDir); err != nil {
-		return err
-	}
-	return nil
+	return vm.interact.transferFiles(files, remoteDir)
 }
 
 func (vm *windows) Run(cmd string, psCmd bool) (string, error) {
@@ -529,7 +577,7 @@ func (vm *windows) RemoveFilesAndNetworks() error {
 	return nil
 }
 
-func (vm *windows) Bootstrap(ctx context.Context, desiredVer, watchNamespace, wicdKubeconfigContents string) error {
+func (vm *windows) TransferPayload(ctx context.Context, watchNamespace, wicdKubeconfigContents string) error {
 	vm.log.Info("configuring")
 
 	// Stop any services that may be running. This prevents the node being shown as Ready after a failed configuration.
@@ -546,7 +594,102 @@ func (vm *windows) Bootstrap(ctx context.Context, desiredVer, watchNamespace, wi
 	if err := vm.transferFiles(); err != nil {
 		return fmt.Errorf("error transferring files to Windows VM: %w", err)
 	}
+	if err := vm.ensureNodeIPOverride(); err != nil {
+		return fmt.Errorf("error setting node IP override: %w", err)
+	}
+	return nil
+}
+
+func (vm *windows) ChangedPayloadFiles() ([]string, error) {
+	var changed []string
+	for src, dest := range vm.filesToTransfer {
+		remotePath := dest + "\\" + filepath.Base(src.Path)
+		exists, err := vm.FileExists(remotePath, src.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("error checking if file '%s' exists on the Windows VM: %w", remotePath, err)
+		}
+		if !exists {
+			changed = append(changed, remotePath)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func (vm *windows) UpdatePayload(ctx context.Context, stop, remove []string, removeNetworks bool) error {
+	vm.log.Info("updating payload", "stopped services", stop, "removed services", remove, "removing networks",
+		removeNetworks)
+	// Stop WICD first, so that it does not start the services again while their files are replaced
+	if err := vm.deconfigureWICD(); err != nil {
+		return err
+	}
+	for _, name := range stop {
+		if err := vm.ensureServiceNotRunning(&service{name: name}); err != nil {
+			return fmt.Errorf("error stopping %s Windows service: %w", name, err)
+		}
+		if name == ContainerdServiceName {
+			// Containers left running after the node was drained keep the containerd shim binary in use
+			if out, err := vm.Run("Stop-Process -Force -Name containerd-shim-runhcs-v1", true); err != nil {
+				vm.log.V(1).Info("unable to stop containerd shims", "output", out, "error", err)
+			}
+		}
+	}
+	for _, name := range remove {
+		if err := vm.ensureServiceIsRemoved(name); err != nil {
+			return err
+		}
+	}
+	if removeNetworks {
+		if err := vm.ensureHNSNetworksAreRemoved(); err != nil {
+			return fmt.Errorf("unable to ensure HNS networks are removed: %w", err)
+		}
+	}
+	if err := vm.createDirectories(); err != nil {
+		return fmt.Errorf("error creating directories on Windows VM: %w", err)
+	}
+	if err := vm.transferFiles(); err != nil {
+		return fmt.Errorf("error transferring files to Windows VM: %w", err)
+	}
+	if err := vm.ensureNodeIPOverride(); err != nil {
+		return fmt.Errorf("error setting node IP override: %w", err)
+	}
+	return nil
+}
 
+func (vm *windows) BackupPayloadFiles(paths []string) error {
+	var backedUp []string
+	for _, path := range paths {
+		if !strings.EqualFold(path, wicdPath) {
+			backedUp = append(backedUp, path)
+		}
+	}
+	vm.log.Info("backing up payload files", "files", backedUp)
+	if out, err := vm.Run(backupFilesCmd(backedUp), true); err != nil {
+		return fmt.Errorf("unable to back up payload files, out: %s, err: %w", out, err)
+	}
+	return nil
+}
+
+func (vm *windows) RestorePayloadFiles(watchNamespace, wicdKubeconfigContents string) error {
+	vm.log.Info("restoring payload files")
+	// The files cannot be replaced while the services using them are running
+	if err := vm.RunWICDCleanup(watchNamespace, wicdKubeconfigContents); err != nil {
+		return fmt.Errorf("unable to cleanup the Windows instance: %w", err)
+	}
+	if out, err := vm.Run(restoreFilesCmd(), true); err != nil {
+		return fmt.Errorf("unable to restore payload files, out: %s, err: %w", out, err)
+	}
+	return vm.RemovePayloadBackup()
+}
+
+func (vm *windows) RemovePayloadBackup() error {
+	if out, err := vm.Run(rmDirCmd(payloadBackupDir), true); err != nil {
+		return fmt.Errorf("unable to remove directory %s, out: %s, err: %w", payloadBackupDir, out, err)
+	}
+	return nil
+}
+
+func (vm *windows) Bootstrap(desiredVer, watchNamespace string) error {
 	wicdBootstrapCmd := fmt.Sprintf("%s bootstrap --desired-version %s --kubeconfig %s --namespace %s",
 		wicdPath, desiredVer, WICDKubeconfigPath, watchNamespace)
 	if out, err := vm.Run(wicdBootstrapCmd, true); err != nil {
@@ -615,6 +758,19 @@ func (vm *windows) ensureWICDFilesExist(wicdKubeconfig string) error {
 	return vm.ensureWICDKubeconfig(wicdKubeconfig)
 }
 
+// ensureNodeIPOverride ensures the node IP override file on the instance holds the instance's Node IP override, or is
+// absent if there is none
+func (vm *windows) ensureNodeIPOverride() error {
+	if vm.instance.NodeIP == "" {
+		if out, err := vm.Run(rmDirCmd(NodeIPOverridePath), true); err != nil {
+			return fmt.Errorf("unable to remove %s, out: %s: %w", NodeIPOverridePath, out, err)
+		}
+		return nil
+	}
+	dir, file := SplitPath(NodeIPOverridePath)
+	return vm.EnsureFileContent([]byte(vm.instance.NodeIP), file, dir)
+}
+
 // ensureHostNameAndContainersFeature ensures hostname of the Windows VM matches the expected name
 // and the required Windows feature is enabled.
 func (vm *windows) ensureHostNameAndContainersFeature(ctx context.Context) error {
@@ -861,9 +1017,10 @@ func (vm *windows) stopService(svc *service) error {
 	return nil
 }
 
-// waitStopped returns once the service has stopped within the retry.Timeout interval otherwise returns an error
+// waitStopped returns once the service has stopped within the retry timeout of the current retry settings, otherwise
+// returns an error
 func (vm *windows) waitStopped(serviceName string) error {
-	return wait.PollImmediate(retry.Interval, retry.Timeout, func() (bool, error) {
+	return wait.PollImmediate(retry.Get().Interval, retry.Get().Timeout, func() (bool, error) {
 		serviceRunning, err := vm.isRunning(serviceName)
 		if err != nil {
 			vm.log.V(1).Error(err, "unable to check if Windows service is running", "service", serviceName)
@@ -886,7 +1043,7 @@ func (vm *windows) deleteService(svc *service) error {
 	}
 
 	// Wait until the service is fully deleted
-	err = wait.PollImmediate(retry.Interval, retry.Timeout, func() (bool, error) {
+	err = wait.PollImmediate(retry.Get().Interval, retry.Get().Timeout, func() (bool, error) {
 		exists, err := vm.serviceExists(svc.name)
 		if err != nil {
 			vm.log.V(1).Error(err, "unable to check if Windows service exists", "service", svc.name)
@@ -962,7 +1119,7 @@ func (vm *windows) ensureHNSNetworksAreRemoved() error {
 	var err error
 	// VIP HNS endpoint created by the operator is also deleted when the HNS networks are deleted.
 	for _, network := range []string{BaseOVNKubeOverlayNetwork, OVNKubeOverlayNetwork} {
-		err = wait.PollImmediate(retry.Interval, retry.Timeout, func() (bool, error) {
+		err = wait.PollImmediate(retry.Get().Interval, retry.Get().Timeout, func() (bool, error) {
 			// reinitialize and retry on failure to avoid connection reset SSH errors
 			if err := vm.removeHNSNetwork(network); err != nil {
 				vm.log.V(1).Error(err, "error removing %s HNS network", "network", network)
@@ -974,7 +1131,7 @@ func (vm *windows) ensureHNSNetworksAreRemoved() error {
 			if err := vm.reinitialize(); err != nil {
 				return false, fmt.Errorf("error reinitializing VM after removing %s HNS network: %w", network, err)
 			}
-			out, err := vm.Run(getHNSNetworkCmd(network), true)
+			out, err := vm.Run(GetHNSNetworkCmd(network), true)
 			if err != nil {
 				vm.log.V(1).Error(err, "error waiting for HNS network", "network", network)
 				return false, nil
@@ -990,7 +1147,7 @@ func (vm *windows) ensureHNSNetworksAreRemoved() error {
 
 // removeHNSNetwork removes the given HNS network.
 func (vm *windows) removeHNSNetwork(networkName string) error {
-	cmd := getHNSNetworkCmd(networkName) + " | Remove-HnsNetwork;"
+	cmd := GetHNSNetworkCmd(networkName) + " | Remove-HnsNetwork;"
 	// PowerShell returns error waiting without exit status or signal error when the networks are removed.
 	if out, err := vm.Run(cmd, true); err != nil && !strings.Contains(err.Error(), cmdExitNoStatus) {
 		return fmt.Errorf("failed to remove %s HNS network with output: %s: %w", networkName, out, err)
@@ -1021,7 +1178,7 @@ func (vm *windows) isContainersFeatureEnabled() (bool, error) {
 
 // waitUntilUnreachable tries to run a dummy command until it fails to see if the instance is reachable via SSH
 func (vm *windows) waitUntilUnreachable(ctx context.Context) error {
-	return wait.PollUntilContextTimeout(ctx, retry.WindowsAPIInterval, retry.ResourceChangeTimeout, true,
+	return wait.PollUntilContextTimeout(ctx, retry.Get().WindowsAPIInterval, retry.Get().ResourceChangeTimeout, true,
 		func(ctx context.Context) (bool, error) {
 			_, err := vm.Run("Get-Help", true)
 			return (err != nil), nil
@@ -1069,14 +1226,36 @@ func rmDirCmd(dirName string) string {
 	return fmt.Sprintf("if(Test-Path %s) {Remove-Item -Recurse -Force %s}", dirName, dirName)
 }
 
+// backupFilesCmd returns the PowerShell command to copy the given files, if they exist, to the payload backup
+// directory, replacing its previous contents
+func backupFilesCmd(paths []string) string {
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, "'"+path+"'")
+	}
+	return fmt.Sprintf("%s; foreach($path in @(%s)) {if(Test-Path $path) "+
+		"{$dest = Join-Path %s $path.Replace(':', ''); New-Item -ItemType Directory -Force -Path (Split-Path $dest) "+
+		"| Out-Null; Copy-Item -Force -Path $path -Destination $dest}}",
+		rmDirCmd(payloadBackupDir), strings.Join(quoted, ","), payloadBackupDir)
+}
+
+// restoreFilesCmd returns the PowerShell command to copy the files in the payload backup directory back to their
+// paths
+func restoreFilesCmd() string {
+	return fmt.Sprintf("if(Test-Path %s) {Get-ChildItem -Path %s -Recurse -File | ForEach-Object "+
+		"{$path = $_.FullName.Substring(%d); Copy-Item -Force -Path $_.FullName "+
+		"-Destination ($path.Substring(0, 1) + ':' + $path.Substring(1))}}",
+		payloadBackupDir, payloadBackupDir, len(payloadBackupDir)+1)
+}
+
 // rmK8sFilesCmd() returns the PowerShell command to remove the k8sDir files excluding WICD files
 func rmK8sFilesCmd() string {
 	return fmt.Sprintf("if(Test-Path %s) {Get-ChildItem %s -Recurse -Exclude %s,%s | Remove-Item -Force -Recurse}",
 		K8sDir, K8sDir, wicdPath, WICDKubeconfigPath)
 }
 
-// getHNSNetworkCmd returns the Windows command to get HNS network by name
-func getHNSNetworkCmd(networkName string) string {
+// GetHNSNetworkCmd returns the Windows command to get HNS network by name
+func GetHNSNetworkCmd(networkName string) string {
 	return "Get-HnsNetwork | where { $_.Name -eq '" + networkName + "'}"
 }
 
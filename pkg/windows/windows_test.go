@@ -89,3 +89,19 @@ func TestSplitPath(t *testing.T) {
 		})
 	}
 }
+
+func TestBackupFilesCmd(t *testing.T) {
+	assert.Equal(t, "if(Test-Path C:\\k\\payload-backup) {Remove-Item -Recurse -Force C:\\k\\payload-backup}; "+
+		"foreach($path in @('C:\\k\\kubelet.exe','C:\\Temp\\hns.psm1')) {if(Test-Path $path) "+
+		"{$dest = Join-Path C:\\k\\payload-backup $path.Replace(':', ''); "+
+		"New-Item -ItemType Directory -Force -Path (Split-Path $dest) | Out-Null; "+
+		"Copy-Item -Force -Path $path -Destination $dest}}",
+		backupFilesCmd([]string{KubeletPath, HNSPSModule}))
+}
+
+func TestRestoreFilesCmd(t *testing.T) {
+	// The path of a restored file is the part of its backup path after the backup directory and its separator
+	assert.Equal(t, "if(Test-Path C:\\k\\payload-backup) {Get-ChildItem -Path C:\\k\\payload-backup -Recurse -File | "+
+		"ForEach-Object {$path = $_.FullName.Substring(20); Copy-Item -Force -Path $_.FullName "+
+		"-Destination ($path.Substring(0, 1) + ':' + $path.Substring(1))}}", restoreFilesCmd())
+}
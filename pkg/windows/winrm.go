@@ -0,0 +1,465 @@
+package windows
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
+)
+
+const (
+	// winRMPath is the path of the WS-Management service on a WinRM listener
+	winRMPath = "/wsman"
+	// winRMShellURI is the resource URI of the cmd.exe remote shell
+	winRMShellURI = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/cmd"
+	// winRMCertAuthHeader is the Authorization header value requesting certificate authentication
+	winRMCertAuthHeader = "http://schemas.dmtf.org/wbem/wsman/1/wsman/secprofile/https/mutual"
+	// winRMCommandDone is the state of a command which has exited
+	winRMCommandDone = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandState/Done"
+	// winRMTimedOutCode is the code of the fault returned when no output was received within the operation timeout
+	winRMTimedOutCode = "2150858793"
+	// winRMOperationTimeout is the maximum time the WinRM service waits for command output before responding
+	winRMOperationTimeout = 60 * time.Second
+	// winRMMaxEnvelopeSize is the maximum size of a response, in bytes
+	winRMMaxEnvelopeSize = 512000
+	// winRMChunkSize is the number of file bytes sent per request when transferring files. Once base64 encoded twice,
+	// requests stay under the default maximum envelope size of the WinRM service.
+	winRMChunkSize = 96 * 1024
+	// winRMRetryInterval is the default wait time between WinRM connection attempts
+	winRMRetryInterval = time.Minute
+	// winRMCommandTimeout is the maximum time waited for a command to exit once it has been started and sent its input
+	winRMCommandTimeout = 30 * time.Minute
+)
+
+// WS-Management actions
+const (
+	wsmanCreate  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create"
+	wsmanDelete  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete"
+	wsmanCommand = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Command"
+	wsmanSend    = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Send"
+	wsmanReceive = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Receive"
+	wsmanSignal  = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Signal"
+	// wsmanTerminate is the signal code releasing the resources of a command
+	wsmanTerminate = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/signal/terminate"
+)
+
+// wsmanEnvelope is the envelope of a WS-Management response, holding the fields of all the responses used
+type wsmanEnvelope struct {
+	Body struct {
+		Fault *wsmanFault `xml:"Fault"`
+		Shell struct {
+			ShellID string `xml:"ShellId"`
+		} `xml:"Shell"`
+		CommandResponse struct {
+			CommandID string `xml:"CommandId"`
+		} `xml:"CommandResponse"`
+		ReceiveResponse struct {
+			Streams []struct {
+				Name string `xml:"Name,attr"`
+				Data string `xml:",chardata"`
+			} `xml:"Stream"`
+			CommandState struct {
+				State    string `xml:"State,attr"`
+				ExitCode int    `xml:"ExitCode"`
+			} `xml:"CommandState"`
+		} `xml:"ReceiveResponse"`
+	} `xml:"Body"`
+}
+
+// wsmanFault is a SOAP fault returned by the WinRM service
+type wsmanFault struct {
+	Reason string `xml:"Reason>Text"`
+	Detail struct {
+		WSManFault struct {
+			Code    string `xml:"Code,attr"`
+			Message string `xml:"Message"`
+		} `xml:"WSManFault"`
+	} `xml:"Detail"`
+}
+
+func (f *wsmanFault) Error() string {
+	message := strings.TrimSpace(f.Detail.WSManFault.Message)
+	if message == "" {
+		message = strings.TrimSpace(f.Reason)
+	}
+	return fmt.Sprintf("WinRM fault %s: %s", f.Detail.WSManFault.Code, message)
+}
+
+// winRMConnectivity encapsulates the information needed to connect to the Windows VM over WinRM. Every command is run
+// in its own cmd.exe remote shell.
+type winRMConnectivity struct {
+	// username is the user to connect to the VM as
+	username string
+	// ipAddress is the VM's IP address
+	ipAddress string
+	// winRM holds the port, authentication method and credentials used to connect
+	winRM instance.WinRM
+	// options are the connection parameters. Keepalive requests are not sent over WinRM.
+	options instance.SSHOptions
+	// hostKeyID identifies the VM in hostKeys
+	hostKeyID string
+	// hostKeys holds the public key of the certificate pinned for the VM, used when no CA is given to verify it
+	hostKeys HostKeyStore
+	// endpoint is the URL of the VM's WS-Management service
+	endpoint string
+	// client is the HTTP client used to send requests to the VM
+	client *http.Client
+	// commandTimeout is the maximum time waited for a command to exit, after which it is terminated
+	commandTimeout time.Duration
+	log            logr.Logger
+}
+
+// newWinRMConnectivity returns an instance of winRMConnectivity. The certificate presented by the VM is verified
+// against the CA given in the credentials, or against the key pinned for hostKeyID in hostKeys if there is none.
+func newWinRMConnectivity(username, ipAddress string, winRM instance.WinRM, options instance.SSHOptions,
+	hostKeyID string, hostKeys HostKeyStore, logger logr.Logger) (connectivity, error) {
+	c := &winRMConnectivity{
+		username:       username,
+		ipAddress:      ipAddress,
+		winRM:          winRM,
+		options:        options,
+		hostKeyID:      hostKeyID,
+		hostKeys:       hostKeys,
+		commandTimeout: winRMCommandTimeout,
+		log:            logger,
+	}
+	if err := c.init(); err != nil {
+		return nil, fmt.Errorf("error instantiating WinRM client: %w", err)
+	}
+	return c, nil
+}
+
+// init creates the HTTP client and waits until a remote shell can be created on the VM
+func (c *winRMConnectivity) init() error {
+	if c.username == "" || c.ipAddress == "" || c.winRM.Credentials == nil || c.hostKeyID == "" ||
+		c.hostKeys == nil {
+		return fmt.Errorf("incomplete winRMConnectivity information: %v", c)
+	}
+	port := instance.DefaultWinRMPort
+	if c.winRM.Port != 0 {
+		port = c.winRM.Port
+	}
+	c.endpoint = "https://" + net.JoinHostPort(c.ipAddress, strconv.Itoa(port)) + winRMPath
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ipAddress,
+		RootCAs: c.winRM.Credentials.RootCAs}
+	if c.winRM.Credentials.RootCAs == nil {
+		// Windows generates self-signed certificates for WinRM listeners, their keys are pinned instead
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = c.verifyPinnedCertificate
+	}
+	if c.winRM.Auth == instance.WinRMAuthCertificate {
+		if c.winRM.Credentials.Certificate == nil {
+			return fmt.Errorf("no client certificate given for WinRM certificate authentication")
+		}
+		tlsConfig.Certificates = []tls.Certificate{*c.winRM.Credentials.Certificate}
+	}
+	transport := &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: c.options.DialTimeout}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: c.options.DialTimeout,
+		// NTLM authenticates connections, so a single connection is used for all the requests
+		MaxConnsPerHost: 1,
+	}
+	c.client = &http.Client{Transport: transport, Timeout: 2 * winRMOperationTimeout}
+	if c.winRM.Auth == instance.WinRMAuthNTLM {
+		c.client.Transport = newNTLMTransport(c.username, c.winRM.Credentials.Password, transport)
+	}
+
+	retryInterval := winRMRetryInterval
+	if c.options.RetryInterval > 0 {
+		retryInterval = c.options.RetryInterval
+	}
+	retryTimeout := retry.Get().Timeout
+	if c.options.RetryTimeout > 0 {
+		retryTimeout = c.options.RetryTimeout
+	}
+	// Retry if we are unable to create a shell as the VM could still be starting its WinRM service
+	err := wait.PollImmediate(retryInterval, retryTimeout, func() (bool, error) {
+		shellID, err := c.createShell()
+		if err == nil {
+			c.deleteShell(shellID)
+			return true, nil
+		}
+		c.log.V(1).Info("WinRM connect", "IP Address", c.ipAddress, "error", err)
+		var authErr *AuthErr
+		var mismatchErr *HostKeyMismatchErr
+		if errors.As(err, &authErr) || errors.As(err, &mismatchErr) {
+			// Retrying will not change the credentials or the certificate presented by the VM
+			return false, err
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to connect to Windows VM %s: %w", c.ipAddress, err)
+	}
+	return nil
+}
+
+// verifyPinnedCertificate accepts the certificate presented by the VM only if its public key matches the key pinned
+// for the VM. If no key has been pinned yet, the presented key is trusted and pinned.
+func (c *winRMConnectivity) verifyPinnedCertificate(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no certificate presented by %s", c.ipAddress)
+	}
+	key, err := ssh.NewPublicKey(state.PeerCertificates[0].PublicKey)
+	if err != nil {
+		return fmt.Errorf("unsupported certificate key presented by %s: %w", c.ipAddress, err)
+	}
+	pinned, err := c.hostKeys.Pin(context.Background(), c.hostKeyID, key)
+	if err != nil {
+		return fmt.Errorf("unable to get host key pinned for %s: %w", c.hostKeyID, err)
+	}
+	if !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+		return &HostKeyMismatchErr{ID: c.hostKeyID, Address: c.ipAddress, Pinned: ssh.FingerprintSHA256(pinned),
+			Presented: ssh.FingerprintSHA256(key)}
+	}
+	return nil
+}
+
+// run runs the command through cmd.exe on the VM and returns the combined stdout and stderr output
+func (c *winRMConnectivity) run(cmd string) (string, error) {
+	return c.execute(cmd, nil)
+}
+
+// transfer reads from reader and creates a file in the remote VM directory, creating the remote directory if needed.
+// The contents are streamed as base64 lines to the standard input of a PowerShell script writing them to the file.
+func (c *winRMConnectivity) transfer(reader io.Reader, filename, remoteDir string) error {
+	remoteFile := remoteDir + "\\" + filename
+	script := fmt.Sprintf("begin { New-Item -ItemType Directory -Force -Path %s | Out-Null; "+
+		"$file = [IO.File]::Create(%s) } "+
+		"process { if ($_) { $bytes = [Convert]::FromBase64String($_); $file.Write($bytes, 0, $bytes.Length) } } "+
+		"end { $file.Close() }", quotePowerShell(remoteDir), quotePowerShell(remoteFile))
+	out, err := c.execute(encodedPowerShellCommand(script), reader)
+	if err != nil {
+		return fmt.Errorf("error copying %s to the Windows VM, out: %s: %w", filename, out, err)
+	}
+	return nil
+}
+
+func (c *winRMConnectivity) transferFiles(files map[string][]byte, remoteDir string) error {
+	return transferEach(files, remoteDir, c.transfer)
+}
+
+// execute runs the command in a new remote shell, sending the contents of stdin to it if not nil, and returns the
+// combined stdout and stderr output. An error is returned if the command exits with a non-zero code, or if it does not
+// exit within the command timeout, in which case it is terminated.
+func (c *winRMConnectivity) execute(cmd string, stdin io.Reader) (string, error) {
+	if c.client == nil {
+		return "", fmt.Errorf("execute cannot be called with nil WinRM client")
+	}
+	shellID, err := c.createShell()
+	if err != nil {
+		return "", err
+	}
+	defer c.deleteShell(shellID)
+
+	resp, err := c.send(wsmanCommand, shellID,
+		map[string]string{"WINRS_CONSOLEMODE_STDIN": "FALSE", "WINRS_SKIP_CMD_SHELL": "FALSE"},
+		"<rsp:CommandLine><rsp:Command>"+escapeXML(cmd)+"</rsp:Command></rsp:CommandLine>")
+	if err != nil {
+		return "", fmt.Errorf("error starting command: %w", err)
+	}
+	commandID := resp.Body.CommandResponse.CommandID
+	defer func() {
+		if _, err := c.send(wsmanSignal, shellID, nil, fmt.Sprintf(
+			"<rsp:Signal CommandId=\"%s\"><rsp:Code>%s</rsp:Code></rsp:Signal>", commandID, wsmanTerminate)); err != nil {
+			c.log.V(1).Info("error terminating WinRM command", "error", err)
+		}
+	}()
+
+	if stdin != nil {
+		if err = c.sendInput(shellID, commandID, stdin); err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.commandTimeout)
+	defer cancel()
+	var out strings.Builder
+	for {
+		resp, err = c.sendContext(ctx, wsmanReceive, shellID, nil, fmt.Sprintf(
+			"<rsp:Receive><rsp:DesiredStream CommandId=\"%s\">stdout stderr</rsp:DesiredStream></rsp:Receive>",
+			commandID))
+		if err != nil {
+			if ctx.Err() != nil {
+				return out.String(), fmt.Errorf("command did not exit within %s", c.commandTimeout)
+			}
+			var fault *wsmanFault
+			if errors.As(err, &fault) && fault.Detail.WSManFault.Code == winRMTimedOutCode {
+				// The command has not produced any output yet
+				continue
+			}
+			return out.String(), fmt.Errorf("error receiving command output: %w", err)
+		}
+		for _, stream := range resp.Body.ReceiveResponse.Streams {
+			data, err := base64.StdEncoding.DecodeString(stream.Data)
+			if err != nil {
+				return out.String(), fmt.Errorf("invalid %s data: %w", stream.Name, err)
+			}
+			out.Write(data)
+		}
+		state := resp.Body.ReceiveResponse.CommandState
+		if state.State == winRMCommandDone {
+			if state.ExitCode != 0 {
+				return out.String(), fmt.Errorf("process exited with status %d", state.ExitCode)
+			}
+			return out.String(), nil
+		}
+	}
+}
+
+// sendInput sends the contents of stdin to the command as base64 lines, closing its standard input once done
+func (c *winRMConnectivity) sendInput(shellID, commandID string, stdin io.Reader) error {
+	chunk := make([]byte, winRMChunkSize)
+	for {
+		n, err := io.ReadFull(stdin, chunk)
+		end := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !end {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+		line := base64.StdEncoding.EncodeToString(chunk[:n]) + "\r\n"
+		endAttr := ""
+		if end {
+			endAttr = " End=\"true\""
+		}
+		if _, err = c.send(wsmanSend, shellID, nil, fmt.Sprintf(
+			"<rsp:Send><rsp:Stream Name=\"stdin\" CommandId=\"%s\"%s>%s</rsp:Stream></rsp:Send>", commandID, endAttr,
+			base64.StdEncoding.EncodeToString([]byte(line)))); err != nil {
+			return fmt.Errorf("error sending input: %w", err)
+		}
+		if end {
+			return nil
+		}
+	}
+}
+
+// createShell creates a cmd.exe remote shell and returns its ID
+func (c *winRMConnectivity) createShell() (string, error) {
+	resp, err := c.send(wsmanCreate, "", map[string]string{"WINRS_NOPROFILE": "TRUE", "WINRS_CODEPAGE": "65001"},
+		"<rsp:Shell><rsp:InputStreams>stdin</rsp:InputStreams>"+
+			"<rsp:OutputStreams>stdout stderr</rsp:OutputStreams></rsp:Shell>")
+	if err != nil {
+		return "", fmt.Errorf("error creating remote shell: %w", err)
+	}
+	if resp.Body.Shell.ShellID == "" {
+		return "", fmt.Errorf("no shell ID in create shell response")
+	}
+	return resp.Body.Shell.ShellID, nil
+}
+
+// deleteShell deletes the remote shell with the given ID, logging any error
+func (c *winRMConnectivity) deleteShell(shellID string) {
+	if _, err := c.send(wsmanDelete, shellID, nil, ""); err != nil {
+		c.log.V(1).Info("error deleting WinRM shell", "error", err)
+	}
+}
+
+// send sends a WS-Management request with the given action to the remote shell with the given ID, or to the shell
+// resource if the ID is empty, and returns the parsed response. SOAP faults are returned as *wsmanFault errors.
+func (c *winRMConnectivity) send(action, shellID string, options map[string]string, body string) (*wsmanEnvelope,
+	error) {
+	return c.sendContext(context.Background(), action, shellID, options, body)
+}
+
+// sendContext is like send, the request being aborted once the given context is done
+func (c *winRMConnectivity) sendContext(ctx context.Context, action, shellID string, options map[string]string,
+	body string) (*wsmanEnvelope, error) {
+	var header strings.Builder
+	fmt.Fprintf(&header, "<a:To>%s</a:To>"+
+		"<a:ReplyTo><a:Address s:mustUnderstand=\"true\">"+
+		"http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>"+
+		"<a:Action s:mustUnderstand=\"true\">%s</a:Action>"+
+		"<a:MessageID>uuid:%s</a:MessageID>"+
+		"<w:ResourceURI s:mustUnderstand=\"true\">%s</w:ResourceURI>"+
+		"<w:MaxEnvelopeSize s:mustUnderstand=\"true\">%d</w:MaxEnvelopeSize>"+
+		"<w:Locale xml:lang=\"en-US\" s:mustUnderstand=\"false\"/>"+
+		"<w:OperationTimeout>PT%dS</w:OperationTimeout>",
+		escapeXML(c.endpoint), action, uuid.NewUUID(), winRMShellURI, winRMMaxEnvelopeSize,
+		int(winRMOperationTimeout.Seconds()))
+	if shellID != "" {
+		fmt.Fprintf(&header, "<w:SelectorSet><w:Selector Name=\"ShellId\">%s</w:Selector></w:SelectorSet>",
+			escapeXML(shellID))
+	}
+	if len(options) != 0 {
+		header.WriteString("<w:OptionSet>")
+		for name, value := range options {
+			fmt.Fprintf(&header, "<w:Option Name=\"%s\">%s</w:Option>", name, value)
+		}
+		header.WriteString("</w:OptionSet>")
+	}
+	envelope := "<s:Envelope xmlns:s=\"http://www.w3.org/2003/05/soap-envelope\" " +
+		"xmlns:a=\"http://schemas.xmlsoap.org/ws/2004/08/addressing\" " +
+		"xmlns:w=\"http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd\" " +
+		"xmlns:rsp=\"http://schemas.microsoft.com/wbem/wsman/1/windows/shell\">" +
+		"<s:Header>" + header.String() + "</s:Header><s:Body>" + body + "</s:Body></s:Envelope>"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	if c.winRM.Auth == instance.WinRMAuthCertificate {
+		req.Header.Set("Authorization", winRMCertAuthHeader)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, newAuthErr("WinRM", fmt.Errorf("%s authentication as %s rejected with HTTP status %s",
+			c.winRM.Auth, c.username, resp.Status))
+	}
+	parsed := &wsmanEnvelope{}
+	if err = xml.Unmarshal(respBody, parsed); err != nil {
+		return nil, fmt.Errorf("invalid response with HTTP status %s: %w", resp.Status, err)
+	}
+	if parsed.Body.Fault != nil {
+		return nil, parsed.Body.Fault
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return parsed, nil
+}
+
+// escapeXML returns the given string with the characters that are special in XML escaped
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// quotePowerShell returns the given string as a single-quoted PowerShell string literal
+func quotePowerShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodedPowerShellCommand returns the command running the given PowerShell script, passed as an encoded command so
+// that it does not need to be quoted
+func encodedPowerShellCommand(script string) string {
+	return "powershell.exe -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " +
+		base64.StdEncoding.EncodeToString(encodeUTF16LE(script))
+}
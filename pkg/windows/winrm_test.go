@@ -0,0 +1,461 @@
+package windows
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// testServerChallenge is the NTLM server challenge sent by testWinRMServer
+var testServerChallenge = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+// testWinRMRequest holds the fields of the WS-Management requests handled by testWinRMServer
+type testWinRMRequest struct {
+	Header struct {
+		Action    string `xml:"Action"`
+		Selectors []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"SelectorSet>Selector"`
+	} `xml:"Header"`
+	Body struct {
+		Command string `xml:"CommandLine>Command"`
+		Send    struct {
+			CommandID string `xml:"CommandId,attr"`
+			Data      string `xml:",chardata"`
+		} `xml:"Send>Stream"`
+		Receive struct {
+			CommandID string `xml:"CommandId,attr"`
+		} `xml:"Receive>DesiredStream"`
+		Signal struct {
+			CommandID string `xml:"CommandId,attr"`
+		} `xml:"Signal"`
+	} `xml:"Body"`
+}
+
+// testCommand is a command started on testWinRMServer
+type testCommand struct {
+	command string
+	stdin   bytes.Buffer
+	// receives is the number of receive requests made for the command
+	receives int
+	// terminated is true once the command has been signalled to terminate
+	terminated bool
+}
+
+// testWinRMServer is a WinRM stand-in listening on localhost over HTTPS. It implements the remote shell operations
+// and runs commands with the given handler.
+type testWinRMServer struct {
+	server *httptest.Server
+	// password is the password required through NTLM, if set. Otherwise a client certificate is required.
+	password string
+	// handler returns the output and exit code of the given command, which was sent the given standard input
+	handler  func(command string, stdin []byte) (string, int)
+	mu       sync.Mutex
+	nextID   int
+	shells   map[string]bool
+	commands map[string]*testCommand
+}
+
+// newTestWinRMServer returns a running testWinRMServer presenting the given certificate. Clients are authenticated
+// with NTLM if password is set, and with a certificate issued by clientCA otherwise.
+func newTestWinRMServer(t *testing.T, certificate tls.Certificate, password string, clientCA *x509.Certificate,
+	handler func(string, []byte) (string, int)) *testWinRMServer {
+	s := &testWinRMServer{password: password, handler: handler, shells: map[string]bool{},
+		commands: map[string]*testCommand{}}
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.server.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	if clientCA != nil {
+		s.server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		s.server.TLS.ClientCAs = x509.NewCertPool()
+		s.server.TLS.ClientCAs.AddCert(clientCA)
+	}
+	s.server.StartTLS()
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// port returns the port the server is listening on
+func (s *testWinRMServer) port() int {
+	return s.server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// openShells returns the number of shells which have not been deleted
+func (s *testWinRMServer) openShells() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.shells)
+}
+
+// terminated returns true if every command started with the given command line has been terminated
+func (s *testWinRMServer) terminated(command string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, started := range s.commands {
+		if started.command == command && !started.terminated {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *testWinRMServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	req := &testWinRMRequest{}
+	if err := xml.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shellID := ""
+	for _, selector := range req.Header.Selectors {
+		if selector.Name == "ShellId" {
+			shellID = selector.Value
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Header.Action != wsmanCreate && !s.shells[shellID] {
+		http.Error(w, "unknown shell", http.StatusBadRequest)
+		return
+	}
+	var body string
+	switch req.Header.Action {
+	case wsmanCreate:
+		s.nextID++
+		shellID = strconv.Itoa(s.nextID)
+		s.shells[shellID] = true
+		body = "<rsp:Shell><rsp:ShellId>" + shellID + "</rsp:ShellId></rsp:Shell>"
+	case wsmanDelete:
+		delete(s.shells, shellID)
+	case wsmanCommand:
+		s.nextID++
+		commandID := strconv.Itoa(s.nextID)
+		s.commands[commandID] = &testCommand{command: req.Body.Command}
+		body = "<rsp:CommandResponse><rsp:CommandId>" + commandID + "</rsp:CommandId></rsp:CommandResponse>"
+	case wsmanSend:
+		data, err := base64.StdEncoding.DecodeString(req.Body.Send.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.commands[req.Body.Send.CommandID].stdin.Write(data)
+	case wsmanReceive:
+		command := s.commands[req.Body.Receive.CommandID]
+		command.receives++
+		// Commands starting with "hang" never exit
+		if command.receives == 1 || strings.HasPrefix(command.command, "hang") {
+			// Clients must keep receiving until the command is done
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, testEnvelope, "<s:Fault><s:Reason><s:Text>timed out</s:Text></s:Reason><s:Detail>"+
+				"<f:WSManFault xmlns:f=\"http://schemas.microsoft.com/wbem/wsman/1/wsmanfault\" Code=\""+
+				winRMTimedOutCode+"\"/></s:Detail></s:Fault>")
+			return
+		}
+		out, exitCode := s.handler(command.command, command.stdin.Bytes())
+		body = fmt.Sprintf("<rsp:ReceiveResponse><rsp:Stream Name=\"stdout\">%s</rsp:Stream>"+
+			"<rsp:CommandState State=\"%s\"><rsp:ExitCode>%d</rsp:ExitCode></rsp:CommandState>"+
+			"</rsp:ReceiveResponse>", base64.StdEncoding.EncodeToString([]byte(out)), winRMCommandDone, exitCode)
+	case wsmanSignal:
+		s.commands[req.Body.Signal.CommandID].terminated = true
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, testEnvelope, body)
+}
+
+// testEnvelope is the format of the envelope of testWinRMServer responses
+const testEnvelope = "<s:Envelope xmlns:s=\"http://www.w3.org/2003/05/soap-envelope\" " +
+	"xmlns:rsp=\"http://schemas.microsoft.com/wbem/wsman/1/windows/shell\"><s:Body>%s</s:Body></s:Envelope>"
+
+// authenticate returns true if the request is authenticated, otherwise it responds with the next step of the
+// authentication
+func (s *testWinRMServer) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	if s.password == "" {
+		if r.Header.Get("Authorization") != winRMCertAuthHeader {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	token, err := findNegotiateToken(http.Header{"Www-Authenticate": r.Header.Values("Authorization")})
+	if err != nil || len(token) < 12 {
+		w.Header().Set("WWW-Authenticate", "Negotiate")
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	switch binary.LittleEndian.Uint32(token[8:]) {
+	case 1:
+		w.Header().Set("WWW-Authenticate", "Negotiate "+base64.StdEncoding.EncodeToString(testChallengeMessage()))
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	case 3:
+		field := func(offset int) []byte {
+			length := int(binary.LittleEndian.Uint16(token[offset:]))
+			start := int(binary.LittleEndian.Uint32(token[offset+4:]))
+			return token[start : start+length]
+		}
+		ntResponse := field(20)
+		key := ntowfv2(decodeUTF16LE(field(28)), decodeUTF16LE(field(36)), s.password)
+		if len(ntResponse) > 16 && bytes.Equal(ntResponse[:16], hmacMD5(key, testServerChallenge, ntResponse[16:])) {
+			return true
+		}
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+// testChallengeMessage returns the NTLM CHALLENGE message sent by testWinRMServer
+func testChallengeMessage() []byte {
+	// MsvAvNbDomainName "WORKGROUP" followed by MsvAvEOL
+	domain := encodeUTF16LE("WORKGROUP")
+	targetInfo := binary.LittleEndian.AppendUint16([]byte{2, 0}, uint16(len(domain)))
+	targetInfo = append(append(targetInfo, domain...), 0, 0, 0, 0)
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmFlags)
+	copy(msg[24:], testServerChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(len(msg)))
+	return append(msg, targetInfo...)
+}
+
+// decodeUTF16LE returns the given UTF-16LE encoded string
+func decodeUTF16LE(b []byte) string {
+	encoded := make([]uint16, len(b)/2)
+	for i := range encoded {
+		encoded[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(encoded))
+}
+
+// newTestCertificate returns a certificate for 127.0.0.1, signed by the given parent, or self-signed if parent is nil
+func newTestCertificate(t *testing.T, isCA bool, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour), IsCA: isCA, BasicConstraintsValid: true,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signerCert, signerKey := template, any(key)
+	if parent != nil {
+		signerCert, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// echoHandler returns the command as its output, failing commands starting with "fail"
+func echoHandler(command string, _ []byte) (string, int) {
+	if strings.HasPrefix(command, "fail") {
+		return "failed", 1
+	}
+	return command, 0
+}
+
+func TestWinRMConnectivityNTLM(t *testing.T) {
+	var transferred []byte
+	var transferScript string
+	server := newTestWinRMServer(t, newTestCertificate(t, false, nil), "P@ssw0rd", nil,
+		func(command string, stdin []byte) (string, int) {
+			encoded, found := strings.CutPrefix(command,
+				"powershell.exe -NonInteractive -ExecutionPolicy Bypass -EncodedCommand ")
+			if !found {
+				return echoHandler(command, stdin)
+			}
+			script, _ := base64.StdEncoding.DecodeString(encoded)
+			transferScript = decodeUTF16LE(script)
+			transferred = nil
+			for _, line := range strings.Split(string(stdin), "\r\n") {
+				data, _ := base64.StdEncoding.DecodeString(line)
+				transferred = append(transferred, data...)
+			}
+			return "", 0
+		})
+	winRM := instance.WinRM{Port: server.port(), Auth: instance.WinRMAuthNTLM,
+		Credentials: &instance.WinRMCredentials{Password: "P@ssw0rd"}}
+
+	conn, err := newWinRMConnectivity("WORKGROUP\\Administrator", "127.0.0.1", winRM, instance.SSHOptions{},
+		"instance", newTestHostKeyStore(), logr.Discard())
+	require.NoError(t, err)
+
+	t.Run("command output is returned", func(t *testing.T) {
+		out, err := conn.run("hostname & echo <done>")
+		require.NoError(t, err)
+		assert.Equal(t, "hostname & echo <done>", out)
+	})
+
+	t.Run("non-zero exit code is an error", func(t *testing.T) {
+		out, err := conn.run("fail")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exited with status 1")
+		assert.Equal(t, "failed", out)
+	})
+
+	t.Run("file is streamed to the remote directory", func(t *testing.T) {
+		// Large enough to be sent in several chunks
+		content := make([]byte, 2*winRMChunkSize+100)
+		_, err := rand.Read(content)
+		require.NoError(t, err)
+		require.NoError(t, conn.transfer(bytes.NewReader(content), "kubelet.exe", "C:\\k\\it's"))
+		assert.Equal(t, content, transferred)
+		assert.Contains(t, transferScript, "'C:\\k\\it''s\\kubelet.exe'")
+	})
+
+	t.Run("files are transferred to their relative paths", func(t *testing.T) {
+		require.NoError(t, conn.transferFiles(map[string][]byte{"sub\\config.yaml": []byte("key: value")},
+			"C:\\k"))
+		assert.Equal(t, []byte("key: value"), transferred)
+		assert.Contains(t, transferScript, "'C:\\k\\sub\\config.yaml'")
+	})
+
+	t.Run("command not exiting in time is terminated", func(t *testing.T) {
+		conn.(*winRMConnectivity).commandTimeout = 200 * time.Millisecond
+		defer func() { conn.(*winRMConnectivity).commandTimeout = winRMCommandTimeout }()
+		_, err := conn.run("hang")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "did not exit within")
+		assert.True(t, server.terminated("hang"))
+	})
+
+	assert.Zero(t, server.openShells())
+
+	t.Run("wrong password is not retried", func(t *testing.T) {
+		start := time.Now()
+		badWinRM := winRM
+		badWinRM.Credentials = &instance.WinRMCredentials{Password: "wrong"}
+		_, err := newWinRMConnectivity("Administrator", "127.0.0.1", badWinRM,
+			instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}, "instance",
+			newTestHostKeyStore(), logr.Discard())
+		require.Error(t, err)
+		var authErr *AuthErr
+		assert.ErrorAs(t, err, &authErr)
+		assert.Less(t, time.Since(start), 30*time.Second)
+	})
+}
+
+func TestWinRMConnectivityCertificate(t *testing.T) {
+	ca := newTestCertificate(t, true, nil)
+	server := newTestWinRMServer(t, newTestCertificate(t, false, &ca), "", ca.Leaf, echoHandler)
+	clientCert := newTestCertificate(t, false, &ca)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Leaf)
+	options := instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}
+
+	t.Run("server certificate is verified with the given CA", func(t *testing.T) {
+		hostKeys := newTestHostKeyStore()
+		winRM := instance.WinRM{Port: server.port(), Auth: instance.WinRMAuthCertificate,
+			Credentials: &instance.WinRMCredentials{Certificate: &clientCert, RootCAs: rootCAs}}
+		conn, err := newWinRMConnectivity("Administrator", "127.0.0.1", winRM, options, "instance", hostKeys,
+			logr.Discard())
+		require.NoError(t, err)
+		out, err := conn.run("hostname")
+		require.NoError(t, err)
+		assert.Equal(t, "hostname", out)
+		// Nothing is pinned when the certificate is verified with a CA
+		assert.Empty(t, hostKeys.keys)
+	})
+
+	t.Run("server certificate signed by another CA is rejected", func(t *testing.T) {
+		otherCAs := x509.NewCertPool()
+		otherCAs.AddCert(newTestCertificate(t, true, nil).Leaf)
+		winRM := instance.WinRM{Port: server.port(), Auth: instance.WinRMAuthCertificate,
+			Credentials: &instance.WinRMCredentials{Certificate: &clientCert, RootCAs: otherCAs}}
+		_, err := newWinRMConnectivity("Administrator", "127.0.0.1", winRM,
+			instance.SSHOptions{RetryInterval: 50 * time.Millisecond, RetryTimeout: 300 * time.Millisecond},
+			"instance", newTestHostKeyStore(), logr.Discard())
+		assert.Error(t, err)
+	})
+
+	t.Run("missing client certificate is rejected", func(t *testing.T) {
+		winRM := instance.WinRM{Port: server.port(), Auth: instance.WinRMAuthCertificate,
+			Credentials: &instance.WinRMCredentials{RootCAs: rootCAs}}
+		_, err := newWinRMConnectivity("Administrator", "127.0.0.1", winRM, options, "instance",
+			newTestHostKeyStore(), logr.Discard())
+		assert.Error(t, err)
+	})
+}
+
+func TestWinRMCertificatePinning(t *testing.T) {
+	serverCert := newTestCertificate(t, false, nil)
+	server := newTestWinRMServer(t, serverCert, "P@ssw0rd", nil, echoHandler)
+	impostor := newTestWinRMServer(t, newTestCertificate(t, false, nil), "P@ssw0rd", nil, echoHandler)
+	hostKeys := newTestHostKeyStore()
+	options := instance.SSHOptions{RetryInterval: time.Second, RetryTimeout: time.Minute}
+	serverKey, err := ssh.NewPublicKey(serverCert.Leaf.PublicKey)
+	require.NoError(t, err)
+	connect := func(port int) error {
+		winRM := instance.WinRM{Port: port, Auth: instance.WinRMAuthNTLM,
+			Credentials: &instance.WinRMCredentials{Password: "P@ssw0rd"}}
+		_, err := newWinRMConnectivity("Administrator", "127.0.0.1", winRM, options, "instance", hostKeys,
+			logr.Discard())
+		return err
+	}
+
+	t.Run("first certificate key is pinned", func(t *testing.T) {
+		require.NoError(t, connect(server.port()))
+		require.Contains(t, hostKeys.keys, "instance")
+		assert.Equal(t, serverKey.Marshal(), hostKeys.keys["instance"].Marshal())
+	})
+
+	t.Run("pinned certificate key is accepted", func(t *testing.T) {
+		assert.NoError(t, connect(server.port()))
+	})
+
+	t.Run("changed certificate key is rejected without retrying", func(t *testing.T) {
+		start := time.Now()
+		err := connect(impostor.port())
+		require.Error(t, err)
+		var mismatchErr *HostKeyMismatchErr
+		require.ErrorAs(t, err, &mismatchErr)
+		assert.Equal(t, ssh.FingerprintSHA256(serverKey), mismatchErr.Pinned)
+		assert.Less(t, time.Since(start), 30*time.Second)
+	})
+}
+
+func TestNTLMTransportWithoutChallenge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "no authentication required")
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: newNTLMTransport("Administrator", "P@ssw0rd", http.DefaultTransport)}
+	_, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,324 @@
+package wiparser
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+const (
+	// usernameKey is the entry key for the name of a user that can be used to SSH into the instance. Required.
+	usernameKey = "username"
+	// sshPortKey is the entry key for the port the SSH server on the instance is listening on
+	sshPortKey = "sshPort"
+	// labelsKey is the entry key for a comma separated list of <key>=<value> labels to apply to the Node
+	labelsKey = "labels"
+	// taintsKey is the entry key for a comma separated list of <key>[=<value>]:<effect> taints to apply to the Node
+	taintsKey = "taints"
+	// hostnameKey is the entry key for the hostname the instance should be given
+	hostnameKey = "hostname"
+	// nodeIPKey is the entry key for the IPv4 address the Node should be registered with
+	nodeIPKey = "nodeIP"
+	// sshDialTimeoutKey is the entry key for the maximum time a single SSH connection attempt may take
+	sshDialTimeoutKey = "sshDialTimeout"
+	// sshKeepaliveIntervalKey is the entry key for how often keepalive requests are sent over SSH connections
+	sshKeepaliveIntervalKey = "sshKeepaliveInterval"
+	// sshRetryIntervalKey is the entry key for the wait time between SSH connection attempts
+	sshRetryIntervalKey = "sshRetryInterval"
+	// sshRetryTimeoutKey is the entry key for the total time spent attempting to connect over SSH
+	sshRetryTimeoutKey = "sshRetryTimeout"
+	// keySecretKey is the entry key for the name of the Secret holding the private key used to SSH into the instance
+	keySecretKey = "keySecret"
+	// jumpHostsKey is the entry key for a comma separated list of <username>@<address>[:<port>]/<key secret> SSH jump
+	// hosts to tunnel connections to the instance through
+	jumpHostsKey = "jumpHosts"
+	// protocolKey is the entry key for the protocol used to connect to the instance, either ssh or winrm. Defaults to
+	// ssh.
+	protocolKey = "protocol"
+	// winRMPortKey is the entry key for the port the WinRM HTTPS listener on the instance is listening on
+	winRMPortKey = "winrmPort"
+	// winRMAuthKey is the entry key for the WinRM authentication method, either ntlm or certificate. Defaults to ntlm.
+	winRMAuthKey = "winrmAuth"
+	// winRMSecretKey is the entry key for the name of the Secret holding the WinRM credentials. Required if the
+	// protocol is winrm.
+	winRMSecretKey = "winrmSecret"
+	// sshProtocol and winRMProtocol are the values of the protocol entry key
+	sshProtocol   = "ssh"
+	winRMProtocol = "winrm"
+	// maxHostnameLength is the maximum length of a Windows computer name
+	maxHostnameLength = 15
+)
+
+// entry holds the options given for an instance in a windows-instances ConfigMap entry
+type entry struct {
+	username   string
+	sshPort    int
+	labels     map[string]string
+	taints     []core.Taint
+	hostname   string
+	nodeIP     string
+	sshOptions instance.SSHOptions
+	keySecret  string
+	jumpHosts  []instance.JumpHost
+	protocol   string
+	winRM      instance.WinRM
+}
+
+// parseEntry parses the value of a windows-instances ConfigMap entry. The value is made of one <key>=<value> pair per
+// line, each key can be given once, and username is required. For example:
+// username=Administrator
+// sshPort=2222
+// labels=example.com/zone=a,tier=frontend
+// taints=dedicated=windows:NoSchedule
+// hostname=winworker1
+// nodeIP=10.0.0.5
+// sshDialTimeout=30s
+// sshKeepaliveInterval=15s
+// sshRetryInterval=10s
+// sshRetryTimeout=5m
+// keySecret=team-a-key
+// jumpHosts=core@bastion.example.com:2222/bastion-key
+// An instance can instead be connected to over WinRM, in which case sshPort, keySecret and jumpHosts cannot be given:
+// username=Administrator
+// protocol=winrm
+// winrmPort=5986
+// winrmAuth=certificate
+// winrmSecret=winrm-credentials
+func parseEntry(value string) (*entry, error) {
+	e := &entry{}
+	seen := make(map[string]struct{})
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, val, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+		if !found {
+			return nil, fmt.Errorf("line %d: expected <key>=<value>, got %q", i+1, line)
+		}
+		if _, present := seen[key]; present {
+			return nil, fmt.Errorf("line %d: %s given more than once", i+1, key)
+		}
+		seen[key] = struct{}{}
+		if err := e.set(key, val); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	if e.username == "" {
+		return nil, fmt.Errorf("%s is required", usernameKey)
+	}
+	if err := e.validateProtocol(seen); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// validateProtocol returns an error if any of the given keys does not apply to the protocol of the entry
+func (e *entry) validateProtocol(keys map[string]struct{}) error {
+	var invalidKeys []string
+	if e.protocol == winRMProtocol {
+		if e.winRM.Auth == "" {
+			e.winRM.Auth = instance.WinRMAuthNTLM
+		}
+		if e.winRM.CredentialsSecret == "" {
+			return fmt.Errorf("%s is required when %s is %s", winRMSecretKey, protocolKey, winRMProtocol)
+		}
+		invalidKeys = []string{sshPortKey, keySecretKey, jumpHostsKey}
+	} else {
+		invalidKeys = []string{winRMPortKey, winRMAuthKey, winRMSecretKey}
+	}
+	for _, key := range invalidKeys {
+		if _, present := keys[key]; present {
+			return fmt.Errorf("%s cannot be given when %s is %s", key, protocolKey, e.protocolOrDefault())
+		}
+	}
+	return nil
+}
+
+// protocolOrDefault returns the protocol of the entry, or ssh if it is not set
+func (e *entry) protocolOrDefault() string {
+	if e.protocol == "" {
+		return sshProtocol
+	}
+	return e.protocol
+}
+
+// winRMOrNil returns the WinRM parameters of the entry, or nil if the instance is connected to over SSH
+func (e *entry) winRMOrNil() *instance.WinRM {
+	if e.protocol != winRMProtocol {
+		return nil
+	}
+	winRM := e.winRM
+	return &winRM
+}
+
+// set validates the given value and sets the option with the given key to it
+func (e *entry) set(key, value string) error {
+	var err error
+	switch key {
+	case usernameKey:
+		if value == "" {
+			return fmt.Errorf("%s cannot be empty", usernameKey)
+		}
+		e.username = value
+	case sshPortKey:
+		e.sshPort, err = strconv.Atoi(value)
+		if err != nil || e.sshPort < 1 || e.sshPort > 65535 {
+			return fmt.Errorf("%s %q must be a number between 1 and 65535", sshPortKey, value)
+		}
+	case labelsKey:
+		e.labels, err = parseLabels(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", labelsKey, err)
+		}
+	case taintsKey:
+		e.taints, err = parseTaints(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", taintsKey, err)
+		}
+	case hostnameKey:
+		if err = validateHostname(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", hostnameKey, err)
+		}
+		e.hostname = value
+	case nodeIPKey:
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%s %q must be an IPv4 address", nodeIPKey, value)
+		}
+		e.nodeIP = ip.String()
+	case sshDialTimeoutKey:
+		e.sshOptions.DialTimeout, err = parseDuration(key, value)
+	case sshKeepaliveIntervalKey:
+		e.sshOptions.KeepaliveInterval, err = parseDuration(key, value)
+	case sshRetryIntervalKey:
+		e.sshOptions.RetryInterval, err = parseDuration(key, value)
+	case sshRetryTimeoutKey:
+		e.sshOptions.RetryTimeout, err = parseDuration(key, value)
+	case keySecretKey:
+		if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+			return fmt.Errorf("%s %q is not a valid Secret name: %s", keySecretKey, value, strings.Join(errs, ", "))
+		}
+		e.keySecret = value
+	case jumpHostsKey:
+		e.jumpHosts, err = instance.ParseJumpHosts(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", jumpHostsKey, err)
+		}
+	case protocolKey:
+		if value != sshProtocol && value != winRMProtocol {
+			return fmt.Errorf("%s %q must be one of %s, %s", protocolKey, value, sshProtocol, winRMProtocol)
+		}
+		e.protocol = value
+	case winRMPortKey:
+		e.winRM.Port, err = strconv.Atoi(value)
+		if err != nil || e.winRM.Port < 1 || e.winRM.Port > 65535 {
+			return fmt.Errorf("%s %q must be a number between 1 and 65535", winRMPortKey, value)
+		}
+	case winRMAuthKey:
+		e.winRM.Auth = instance.WinRMAuth(value)
+		if e.winRM.Auth != instance.WinRMAuthNTLM && e.winRM.Auth != instance.WinRMAuthCertificate {
+			return fmt.Errorf("%s %q must be one of %s, %s", winRMAuthKey, value, instance.WinRMAuthNTLM,
+				instance.WinRMAuthCertificate)
+		}
+	case winRMSecretKey:
+		if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+			return fmt.Errorf("%s %q is not a valid Secret name: %s", winRMSecretKey, value, strings.Join(errs, ", "))
+		}
+		e.winRM.CredentialsSecret = value
+	default:
+		return fmt.Errorf("unknown key %q, expected one of %s", key, strings.Join([]string{usernameKey, sshPortKey,
+			labelsKey, taintsKey, hostnameKey, nodeIPKey, sshDialTimeoutKey, sshKeepaliveIntervalKey,
+			sshRetryIntervalKey, sshRetryTimeoutKey, keySecretKey, jumpHostsKey, protocolKey, winRMPortKey,
+			winRMAuthKey, winRMSecretKey}, ", "))
+	}
+	return err
+}
+
+// parseDuration parses the positive duration given for the option with the given key
+func parseDuration(key, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s %q must be a positive duration, such as 30s or 5m", key, value)
+	}
+	return d, nil
+}
+
+// parseLabels parses a comma separated list of <key>=<value> labels
+func parseLabels(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		key, val, found := strings.Cut(label, "=")
+		if !found {
+			return nil, fmt.Errorf("label %q must be in the form <key>=<value>", label)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return nil, fmt.Errorf("label key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(val); len(errs) != 0 {
+			return nil, fmt.Errorf("label value %q: %s", val, strings.Join(errs, ", "))
+		}
+		if _, present := labels[key]; present {
+			return nil, fmt.Errorf("label key %q given more than once", key)
+		}
+		labels[key] = val
+	}
+	return labels, nil
+}
+
+// parseTaints parses a comma separated list of <key>[=<value>]:<effect> taints
+func parseTaints(value string) ([]core.Taint, error) {
+	var taints []core.Taint
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		keyValue, effect, found := strings.Cut(spec, ":")
+		if !found {
+			return nil, fmt.Errorf("taint %q must be in the form <key>[=<value>]:<effect>", spec)
+		}
+		key, val, _ := strings.Cut(keyValue, "=")
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return nil, fmt.Errorf("taint key %q: %s", key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(val); len(errs) != 0 {
+			return nil, fmt.Errorf("taint value %q: %s", val, strings.Join(errs, ", "))
+		}
+		taint := core.Taint{Key: key, Value: val, Effect: core.TaintEffect(effect)}
+		switch taint.Effect {
+		case core.TaintEffectNoSchedule, core.TaintEffectPreferNoSchedule, core.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("taint %q has invalid effect %q, expected one of %s, %s, %s", spec, effect,
+				core.TaintEffectNoSchedule, core.TaintEffectPreferNoSchedule, core.TaintEffectNoExecute)
+		}
+		for _, existing := range taints {
+			if existing.MatchTaint(&taint) {
+				return nil, fmt.Errorf("taint %s:%s given more than once", key, effect)
+			}
+		}
+		taints = append(taints, taint)
+	}
+	return taints, nil
+}
+
+// validateHostname returns an error if the given name cannot be used as both a Windows computer name and a Node name
+func validateHostname(name string) error {
+	if len(name) > maxHostnameLength {
+		return fmt.Errorf("%q is longer than %d characters", name, maxHostnameLength)
+	}
+	if errs := validation.IsDNS1123Label(strings.ToLower(name)); len(errs) != 0 {
+		return fmt.Errorf("%q: %s", name, strings.Join(errs, ", "))
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("%q cannot be entirely numeric", name)
+	}
+	return nil
+}
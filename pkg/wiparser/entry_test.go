@@ -0,0 +1,201 @@
+package wiparser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+func TestParseEntry(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expectedOut *entry
+		expectedErr string
+	}{
+		{
+			name:        "username only",
+			input:       "username=core",
+			expectedOut: &entry{username: "core"},
+		},
+		{
+			name: "all options",
+			input: "username=Administrator\r\n" +
+				"  sshPort = 2222\n" +
+				"\n" +
+				"labels=example.com/zone=a, tier=frontend\n" +
+				"taints=dedicated=windows:NoSchedule,gpu:NoExecute\n" +
+				"hostname=WinWorker1\n" +
+				"nodeIP=10.0.0.5\n" +
+				"sshDialTimeout=30s\n" +
+				"sshKeepaliveInterval=15s\n" +
+				"sshRetryInterval=10s\n" +
+				"sshRetryTimeout=5m\n" +
+				"keySecret=team-a-key\n" +
+				"jumpHosts=core@bastion.example.com:2222/bastion-key,Administrator@10.0.0.1/inner-key\n",
+			expectedOut: &entry{
+				username: "Administrator",
+				sshPort:  2222,
+				labels:   map[string]string{"example.com/zone": "a", "tier": "frontend"},
+				taints: []core.Taint{
+					{Key: "dedicated", Value: "windows", Effect: core.TaintEffectNoSchedule},
+					{Key: "gpu", Effect: core.TaintEffectNoExecute},
+				},
+				hostname: "WinWorker1",
+				nodeIP:   "10.0.0.5",
+				sshOptions: instance.SSHOptions{DialTimeout: 30 * time.Second, KeepaliveInterval: 15 * time.Second,
+					RetryInterval: 10 * time.Second, RetryTimeout: 5 * time.Minute},
+				keySecret: "team-a-key",
+				jumpHosts: []instance.JumpHost{
+					{Address: "bastion.example.com", Port: 2222, Username: "core", KeySecret: "bastion-key"},
+					{Address: "10.0.0.1", Username: "Administrator", KeySecret: "inner-key"},
+				},
+			},
+		},
+		{
+			name: "WinRM options",
+			input: "username=Administrator\nprotocol=winrm\nwinrmPort=15986\nwinrmAuth=certificate\n" +
+				"winrmSecret=winrm-credentials",
+			expectedOut: &entry{username: "Administrator", protocol: "winrm", winRM: instance.WinRM{Port: 15986,
+				Auth: instance.WinRMAuthCertificate, CredentialsSecret: "winrm-credentials"}},
+		},
+		{
+			name:  "WinRM authentication defaults to NTLM",
+			input: "username=Administrator\nprotocol=winrm\nwinrmSecret=winrm-credentials",
+			expectedOut: &entry{username: "Administrator", protocol: "winrm",
+				winRM: instance.WinRM{Auth: instance.WinRMAuthNTLM, CredentialsSecret: "winrm-credentials"}},
+		},
+		{
+			name:        "WinRM without credentials secret",
+			input:       "username=Administrator\nprotocol=winrm",
+			expectedErr: "winrmSecret is required when protocol is winrm",
+		},
+		{
+			name:        "WinRM with SSH only option",
+			input:       "username=Administrator\nprotocol=winrm\nwinrmSecret=winrm-credentials\nsshPort=2222",
+			expectedErr: "sshPort cannot be given when protocol is winrm",
+		},
+		{
+			name:        "WinRM option without WinRM protocol",
+			input:       "username=Administrator\nwinrmSecret=winrm-credentials",
+			expectedErr: "winrmSecret cannot be given when protocol is ssh",
+		},
+		{
+			name:        "unknown protocol",
+			input:       "username=Administrator\nprotocol=telnet",
+			expectedErr: "line 2: protocol \"telnet\" must be one of ssh, winrm",
+		},
+		{
+			name:        "unknown WinRM authentication method",
+			input:       "username=Administrator\nprotocol=winrm\nwinrmAuth=basic",
+			expectedErr: "line 3: winrmAuth \"basic\" must be one of ntlm, certificate",
+		},
+		{
+			name:        "missing username",
+			input:       "sshPort=22",
+			expectedErr: "username is required",
+		},
+		{
+			name:        "empty username",
+			input:       "username=",
+			expectedErr: "line 1: username cannot be empty",
+		},
+		{
+			name:        "line without separator",
+			input:       "username=core\ncore",
+			expectedErr: "line 2: expected <key>=<value>",
+		},
+		{
+			name:        "unknown key",
+			input:       "username=core\nport=22",
+			expectedErr: "line 2: unknown key \"port\"",
+		},
+		{
+			name:        "duplicate key",
+			input:       "username=core\nusername=Admin",
+			expectedErr: "line 2: username given more than once",
+		},
+		{
+			name:        "invalid ssh port",
+			input:       "username=core\nsshPort=70000",
+			expectedErr: "line 2: sshPort \"70000\" must be a number between 1 and 65535",
+		},
+		{
+			name:        "label without value",
+			input:       "username=core\nlabels=tier",
+			expectedErr: "line 2: invalid labels: label \"tier\" must be in the form <key>=<value>",
+		},
+		{
+			name:        "invalid label key",
+			input:       "username=core\nlabels=-tier=a",
+			expectedErr: "line 2: invalid labels: label key \"-tier\"",
+		},
+		{
+			name:        "duplicate label key",
+			input:       "username=core\nlabels=tier=a,tier=b",
+			expectedErr: "line 2: invalid labels: label key \"tier\" given more than once",
+		},
+		{
+			name:        "taint without effect",
+			input:       "username=core\ntaints=dedicated=windows",
+			expectedErr: "line 2: invalid taints: taint \"dedicated=windows\" must be in the form",
+		},
+		{
+			name:        "invalid taint effect",
+			input:       "username=core\ntaints=dedicated:Sometimes",
+			expectedErr: "line 2: invalid taints: taint \"dedicated:Sometimes\" has invalid effect \"Sometimes\"",
+		},
+		{
+			name:        "hostname too long",
+			input:       "username=core\nhostname=averyveryverylonghostname",
+			expectedErr: "line 2: invalid hostname: \"averyveryverylonghostname\" is longer than 15 characters",
+		},
+		{
+			name:        "hostname with invalid characters",
+			input:       "username=core\nhostname=win;reboot",
+			expectedErr: "line 2: invalid hostname",
+		},
+		{
+			name:        "numeric hostname",
+			input:       "username=core\nhostname=12345",
+			expectedErr: "line 2: invalid hostname: \"12345\" cannot be entirely numeric",
+		},
+		{
+			name:        "invalid SSH duration",
+			input:       "username=core\nsshRetryTimeout=-5m",
+			expectedErr: "line 2: sshRetryTimeout \"-5m\" must be a positive duration",
+		},
+		{
+			name:        "invalid key secret",
+			input:       "username=core\nkeySecret=Team_A",
+			expectedErr: "line 2: keySecret \"Team_A\" is not a valid Secret name",
+		},
+		{
+			name:        "jump host without key secret",
+			input:       "username=core\njumpHosts=core@bastion.example.com",
+			expectedErr: "line 2: invalid jumpHosts: jump host \"core@bastion.example.com\" must be in the form",
+		},
+		{
+			name:        "IPv6 node IP",
+			input:       "username=core\nnodeIP=::1",
+			expectedErr: "line 2: nodeIP \"::1\" must be an IPv4 address",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := parseEntry(test.input)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOut, out)
+		})
+	}
+}
@@ -5,20 +5,30 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
 )
 
-// InstanceConfigMap is the name of the ConfigMap where VMs to be configured should be described.
-const InstanceConfigMap = "windows-instances"
+const (
+	// InstanceConfigMap is the name of the ConfigMap where VMs to be configured should be described.
+	InstanceConfigMap = "windows-instances"
+	// MigrateAnnotation can be set to "true" on the InstanceConfigMap to request that its entries are converted into
+	// WindowsInstance objects and removed from the ConfigMap
+	MigrateAnnotation = "windowsmachineconfig.openshift.io/migrate-to-windowsinstances"
+)
 
-// GetInstances returns a list of Windows instances by parsing the Windows instance configMap.
+// GetInstances returns a list of Windows instances by parsing the Windows instance configMap and WindowsInstance
+// objects. Instances whose description is invalid are left out.
 func GetInstances(ctx context.Context, c client.Client, namespace string) ([]*instance.Info, error) {
 	configMap := &core.ConfigMap{}
 	err := c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace,
@@ -33,45 +43,294 @@ func GetInstances(ctx context.Context, c client.Client, namespace string) ([]*in
 		return nil, fmt.Errorf("error listing nodes: %w", err)
 	}
 
-	windowsInstances, err := Parse(configMap.Data, nodes)
+	// Invalid entries are reported by the ConfigMap controller
+	windowsInstances, _, err := Parse(configMap.Data, nodes)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse instances from ConfigMap %s: %w", configMap.Name, err)
 	}
+
+	windowsInstanceList := &wmcov1.WindowsInstanceList{}
+	if err := c.List(ctx, windowsInstanceList, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("error listing WindowsInstances: %w", err)
+	}
+	crInstances, _, err := ParseWindowsInstances(windowsInstanceList.Items, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return Merge(windowsInstances, crInstances), nil
+}
+
+// ParseWindowsInstances returns the list of instances described by the given WindowsInstance objects. Each instance
+// returned will contain a reference to its associated Node from the given NodeList, if it has one. Invalid
+// WindowsInstances are left out of the list, so that they do not prevent the other instances from being configured,
+// and the error describing each of them is returned keyed by the name of the WindowsInstance.
+func ParseWindowsInstances(windowsInstances []wmcov1.WindowsInstance, nodes *core.NodeList) ([]*instance.Info,
+	map[string]error, error) {
+	if nodes == nil {
+		return nil, nil, fmt.Errorf("nodes cannot be nil")
+	}
+	instances := make([]*instance.Info, 0, len(windowsInstances))
+	invalid := make(map[string]error)
+	for i := range windowsInstances {
+		instanceInfo, err := parseWindowsInstance(&windowsInstances[i], nodes)
+		if err != nil {
+			invalid[windowsInstances[i].GetName()] = err
+			continue
+		}
+		instances = append(instances, instanceInfo)
+	}
+	return instances, invalid, nil
+}
+
+// parseWindowsInstance returns the instance described by the given WindowsInstance
+func parseWindowsInstance(wi *wmcov1.WindowsInstance, nodes *core.NodeList) (*instance.Info, error) {
+	if wi.Spec.Username == "" {
+		return nil, fmt.Errorf("WindowsInstance %s has an empty username", wi.GetName())
+	}
+	ip, err := net.ResolveIPAddr("ip4", wi.Spec.Address)
+	if err != nil {
+		return nil, fmt.Errorf("WindowsInstance %s has an invalid address: %w", wi.GetName(), err)
+	}
+	if wi.Spec.Hostname != "" {
+		if err := validateHostname(wi.Spec.Hostname); err != nil {
+			return nil, fmt.Errorf("WindowsInstance %s has an invalid hostname: %w", wi.GetName(), err)
+		}
+	}
+	if wi.Spec.NodeIP != "" {
+		if nodeIP := net.ParseIP(wi.Spec.NodeIP); nodeIP == nil || nodeIP.To4() == nil {
+			return nil, fmt.Errorf("WindowsInstance %s has an invalid nodeIP %s", wi.GetName(), wi.Spec.NodeIP)
+		}
+	}
+	if wi.Spec.KeySecret != "" {
+		if errs := validation.IsDNS1123Subdomain(wi.Spec.KeySecret); len(errs) > 0 {
+			return nil, fmt.Errorf("WindowsInstance %s has an invalid keySecret %s: %s", wi.GetName(),
+				wi.Spec.KeySecret, strings.Join(errs, ", "))
+		}
+	}
+	winRM, err := winRMFromSpec(&wi.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("WindowsInstance %s: %w", wi.GetName(), err)
+	}
+	instanceInfo, err := instance.NewInfo(wi.Spec.Address, wi.Spec.Username, wi.Spec.Hostname, false,
+		findNode(ip.String(), wi.Spec.NodeIP, nodes))
+	if err != nil {
+		return nil, fmt.Errorf("WindowsInstance %s: %w", wi.GetName(), err)
+	}
+	instanceInfo.SSHPort = int(wi.Spec.SSHPort)
+	instanceInfo.Labels = wi.Spec.Labels
+	instanceInfo.Taints = wi.Spec.Taints
+	instanceInfo.NodeIP = wi.Spec.NodeIP
+	instanceInfo.SSHOptions = SSHOptionsFromSettings(wi.Spec.SSH)
+	instanceInfo.KeySecret = wi.Spec.KeySecret
+	instanceInfo.JumpHosts = jumpHostsFromSpec(wi.Spec.JumpHosts)
+	instanceInfo.WinRM = winRM
+	return instanceInfo, nil
+}
+
+// Merge combines instances described by the windows-instances ConfigMap with instances described by WindowsInstance
+// objects. If both describe an instance with the same address, the WindowsInstance takes precedence. This allows
+// entries to be moved from the ConfigMap to WindowsInstance objects without the instance being reconfigured.
+func Merge(configMapInstances, crInstances []*instance.Info) []*instance.Info {
+	merged := append([]*instance.Info{}, crInstances...)
+	for _, cmInstance := range configMapInstances {
+		if FindByAddress(cmInstance.Address, crInstances) != nil {
+			continue
+		}
+		merged = append(merged, cmInstance)
+	}
+	return merged
+}
+
+// FindByAddress returns the instance in the given slice with the given address, or nil if there is none
+func FindByAddress(address string, instances []*instance.Info) *instance.Info {
+	for _, instanceInfo := range instances {
+		if instanceInfo.Address == address {
+			return instanceInfo
+		}
+	}
+	return nil
+}
+
+// ToWindowsInstances converts the entries in the windows-instances ConfigMap data into WindowsInstance objects in the
+// given namespace. The objects are named after the address of the instance they describe.
+func ToWindowsInstances(instancesData map[string]string, namespace string) ([]*wmcov1.WindowsInstance, error) {
+	windowsInstances := make([]*wmcov1.WindowsInstance, 0, len(instancesData))
+	for address, data := range instancesData {
+		e, err := parseEntry(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry for %s: %w", address, err)
+		}
+		name := strings.ToLower(address)
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			return nil, fmt.Errorf("unable to derive a WindowsInstance name from address %s: %s", address,
+				strings.Join(errs, ", "))
+		}
+		windowsInstances = append(windowsInstances, &wmcov1.WindowsInstance{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: wmcov1.WindowsInstanceSpec{Address: address, Username: e.username, SSHPort: int32(e.sshPort),
+				Labels: e.labels, Taints: e.taints, Hostname: e.hostname, NodeIP: e.nodeIP,
+				SSH: sshSettingsFromOptions(e.sshOptions), KeySecret: e.keySecret,
+				JumpHosts: jumpHostsToSpec(e.jumpHosts), WinRM: winRMToSpec(e.winRMOrNil())},
+		})
+	}
 	return windowsInstances, nil
 }
 
 // Parse returns the list of instances specified in the Windows instances data. This function should be passed a list
 // of Nodes in the cluster, as each instance returned will contain a reference to its associated Node, if it has one
 // in the given NodeList. If an instance does not have an associated node from the NodeList, the node reference will
-// be nil.
-func Parse(instancesData map[string]string, nodes *core.NodeList) ([]*instance.Info, error) {
+// be nil. Invalid entries are left out of the list, so that they do not prevent the other instances from being
+// configured, and the error describing each of them is returned keyed by the address of the entry.
+func Parse(instancesData map[string]string, nodes *core.NodeList) ([]*instance.Info, map[string]error, error) {
 	if nodes == nil {
-		return nil, fmt.Errorf("nodes cannot be nil")
+		return nil, nil, fmt.Errorf("nodes cannot be nil")
 	}
 	instances := make([]*instance.Info, 0)
+	invalid := make(map[string]error)
 	// Get information about the instances from each entry. The expected key/value format for each entry is:
-	// <address>: username=<username>
+	// <address>: <key>=<value> lines, as described by parseEntry
 	for address, data := range instancesData {
-		username, err := extractUsername(data)
+		instanceInfo, err := parseInstance(address, data, nodes)
 		if err != nil {
-			return instances, fmt.Errorf("unable to get username for %s: %w", address, err)
+			invalid[address] = fmt.Errorf("invalid entry for %s: %w", address, err)
+			continue
 		}
+		instances = append(instances, instanceInfo)
+	}
+	return instances, invalid, nil
+}
 
-		// Node is only guaranteed to be found when looking for its IP address
-		ip, err := net.ResolveIPAddr("ip4", address)
-		if err != nil {
-			return nil, err
+// parseInstance returns the instance described by the given windows-instances ConfigMap entry
+func parseInstance(address, data string, nodes *core.NodeList) (*instance.Info, error) {
+	e, err := parseEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	// Node is only guaranteed to be found when looking for its IP address
+	ip, err := net.ResolveIPAddr("ip4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create instance info with the associated node if the described instance has one.
+	// Address validation occurs upon construction.
+	instanceInfo, err := instance.NewInfo(address, e.username, e.hostname, false, findNode(ip.String(), e.nodeIP,
+		nodes))
+	if err != nil {
+		return nil, err
+	}
+	instanceInfo.SSHPort = e.sshPort
+	instanceInfo.Labels = e.labels
+	instanceInfo.Taints = e.taints
+	instanceInfo.NodeIP = e.nodeIP
+	instanceInfo.SSHOptions = e.sshOptions
+	instanceInfo.KeySecret = e.keySecret
+	instanceInfo.JumpHosts = e.jumpHosts
+	instanceInfo.WinRM = e.winRMOrNil()
+	return instanceInfo, nil
+}
+
+// SSHOptionsFromSettings returns the SSH options described by the given WindowsInstance SSH settings
+func SSHOptionsFromSettings(settings *wmcov1.SSHSettings) instance.SSHOptions {
+	var options instance.SSHOptions
+	if settings == nil {
+		return options
+	}
+	for _, field := range []struct {
+		target *time.Duration
+		value  *meta.Duration
+	}{
+		{&options.DialTimeout, settings.DialTimeout},
+		{&options.KeepaliveInterval, settings.KeepaliveInterval},
+		{&options.RetryInterval, settings.RetryInterval},
+		{&options.RetryTimeout, settings.RetryTimeout},
+	} {
+		if field.value != nil && field.value.Duration > 0 {
+			*field.target = field.value.Duration
 		}
+	}
+	return options
+}
 
-		// Create instance info with the associated node if the described instance has one.
-		// Address validation occurs upon construction.
-		instanceInfo, err := instance.NewInfo(address, username, "", false, nodeutil.FindByAddress(ip.String(), nodes))
-		if err != nil {
-			return nil, err
+// sshSettingsFromOptions returns the WindowsInstance SSH settings describing the given SSH options, or nil if no
+// options are set
+func sshSettingsFromOptions(options instance.SSHOptions) *wmcov1.SSHSettings {
+	if options == (instance.SSHOptions{}) {
+		return nil
+	}
+	toDuration := func(d time.Duration) *meta.Duration {
+		if d == 0 {
+			return nil
 		}
-		instances = append(instances, instanceInfo)
+		return &meta.Duration{Duration: d}
+	}
+	return &wmcov1.SSHSettings{
+		DialTimeout:       toDuration(options.DialTimeout),
+		KeepaliveInterval: toDuration(options.KeepaliveInterval),
+		RetryInterval:     toDuration(options.RetryInterval),
+		RetryTimeout:      toDuration(options.RetryTimeout),
+	}
+}
+
+// jumpHostsFromSpec returns the jump hosts described by the given WindowsInstance jump hosts
+func jumpHostsFromSpec(specJumpHosts []wmcov1.JumpHost) []instance.JumpHost {
+	var jumpHosts []instance.JumpHost
+	for _, jumpHost := range specJumpHosts {
+		jumpHosts = append(jumpHosts, instance.JumpHost{Address: jumpHost.Address, Port: int(jumpHost.Port),
+			Username: jumpHost.Username, KeySecret: jumpHost.KeySecret})
 	}
-	return instances, nil
+	return jumpHosts
+}
+
+// jumpHostsToSpec returns the WindowsInstance jump hosts describing the given jump hosts
+func jumpHostsToSpec(jumpHosts []instance.JumpHost) []wmcov1.JumpHost {
+	var specJumpHosts []wmcov1.JumpHost
+	for _, jumpHost := range jumpHosts {
+		specJumpHosts = append(specJumpHosts, wmcov1.JumpHost{Address: jumpHost.Address, Port: int32(jumpHost.Port),
+			Username: jumpHost.Username, KeySecret: jumpHost.KeySecret})
+	}
+	return specJumpHosts
+}
+
+// winRMFromSpec returns the WinRM parameters described by the given WindowsInstance spec, or nil if the instance is
+// connected to over SSH
+func winRMFromSpec(spec *wmcov1.WindowsInstanceSpec) (*instance.WinRM, error) {
+	if spec.WinRM == nil {
+		return nil, nil
+	}
+	if spec.SSHPort != 0 || spec.KeySecret != "" || len(spec.JumpHosts) != 0 {
+		return nil, fmt.Errorf("sshPort, keySecret and jumpHosts cannot be set along with winRM")
+	}
+	winRM := &instance.WinRM{Port: int(spec.WinRM.Port), Auth: instance.WinRMAuth(spec.WinRM.Auth),
+		CredentialsSecret: spec.WinRM.CredentialsSecret}
+	if winRM.Auth == "" {
+		winRM.Auth = instance.WinRMAuthNTLM
+	}
+	if err := winRM.Validate(); err != nil {
+		return nil, err
+	}
+	return winRM, nil
+}
+
+// winRMToSpec returns the WindowsInstance WinRM settings describing the given WinRM parameters, or nil if winRM is nil
+func winRMToSpec(winRM *instance.WinRM) *wmcov1.WinRMSettings {
+	if winRM == nil {
+		return nil
+	}
+	return &wmcov1.WinRMSettings{Port: int32(winRM.Port), Auth: string(winRM.Auth),
+		CredentialsSecret: winRM.CredentialsSecret}
+}
+
+// findNode returns the Node associated with an instance with the given IPv4 address and Node IP override, or nil if
+// there is none. A Node registered with an overridden IP may not report the instance's IPv4 address.
+func findNode(ipv4Address, nodeIP string, nodes *core.NodeList) *core.Node {
+	if node := nodeutil.FindByAddress(ipv4Address, nodes); node != nil {
+		return node
+	}
+	if nodeIP != "" {
+		return nodeutil.FindByAddress(nodeIP, nodes)
+	}
+	return nil
 }
 
 // GetNodeUsername retrieves the username associated with the given node from the instance ConfigMap data
@@ -82,17 +341,24 @@ func GetNodeUsername(instancesData map[string]string, node *core.Node) (string,
 	// Find entry in ConfigMap that is associated to node via address
 	for _, address := range node.Status.Addresses {
 		if value, found := instancesData[address.Address]; found {
-			return extractUsername(value)
+			e, err := parseEntry(value)
+			if err != nil {
+				return "", err
+			}
+			return e.username, nil
 		}
 	}
-	return "", fmt.Errorf("unable to find instance associated with node %s", node.GetName())
-}
-
-// extractUsername returns the username string from data in the form username=<username>
-func extractUsername(value string) (string, error) {
-	splitData := strings.SplitN(value, "=", 2)
-	if len(splitData) == 0 || splitData[0] != "username" {
-		return "", fmt.Errorf("data has an incorrect format")
+	// The node may have been registered with an overridden IP, which is not the key of its entry
+	for _, value := range instancesData {
+		e, err := parseEntry(value)
+		if err != nil || e.nodeIP == "" {
+			continue
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Address == e.nodeIP {
+				return e.username, nil
+			}
+		}
 	}
-	return splitData[1], nil
+	return "", fmt.Errorf("unable to find instance associated with node %s", node.GetName())
 }
@@ -2,65 +2,67 @@ package wiparser
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	wmcov1 "github.com/openshift/windows-machine-config-operator/api/v1"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 )
 
 func TestParse(t *testing.T) {
 
 	testCases := []struct {
-		name        string
-		input       map[string]string
-		nodeList    *core.NodeList
-		expectedOut []*instance.Info
-		expectedErr bool
+		name            string
+		input           map[string]string
+		nodeList        *core.NodeList
+		expectedOut     []*instance.Info
+		expectedInvalid bool
 	}{
 		{
-			name:        "invalid username",
-			input:       map[string]string{"localhost": "notusername=core"},
-			nodeList:    &core.NodeList{},
-			expectedOut: nil,
-			expectedErr: true,
+			name:            "invalid username",
+			input:           map[string]string{"localhost": "notusername=core"},
+			nodeList:        &core.NodeList{},
+			expectedOut:     nil,
+			expectedInvalid: true,
 		},
 		{
-			name:        "invalid DNS address",
-			input:       map[string]string{"notlocalhost": "username=core"},
-			nodeList:    &core.NodeList{},
-			expectedOut: nil,
-			expectedErr: true,
+			name:            "invalid DNS address",
+			input:           map[string]string{"notlocalhost": "username=core"},
+			nodeList:        &core.NodeList{},
+			expectedOut:     nil,
+			expectedInvalid: true,
 		},
 		{
-			name:        "invalid username and DNS",
-			input:       map[string]string{"invalid": "invalid"},
-			nodeList:    &core.NodeList{},
-			expectedOut: nil,
-			expectedErr: true,
+			name:            "invalid username and DNS",
+			input:           map[string]string{"invalid": "invalid"},
+			nodeList:        &core.NodeList{},
+			expectedOut:     nil,
+			expectedInvalid: true,
 		},
 		{
-			name:        "valid ipv6 address",
-			input:       map[string]string{"::1": "username=core"},
-			nodeList:    &core.NodeList{},
-			expectedOut: nil,
-			expectedErr: true,
+			name:            "valid ipv6 address",
+			input:           map[string]string{"::1": "username=core"},
+			nodeList:        &core.NodeList{},
+			expectedOut:     nil,
+			expectedInvalid: true,
 		},
 		{
-			name:        "valid dns address",
-			input:       map[string]string{"localhost": "username=core"},
-			nodeList:    &core.NodeList{},
-			expectedOut: []*instance.Info{{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core"}},
-			expectedErr: false,
+			name:            "valid dns address",
+			input:           map[string]string{"localhost": "username=core"},
+			nodeList:        &core.NodeList{},
+			expectedOut:     []*instance.Info{{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core"}},
+			expectedInvalid: false,
 		},
 		{
-			name:        "valid ip address",
-			input:       map[string]string{"127.0.0.1": "username=core"},
-			nodeList:    &core.NodeList{},
-			expectedOut: []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core"}},
-			expectedErr: false,
+			name:            "valid ip address",
+			input:           map[string]string{"127.0.0.1": "username=core"},
+			nodeList:        &core.NodeList{},
+			expectedOut:     []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core"}},
+			expectedInvalid: false,
 		},
 		{
 			name:     "valid dns and ip addresses with no nodes",
@@ -70,7 +72,7 @@ func TestParse(t *testing.T) {
 				{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core"},
 				{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "Admin"},
 			},
-			expectedErr: false,
+			expectedInvalid: false,
 		},
 		{
 			name:  "valid dns and ip addresses with unassociated nodes",
@@ -93,7 +95,7 @@ func TestParse(t *testing.T) {
 				{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "Admin", Node: nil},
 				{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core", Node: nil},
 			},
-			expectedErr: false,
+			expectedInvalid: false,
 		},
 		{
 			name:  "valid dns and ip addresses with associated nodes",
@@ -134,22 +136,69 @@ func TestParse(t *testing.T) {
 							Type: core.NodeInternalIP}},
 						}}},
 			},
-			expectedErr: false,
+			expectedInvalid: false,
+		},
+		{
+			name: "options and node registered with an overridden IP",
+			input: map[string]string{"localhost": "username=core\nsshPort=2222\nlabels=tier=web\n" +
+				"taints=os=windows:NoSchedule\nhostname=winworker\nnodeIP=127.0.0.3"},
+			nodeList: &core.NodeList{
+				Items: []core.Node{
+					{
+						ObjectMeta: meta.ObjectMeta{Name: "node-ip-node"},
+						Status: core.NodeStatus{
+							Addresses: []core.NodeAddress{{Address: "127.0.0.3", Type: core.NodeInternalIP}},
+						},
+					},
+				},
+			},
+			expectedOut: []*instance.Info{
+				{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core", SSHPort: 2222,
+					Labels:      map[string]string{"tier": "web"},
+					Taints:      []core.Taint{{Key: "os", Value: "windows", Effect: core.TaintEffectNoSchedule}},
+					NewHostname: "winworker", NodeIP: "127.0.0.3",
+					Node: &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node-ip-node"},
+						Status: core.NodeStatus{Addresses: []core.NodeAddress{{Address: "127.0.0.3",
+							Type: core.NodeInternalIP}},
+						}}},
+			},
+			expectedInvalid: false,
 		},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			out, err := Parse(test.input, test.nodeList)
-			if test.expectedErr {
-				assert.Error(t, err)
+			out, invalid, err := Parse(test.input, test.nodeList)
+			require.NoError(t, err)
+			if test.expectedInvalid {
+				assert.Empty(t, out)
+				assert.NotEmpty(t, invalid)
 				return
 			}
-			require.NoError(t, err)
+			assert.Empty(t, invalid)
 			assert.ElementsMatch(t, test.expectedOut, out)
 		})
 	}
 }
 
+func TestParseReportsEveryInvalidEntry(t *testing.T) {
+	out, invalid, err := Parse(map[string]string{
+		"127.0.0.1":    "username=core\nsshPort=0",
+		"127.0.0.2":    "username=core",
+		"127.0.0.3":    "hostname=win",
+		"notlocalhost": "username=core",
+	}, &core.NodeList{})
+	require.NoError(t, err)
+	// The valid entries are parsed regardless of the invalid ones
+	assert.Equal(t, []*instance.Info{{Address: "127.0.0.2", IPv4Address: "127.0.0.2", Username: "core"}}, out)
+	require.Len(t, invalid, 3)
+	assert.ErrorContains(t, invalid["127.0.0.1"], "invalid entry for 127.0.0.1: line 2: sshPort")
+	assert.ErrorContains(t, invalid["127.0.0.3"], "invalid entry for 127.0.0.3: username is required")
+	assert.ErrorContains(t, invalid["notlocalhost"], "invalid entry for notlocalhost")
+
+	_, _, err = Parse(nil, nil)
+	assert.Error(t, err)
+}
+
 func TestGetNodeUsername(t *testing.T) {
 	testNode := &core.Node{
 		ObjectMeta: meta.ObjectMeta{
@@ -218,6 +267,13 @@ func TestGetNodeUsername(t *testing.T) {
 			expectedOut: "Admin",
 			expectedErr: false,
 		},
+		{
+			name:        "node registered with an overridden IP",
+			data:        map[string]string{"localhost": "username=core\nnodeIP=111.1.1.1"},
+			node:        testNode,
+			expectedOut: "core",
+			expectedErr: false,
+		},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
@@ -231,3 +287,184 @@ func TestGetNodeUsername(t *testing.T) {
 		})
 	}
 }
+
+func TestParseWindowsInstances(t *testing.T) {
+	ipNode := core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "ip-node"},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{{Address: "127.0.0.2", Type: core.NodeInternalIP}},
+		},
+	}
+	taints := []core.Taint{{Key: "os", Value: "windows", Effect: core.TaintEffectNoSchedule}}
+
+	testCases := []struct {
+		name            string
+		input           []wmcov1.WindowsInstance
+		nodeList        *core.NodeList
+		expectedOut     []*instance.Info
+		expectedInvalid bool
+	}{
+		{
+			name: "empty username",
+			input: []wmcov1.WindowsInstance{{ObjectMeta: meta.ObjectMeta{Name: "test"},
+				Spec: wmcov1.WindowsInstanceSpec{Address: "localhost"}}},
+			nodeList:        &core.NodeList{},
+			expectedInvalid: true,
+		},
+		{
+			name: "invalid address",
+			input: []wmcov1.WindowsInstance{{ObjectMeta: meta.ObjectMeta{Name: "test"},
+				Spec: wmcov1.WindowsInstanceSpec{Address: "notlocalhost", Username: "core"}}},
+			nodeList:        &core.NodeList{},
+			expectedInvalid: true,
+		},
+		{
+			name: "invalid key secret",
+			input: []wmcov1.WindowsInstance{{ObjectMeta: meta.ObjectMeta{Name: "test"},
+				Spec: wmcov1.WindowsInstanceSpec{Address: "localhost", Username: "core", KeySecret: "Team_A"}}},
+			nodeList:        &core.NodeList{},
+			expectedInvalid: true,
+		},
+		{
+			name: "WinRM with SSH options",
+			input: []wmcov1.WindowsInstance{{ObjectMeta: meta.ObjectMeta{Name: "test"},
+				Spec: wmcov1.WindowsInstanceSpec{Address: "localhost", Username: "core", SSHPort: 2222,
+					WinRM: &wmcov1.WinRMSettings{CredentialsSecret: "winrm-credentials"}}}},
+			nodeList:        &core.NodeList{},
+			expectedInvalid: true,
+		},
+		{
+			name: "WinRM",
+			input: []wmcov1.WindowsInstance{{ObjectMeta: meta.ObjectMeta{Name: "test"},
+				Spec: wmcov1.WindowsInstanceSpec{Address: "localhost", Username: "core",
+					WinRM: &wmcov1.WinRMSettings{CredentialsSecret: "winrm-credentials"}}}},
+			nodeList: &core.NodeList{},
+			expectedOut: []*instance.Info{{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core",
+				WinRM: &instance.WinRM{Auth: instance.WinRMAuthNTLM, CredentialsSecret: "winrm-credentials"}}},
+		},
+		{
+			name: "instances with and without nodes",
+			input: []wmcov1.WindowsInstance{
+				{ObjectMeta: meta.ObjectMeta{Name: "dns"}, Spec: wmcov1.WindowsInstanceSpec{Address: "localhost",
+					Username: "core", SSHPort: 2222, Labels: map[string]string{"a": "b"}, Taints: taints,
+					KeySecret: "team-a-key"}},
+				{ObjectMeta: meta.ObjectMeta{Name: "ip"}, Spec: wmcov1.WindowsInstanceSpec{Address: "127.0.0.2",
+					Username: "Admin", JumpHosts: []wmcov1.JumpHost{{Address: "bastion.example.com", Port: 2222,
+						Username: "core", KeySecret: "bastion-key"}}}},
+			},
+			nodeList: &core.NodeList{Items: []core.Node{ipNode}},
+			expectedOut: []*instance.Info{
+				{Address: "localhost", IPv4Address: "127.0.0.1", Username: "core", SSHPort: 2222,
+					Labels: map[string]string{"a": "b"}, Taints: taints, KeySecret: "team-a-key"},
+				{Address: "127.0.0.2", IPv4Address: "127.0.0.2", Username: "Admin", Node: &ipNode,
+					JumpHosts: []instance.JumpHost{{Address: "bastion.example.com", Port: 2222, Username: "core",
+						KeySecret: "bastion-key"}}},
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, invalid, err := ParseWindowsInstances(test.input, test.nodeList)
+			require.NoError(t, err)
+			if test.expectedInvalid {
+				assert.Empty(t, out)
+				assert.Contains(t, invalid, "test")
+				return
+			}
+			assert.Empty(t, invalid)
+			assert.ElementsMatch(t, test.expectedOut, out)
+		})
+	}
+
+	_, _, err := ParseWindowsInstances(nil, nil)
+	assert.Error(t, err)
+}
+
+func TestParseWindowsInstancesSkipsInvalidInstances(t *testing.T) {
+	out, invalid, err := ParseWindowsInstances([]wmcov1.WindowsInstance{
+		{ObjectMeta: meta.ObjectMeta{Name: "no-username"}, Spec: wmcov1.WindowsInstanceSpec{Address: "127.0.0.1"}},
+		{ObjectMeta: meta.ObjectMeta{Name: "valid"}, Spec: wmcov1.WindowsInstanceSpec{Address: "127.0.0.2",
+			Username: "core"}},
+		{ObjectMeta: meta.ObjectMeta{Name: "unresolvable"}, Spec: wmcov1.WindowsInstanceSpec{
+			Address: "notlocalhost", Username: "core"}},
+	}, &core.NodeList{})
+	require.NoError(t, err)
+	// The valid instances are parsed regardless of the invalid ones
+	assert.Equal(t, []*instance.Info{{Address: "127.0.0.2", IPv4Address: "127.0.0.2", Username: "core"}}, out)
+	require.Len(t, invalid, 2)
+	assert.ErrorContains(t, invalid["no-username"], "WindowsInstance no-username has an empty username")
+	assert.ErrorContains(t, invalid["unresolvable"], "WindowsInstance unresolvable has an invalid address")
+}
+
+func TestMerge(t *testing.T) {
+	cmInstance := &instance.Info{Address: "127.0.0.1", Username: "core"}
+	crInstance := &instance.Info{Address: "127.0.0.1", Username: "Admin", SSHPort: 2222}
+	otherInstance := &instance.Info{Address: "127.0.0.2", Username: "core"}
+
+	out := Merge([]*instance.Info{cmInstance, otherInstance}, []*instance.Info{crInstance})
+	assert.ElementsMatch(t, []*instance.Info{crInstance, otherInstance}, out)
+}
+
+func TestSSHOptionsConversion(t *testing.T) {
+	options := instance.SSHOptions{DialTimeout: 30 * time.Second, RetryTimeout: 5 * time.Minute}
+	settings := sshSettingsFromOptions(options)
+	assert.Equal(t, &wmcov1.SSHSettings{DialTimeout: &meta.Duration{Duration: 30 * time.Second},
+		RetryTimeout: &meta.Duration{Duration: 5 * time.Minute}}, settings)
+	assert.Equal(t, options, SSHOptionsFromSettings(settings))
+
+	assert.Nil(t, sshSettingsFromOptions(instance.SSHOptions{}))
+	assert.Equal(t, instance.SSHOptions{}, SSHOptionsFromSettings(nil))
+}
+
+func TestToWindowsInstances(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       map[string]string
+		expectedOut []*wmcov1.WindowsInstance
+		expectedErr bool
+	}{
+		{
+			name:        "invalid username",
+			input:       map[string]string{"localhost": "notusername=core"},
+			expectedErr: true,
+		},
+		{
+			name:        "address is not a valid name",
+			input:       map[string]string{"my_host": "username=core"},
+			expectedErr: true,
+		},
+		{
+			name: "valid entries",
+			input: map[string]string{"MyHost.example.com": "username=core",
+				"10.0.0.2": "username=Admin\nprotocol=winrm\nwinrmAuth=certificate\nwinrmSecret=winrm-credentials",
+				"10.0.0.1": "username=Admin\nsshPort=2222\nlabels=tier=web\ntaints=os=windows:NoSchedule\n" +
+					"hostname=winworker\nnodeIP=10.0.1.1\nkeySecret=team-a-key\n" +
+					"jumpHosts=core@bastion.example.com/bastion-key"},
+			expectedOut: []*wmcov1.WindowsInstance{
+				{ObjectMeta: meta.ObjectMeta{Name: "myhost.example.com", Namespace: "test"},
+					Spec: wmcov1.WindowsInstanceSpec{Address: "MyHost.example.com", Username: "core"}},
+				{ObjectMeta: meta.ObjectMeta{Name: "10.0.0.2", Namespace: "test"},
+					Spec: wmcov1.WindowsInstanceSpec{Address: "10.0.0.2", Username: "Admin",
+						WinRM: &wmcov1.WinRMSettings{Auth: "certificate", CredentialsSecret: "winrm-credentials"}}},
+				{ObjectMeta: meta.ObjectMeta{Name: "10.0.0.1", Namespace: "test"},
+					Spec: wmcov1.WindowsInstanceSpec{Address: "10.0.0.1", Username: "Admin", SSHPort: 2222,
+						Labels:   map[string]string{"tier": "web"},
+						Taints:   []core.Taint{{Key: "os", Value: "windows", Effect: core.TaintEffectNoSchedule}},
+						Hostname: "winworker", NodeIP: "10.0.1.1", KeySecret: "team-a-key",
+						JumpHosts: []wmcov1.JumpHost{{Address: "bastion.example.com", Username: "core",
+							KeySecret: "bastion-key"}}}},
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ToWindowsInstances(test.input, "test")
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.expectedOut, out)
+		})
+	}
+}
@@ -79,6 +79,13 @@ func (tc *testContext) testPrometheus(t *testing.T) {
 		metrics.WindowsMetricsResource, metav1.GetOptions{})
 	require.NoError(t, err, "error getting service monitor")
 
+	// check that the operator metrics service and SM exist
+	_, err = tc.client.K8s.CoreV1().Services(wmcoNamespace).Get(context.TODO(),
+		metrics.OperatorMetricsResource, metav1.GetOptions{})
+	require.NoError(t, err, "error getting operator metrics service")
+	_, err = tc.client.Monitoring.ServiceMonitors(wmcoNamespace).Get(context.TODO(),
+		metrics.OperatorMetricsResource, metav1.GetOptions{})
+	require.NoError(t, err, "error getting operator service monitor")
 }
 
 // PrometheusQuery defines the result of the /query request